@@ -1,18 +1,28 @@
 --module Data.Session exposing (Session, attempt)
-module Data.Session exposing (Session)
+module Data.Session exposing (Session, tokenDecoder)
 
 --import Data.AuthToken exposing (AuthToken)
 import Data.User as User exposing (User)
 --import Util exposing ((=>))
 import Date exposing (Date)
+import Json.Decode as Decode exposing (Decoder)
+import Json.Decode.Pipeline exposing (decode, optional)
 
 
 
+-- The token is sent in the `Authorization` header so the server knows who is asking.
 type alias Session =
     { user : Maybe User
+    , token : String
     }
 
 
+tokenDecoder : Decoder String
+tokenDecoder =
+    decode identity
+        |> optional "token" Decode.string ""
+
+
 --attempt : String -> (AuthToken -> Cmd msg) -> Session -> ( List String, Cmd msg )
 --attempt attemptedAction toCmd session =
 --    case Maybe.map .token session.user of
@@ -4,10 +4,10 @@ module Data.User exposing
     , authEncoder
     , decoder
     , encoder
-    , hashEncoder
     , manyDecoder
     , new
     , pagingDecoder
+    , passwordEncoder
     , queryEncoder
     , succeed
     )
@@ -110,12 +110,20 @@ encoder user =
         ]
 
 
-hashEncoder : { r | id : Int, password : String } -> Encode.Value
-hashEncoder user =
+-- The current password is only needed when changing your own, so an empty one isn't sent.
+passwordEncoder : Int -> String -> String -> Encode.Value
+passwordEncoder realSpecialist currentPassword password =
     Encode.object
-        [ ( "id", Encode.int user.id )
-        , ( "password", Encode.string user.password )
-        ]
+        ( List.append
+            [ ( "realSpecialist", Encode.int realSpecialist )
+            , ( "password", Encode.string password )
+            ]
+            ( if String.isEmpty currentPassword then
+                []
+              else
+                [ ( "currentPassword", Encode.string currentPassword ) ]
+            )
+        )
 
 
 queryEncoder : String -> Encode.Value
@@ -76,7 +76,7 @@ init flags location =
             else "http://localhost:8080/cpss"
     in
     setRoute ( Route.fromLocation location )
-        { session = { user = Nothing }
+        { session = { user = Nothing, token = "" }
         , build =
             { url = url
             , today =
@@ -266,12 +266,13 @@ setRoute maybeRoute model =
                 session = model.session
             in
                 { model |
-                    session = { session | user = Nothing }
+                    session = { session | user = Nothing, token = "" }
                     , page = Login Login.init
                     , onLogin = Just Route.Home
                 } ! [ Route.Login |> Route.modifyUrl
                     , setSessionCredentials             -- Send session credentials to JavaScript to be put into local storage to complete logout.
                         { user = -1
+                        , token = ""
                         }
                     ]
 
@@ -311,7 +312,7 @@ setRoute maybeRoute model =
                         1 ->
                             let
                                 ( subModel, subMsg ) =
-                                    Specialist.init model.build.url
+                                    Specialist.init model.build.url user
                             in
                             { model |
                                 page = Specialist subModel
@@ -429,27 +430,29 @@ update msg model =
                         Login.Nop ->
                             ( { model | page = Login pageModel }, Cmd.map LoginMsg cmd )
 
-                        Login.SetUser user ->
+                        Login.SetUser user token ->
                             let
                                 session =
                                     model.session
 
                                 ( m, routeCmd ) =
                                     { model |
-                                        session = { user = Just user }
+                                        session = { user = Just user, token = token }
                                         , page = Blank
                                         , onLogin = model.onLogin
                                     } |> setRoute model.onLogin         -- Redirect after logging in.
                             in
                             m ! [ routeCmd
                                 , setSessionCredentials                 -- Send session credentials to JavaScript to be put into local storage.
-                                    { user = user.id }
+                                    { user = user.id, token = token }
                                 ]
             in
             ( newModel, newCmd )
 
         ( ReadSessionCredentials session, _ ) ->
             let
+                oldSession = model.session
+
                 cmd =
                     if (/=) session.user -1 then
                         session.user
@@ -457,7 +460,9 @@ update msg model =
                             |> Http.send FetchedUserSession
                     else Cmd.none
             in
-            model ! [ cmd ]
+            { model |
+                session = { oldSession | token = session.token }
+            } ! [ cmd ]
 
         ( ServiceCodeMsg subMsg, ServiceCode subModel ) ->
             toPage ServiceCode ServiceCodeMsg ServiceCode.update subMsg subModel
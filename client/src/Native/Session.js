@@ -1,13 +1,16 @@
 app.ports.setSessionCredentials.subscribe(user => {
     localStorage.setItem('user', user.user);
+    localStorage.setItem('token', user.token);
 
     // Send back into Elm to set the populate the session upon a new login!
     app.ports.getSessionCredentials.send({
-        user: Number(localStorage.getItem('user')) || -1
+        user: Number(localStorage.getItem('user')) || -1,
+        token: localStorage.getItem('token') || ''
     });
 });
 
 app.ports.getSessionCredentials.send({
     user: Number(localStorage.getItem('user')) || -1,
+    token: localStorage.getItem('token') || ''
 });
 
@@ -62,6 +62,7 @@ type alias Model =
         , datePicker : DatePicker.DatePicker
         }
     , user : User
+    , token : String
     }
 
 
@@ -99,7 +100,7 @@ init build session =
                         , Request.ServiceCode.list url |> Http.send ( ServiceCodes >> Fetch )
                         , Request.Specialist.list url |> Http.send ( Specialists >> Fetch )
                         , Request.Status.list url |> Http.send ( Statuses >> Fetch )
-                        , 0 |> Request.BillSheet.page url whereClause |> Http.send ( BillSheets >> Fetch )
+                        , 0 |> Request.BillSheet.page url session.token whereClause |> Http.send ( BillSheets >> Fetch )
                         ]
                     )
 
@@ -114,7 +115,7 @@ init build session =
                         , Request.Consumer.list url |> Http.send ( Consumers >> Fetch )
                         , Request.County.list url |> Http.send ( Counties >> Fetch )
                         , Request.ServiceCode.list url |> Http.send ( ServiceCodes >> Fetch )
-                        , 0 |> Request.BillSheet.page url whereClause |> Http.send ( BillSheets >> Fetch )
+                        , 0 |> Request.BillSheet.page url session.token whereClause |> Http.send ( BillSheets >> Fetch )
                         ]
                     )
     in
@@ -136,6 +137,7 @@ init build session =
     , pagerState = Data.Pager.new
     , subModel = subModel
     , user = user
+    , token = session.token
     } ! cmd
 
 
@@ -254,7 +256,7 @@ update url msg model =
             { model |
                 query = defaultQuery
             } ! [ 0
-                    |> Request.BillSheet.page url whereClause
+                    |> Request.BillSheet.page url model.token whereClause
                     >> Http.send ( BillSheets >> Fetch )
                 ]
 
@@ -503,7 +505,7 @@ update url msg model =
                             ( True
                             , Modal.Spinner |> Just
                             , query |> Just                     -- We need to save the search query for paging!
-                            , Request.BillSheet.page url q 0
+                            , Request.BillSheet.page url model.token q 0
                                 |> Http.send ( BillSheets >> Fetch )
                             )
 
@@ -596,7 +598,7 @@ update url msg model =
             { model | checked = [] } ! -- Clear the list of checked items when paging!
             [ page
                 |> Maybe.withDefault -1
-                |> Request.BillSheet.page url s
+                |> Request.BillSheet.page url model.token s
                 |> Http.send ( BillSheets >> Fetch )
             ]
 
@@ -5,7 +5,6 @@ import Html exposing (Html, button, div, form, h1, p, section, text)
 import Html.Attributes exposing (autofocus, class, value)
 import Html.Events exposing (onClick, onInput, onSubmit)
 import Http
-import Request.Session
 import Request.Specialist
 import Task exposing (Task)
 import Views.Errors as Errors
@@ -21,6 +20,7 @@ type alias Model =
     { action : ViewAction
     , disabled : Bool
     , errors : List String
+    , currentPassword : String
     , newPassword : String
     , confirmPassword : String
     , specialist : Maybe User
@@ -32,6 +32,7 @@ init specialist =
     { action = None
     , disabled = True
     , errors = []
+    , currentPassword = ""
     , newPassword = ""
     , confirmPassword = ""
     , specialist =
@@ -48,7 +49,6 @@ init specialist =
 type Msg
     = Cancel
     | ChangePassword User
-    | Hashed ( Result Http.Error User )
     | Put ViewAction
     | Putted ( Result Http.Error User )
     | SetPasswordValue ( String -> Model ) String
@@ -61,6 +61,7 @@ update url msg model =
         Cancel ->
             { model |
                 action = None
+                , currentPassword = ""
                 , newPassword = ""
                 , confirmPassword = ""
                 , specialist = Nothing
@@ -73,53 +74,20 @@ update url msg model =
                 , specialist = specialist |> Just
             } ! []
 
-        Hashed ( Ok specialist ) ->
-            let
-                newSpecialist =
-                    case model.specialist of
-                        Nothing ->
-                            specialist
-
-                        Just current ->
-                            { current | password = specialist.password }
-
-                subCmd =
-                    Request.Specialist.put url newSpecialist
-                        |> Http.toTask
-                        |> Task.attempt Putted
-            in
-                { model |
-                    action = None
-                } ! [ subCmd ]
-
-        Hashed ( Err err ) ->
-            let
-                e =
-                    case err of
-                        Http.BadStatus e ->
-                            e.body
-
-                        _ ->
-                            "nop"
-            in
-            { model |
-                action = None
-                , errors = (::) e model.errors
-            } ! []
-
         Put action ->
             case action of
                 ChangingPassword specialist ->
                     let
                         subCmd =
-                            { specialist | password = model.newPassword }
-                                |> Request.Session.hash url
+                            specialist
+                                |> Request.Specialist.password url specialist.id model.currentPassword model.newPassword
                                     |> Http.toTask
-                                    |> Task.attempt Hashed
+                                    |> Task.attempt Putted
                     in
                         { model |
                             action = None
                             , disabled = True
+                            , currentPassword = ""
                             , newPassword = ""
                             , confirmPassword = ""
                         } ! [ subCmd ]
@@ -160,6 +128,7 @@ update url msg model =
                             ( (==) "" m.confirmPassword ) &&
                             ( (==) "" m.newPassword )
                         ) ||
+                            (==) "" m.currentPassword ||
                             (/=) m.newPassword m.confirmPassword
                         )
                     then True
@@ -217,9 +186,14 @@ drawView (
 
         ChangingPassword specialist ->
             [ form [ onSubmit ( Put ( ChangingPassword specialist ) ) ]
-                [ Form.password "New Password"
-                    [ value model.newPassword
+                [ Form.password "Current Password"
+                    [ value model.currentPassword
                     , True |> autofocus
+                    , onInput ( SetPasswordValue (\v -> { model | currentPassword = v } ) )
+                    ]
+                    []
+                , Form.password "New Password"
+                    [ value model.newPassword
                     , onInput ( SetPasswordValue (\v -> { model | newPassword = v } ) )
                     ]
                     []
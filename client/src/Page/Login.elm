@@ -36,14 +36,14 @@ init =
 
 type Msg
     = Authenticate
-    | Authenticated ( Result Http.Error User )
+    | Authenticated ( Result Http.Error ( User, String ) )
     | Cancel
     | SetFormValue ( String -> Model ) String
 
 
 type ExternalMsg
     = Nop
-    | SetUser User
+    | SetUser User String
 
 
 update : String -> Msg -> Model -> ( ( Model, Cmd Msg ), ExternalMsg )
@@ -56,8 +56,8 @@ update url msg model =
                     |> Task.attempt Authenticated
             ] , Nop )
 
-        Authenticated ( Ok user ) ->
-            ( { model | username = "" , password = "", error = "" } ! [], SetUser user )
+        Authenticated ( Ok ( user, token ) ) ->
+            ( { model | username = "" , password = "", error = "" } ! [], SetUser user token )
 
         Authenticated ( Err err ) ->
             ( { model | username = "", password = "", error = "Bad username or password" } ! [], Nop )
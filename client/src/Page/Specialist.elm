@@ -10,7 +10,6 @@ import Html.Attributes exposing (autofocus, action, autofocus, checked, class, f
 import Html.Events exposing (onCheck, onClick, onInput, onSubmit)
 import Http
 import Request.PayHistory
-import Request.Session
 import Request.Specialist
 import Search.Specialist
 import Table exposing (defaultCustomizations)
@@ -41,12 +40,14 @@ type alias Model =
     , payHistory : List PayHistory
     , query : Maybe Query
     , pager : Pager
+    , user : User
     }
 
 
 
-init : String -> ( Model, Cmd Msg )
-init url =
+-- The user is the admin who is logged in.
+init : String -> User -> ( Model, Cmd Msg )
+init url user =
     { errors = []
     , tableState = Table.initialSort "ID"
     , action = None
@@ -59,6 +60,7 @@ init url =
     , payHistory = []
     , query = Search.Specialist.defaultQuery |> Just
     , pager = Data.Pager.new
+    , user = user
     } ! [ 0
             |> Request.Specialist.page url
                 ( String.dropRight 5 << Dict.foldl fmtFuzzyMatch "" <| Search.Specialist.defaultQuery )
@@ -79,7 +81,6 @@ type Msg
     | Deleted ( Result Http.Error User )
     | Edit User
     | FetchedSpecialists ( Result Http.Error UserWithPager )
-    | Hashed ( Result Http.Error User )
     | ModalMsg Modal.Msg
     | NewPage ( Maybe Int )
     | Post
@@ -189,40 +190,6 @@ update url msg model =
                 , tableState = Table.initialSort "ID"
             } ! []
 
-        Hashed ( Ok specialist ) ->
-            let
-                newSpecialist =
-                    case model.editing of
-                        Nothing ->
-                            specialist
-
-                        Just current ->
-                            { current | password = specialist.password }
-
-                subCmd =
-                    Request.Specialist.put url newSpecialist
-                        |> Http.toTask
-                        |> Task.attempt Putted
-            in
-                { model |
-                    action = None
-                } ! [ subCmd ]
-
-        Hashed ( Err err ) ->
-            let
-                e =
-                    case err of
-                        Http.BadStatus e ->
-                            e.body
-
-                        _ ->
-                            "nop"
-            in
-            { model |
-                action = None
-                , errors = (::) e model.errors
-            } ! []
-
         ModalMsg subMsg ->
             let
                 ( showModal, whichModal, query, cmd ) =
@@ -378,13 +345,14 @@ update url msg model =
                 ChangingPassword specialist ->
                     let
                         subCmd =
-                            { specialist | password = model.newPassword }
-                                |> Request.Session.hash url
+                            specialist
+                                |> Request.Specialist.password url model.user.id "" model.newPassword
                                     |> Http.toTask
-                                    |> Task.attempt Hashed
+                                    |> Task.attempt Putted
                     in
                         { model |
-                            disabled = True
+                            action = None
+                            , disabled = True
                             , newPassword = ""
                             , confirmPassword = ""
                         } ! [ subCmd ]
@@ -8,6 +8,7 @@ port module Ports exposing
 
 type alias SessionCredentials =
     { user : Int
+    , token : String
     }
 
 
@@ -34,22 +34,43 @@ delete url billsheet =
 --        |> Http.get ( url ++ "/billsheet/" ++ method )
 
 
-list : String -> Http.Request ( List BillSheet )
-list url =
-    manyDecoder |> Http.get ( (++) url "/billsheet/list" )
+-- The server only returns the billsheets that the session's user can see.
+authorization : String -> List Http.Header
+authorization token =
+    [ Http.header "Authorization" ( "Bearer " ++ token ) ]
+
+
+list : String -> String -> Http.Request ( List BillSheet )
+list url token =
+    Http.request
+        { method = "GET"
+        , headers = authorization token
+        , url = (++) url "/billsheet/list"
+        , body = Http.emptyBody
+        , expect = Http.expectJson manyDecoder
+        , timeout = Nothing
+        , withCredentials = False
+        }
 
 
 -- The where clause is "optional", pass an empty string for none.
-page : String -> String -> Int -> Http.Request BillSheetWithPager
-page url whereClause page =
+page : String -> String -> String -> Int -> Http.Request BillSheetWithPager
+page url token whereClause page =
     let
         body : Http.Body
         body =
             queryEncoder whereClause
                 |> Http.jsonBody
     in
-        pagingDecoder
-            |> Http.post ( url ++ "/billsheet/list/" ++ ( page |> toString ) ) body
+        Http.request
+            { method = "POST"
+            , headers = authorization token
+            , url = url ++ "/billsheet/list/" ++ ( page |> toString )
+            , body = body
+            , expect = Http.expectJson pagingDecoder
+            , timeout = Nothing
+            , withCredentials = False
+            }
 
 
 post : String -> BillSheet -> Http.Request BillSheet
@@ -1,33 +1,28 @@
-module Request.Session exposing (auth, hash)
+module Request.Session exposing (auth)
 
 import Http
-import Data.User exposing (User, decoder, authEncoder, hashEncoder)
+import Data.Session exposing (tokenDecoder)
+import Data.User exposing (User, decoder, authEncoder)
+import Json.Decode as Decode exposing (Decoder)
 import Json.Encode as Encode
 
 
 
-post : String -> ( a -> Encode.Value ) -> String -> a -> Http.Request User
-post method encoder url user =
+post : String -> ( a -> Encode.Value ) -> Decoder b -> String -> a -> Http.Request b
+post method encoder responseDecoder url user =
     let
         body : Http.Body
         body =
             encoder user
                 |> Http.jsonBody
     in
-        decoder
+        responseDecoder
             |> Http.post ( (++) url ( (++) "/session/" method ) ) body
 
 
 -- We're not defining an `Auth` type here b/c the Login page (the main caller of this function)
 -- also has an `errors` field in its model!
-auth : String -> { r | username : String, password : String } -> Http.Request User
+-- Returns the user along with the token of the new session.
+auth : String -> { r | username : String, password : String } -> Http.Request ( User, String )
 auth =
-    post "auth" authEncoder
-
-
--- Same reasoning as above, but for the Specialist page!
-hash : String -> { r | id : Int, password : String } -> Http.Request User
-hash =
-    post "hash" hashEncoder
-
-
+    post "auth" authEncoder ( Decode.map2 (,) decoder tokenDecoder )
@@ -1,4 +1,4 @@
-module Request.Specialist exposing (delete, get, list, page, post, put)
+module Request.Specialist exposing (delete, get, list, page, password, post, put)
 
 import Http
 import Data.User exposing
@@ -8,6 +8,7 @@ import Data.User exposing
     , encoder
     , manyDecoder
     , pagingDecoder
+    , passwordEncoder
     , queryEncoder
     , succeed
     )
@@ -52,6 +53,26 @@ page url whereClause page =
 
 
 
+-- The new password is hashed on the server.  Pass an empty current password when an admin is
+-- changing someone else's.
+password : String -> Int -> String -> String -> User -> Http.Request User
+password url realSpecialist currentPassword newPassword specialist =
+    let
+        body : Http.Body
+        body =
+            passwordEncoder realSpecialist currentPassword newPassword
+                |> Http.jsonBody
+    in
+        Http.request
+            { method = "PUT"
+            , headers = []
+            , url = url ++ "/specialist/" ++ ( toString specialist.id ) ++ "/password"
+            , body = body
+            , expect = Http.expectJson decoder
+            , timeout = Nothing
+            , withCredentials = False
+            }
+
 
 post : String -> User -> Http.Request User
 post url specialist =
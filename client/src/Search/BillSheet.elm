@@ -53,7 +53,7 @@ update query msg =
                             selection |> setSelection q "billsheet.consumer" |> Just
 
                         Form.CountyID ->
-                            selection |> setSelection q "billsheet.county" |> Just
+                            selection |> setSelection q "consumer.county" |> Just
 
                         Form.ServiceCodeID ->
                             selection |> setSelection q "billsheet.serviceCode" |> Just
@@ -136,7 +136,7 @@ view user query viewLists =
                         counties
                             |> List.map ( \m -> ( m.id |> toString, m.name ) )
                             |> (::) ( "-1", "-- Select a county --" )
-                            |> List.map ( "billsheet.county" |> getSelection q |> Form.option )
+                            |> List.map ( "consumer.county" |> getSelection q |> Form.option )
                     )
                 , Form.text "Service Date From"
                     [ True |> autofocus
@@ -183,7 +183,7 @@ view user query viewLists =
                         counties
                             |> List.map ( \m -> ( m.id |> toString, m.name ) )
                             |> (::) ( "-1", "-- Select a county --" )
-                            |> List.map ( "billsheet.county" |> getSelection q |> Form.option )
+                            |> List.map ( "consumer.county" |> getSelection q |> Form.option )
                     )
                 , Form.text "Service Date From"
                     [ True |> autofocus
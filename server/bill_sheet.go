@@ -9,22 +9,60 @@ import (
 // BillSheetController implements the BillSheet resource.
 type BillSheetController struct {
 	*goa.Controller
+	billSheets sql.BillSheetRepository
 }
 
 // NewBillSheetController creates a BillSheet controller.
-func NewBillSheetController(service *goa.Service) *BillSheetController {
-	return &BillSheetController{Controller: service.NewController("BillSheetController")}
+func NewBillSheetController(service *goa.Service, billSheets sql.BillSheetRepository) *BillSheetController {
+	return &BillSheetController{
+		Controller: service.NewController("BillSheetController"),
+		billSheets: billSheets,
+	}
+}
+
+// Approve runs the approve action.
+func (c *BillSheetController) Approve(ctx *app.ApproveBillSheetContext) error {
+	// BillSheetController_Approve: start_implement
+
+	collection, err := c.billSheets.Transition(ctx, &sql.TransitionQuery{
+		IDs:     ctx.Payload.Ids,
+		State:   sql.StateApproved,
+		Comment: stringOrEmpty(ctx.Payload.Comment),
+	})
+	if err != nil {
+		return err
+	}
+	return ctx.OK(collection)
+
+	// BillSheetController_Approve: end_implement
+}
+
+// Bulk runs the bulk action.
+func (c *BillSheetController) Bulk(ctx *app.BulkBillSheetContext) error {
+	// BillSheetController_Bulk: start_implement
+
+	collection, err := c.billSheets.Bulk(ctx, &sql.BulkQuery{
+		IDs:    ctx.Payload.Ids,
+		Filter: ctx.Payload.Filter,
+		Patch:  ctx.Payload.Patch,
+	})
+	if err != nil {
+		return err
+	}
+	return ctx.OK(collection)
+
+	// BillSheetController_Bulk: end_implement
 }
 
 // Create runs the create action.
 func (c *BillSheetController) Create(ctx *app.CreateBillSheetContext) error {
 	// BillSheetController_Create: start_implement
 
-	rec, err := sql.Create(sql.NewBillSheet(ctx.Payload))
+	rec, err := c.billSheets.Create(ctx, ctx.Payload)
 	if err != nil {
 		return err
 	}
-	return ctx.OK(rec.(*app.BillSheetMedia))
+	return ctx.OK(rec)
 
 	// BillSheetController_Create: end_implement
 }
@@ -33,7 +71,7 @@ func (c *BillSheetController) Create(ctx *app.CreateBillSheetContext) error {
 func (c *BillSheetController) Delete(ctx *app.DeleteBillSheetContext) error {
 	// BillSheetController_Delete: start_implement
 
-	err := sql.Delete(sql.NewBillSheet(ctx.ID))
+	err := c.billSheets.Delete(ctx, ctx.ID)
 	if err != nil {
 		return err
 	}
@@ -42,15 +80,42 @@ func (c *BillSheetController) Delete(ctx *app.DeleteBillSheetContext) error {
 	// BillSheetController_Delete: end_implement
 }
 
+// Export runs the export action.
+func (c *BillSheetController) Export(ctx *app.ExportBillSheetContext) error {
+	// BillSheetController_Export: start_implement
+
+	principal := sql.PrincipalFromContext(ctx)
+	if principal == nil {
+		return ctx.Unauthorized()
+	}
+	w, err := newExportWriter(ctx.ResponseData, ctx.Format, "billsheets")
+	if err != nil {
+		return err
+	}
+	return c.billSheets.Export(ctx, &sql.BillSheetExportQuery{
+		ExportQuery: sql.ExportQuery{
+			Principal: principal,
+		},
+		Sort:   stringOrEmpty(ctx.Sort),
+		Filter: ctx.Payload,
+	}, w)
+
+	// BillSheetController_Export: end_implement
+}
+
 // List runs the list action.
 func (c *BillSheetController) List(ctx *app.ListBillSheetContext) error {
 	// BillSheetController_List: start_implement
 
-	collection, err := sql.List(sql.NewBillSheet(nil))
+	principal := sql.PrincipalFromContext(ctx)
+	if principal == nil {
+		return ctx.Unauthorized()
+	}
+	collection, err := c.billSheets.List(ctx, principal)
 	if err != nil {
 		return err
 	}
-	return ctx.OK(collection.([]*app.BillSheetItem))
+	return ctx.OK(collection)
 
 	// BillSheetController_List: end_implement
 }
@@ -59,24 +124,128 @@ func (c *BillSheetController) List(ctx *app.ListBillSheetContext) error {
 func (c *BillSheetController) Page(ctx *app.PageBillSheetContext) error {
 	// BillSheetController_Page: start_implement
 
-	collection, err := sql.Page(sql.NewBillSheet(&sql.PageQuery{ctx.Page, *ctx.Payload.WhereClause}))
+	principal := sql.PrincipalFromContext(ctx)
+	if principal == nil {
+		return ctx.Unauthorized()
+	}
+	query := pageQuery(ctx.Page, ctx.Sort, ctx.PerPage, ctx.Fields)
+	query.Principal = principal
+	collection, err := c.billSheets.Page(ctx, &sql.BillSheetPageQuery{
+		PageQuery: query,
+		Filter:    ctx.Payload,
+	})
 	if err != nil {
 		return err
 	}
-	return ctx.OKPaging(collection.(*app.BillSheetMediaPaging))
+	if len(query.Fields) > 0 {
+		return sendFields(ctx, ctx.ResponseData, query.Fields, collection)
+	}
+	return ctx.OKPaging(collection)
 
 	// BillSheetController_Page: end_implement
 }
 
+// Patch runs the patch action.
+func (c *BillSheetController) Patch(ctx *app.PatchBillSheetContext) error {
+	// BillSheetController_Patch: start_implement
+
+	// The id in the route is the record that's being patched.
+	ctx.Payload.ID = &ctx.ID
+	version, err := ifMatch(ctx.IfMatch, ctx.Payload.Version)
+	if err != nil {
+		return err
+	}
+	ctx.Payload.Version = version
+	rec, err := c.billSheets.Patch(ctx, ctx.Payload)
+	if stale, ok := err.(*sql.StaleError); ok {
+		current := stale.BillSheet
+		setETag(ctx.ResponseData, current.Version)
+		return ctx.PreconditionFailed(current)
+	}
+	if err != nil {
+		return err
+	}
+	setETag(ctx.ResponseData, rec.Version)
+	return ctx.OK(rec)
+
+	// BillSheetController_Patch: end_implement
+}
+
+// Reject runs the reject action.
+func (c *BillSheetController) Reject(ctx *app.RejectBillSheetContext) error {
+	// BillSheetController_Reject: start_implement
+
+	collection, err := c.billSheets.Transition(ctx, &sql.TransitionQuery{
+		IDs:     ctx.Payload.Ids,
+		State:   sql.StateRejected,
+		Comment: stringOrEmpty(ctx.Payload.Comment),
+	})
+	if err != nil {
+		return err
+	}
+	return ctx.OK(collection)
+
+	// BillSheetController_Reject: end_implement
+}
+
+// Show runs the show action.
+func (c *BillSheetController) Show(ctx *app.ShowBillSheetContext) error {
+	// BillSheetController_Show: start_implement
+
+	rec, err := c.billSheets.Read(ctx, ctx.ID)
+	if err != nil {
+		return err
+	}
+	setETag(ctx.ResponseData, rec.Version)
+	return ctx.OK(rec)
+
+	// BillSheetController_Show: end_implement
+}
+
+// Transition runs the transition action.
+func (c *BillSheetController) Transition(ctx *app.TransitionBillSheetContext) error {
+	// BillSheetController_Transition: start_implement
+
+	collection, err := c.billSheets.Transition(ctx, &sql.TransitionQuery{
+		IDs:     ctx.Payload.Ids,
+		State:   ctx.Payload.State,
+		Comment: stringOrEmpty(ctx.Payload.Comment),
+	})
+	if err != nil {
+		return err
+	}
+	return ctx.OK(collection)
+
+	// BillSheetController_Transition: end_implement
+}
+
 // Update runs the update action.
 func (c *BillSheetController) Update(ctx *app.UpdateBillSheetContext) error {
 	// BillSheetController_Update: start_implement
 
-	rec, err := sql.Update(sql.NewBillSheet(ctx.Payload))
+	version, err := ifMatch(ctx.IfMatch, ctx.Payload.Version)
+	if err != nil {
+		return err
+	}
+	ctx.Payload.Version = version
+	rec, err := c.billSheets.Update(ctx, ctx.Payload)
+	if stale, ok := err.(*sql.StaleError); ok {
+		current := stale.BillSheet
+		setETag(ctx.ResponseData, current.Version)
+		return ctx.PreconditionFailed(current)
+	}
 	if err != nil {
 		return err
 	}
-	return ctx.OK(rec.(*app.BillSheetMedia))
+	setETag(ctx.ResponseData, rec.Version)
+	return ctx.OK(rec)
 
 	// BillSheetController_Update: end_implement
 }
+
+func stringOrEmpty(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"github.com/btoll/cpss/server/app"
+	"github.com/btoll/cpss/server/sql"
+	"github.com/goadesign/goa"
+)
+
+// CaseloadController implements the Caseload resource.
+type CaseloadController struct {
+	*goa.Controller
+	caseloads sql.CaseloadRepository
+}
+
+// NewCaseloadController creates a Caseload controller.
+func NewCaseloadController(service *goa.Service, caseloads sql.CaseloadRepository) *CaseloadController {
+	return &CaseloadController{
+		Controller: service.NewController("CaseloadController"),
+		caseloads:  caseloads,
+	}
+}
+
+// Create runs the create action.
+func (c *CaseloadController) Create(ctx *app.CreateCaseloadContext) error {
+	// CaseloadController_Create: start_implement
+
+	rec, err := c.caseloads.Create(ctx, ctx.Payload)
+	if err != nil {
+		return err
+	}
+	return ctx.OK(rec)
+
+	// CaseloadController_Create: end_implement
+}
+
+// Delete runs the delete action.
+func (c *CaseloadController) Delete(ctx *app.DeleteCaseloadContext) error {
+	// CaseloadController_Delete: start_implement
+
+	err := c.caseloads.Delete(ctx, ctx.ID)
+	if err != nil {
+		return err
+	}
+	return ctx.OKTiny(&app.CaseloadMediaTiny{ctx.ID})
+
+	// CaseloadController_Delete: end_implement
+}
+
+// List runs the list action.
+func (c *CaseloadController) List(ctx *app.ListCaseloadContext) error {
+	// CaseloadController_List: start_implement
+
+	collection, err := c.caseloads.List(ctx)
+	if err != nil {
+		return err
+	}
+	return ctx.OK(collection)
+
+	// CaseloadController_List: end_implement
+}
+
+// Page runs the page action.
+func (c *CaseloadController) Page(ctx *app.PageCaseloadContext) error {
+	// CaseloadController_Page: start_implement
+
+	query := pageQuery(ctx.Page, ctx.Sort, ctx.PerPage, ctx.Fields)
+	query.Principal = sql.PrincipalFromContext(ctx)
+	collection, err := c.caseloads.Page(ctx, &sql.CaseloadPageQuery{
+		PageQuery: query,
+		Filter:    ctx.Payload,
+	})
+	if err != nil {
+		return err
+	}
+	if len(query.Fields) > 0 {
+		return sendFields(ctx, ctx.ResponseData, query.Fields, collection)
+	}
+	return ctx.OKPaging(collection)
+
+	// CaseloadController_Page: end_implement
+}
+
+// Patch runs the patch action.
+func (c *CaseloadController) Patch(ctx *app.PatchCaseloadContext) error {
+	// CaseloadController_Patch: start_implement
+
+	// The id in the route is the record that's being patched.
+	ctx.Payload.ID = &ctx.ID
+	rec, err := c.caseloads.Patch(ctx, ctx.Payload)
+	if err != nil {
+		return err
+	}
+	return ctx.OK(rec)
+
+	// CaseloadController_Patch: end_implement
+}
+
+// Update runs the update action.
+func (c *CaseloadController) Update(ctx *app.UpdateCaseloadContext) error {
+	// CaseloadController_Update: start_implement
+
+	rec, err := c.caseloads.Update(ctx, ctx.Payload)
+	if err != nil {
+		return err
+	}
+	return ctx.OK(rec)
+
+	// CaseloadController_Update: end_implement
+}
@@ -9,22 +9,26 @@ import (
 // ConsumerController implements the Consumer resource.
 type ConsumerController struct {
 	*goa.Controller
+	consumers sql.ConsumerRepository
 }
 
 // NewConsumerController creates a Consumer controller.
-func NewConsumerController(service *goa.Service) *ConsumerController {
-	return &ConsumerController{Controller: service.NewController("ConsumerController")}
+func NewConsumerController(service *goa.Service, consumers sql.ConsumerRepository) *ConsumerController {
+	return &ConsumerController{
+		Controller: service.NewController("ConsumerController"),
+		consumers:  consumers,
+	}
 }
 
 // Create runs the create action.
 func (c *ConsumerController) Create(ctx *app.CreateConsumerContext) error {
 	// ConsumerController_Create: start_implement
 
-	id, err := sql.Create(sql.NewConsumer(ctx.Payload))
+	id, err := c.consumers.Create(ctx, ctx.Payload)
 	if err != nil {
 		return err
 	}
-	return ctx.OKTiny(&app.ConsumerMediaTiny{id.(int)})
+	return ctx.OKTiny(&app.ConsumerMediaTiny{id})
 
 	// ConsumerController_Create: end_implement
 }
@@ -33,7 +37,7 @@ func (c *ConsumerController) Create(ctx *app.CreateConsumerContext) error {
 func (c *ConsumerController) Delete(ctx *app.DeleteConsumerContext) error {
 	// ConsumerController_Delete: start_implement
 
-	err := sql.Delete(sql.NewConsumer(ctx.ID))
+	err := c.consumers.Delete(ctx, ctx.ID)
 	if err != nil {
 		return err
 	}
@@ -42,15 +46,33 @@ func (c *ConsumerController) Delete(ctx *app.DeleteConsumerContext) error {
 	// ConsumerController_Delete: end_implement
 }
 
+// Export runs the export action.
+func (c *ConsumerController) Export(ctx *app.ExportConsumerContext) error {
+	// ConsumerController_Export: start_implement
+
+	w, err := newExportWriter(ctx.ResponseData, ctx.Format, "consumers")
+	if err != nil {
+		return err
+	}
+	return c.consumers.Export(ctx, &sql.ConsumerExportQuery{
+		ExportQuery: sql.ExportQuery{
+			Principal: sql.PrincipalFromContext(ctx),
+		},
+		Filter: ctx.Payload,
+	}, w)
+
+	// ConsumerController_Export: end_implement
+}
+
 // List runs the list action.
 func (c *ConsumerController) List(ctx *app.ListConsumerContext) error {
 	// ConsumerController_List: start_implement
 
-	collection, err := sql.List(sql.NewConsumer(nil))
+	collection, err := c.consumers.List(ctx, ctx.Mine != nil && *ctx.Mine)
 	if err != nil {
 		return err
 	}
-	return ctx.OK(collection.([]*app.ConsumerItem))
+	return ctx.OK(collection)
 
 	// ConsumerController_List: end_implement
 }
@@ -59,24 +81,83 @@ func (c *ConsumerController) List(ctx *app.ListConsumerContext) error {
 func (c *ConsumerController) Page(ctx *app.PageConsumerContext) error {
 	// ConsumerController_Page: start_implement
 
-	collection, err := sql.Page(sql.NewConsumer(&sql.PageQuery{ctx.Page, *ctx.Payload.WhereClause}))
+	query := pageQuery(ctx.Page, ctx.Sort, ctx.PerPage, ctx.Fields)
+	query.Principal = sql.PrincipalFromContext(ctx)
+	collection, err := c.consumers.Page(ctx, &sql.ConsumerPageQuery{
+		PageQuery: query,
+		Filter:    ctx.Payload,
+	})
 	if err != nil {
 		return err
 	}
-	return ctx.OKPaging(collection.(*app.ConsumerMediaPaging))
+	if len(query.Fields) > 0 {
+		return sendFields(ctx, ctx.ResponseData, query.Fields, collection)
+	}
+	return ctx.OKPaging(collection)
 
 	// ConsumerController_Page: end_implement
 }
 
+// Patch runs the patch action.
+func (c *ConsumerController) Patch(ctx *app.PatchConsumerContext) error {
+	// ConsumerController_Patch: start_implement
+
+	// The id in the route is the record that's being patched.
+	ctx.Payload.ID = &ctx.ID
+	version, err := ifMatch(ctx.IfMatch, ctx.Payload.Version)
+	if err != nil {
+		return err
+	}
+	ctx.Payload.Version = version
+	rec, err := c.consumers.Patch(ctx, ctx.Payload)
+	if stale, ok := err.(*sql.StaleError); ok {
+		current := stale.Consumer
+		setETag(ctx.ResponseData, current.Version)
+		return ctx.PreconditionFailed(current)
+	}
+	if err != nil {
+		return err
+	}
+	setETag(ctx.ResponseData, rec.Version)
+	return ctx.OK(rec)
+
+	// ConsumerController_Patch: end_implement
+}
+
+// Show runs the show action.
+func (c *ConsumerController) Show(ctx *app.ShowConsumerContext) error {
+	// ConsumerController_Show: start_implement
+
+	rec, err := c.consumers.Read(ctx, ctx.ID)
+	if err != nil {
+		return err
+	}
+	setETag(ctx.ResponseData, rec.Version)
+	return ctx.OK(rec)
+
+	// ConsumerController_Show: end_implement
+}
+
 // Update runs the update action.
 func (c *ConsumerController) Update(ctx *app.UpdateConsumerContext) error {
 	// ConsumerController_Update: start_implement
 
-	rec, err := sql.Update(sql.NewConsumer(ctx.Payload))
+	version, err := ifMatch(ctx.IfMatch, ctx.Payload.Version)
+	if err != nil {
+		return err
+	}
+	ctx.Payload.Version = version
+	rec, err := c.consumers.Update(ctx, ctx.Payload)
+	if stale, ok := err.(*sql.StaleError); ok {
+		current := stale.Consumer
+		setETag(ctx.ResponseData, current.Version)
+		return ctx.PreconditionFailed(current)
+	}
 	if err != nil {
 		return err
 	}
-	return ctx.OK(rec.(*app.ConsumerMedia))
+	setETag(ctx.ResponseData, rec.Version)
+	return ctx.OK(rec)
 
 	// ConsumerController_Update: end_implement
 }
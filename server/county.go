@@ -9,22 +9,26 @@ import (
 // CountyController implements the County resource.
 type CountyController struct {
 	*goa.Controller
+	counties sql.CountyRepository
 }
 
 // NewCountyController creates a County controller.
-func NewCountyController(service *goa.Service) *CountyController {
-	return &CountyController{Controller: service.NewController("CountyController")}
+func NewCountyController(service *goa.Service, counties sql.CountyRepository) *CountyController {
+	return &CountyController{
+		Controller: service.NewController("CountyController"),
+		counties:   counties,
+	}
 }
 
 // Create runs the create action.
 func (c *CountyController) Create(ctx *app.CreateCountyContext) error {
 	// CountyController_Create: start_implement
 
-	id, err := sql.Create(sql.NewCounty(ctx.Payload))
+	rec, err := c.counties.Create(ctx, ctx.Payload)
 	if err != nil {
 		return err
 	}
-	return ctx.OKTiny(&app.CountyMediaTiny{id.(int)})
+	return ctx.OKTiny(&app.CountyMediaTiny{rec.ID})
 
 	// CountyController_Create: end_implement
 }
@@ -33,7 +37,7 @@ func (c *CountyController) Create(ctx *app.CreateCountyContext) error {
 func (c *CountyController) Delete(ctx *app.DeleteCountyContext) error {
 	// CountyController_Delete: start_implement
 
-	err := sql.Delete(sql.NewCounty(ctx.ID))
+	err := c.counties.Delete(ctx, ctx.ID)
 	if err != nil {
 		return err
 	}
@@ -46,11 +50,11 @@ func (c *CountyController) Delete(ctx *app.DeleteCountyContext) error {
 func (c *CountyController) List(ctx *app.ListCountyContext) error {
 	// CountyController_List: start_implement
 
-	collection, err := sql.List(sql.NewCounty(nil))
+	collection, err := c.counties.List(ctx)
 	if err != nil {
 		return err
 	}
-	return ctx.OK(collection.(app.CountyMediaCollection))
+	return ctx.OK(collection)
 
 	// CountyController_List: end_implement
 }
@@ -59,11 +63,15 @@ func (c *CountyController) List(ctx *app.ListCountyContext) error {
 func (c *CountyController) Page(ctx *app.PageCountyContext) error {
 	// CountyController_Page: start_implement
 
-	collection, err := sql.Page(sql.NewCounty(ctx.Page))
+	query := pageQuery(ctx.Page, ctx.Sort, ctx.PerPage, ctx.Fields)
+	collection, err := c.counties.Page(ctx, &query)
 	if err != nil {
 		return err
 	}
-	return ctx.OKPaging(collection.(*app.CountyMediaPaging))
+	if len(query.Fields) > 0 {
+		return sendFields(ctx, ctx.ResponseData, query.Fields, collection)
+	}
+	return ctx.OKPaging(collection)
 
 	// CountyController_Page: end_implement
 }
@@ -72,11 +80,11 @@ func (c *CountyController) Page(ctx *app.PageCountyContext) error {
 func (c *CountyController) Show(ctx *app.ShowCountyContext) error {
 	// CountyController_Show: start_implement
 
-	collection, err := sql.Read(sql.NewCounty(ctx.ID))
+	rec, err := c.counties.Read(ctx, ctx.ID)
 	if err != nil {
 		return err
 	}
-	return ctx.OK(collection.(app.CountyMediaCollection))
+	return ctx.OK(app.CountyMediaCollection{rec})
 
 	// CountyController_Show: end_implement
 }
@@ -85,11 +93,11 @@ func (c *CountyController) Show(ctx *app.ShowCountyContext) error {
 func (c *CountyController) Update(ctx *app.UpdateCountyContext) error {
 	// CountyController_Update: start_implement
 
-	rec, err := sql.Update(sql.NewCounty(ctx.Payload))
+	rec, err := c.counties.Update(ctx, ctx.Payload)
 	if err != nil {
 		return err
 	}
-	return ctx.OK(rec.(*app.CountyMedia))
+	return ctx.OK(rec)
 
 	// CountyController_Update: end_implement
 }
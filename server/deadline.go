@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/goadesign/goa"
+)
+
+// How long an action can run before it's cancelled, overridden by the CPSS_REQUEST_TIMEOUT environment
+// variable (e.g. "45s").
+var requestTimeout = 30 * time.Second
+
+// The actions that take longer than requestTimeout, by controller or by controller and action.  Added to
+// or overridden by the CPSS_ACTION_TIMEOUTS environment variable, e.g.
+// "BillSheetController.export=10m,ImportController=5m".
+var actionTimeouts = map[string]time.Duration{
+	"BillSheetController.bulk":    2 * time.Minute,
+	"BillSheetController.export":  5 * time.Minute,
+	"ConsumerController.export":   5 * time.Minute,
+	"ImportController":            5 * time.Minute,
+	"PayHistoryController.export": 5 * time.Minute,
+	"ReportController":            2 * time.Minute,
+	"SpecialistController.export": 5 * time.Minute,
+}
+
+var ErrTimeout = goa.NewErrorClass("timeout", http.StatusServiceUnavailable)
+
+// Reads the timeouts from the environment.
+func configureTimeouts() error {
+	if env := os.Getenv("CPSS_REQUEST_TIMEOUT"); env != "" {
+		d, err := time.ParseDuration(env)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("Bad CPSS_REQUEST_TIMEOUT: %s", env)
+		}
+		requestTimeout = d
+	}
+	if env := os.Getenv("CPSS_ACTION_TIMEOUTS"); env != "" {
+		for _, pair := range strings.Split(env, ",") {
+			parts := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+			if len(parts) != 2 {
+				return fmt.Errorf("Bad CPSS_ACTION_TIMEOUTS: expected Controller.action=duration, got %s", pair)
+			}
+			d, err := time.ParseDuration(parts[1])
+			if err != nil || d <= 0 {
+				return fmt.Errorf("Bad CPSS_ACTION_TIMEOUTS: %s", pair)
+			}
+			actionTimeouts[parts[0]] = d
+		}
+	}
+	return nil
+}
+
+func timeoutFor(controller, action string) time.Duration {
+	if d, ok := actionTimeouts[controller+"."+action]; ok {
+		return d
+	}
+	if d, ok := actionTimeouts[controller]; ok {
+		return d
+	}
+	return requestTimeout
+}
+
+// Deadline cancels the context of an action when the client goes away or when the action runs longer than
+// its timeout, which cancels any statement that's running.  goa's request context isn't derived from the
+// request's own, so the client going away is passed on here.  It has to be mounted after the ErrorHandler,
+// so that a timeout is sent back as one.
+func Deadline() goa.Middleware {
+	return func(h goa.Handler) goa.Handler {
+		return func(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+			ctx, cancel := context.WithTimeout(ctx, timeoutFor(goa.ContextController(ctx), goa.ContextAction(ctx)))
+			defer cancel()
+			go func() {
+				select {
+				case <-req.Context().Done():
+					cancel()
+				case <-ctx.Done():
+				}
+			}()
+			err := h(ctx, rw, req)
+			if err != nil && ctx.Err() == context.DeadlineExceeded {
+				return ErrTimeout("This is taking too long, please try again later!")
+			}
+			return err
+		}
+	}
+}
@@ -24,8 +24,9 @@ var _ = API("cpss", func() {
 	// Add CORS
 	// https://github.com/goadesign/goa-cellar/commit/1ce01fda44482340624ef907b4f40b124a3f59c3
 	Origin("*", func() {
-		Methods("GET", "POST", "PUT", "DELETE")
-		Headers("Accept, Accept-Language, Content-Language, Content-Type")
+		Methods("GET", "POST", "PUT", "PATCH", "DELETE")
+		Headers("Accept, Accept-Language, Content-Language, Content-Type, If-Match, Authorization")
+		Expose("ETag")
 		MaxAge(600)
 		Credentials()
 	})
@@ -18,14 +18,41 @@ var _ = Resource("BillSheet", func() {
 		Response(OK, BillSheetMedia)
 	})
 
+	Action("show", func() {
+		Routing(GET("/:id"))
+		Params(func() {
+			Param("id", Integer, "BillSheet ID")
+		})
+		Description("Get a billsheet by id.  The ETag is the version of the billsheet.")
+		Response(OK, BillSheetMedia)
+	})
+
 	Action("update", func() {
 		Routing(PUT("/:id"))
 		Payload(BillSheetPayload)
 		Params(func() {
 			Param("id", Integer, "BillSheet ID")
 		})
+		Headers(func() {
+			Header("If-Match", String, "The ETag of the billsheet that was read")
+		})
 		Description("Update a billsheet by id.")
 		Response(OK, BillSheetMedia)
+		Response(PreconditionFailed, BillSheetMedia)
+	})
+
+	Action("patch", func() {
+		Routing(PATCH("/:id"))
+		Payload(BillSheetPatchPayload)
+		Params(func() {
+			Param("id", Integer, "BillSheet ID")
+		})
+		Headers(func() {
+			Header("If-Match", String, "The ETag of the billsheet that was read")
+		})
+		Description("Update only the given fields of a billsheet by id.")
+		Response(OK, BillSheetMedia)
+		Response(PreconditionFailed, BillSheetMedia)
 	})
 
 	Action("delete", func() {
@@ -42,21 +69,67 @@ var _ = Resource("BillSheet", func() {
 
 	Action("list", func() {
 		Routing(GET("/list"))
-		Description("Get all billsheets")
+		Description("Get all of the billsheets that the authenticated specialist can see")
 		Response(OK, ArrayOf("billSheetItem"))
+		Response(Unauthorized)
+	})
+
+	Action("bulk", func() {
+		Routing(POST("/bulk"))
+		Description("Patch many billsheets at once, either by id or by the same filters as `page`.")
+		Payload(BillSheetBulkPayload)
+		Response(OK, ArrayOf("transitionResultItem"))
+	})
+
+	Action("transition", func() {
+		Routing(POST("/transition"))
+		Description("Move billsheets to a new workflow state.")
+		Payload(BillSheetTransitionPayload)
+		Response(OK, ArrayOf("transitionResultItem"))
+	})
+
+	Action("approve", func() {
+		Routing(POST("/approve"))
+		Description("Approve submitted billsheets.")
+		Payload(BillSheetReviewPayload)
+		Response(OK, ArrayOf("transitionResultItem"))
+	})
+
+	Action("reject", func() {
+		Routing(POST("/reject"))
+		Description("Reject submitted billsheets, a comment is required.")
+		Payload(BillSheetReviewPayload)
+		Response(OK, ArrayOf("transitionResultItem"))
 	})
 
 	Action("page", func() {
 		Routing(POST("/list/:page"))
 		Params(func() {
 			Param("page", Integer, "Given a page number, returns an object consisting of the slice of bill_sheets and a pager object")
+			PageParams()
 		})
-		Description("Get a page of bill_sheets that may be filtered")
+		Description("Get a page of bill_sheets that may be filtered.  Only the billsheets that the authenticated specialist can see are returned.")
 		Payload(BillSheetQueryPayload)
 		Response(OK, func() {
 			Status(200)
 			Media(BillSheetMedia, "paging")
 		})
+		Response(Unauthorized)
+	})
+
+	Action("export", func() {
+		Routing(POST("/export"))
+		Params(func() {
+			Param("format", String, "The format of the spreadsheet", func() {
+				Enum("csv", "xlsx")
+				Default("csv")
+			})
+			SortParam()
+		})
+		Description("Export every billsheet that matches the filter and that the authenticated specialist can see, not just one page, as a spreadsheet")
+		Payload(BillSheetQueryPayload)
+		Response(OK)
+		Response(Unauthorized)
 	})
 })
 
@@ -71,10 +144,6 @@ var BillSheetPayload = Type("BillSheetPayload", func() {
 		Metadata("struct:tag:datastore", "specialist,noindex")
 		Metadata("struct:tag:json", "specialist")
 	})
-	Attribute("realSpecialist", Integer, "Analogous to linux' real user id", func() {
-		Metadata("struct:tag:datastore", "realSpecialist,noindex")
-		Metadata("struct:tag:json", "realSpecialist")
-	})
 	Attribute("consumer", Integer, "BillSheet consumer", func() {
 		Metadata("struct:tag:datastore", "consumer,noindex")
 		Metadata("struct:tag:json", "consumer")
@@ -111,17 +180,176 @@ var BillSheetPayload = Type("BillSheetPayload", func() {
 		Metadata("struct:tag:datastore", "description,noindex")
 		Metadata("struct:tag:json", "description")
 	})
+	// The fields are defined by the service code's note template.
+	Attribute("notes", ArrayOf("noteItem"))
+	Attribute("version", Integer, "The version that was read, a stale version is refused", func() {
+		Metadata("struct:tag:datastore", "version,noindex")
+		Metadata("struct:tag:json", "version")
+	})
 
 	Required("specialist", "consumer", "serviceDate", "serviceCode")
 })
 
+var BillSheetPatchPayload = Type("BillSheetPatchPayload", func() {
+	Description("BillSheet Patch Description, anything not given is left alone.")
+	Reference(BillSheetPayload)
+
+	Attribute("id")
+	Attribute("specialist")
+	Attribute("consumer")
+	Attribute("units")
+	Attribute("serviceDate")
+	Attribute("serviceCode")
+	Attribute("status")
+	Attribute("confirmation")
+	Attribute("description")
+	Attribute("notes")
+	Attribute("version")
+})
+
 var BillSheetQueryPayload = Type("BillSheetQueryPayload", func() {
-	Description("BillSheet Query Description.")
+	Description("BillSheet Query Description.  Every filter that's given has to match.")
 
-	Attribute("whereClause", String, "where clause", func() {
-		Metadata("struct:tag:datastore", "whereClause,noindex")
-		Metadata("struct:tag:json", "whereClause")
+	Attribute("specialist", Integer, "The specialist on the billsheet", func() {
+		Metadata("struct:tag:datastore", "specialist,noindex")
+		Metadata("struct:tag:json", "specialist")
+	})
+	Attribute("consumer", Integer, "The consumer on the billsheet", func() {
+		Metadata("struct:tag:datastore", "consumer,noindex")
+		Metadata("struct:tag:json", "consumer")
+	})
+	Attribute("county", Integer, "The county of the consumer", func() {
+		Metadata("struct:tag:datastore", "county,noindex")
+		Metadata("struct:tag:json", "county")
+	})
+	Attribute("fundingSource", Integer, "The funding source of the consumer", func() {
+		Metadata("struct:tag:datastore", "fundingSource,noindex")
+		Metadata("struct:tag:json", "fundingSource")
 	})
+	Attribute("dia", Integer, "The DIA of the consumer", func() {
+		Metadata("struct:tag:datastore", "dia,noindex")
+		Metadata("struct:tag:json", "dia")
+	})
+	Attribute("bsu", String, "The BSU of the consumer", func() {
+		Metadata("struct:tag:datastore", "bsu,noindex")
+		Metadata("struct:tag:json", "bsu")
+	})
+	Attribute("serviceDateFrom", String, "The earliest service date (MM/DD/YY)", func() {
+		Metadata("struct:tag:datastore", "serviceDateFrom,noindex")
+		Metadata("struct:tag:json", "serviceDateFrom")
+	})
+	Attribute("serviceDateTo", String, "The latest service date (MM/DD/YY)", func() {
+		Metadata("struct:tag:datastore", "serviceDateTo,noindex")
+		Metadata("struct:tag:json", "serviceDateTo")
+	})
+	Attribute("statuses", ArrayOf(Integer), "Any of these billing statuses", func() {
+		Metadata("struct:tag:datastore", "statuses,noindex")
+		Metadata("struct:tag:json", "statuses")
+	})
+	Attribute("states", ArrayOf(String, func() {
+		Enum("draft", "submitted", "approved", "rejected", "billed", "paid", "denied", "void")
+	}), "Any of these workflow states", func() {
+		Metadata("struct:tag:datastore", "states,noindex")
+		Metadata("struct:tag:json", "states")
+	})
+	Attribute("minAmount", Number, "The smallest billed amount", func() {
+		Metadata("struct:tag:datastore", "minAmount,noindex")
+		Metadata("struct:tag:json", "minAmount")
+	})
+	Attribute("maxAmount", Number, "The largest billed amount", func() {
+		Metadata("struct:tag:datastore", "maxAmount,noindex")
+		Metadata("struct:tag:json", "maxAmount")
+	})
+})
+
+var BillSheetTransitionPayload = Type("BillSheetTransitionPayload", func() {
+	Description("BillSheet Transition Description.")
+
+	Attribute("ids", ArrayOf(Integer), "BillSheet ids", func() {
+		Metadata("struct:tag:datastore", "ids,noindex")
+		Metadata("struct:tag:json", "ids")
+	})
+	Attribute("state", String, "The new workflow state", func() {
+		Enum("draft", "submitted", "approved", "rejected", "billed", "paid", "denied", "void")
+		Metadata("struct:tag:datastore", "state,noindex")
+		Metadata("struct:tag:json", "state")
+	})
+	Attribute("comment", String, "Transition comment", func() {
+		Metadata("struct:tag:datastore", "comment,noindex")
+		Metadata("struct:tag:json", "comment")
+	})
+
+	Required("ids", "state")
+})
+
+var BillSheetReviewPayload = Type("BillSheetReviewPayload", func() {
+	Description("BillSheet Review Description.")
+
+	Attribute("ids", ArrayOf(Integer), "BillSheet ids", func() {
+		Metadata("struct:tag:datastore", "ids,noindex")
+		Metadata("struct:tag:json", "ids")
+	})
+	Attribute("comment", String, "Review comment", func() {
+		Metadata("struct:tag:datastore", "comment,noindex")
+		Metadata("struct:tag:json", "comment")
+	})
+
+	Required("ids")
+})
+
+var BillSheetBulkPayload = Type("BillSheetBulkPayload", func() {
+	Description("BillSheet Bulk Description.")
+
+	Attribute("ids", ArrayOf(Integer), "BillSheet ids, takes precedence over the filter", func() {
+		Metadata("struct:tag:datastore", "ids,noindex")
+		Metadata("struct:tag:json", "ids")
+	})
+	Attribute("filter", BillSheetQueryPayload, "Selects the billsheets when there are no ids", func() {
+		Metadata("struct:tag:datastore", "filter,noindex")
+		Metadata("struct:tag:json", "filter")
+	})
+	Attribute("patch", BillSheetPatch)
+
+	Required("patch")
+})
+
+var BillSheetPatch = Type("BillSheetPatch", func() {
+	Description("The fields to change, anything not given is left alone.")
+
+	Attribute("status", Integer, "BillSheet status", func() {
+		Metadata("struct:tag:datastore", "status,noindex")
+		Metadata("struct:tag:json", "status")
+	})
+	Attribute("confirmation", String, "BillSheet confirmation", func() {
+		Metadata("struct:tag:datastore", "confirmation,noindex")
+		Metadata("struct:tag:json", "confirmation")
+	})
+	Attribute("state", String, "The new workflow state", func() {
+		Enum("draft", "submitted", "approved", "rejected", "billed", "paid", "denied", "void")
+		Metadata("struct:tag:datastore", "state,noindex")
+		Metadata("struct:tag:json", "state")
+	})
+	Attribute("comment", String, "Transition comment", func() {
+		Metadata("struct:tag:datastore", "comment,noindex")
+		Metadata("struct:tag:json", "comment")
+	})
+})
+
+var TransitionResultItem = Type("transitionResultItem", func() {
+	Attribute("id", Integer, "BillSheet id", func() {
+		Metadata("struct:tag:datastore", "id,noindex")
+		Metadata("struct:tag:json", "id")
+	})
+	Attribute("state", String, "The workflow state of the billsheet after the transition", func() {
+		Metadata("struct:tag:datastore", "state,noindex")
+		Metadata("struct:tag:json", "state")
+	})
+	Attribute("error", String, "Why the transition failed, if it did", func() {
+		Metadata("struct:tag:datastore", "error,noindex")
+		Metadata("struct:tag:json", "error")
+	})
+
+	Required("id")
 })
 
 var BillSheetItem = Type("billSheetItem", func() {
@@ -138,6 +366,9 @@ var BillSheetItem = Type("billSheetItem", func() {
 	Attribute("billedAmount")
 	Attribute("confirmation")
 	Attribute("description")
+	Attribute("notes", ArrayOf("noteItem"))
+	Attribute("state", String, "BillSheet workflow state")
+	Attribute("version")
 
 	Required("id", "specialist", "consumer", "serviceDate", "serviceCode")
 })
@@ -160,6 +391,9 @@ var BillSheetMedia = MediaType("application/billsheetapi.billsheetentity", func(
 		Attribute("billedAmount")
 		Attribute("confirmation")
 		Attribute("description")
+		Attribute("notes", ArrayOf("noteItem"))
+		Attribute("state", String, "BillSheet workflow state")
+		Attribute("version")
 		Attribute("billsheets", ArrayOf("billSheetItem"))
 		Attribute("pager", Pager)
 
@@ -178,6 +412,9 @@ var BillSheetMedia = MediaType("application/billsheetapi.billsheetentity", func(
 		Attribute("billedAmount")
 		Attribute("confirmation")
 		Attribute("description")
+		Attribute("notes")
+		Attribute("state")
+		Attribute("version")
 	})
 
 	View("paging", func() {
@@ -0,0 +1,184 @@
+package design
+
+import (
+	. "github.com/goadesign/goa/design"
+	. "github.com/goadesign/goa/design/apidsl"
+)
+
+var _ = Resource("Caseload", func() {
+	BasePath("/caseload")
+	// Seems that goa doesn't like setting DefaultMedia here at the top-level when the MediaType has multiple Views.
+	//	DefaultMedia(CaseloadMedia)
+	Description("Describes a specialist's caseload assignment.")
+
+	Action("create", func() {
+		Routing(POST("/"))
+		Description("Assign a consumer to a specialist.")
+		Payload(CaseloadPayload)
+		Response(OK, CaseloadMedia)
+	})
+
+	Action("update", func() {
+		Routing(PUT("/:id"))
+		Payload(CaseloadPayload)
+		Params(func() {
+			Param("id", Integer, "Caseload ID")
+		})
+		Description("Update a caseload assignment by id.")
+		Response(OK, CaseloadMedia)
+	})
+
+	Action("patch", func() {
+		Routing(PATCH("/:id"))
+		Payload(CaseloadPatchPayload)
+		Params(func() {
+			Param("id", Integer, "Caseload ID")
+		})
+		Description("Update only the given fields of a caseload by id.")
+		Response(OK, CaseloadMedia)
+	})
+
+	Action("delete", func() {
+		Routing(DELETE("/:id"))
+		Params(func() {
+			Param("id", Integer, "Caseload ID")
+		})
+		Description("Delete a caseload assignment by id.")
+		Response(OK, func() {
+			Status(200)
+			Media(CaseloadMedia, "tiny")
+		})
+	})
+
+	Action("list", func() {
+		Routing(GET("/list"))
+		Description("Get all caseload assignments")
+		Response(OK, ArrayOf("caseloadItem"))
+	})
+
+	Action("page", func() {
+		Routing(POST("/list/:page"))
+		Params(func() {
+			Param("page", Integer, "Given a page number, returns an object consisting of the slice of caseload assignments and a pager object")
+			PageParams()
+		})
+		Description("Get a page of caseload assignments that may be filtered")
+		Payload(CaseloadQueryPayload)
+		Response(OK, func() {
+			Status(200)
+			Media(CaseloadMedia, "paging")
+		})
+	})
+})
+
+var CaseloadPayload = Type("CaseloadPayload", func() {
+	Description("Caseload Description.")
+
+	Attribute("id", Integer, "ID", func() {
+		Metadata("struct:tag:datastore", "id,noindex")
+		Metadata("struct:tag:json", "id")
+	})
+	Attribute("specialist", Integer, "Caseload specialist", func() {
+		Metadata("struct:tag:datastore", "specialist,noindex")
+		Metadata("struct:tag:json", "specialist")
+	})
+	Attribute("consumer", Integer, "Caseload consumer", func() {
+		Metadata("struct:tag:datastore", "consumer,noindex")
+		Metadata("struct:tag:json", "consumer")
+	})
+	Attribute("startDate", String, "Caseload startDate (MM/DD/YY)", func() {
+		Metadata("struct:tag:datastore", "startDate,noindex")
+		Metadata("struct:tag:json", "startDate")
+	})
+	Attribute("endDate", String, "Caseload endDate (MM/DD/YY), open-ended when empty", func() {
+		Metadata("struct:tag:datastore", "endDate,noindex")
+		Metadata("struct:tag:json", "endDate")
+	})
+	Attribute("isPrimary", Boolean, "Is this the consumer's primary specialist?", func() {
+		Metadata("struct:tag:datastore", "isPrimary,noindex")
+		Metadata("struct:tag:json", "isPrimary")
+	})
+
+	Required("specialist", "consumer", "startDate", "isPrimary")
+})
+
+var CaseloadPatchPayload = Type("CaseloadPatchPayload", func() {
+	Description("Caseload Patch Description, anything not given is left alone.")
+	Reference(CaseloadPayload)
+
+	Attribute("id")
+	Attribute("specialist")
+	Attribute("consumer")
+	Attribute("startDate")
+	Attribute("endDate")
+	Attribute("isPrimary")
+})
+
+var CaseloadQueryPayload = Type("CaseloadQueryPayload", func() {
+	Description("Caseload Query Description.  Every filter that's given has to match.")
+
+	Attribute("specialist", Integer, "The specialist of the assignment", func() {
+		Metadata("struct:tag:datastore", "specialist,noindex")
+		Metadata("struct:tag:json", "specialist")
+	})
+	Attribute("consumer", Integer, "The consumer of the assignment", func() {
+		Metadata("struct:tag:datastore", "consumer,noindex")
+		Metadata("struct:tag:json", "consumer")
+	})
+	Attribute("current", Boolean, "Only the assignments that are current today", func() {
+		Metadata("struct:tag:datastore", "current,noindex")
+		Metadata("struct:tag:json", "current")
+	})
+})
+
+var CaseloadItem = Type("caseloadItem", func() {
+	Reference(CaseloadPayload)
+
+	Attribute("id")
+	Attribute("specialist")
+	Attribute("consumer")
+	Attribute("startDate")
+	Attribute("endDate")
+	Attribute("isPrimary")
+
+	Required("id", "specialist", "consumer", "startDate", "isPrimary")
+})
+
+var CaseloadMedia = MediaType("application/caseloadapi.caseloadentity", func() {
+	Description("Caseload response")
+	TypeName("CaseloadMedia")
+	ContentType("application/json")
+	Reference(CaseloadPayload)
+
+	Attributes(func() {
+		Attribute("id")
+		Attribute("specialist")
+		Attribute("consumer")
+		Attribute("startDate")
+		Attribute("endDate")
+		Attribute("isPrimary")
+		Attribute("caseloads", ArrayOf("caseloadItem"))
+		Attribute("pager", Pager)
+
+		Required("id", "specialist", "consumer", "startDate", "isPrimary")
+	})
+
+	View("default", func() {
+		Attribute("id")
+		Attribute("specialist")
+		Attribute("consumer")
+		Attribute("startDate")
+		Attribute("endDate")
+		Attribute("isPrimary")
+	})
+
+	View("paging", func() {
+		Attribute("caseloads")
+		Attribute("pager")
+	})
+
+	View("tiny", func() {
+		Description("`tiny` is the view used to create new caseload assignments.")
+		Attribute("id")
+	})
+})
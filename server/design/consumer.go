@@ -21,14 +21,41 @@ var _ = Resource("Consumer", func() {
 		})
 	})
 
+	Action("show", func() {
+		Routing(GET("/:id"))
+		Params(func() {
+			Param("id", Integer, "Consumer ID")
+		})
+		Description("Get a consumer by id.  The ETag is the version of the consumer.")
+		Response(OK, ConsumerMedia)
+	})
+
 	Action("update", func() {
 		Routing(PUT("/:id"))
 		Payload(ConsumerPayload)
 		Params(func() {
 			Param("id", Integer, "Consumer ID")
 		})
+		Headers(func() {
+			Header("If-Match", String, "The ETag of the consumer that was read")
+		})
 		Description("Update a consumer by id.")
 		Response(OK, ConsumerMedia)
+		Response(PreconditionFailed, ConsumerMedia)
+	})
+
+	Action("patch", func() {
+		Routing(PATCH("/:id"))
+		Payload(ConsumerPatchPayload)
+		Params(func() {
+			Param("id", Integer, "Consumer ID")
+		})
+		Headers(func() {
+			Header("If-Match", String, "The ETag of the consumer that was read")
+		})
+		Description("Update only the given fields of a consumer by id.")
+		Response(OK, ConsumerMedia)
+		Response(PreconditionFailed, ConsumerMedia)
 	})
 
 	Action("delete", func() {
@@ -45,6 +72,9 @@ var _ = Resource("Consumer", func() {
 
 	Action("list", func() {
 		Routing(GET("/list"))
+		Params(func() {
+			Param("mine", Boolean, "Only list the consumers currently assigned to the specialist that is logged in")
+		})
 		Description("Get all consumers")
 		Response(OK, ArrayOf("consumerItem"))
 	})
@@ -53,6 +83,7 @@ var _ = Resource("Consumer", func() {
 		Routing(POST("/list/:page"))
 		Params(func() {
 			Param("page", Integer, "Given a page number, returns an object consisting of the slice of consumers and a pager object")
+			PageParams()
 		})
 		Description("Get a page of consumers that may be filtered")
 		Payload(ConsumerQueryPayload)
@@ -61,6 +92,19 @@ var _ = Resource("Consumer", func() {
 			Media(ConsumerMedia, "paging")
 		})
 	})
+
+	Action("export", func() {
+		Routing(POST("/export"))
+		Params(func() {
+			Param("format", String, "The format of the spreadsheet", func() {
+				Enum("csv", "xlsx")
+				Default("csv")
+			})
+		})
+		Description("Export every consumer that matches the filter and can be seen, not just one page, as a spreadsheet")
+		Payload(ConsumerQueryPayload)
+		Response(OK)
+	})
 })
 
 var ConsumerPayload = Type("ConsumerPayload", func() {
@@ -107,16 +151,46 @@ var ConsumerPayload = Type("ConsumerPayload", func() {
 		Metadata("struct:tag:datastore", "other,noindex")
 		Metadata("struct:tag:json", "other")
 	})
+	Attribute("version", Integer, "The version that was read, a stale version is refused", func() {
+		Metadata("struct:tag:datastore", "version,noindex")
+		Metadata("struct:tag:json", "version")
+	})
 
 	Required("firstname", "lastname", "active", "county", "serviceCodes", "fundingSource", "bsu", "recipientID", "dia", "other")
 })
 
+var ConsumerPatchPayload = Type("ConsumerPatchPayload", func() {
+	Description("Consumer Patch Description, anything not given is left alone.")
+	Reference(ConsumerPayload)
+
+	Attribute("id")
+	Attribute("firstname")
+	Attribute("lastname")
+	Attribute("active")
+	Attribute("county")
+	Attribute("serviceCodes")
+	Attribute("fundingSource")
+	Attribute("bsu")
+	Attribute("recipientID")
+	Attribute("dia")
+	Attribute("other")
+	Attribute("version")
+})
+
 var ConsumerQueryPayload = Type("ConsumerQueryPayload", func() {
-	Description("Consumer Query Description.")
+	Description("Consumer Query Description.  Every filter that's given has to match.")
 
-	Attribute("whereClause", String, "where clause", func() {
-		Metadata("struct:tag:datastore", "whereClause,noindex")
-		Metadata("struct:tag:json", "whereClause")
+	Attribute("active", Boolean, "Only the active (or inactive) consumers", func() {
+		Metadata("struct:tag:datastore", "active,noindex")
+		Metadata("struct:tag:json", "active")
+	})
+	Attribute("lastname", String, "Only the last names that contain this", func() {
+		Metadata("struct:tag:datastore", "lastname,noindex")
+		Metadata("struct:tag:json", "lastname")
+	})
+	Attribute("firstname", String, "Only the first names that contain this", func() {
+		Metadata("struct:tag:datastore", "firstname,noindex")
+		Metadata("struct:tag:json", "firstname")
 	})
 })
 
@@ -134,6 +208,7 @@ var ConsumerItem = Type("consumerItem", func() {
 	Attribute("recipientID")
 	Attribute("dia")
 	Attribute("other")
+	Attribute("version")
 
 	Required("id", "firstname", "lastname", "active", "county", "serviceCodes", "fundingSource", "bsu", "recipientID", "dia", "other")
 })
@@ -174,6 +249,7 @@ var ConsumerMedia = MediaType("application/consumerapi.consumerentity", func() {
 		Attribute("recipientID")
 		Attribute("dia")
 		Attribute("other")
+		Attribute("version")
 		Attribute("consumers", ArrayOf("consumerItem"))
 		Attribute("pager", Pager)
 
@@ -192,6 +268,7 @@ var ConsumerMedia = MediaType("application/consumerapi.consumerentity", func() {
 		Attribute("recipientID")
 		Attribute("dia")
 		Attribute("other")
+		Attribute("version")
 	})
 
 	View("paging", func() {
@@ -63,6 +63,7 @@ var _ = Resource("County", func() {
 		Routing(GET("/list/:page"))
 		Params(func() {
 			Param("page", Integer, "Given a page number, returns an object consisting of the slice of counties and a pager object")
+			PageParams()
 		})
 		Description("Get a page of counties")
 		Response(OK, func() {
@@ -50,6 +50,7 @@ var _ = Resource("DIA", func() {
 		Routing(GET("/list/:page"))
 		Params(func() {
 			Param("page", Integer, "Given a page number, returns an object consisting of the slice of DIAs and a pager object")
+			PageParams()
 		})
 		Description("Get a page of DIAs")
 		Response(OK, func() {
@@ -50,6 +50,7 @@ var _ = Resource("FundingSource", func() {
 		Routing(GET("/list/:page"))
 		Params(func() {
 			Param("page", Integer, "Given a page number, returns an object consisting of the slice of FundingSources and a pager object")
+			PageParams()
 		})
 		Description("Get a page of FundingSources")
 		Response(OK, func() {
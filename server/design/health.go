@@ -0,0 +1,77 @@
+package design
+
+import (
+	. "github.com/goadesign/goa/design"
+	. "github.com/goadesign/goa/design/apidsl"
+)
+
+// The probes are at the root rather than under the API's base path, since that's where the load balancer
+// and the deploy look for them.  They don't need a session.
+var _ = Resource("Health", func() {
+	Description("Tells whether the service is up and which build it is.")
+
+	Action("healthz", func() {
+		Routing(GET("//healthz"))
+		Description("The service is alive.")
+		Response(OK, HealthMedia)
+	})
+
+	Action("readyz", func() {
+		Routing(GET("//readyz"))
+		Description("The database can be reached and its schema is up to date.")
+		Response(OK, HealthMedia)
+		Response(ServiceUnavailable, HealthMedia)
+	})
+
+	Action("version", func() {
+		Routing(GET("//version"))
+		Description("The build that's deployed.")
+		Response(OK, VersionMedia)
+	})
+})
+
+var HealthMedia = MediaType("application/healthapi.healthentity", func() {
+	Description("Health response")
+	TypeName("HealthMedia")
+	ContentType("application/json")
+
+	Attributes(func() {
+		Attribute("status", String, "ok, or unavailable when it isn't ready", func() {
+			Enum("ok", "unavailable")
+		})
+		Attribute("schemaVersion", Integer, "The version of the schema that's been applied")
+		Attribute("expectedSchemaVersion", Integer, "The version of the schema that this build needs")
+		Attribute("error", String, "Why it isn't ready")
+
+		Required("status")
+	})
+
+	View("default", func() {
+		Attribute("status")
+		Attribute("schemaVersion")
+		Attribute("expectedSchemaVersion")
+		Attribute("error")
+	})
+})
+
+var VersionMedia = MediaType("application/versionapi.versionentity", func() {
+	Description("Version response")
+	TypeName("VersionMedia")
+	ContentType("application/json")
+
+	Attributes(func() {
+		Attribute("gitSHA", String, "The commit that was built")
+		Attribute("buildTime", String, "When it was built (UTC)")
+		Attribute("goaVersion", String, "The version of goa")
+		Attribute("goVersion", String, "The version of Go")
+
+		Required("gitSHA", "buildTime", "goaVersion", "goVersion")
+	})
+
+	View("default", func() {
+		Attribute("gitSHA")
+		Attribute("buildTime")
+		Attribute("goaVersion")
+		Attribute("goVersion")
+	})
+})
@@ -0,0 +1,88 @@
+package design
+
+import (
+	. "github.com/goadesign/goa/design"
+	. "github.com/goadesign/goa/design/apidsl"
+)
+
+var _ = Resource("Import", func() {
+	BasePath("/import")
+	DefaultMedia(ImportMedia)
+	Description("Imports consumers, unit blocks and billsheets from a spreadsheet.")
+
+	Action("consumers", func() {
+		Routing(POST("/consumers"))
+		Description("Import consumers.  The columns are firstname, lastname, active, county, fundingSource, bsu, recipientID, dia and other.")
+		Payload(ImportPayload)
+		Response(OK)
+	})
+
+	Action("unitBlocks", func() {
+		Routing(POST("/unitblocks"))
+		Description("Import unit blocks.  The columns are consumer (lastname, firstname), serviceCode and units.")
+		Payload(ImportPayload)
+		Response(OK)
+	})
+
+	Action("billsheets", func() {
+		Routing(POST("/billsheets"))
+		Description("Import billsheets.  The columns are specialist (username), consumer (lastname, firstname), units, serviceDate, serviceCode, status, confirmation and description.  Any other column is a note field.")
+		Payload(ImportPayload)
+		Response(OK)
+	})
+})
+
+var ImportPayload = Type("ImportPayload", func() {
+	Description("Import Description.")
+
+	Attribute("data", String, "The CSV file, the first row is the header", func() {
+		Metadata("struct:tag:datastore", "data,noindex")
+		Metadata("struct:tag:json", "data")
+	})
+	Attribute("dryRun", Boolean, "Only report the errors, nothing is written", func() {
+		Default(false)
+		Metadata("struct:tag:datastore", "dryRun,noindex")
+		Metadata("struct:tag:json", "dryRun")
+	})
+
+	Required("data")
+})
+
+var ImportRowItem = Type("importRowItem", func() {
+	Attribute("row", Integer, "The row of the file, counting the header as row 1", func() {
+		Metadata("struct:tag:datastore", "row,noindex")
+		Metadata("struct:tag:json", "row")
+	})
+	Attribute("id", Integer, "The id of the new record, if it was written", func() {
+		Metadata("struct:tag:datastore", "id,noindex")
+		Metadata("struct:tag:json", "id")
+	})
+	Attribute("error", String, "Why the row can't be imported, if it can't", func() {
+		Metadata("struct:tag:datastore", "error,noindex")
+		Metadata("struct:tag:json", "error")
+	})
+
+	Required("row")
+})
+
+var ImportMedia = MediaType("application/importapi.importentity", func() {
+	Description("Import response")
+	TypeName("ImportMedia")
+	ContentType("application/json")
+
+	Attributes(func() {
+		Attribute("dryRun", Boolean, "Was anything written?")
+		Attribute("imported", Integer, "How many rows were written")
+		Attribute("failed", Integer, "How many rows have errors")
+		Attribute("rows", ArrayOf("importRowItem"))
+
+		Required("dryRun", "imported", "failed", "rows")
+	})
+
+	View("default", func() {
+		Attribute("dryRun")
+		Attribute("imported")
+		Attribute("failed")
+		Attribute("rows")
+	})
+})
@@ -0,0 +1,95 @@
+package design
+
+import (
+	. "github.com/goadesign/goa/design"
+	. "github.com/goadesign/goa/design/apidsl"
+)
+
+var _ = Resource("Job", func() {
+	BasePath("/job")
+	// Seems that goa doesn't like setting DefaultMedia here at the top-level when the MediaType has multiple Views.
+	//	DefaultMedia(JobRunMedia)
+	Description("Describes the scheduled jobs and their runs.  Only an admin can see or trigger them.")
+
+	Action("list", func() {
+		Routing(GET("/list"))
+		Description("Get all jobs and when they'll next run")
+		Response(OK, ArrayOf("jobItem"))
+	})
+
+	Action("trigger", func() {
+		Routing(POST("/:name/trigger"))
+		Params(func() {
+			Param("name", String, "Job name")
+		})
+		Description("Run a job now.  The run is returned right away, use `show` to see when it's done.")
+		Response(OK, JobRunMedia)
+		Response(NotFound)
+	})
+
+	Action("runs", func() {
+		Routing(GET("/:name/runs"))
+		Params(func() {
+			Param("name", String, "Job name")
+			Param("limit", Integer, "How many of the most recent runs", func() {
+				Default(20)
+				Minimum(1)
+				Maximum(500)
+			})
+		})
+		Description("Get the most recent runs of a job")
+		Response(OK, CollectionOf(JobRunMedia))
+	})
+
+	Action("show", func() {
+		Routing(GET("/run/:id"))
+		Params(func() {
+			Param("id", Integer, "Job run ID")
+		})
+		Description("Get a job run by id.")
+		Response(OK, JobRunMedia)
+	})
+})
+
+var JobItem = Type("jobItem", func() {
+	Attribute("name", String, "Job name")
+	Attribute("description", String, "What the job does")
+	Attribute("schedule", String, "When the job runs (cron)")
+	Attribute("nextRun", Integer, "When the job will next run (unix time)")
+
+	Required("name", "description", "schedule", "nextRun")
+})
+
+var JobRunMedia = MediaType("application/jobapi.jobrunentity", func() {
+	Description("Job run response")
+	TypeName("JobRunMedia")
+	ContentType("application/json")
+
+	Attributes(func() {
+		Attribute("id", Integer, "Job run ID")
+		Attribute("job", String, "Job name")
+		Attribute("trigger", String, "What started the run", func() {
+			Enum("schedule", "manual")
+		})
+		Attribute("status", String, "Job run status", func() {
+			Enum("running", "succeeded", "failed")
+		})
+		Attribute("instance", String, "The server instance that ran the job")
+		Attribute("startTime", Integer, "When the run started (unix time)")
+		Attribute("endTime", Integer, "When the run ended (unix time), 0 while it's running")
+		Attribute("output", String, "What the job reported, or why it failed")
+
+		Required("id", "job", "trigger", "status", "instance", "startTime", "endTime", "output")
+	})
+
+	View("default", func() {
+		Attribute("id")
+		Attribute("job")
+		Attribute("trigger")
+		Attribute("status")
+		Attribute("instance")
+		Attribute("startTime")
+		Attribute("endTime")
+		Attribute("output")
+	})
+})
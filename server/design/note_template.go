@@ -0,0 +1,118 @@
+package design
+
+import (
+	. "github.com/goadesign/goa/design"
+	. "github.com/goadesign/goa/design/apidsl"
+)
+
+var _ = Resource("NoteTemplate", func() {
+	BasePath("/notetemplate")
+	Description("Describes the progress note fields that a service code requires.")
+
+	Action("show", func() {
+		Routing(GET("/:id"))
+		Params(func() {
+			Param("id", Integer, "Service Code ID")
+		})
+		Description("Get the note template by service code id.")
+		Response(OK, CollectionOf(NoteFieldMedia))
+	})
+
+	Action("update", func() {
+		Routing(PUT("/:id"))
+		Payload(NoteTemplatePayload)
+		Params(func() {
+			Param("id", Integer, "Service Code ID")
+		})
+		Description("Update the note template by service code id.")
+		Response(OK, CollectionOf(NoteFieldMedia))
+	})
+
+	Action("delete", func() {
+		Routing(DELETE("/:id"))
+		Params(func() {
+			Param("id", Integer, "Service Code ID")
+		})
+		Description("Delete the note template by service code id.")
+		Response(OK, func() {
+			Status(200)
+			Media(NoteFieldMedia, "tiny")
+		})
+	})
+})
+
+var NoteTemplatePayload = Type("NoteTemplatePayload", func() {
+	Description("NoteTemplate Description.")
+
+	Attribute("serviceCode", Integer, "NoteTemplate serviceCode", func() {
+		Metadata("struct:tag:datastore", "serviceCode,noindex")
+		Metadata("struct:tag:json", "serviceCode")
+	})
+	Attribute("fields", ArrayOf("noteFieldItem"))
+
+	Required("serviceCode", "fields")
+})
+
+var NoteFieldItem = Type("noteFieldItem", func() {
+	Attribute("id", Integer, "NoteField id", func() {
+		Metadata("struct:tag:datastore", "id,noindex")
+		Metadata("struct:tag:json", "id")
+	})
+	Attribute("name", String, "NoteField name (the key used in a billsheet's notes)", func() {
+		Metadata("struct:tag:datastore", "name,noindex")
+		Metadata("struct:tag:json", "name")
+	})
+	Attribute("label", String, "NoteField label", func() {
+		Metadata("struct:tag:datastore", "label,noindex")
+		Metadata("struct:tag:json", "label")
+	})
+	Attribute("required", Boolean, "Must a billsheet for this service code fill in this field?", func() {
+		Metadata("struct:tag:datastore", "required,noindex")
+		Metadata("struct:tag:json", "required")
+	})
+
+	Required("id", "name", "label", "required")
+})
+
+var NoteItem = Type("noteItem", func() {
+	Attribute("field", String, "The name of the note template field", func() {
+		Metadata("struct:tag:datastore", "field,noindex")
+		Metadata("struct:tag:json", "field")
+	})
+	Attribute("value", String, "Note value", func() {
+		Metadata("struct:tag:datastore", "value,noindex")
+		Metadata("struct:tag:json", "value")
+	})
+
+	Required("field", "value")
+})
+
+var NoteFieldMedia = MediaType("application/notefieldapi.notefieldentity", func() {
+	Description("NoteField response")
+	TypeName("NoteFieldMedia")
+	ContentType("application/json")
+	Reference(NoteFieldItem)
+
+	Attributes(func() {
+		Attribute("id")
+		Attribute("serviceCode", Integer)
+		Attribute("name")
+		Attribute("label")
+		Attribute("required")
+
+		Required("id", "serviceCode", "name", "label", "required")
+	})
+
+	View("default", func() {
+		Attribute("id")
+		Attribute("serviceCode")
+		Attribute("name")
+		Attribute("label")
+		Attribute("required")
+	})
+
+	View("tiny", func() {
+		Description("`tiny` is the view used when deleting a note template.")
+		Attribute("serviceCode")
+	})
+})
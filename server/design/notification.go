@@ -0,0 +1,67 @@
+package design
+
+import (
+	. "github.com/goadesign/goa/design"
+	. "github.com/goadesign/goa/design/apidsl"
+)
+
+var _ = Resource("Notification", func() {
+	BasePath("/notification")
+	DefaultMedia(NotificationMedia)
+	Description("Describes which emails a specialist has opted out of.")
+
+	Action("show", func() {
+		Routing(GET("/:id"))
+		Params(func() {
+			Param("id", Integer, "Specialist ID")
+		})
+		Description("Get the notification preferences of a specialist.")
+		Response(OK, NotificationMedia)
+	})
+
+	Action("update", func() {
+		Routing(PUT("/:id"))
+		Payload(NotificationPayload)
+		Params(func() {
+			Param("id", Integer, "Specialist ID")
+		})
+		Description("Replace the notification preferences of a specialist.  Password reset emails are always sent.")
+		Response(OK, NotificationMedia)
+	})
+})
+
+var NotificationPayload = Type("NotificationPayload", func() {
+	Description("Notification Description.")
+
+	Attribute("specialist", Integer, "Specialist ID", func() {
+		Metadata("struct:tag:datastore", "specialist,noindex")
+		Metadata("struct:tag:json", "specialist")
+	})
+	Attribute("optOut", ArrayOf(String, func() {
+		Enum("lowUnitBlock", "rejectedBillSheet", "timesheetReminder")
+	}), "The kinds of emails that aren't sent", func() {
+		Metadata("struct:tag:datastore", "optOut,noindex")
+		Metadata("struct:tag:json", "optOut")
+	})
+
+	Required("specialist", "optOut")
+})
+
+var NotificationMedia = MediaType("application/notificationapi.notificationentity", func() {
+	Description("Notification response")
+	TypeName("NotificationMedia")
+	ContentType("application/json")
+	Reference(NotificationPayload)
+
+	Attributes(func() {
+		Attribute("specialist")
+		Attribute("optOut")
+
+		Required("specialist", "optOut")
+	})
+
+	View("default", func() {
+		Attribute("specialist")
+		Attribute("optOut")
+	})
+})
@@ -10,6 +10,22 @@ var Pager = Type("pager", func() {
 	Attribute("recordsPerPage", Integer)
 	Attribute("totalCount", Integer)
 	Attribute("totalPages", Integer)
+	Attribute("sort", String, "The sort that was used")
+	Attribute("fields", ArrayOf(String), "The fields of each record that were sent, all of them when empty")
 
 	Required("currentPage", "recordsPerPage", "totalCount", "totalPages")
 })
+
+// The query string of every page action, used inside of its Params.
+func PageParams() {
+	SortParam()
+	Param("perPage", Integer, "The number of records on a page", func() {
+		Minimum(1)
+		Maximum(500)
+	})
+	Param("fields", String, "The fields of each record to send back separated by commas, all of them when not given")
+}
+
+func SortParam() {
+	Param("sort", String, "The keys to sort by separated by commas, each one descending when it starts with `-`")
+}
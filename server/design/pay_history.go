@@ -17,6 +17,19 @@ var _ = Resource("PayHistory", func() {
 		Response(OK, CollectionOf(PayHistoryMedia))
 	})
 
+	Action("export", func() {
+		Routing(POST("/export"))
+		Params(func() {
+			Param("format", String, "The format of the spreadsheet", func() {
+				Enum("csv", "xlsx")
+				Default("csv")
+			})
+		})
+		Description("Export every pay history entry that matches the filter, not just one page, as a spreadsheet.  Only an admin can export them.")
+		Payload(PayHistoryQueryPayload)
+		Response(OK)
+	})
+
 	/*
 		Action("page", func() {
 			Routing(POST("/list/:page"))
@@ -56,6 +69,15 @@ var PayHistoryPayload = Type("PayHistoryPayload", func() {
 	Required("specialist", "changeDate", "payrate")
 })
 
+var PayHistoryQueryPayload = Type("PayHistoryQueryPayload", func() {
+	Description("PayHistory Query Description.")
+
+	Attribute("specialist", Integer, "Only the pay history of this specialist", func() {
+		Metadata("struct:tag:datastore", "specialist,noindex")
+		Metadata("struct:tag:json", "specialist")
+	})
+})
+
 /*
 var PayHistoryItem = Type("payhistoryItem", func() {
 	Reference(PayHistoryPayload)
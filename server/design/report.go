@@ -0,0 +1,97 @@
+package design
+
+import (
+	. "github.com/goadesign/goa/design"
+	. "github.com/goadesign/goa/design/apidsl"
+)
+
+var _ = Resource("Report", func() {
+	BasePath("/report")
+	Description("Aggregate reports over the billsheets.")
+
+	Action("billing", func() {
+		Routing(POST("/billing"))
+		Description("Get the units and the billed and paid amounts, grouped by any of consumer, serviceCode, county, fundingSource and month.")
+		Payload(ReportQueryPayload)
+		Response(OK, ArrayOf("billingReportItem"))
+	})
+
+	Action("productivity", func() {
+		Routing(POST("/productivity"))
+		Description("Get the hours worked by each specialist per week.")
+		Payload(ReportQueryPayload)
+		Response(OK, ArrayOf("productivityReportItem"))
+	})
+
+	Action("utilization", func() {
+		Routing(POST("/utilization"))
+		Description("Get the units used of each unit block against the units that were authorized.")
+		Payload(ReportQueryPayload)
+		Response(OK, ArrayOf("utilizationReportItem"))
+	})
+})
+
+var ReportQueryPayload = Type("ReportQueryPayload", func() {
+	Description("Report Query Description.")
+
+	Attribute("startDate", String, "The first service date of the report (MM/DD/YY)", func() {
+		Metadata("struct:tag:datastore", "startDate,noindex")
+		Metadata("struct:tag:json", "startDate")
+	})
+	Attribute("endDate", String, "The last service date of the report (MM/DD/YY)", func() {
+		Metadata("struct:tag:datastore", "endDate,noindex")
+		Metadata("struct:tag:json", "endDate")
+	})
+	Attribute("statuses", ArrayOf(Integer), "Only the billsheets with these billing statuses", func() {
+		Metadata("struct:tag:datastore", "statuses,noindex")
+		Metadata("struct:tag:json", "statuses")
+	})
+	Attribute("states", ArrayOf(String, func() {
+		Enum("draft", "submitted", "approved", "rejected", "billed", "paid", "denied", "void")
+	}), "Only the billsheets in these workflow states", func() {
+		Metadata("struct:tag:datastore", "states,noindex")
+		Metadata("struct:tag:json", "states")
+	})
+	Attribute("groupBy", ArrayOf(String, func() {
+		Enum("consumer", "serviceCode", "county", "fundingSource", "month")
+	}), "What to group the billing report by, in order", func() {
+		Metadata("struct:tag:datastore", "groupBy,noindex")
+		Metadata("struct:tag:json", "groupBy")
+	})
+
+	Required("startDate", "endDate")
+})
+
+var BillingReportItem = Type("billingReportItem", func() {
+	Attribute("consumer", String, "Consumer name, when grouped by consumer")
+	Attribute("serviceCode", String, "Service code name, when grouped by service code")
+	Attribute("county", String, "County name, when grouped by county")
+	Attribute("fundingSource", String, "Funding source name, when grouped by funding source")
+	Attribute("month", String, "Month of the service date (YYYY-MM), when grouped by month")
+	Attribute("billsheets", Integer, "How many billsheets")
+	Attribute("units", Number, "Total units")
+	Attribute("billedAmount", Number, "Total billed amount")
+	Attribute("paidAmount", Number, "Total billed amount of the billsheets that have been paid")
+
+	Required("billsheets", "units", "billedAmount", "paidAmount")
+})
+
+var ProductivityReportItem = Type("productivityReportItem", func() {
+	Attribute("specialist", String, "Specialist name")
+	Attribute("week", String, "The Monday of the week (MM/DD/YY)")
+	Attribute("units", Number, "Total units")
+	Attribute("hours", Number, "Total hours (4 units per hour)")
+
+	Required("specialist", "week", "units", "hours")
+})
+
+var UtilizationReportItem = Type("utilizationReportItem", func() {
+	Attribute("consumer", String, "Consumer name")
+	Attribute("serviceCode", String, "Service code name")
+	Attribute("authorizedUnits", Number, "The units that were authorized")
+	Attribute("usedUnits", Number, "The units used in the report's date range")
+	Attribute("remainingUnits", Number, "The units that are left in the unit block")
+	Attribute("utilization", Number, "The percentage of the authorized units used in the report's date range")
+
+	Required("consumer", "serviceCode", "authorizedUnits", "usedUnits", "remainingUnits", "utilization")
+})
@@ -0,0 +1,44 @@
+package design
+
+import (
+	. "github.com/goadesign/goa/design"
+	. "github.com/goadesign/goa/design/apidsl"
+)
+
+var _ = Resource("Search", func() {
+	BasePath("/search")
+	Description("Finds consumers, specialists and billsheets by what they're called, not by their ids.")
+
+	Action("search", func() {
+		Routing(GET("/"))
+		Params(func() {
+			Param("q", String, "What to look for.  Every word is matched as a prefix.", func() {
+				MinLength(2)
+			})
+			Param("types", ArrayOf(String, func() {
+				Enum("consumer", "specialist", "billsheet")
+			}), "Only look for these types, all of them when not given")
+			Param("limit", Integer, "The most results to return", func() {
+				Minimum(1)
+				Maximum(100)
+				Default(20)
+			})
+			Required("q")
+		})
+		Description("Search the consumer names, recipient ids and BSUs, the specialist names and emails and the billsheet descriptions and confirmations.  The best matches are first, and only the records that the authenticated specialist can see are returned.")
+		Response(OK, ArrayOf("searchResultItem"))
+		Response(Unauthorized)
+	})
+})
+
+var SearchResultItem = Type("searchResultItem", func() {
+	Attribute("type", String, "The type of the record", func() {
+		Enum("consumer", "specialist", "billsheet")
+	})
+	Attribute("id", Integer, "The id of the record")
+	Attribute("title", String, "What the record is called")
+	Attribute("detail", String, "What else matched")
+	Attribute("score", Number, "How well the record matched, higher is better")
+
+	Required("type", "id", "title", "score")
+})
@@ -28,6 +28,16 @@ var _ = Resource("ServiceCode", func() {
 		Response(OK, ServiceCodeMedia)
 	})
 
+	Action("patch", func() {
+		Routing(PATCH("/:id"))
+		Payload(ServiceCodePatchPayload)
+		Params(func() {
+			Param("id", Integer, "Service Code ID")
+		})
+		Description("Update only the given fields of a service code by id.")
+		Response(OK, ServiceCodeMedia)
+	})
+
 	Action("delete", func() {
 		Routing(DELETE("/:id"))
 		Params(func() {
@@ -70,6 +80,16 @@ var ServiceCodePayload = Type("ServiceCodePayload", func() {
 	Required("name", "unitRate", "description")
 })
 
+var ServiceCodePatchPayload = Type("ServiceCodePatchPayload", func() {
+	Description("ServiceCode Patch Description, anything not given is left alone.")
+	Reference(ServiceCodePayload)
+
+	Attribute("id")
+	Attribute("name")
+	Attribute("unitRate")
+	Attribute("description")
+})
+
 var ServiceCodeMedia = MediaType("application/servicecodeapi.servicecodeentity", func() {
 	Description("Service code response")
 	TypeName("ServiceCodeMedia")
@@ -16,19 +16,59 @@ var _ = Resource("Session", func() {
 		Description("Authenticate the user.")
 		Payload(SessionPayload)
 		Response(OK, SessionMedia)
+		Response(Accepted, SessionChallengeMedia)
+		Response(Unauthorized)
 	})
 
-	Action("hash", func() {
-		Routing(POST("/hash"))
-		Description("Hash the new password.")
-		Payload(SessionPayload)
-		Response(OK, func() {
-			Status(200)
-			Media(SessionMedia, "tiny")
-		})
+	Action("verify", func() {
+		Routing(POST("/verify"))
+		Description("The second step of authenticating, when `auth` has answered with a challenge.")
+		Payload(SessionVerifyPayload)
+		Response(OK, SessionMedia)
+		Response(Unauthorized)
+	})
+
+	Action("reset", func() {
+		Routing(POST("/reset"))
+		Description("Email a single-use link to reset the password.  The response is the same whether or not the username exists.")
+		Payload(SessionResetPayload)
+		Response(NoContent)
+	})
+
+	Action("password", func() {
+		Routing(POST("/password"))
+		Description("Set a new password with the token from a reset link.")
+		Payload(SessionPasswordPayload)
+		Response(NoContent)
 	})
 })
 
+var SessionResetPayload = Type("SessionResetPayload", func() {
+	Description("Session Reset Description.")
+
+	Attribute("username", String, "The username of the account to reset", func() {
+		Metadata("struct:tag:datastore", "username,noindex")
+		Metadata("struct:tag:json", "username")
+	})
+
+	Required("username")
+})
+
+var SessionPasswordPayload = Type("SessionPasswordPayload", func() {
+	Description("Session Password Description.")
+
+	Attribute("token", String, "The token from the reset link", func() {
+		Metadata("struct:tag:datastore", "token,noindex")
+		Metadata("struct:tag:json", "token")
+	})
+	Attribute("password", String, "The new password", func() {
+		Metadata("struct:tag:datastore", "password,noindex")
+		Metadata("struct:tag:json", "password")
+	})
+
+	Required("token", "password")
+})
+
 var SessionPayload = Type("SessionPayload", func() {
 	Description("Session Description.")
 
@@ -72,6 +112,41 @@ var SessionPayload = Type("SessionPayload", func() {
 	Required("password")
 })
 
+var SessionVerifyPayload = Type("SessionVerifyPayload", func() {
+	Description("Session Verify Description.")
+
+	Attribute("challenge", String, "The challenge from `auth`", func() {
+		Metadata("struct:tag:datastore", "challenge,noindex")
+		Metadata("struct:tag:json", "challenge")
+	})
+	Attribute("code", String, "A code from the authenticator app or a recovery code", func() {
+		Metadata("struct:tag:datastore", "code,noindex")
+		Metadata("struct:tag:json", "code")
+	})
+
+	Required("challenge", "code")
+})
+
+var SessionChallengeMedia = MediaType("application/sessionapi.sessionchallengeentity", func() {
+	Description("The password was right but a second factor is needed")
+	TypeName("SessionChallengeMedia")
+	ContentType("application/json")
+
+	Attributes(func() {
+		Attribute("specialist", Integer, "Specialist ID")
+		Attribute("challenge", String, "Give this back to `verify` along with the code")
+		Attribute("enroll", Boolean, "The specialist has to enroll in two-factor authentication before they can verify")
+
+		Required("specialist", "challenge", "enroll")
+	})
+
+	View("default", func() {
+		Attribute("specialist")
+		Attribute("challenge")
+		Attribute("enroll")
+	})
+})
+
 var SessionMedia = MediaType("application/sessionapi.sessionentity", func() {
 	Description("Session response")
 	TypeName("SessionMedia")
@@ -88,6 +163,7 @@ var SessionMedia = MediaType("application/sessionapi.sessionentity", func() {
 		Attribute("email")
 		Attribute("payrate", Number)
 		Attribute("authLevel", Integer)
+		Attribute("token", String, "Send as `Authorization: Bearer <token>` on every request of the session")
 
 		Required("id", "username", "password", "firstname", "lastname", "active", "email", "payrate", "authLevel")
 	})
@@ -102,10 +178,6 @@ var SessionMedia = MediaType("application/sessionapi.sessionentity", func() {
 		Attribute("email")
 		Attribute("payrate")
 		Attribute("authLevel")
-	})
-
-	View("tiny", func() {
-		Attribute("id")
-		Attribute("password")
+		Attribute("token")
 	})
 })
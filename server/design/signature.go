@@ -0,0 +1,98 @@
+package design
+
+import (
+	. "github.com/goadesign/goa/design"
+	. "github.com/goadesign/goa/design/apidsl"
+)
+
+var _ = Resource("Signature", func() {
+	BasePath("/signature")
+	// Seems that goa doesn't like setting DefaultMedia here at the top-level when the MediaType has multiple Views.
+	//	DefaultMedia(SignatureMedia)
+	Description("Describes a billsheet signature.")
+
+	Action("create", func() {
+		Routing(POST("/"))
+		Description("Sign a billsheet.")
+		Payload(SignaturePayload)
+		Response(OK, SignatureMedia)
+	})
+
+	Action("show", func() {
+		Routing(GET("/:id"))
+		Params(func() {
+			Param("id", Integer, "BillSheet ID")
+		})
+		Description("Get all signatures by billsheet id.")
+		Response(OK, CollectionOf(SignatureMedia))
+	})
+
+	Action("verify", func() {
+		Routing(GET("/verify/:id"))
+		Params(func() {
+			Param("id", Integer, "BillSheet ID")
+		})
+		Description("Check the integrity of all signatures by billsheet id against the current billsheet contents.")
+		Response(OK, CollectionOf(SignatureMedia))
+	})
+})
+
+var SignaturePayload = Type("SignaturePayload", func() {
+	Description("Signature Description.")
+
+	Attribute("billsheet", Integer, "Signature billsheet", func() {
+		Metadata("struct:tag:datastore", "billsheet,noindex")
+		Metadata("struct:tag:json", "billsheet")
+	})
+	Attribute("role", String, "Who is signing", func() {
+		Enum("specialist", "consumer")
+		Metadata("struct:tag:datastore", "role,noindex")
+		Metadata("struct:tag:json", "role")
+	})
+	Attribute("method", String, "How the signature was captured", func() {
+		Enum("image", "typed")
+		Metadata("struct:tag:datastore", "method,noindex")
+		Metadata("struct:tag:json", "method")
+	})
+	Attribute("data", String, "Signature data (a base64 encoded image or the typed name)", func() {
+		Metadata("struct:tag:datastore", "data,noindex")
+		Metadata("struct:tag:json", "data")
+	})
+
+	Required("billsheet", "role", "method", "data")
+})
+
+var SignatureMedia = MediaType("application/signatureapi.signatureentity", func() {
+	Description("Signature response")
+	TypeName("SignatureMedia")
+	ContentType("application/json")
+	Reference(SignaturePayload)
+
+	Attributes(func() {
+		Attribute("id", Integer)
+		Attribute("billsheet")
+		Attribute("role")
+		Attribute("signer", Integer, "Signature signer (the specialist that attested, none for a consumer)")
+		Attribute("signerName", String, "Signature signer name, taken from the specialist or consumer")
+		Attribute("method")
+		Attribute("data")
+		Attribute("signedAt", Integer, "Unix timestamp of the signing")
+		Attribute("contentHash", String, "SHA-256 hash of the billsheet contents at signing time")
+		Attribute("valid", Boolean, "False once the billsheet has been edited after signing")
+
+		Required("id", "billsheet", "role", "signerName", "method", "data", "signedAt", "contentHash", "valid")
+	})
+
+	View("default", func() {
+		Attribute("id")
+		Attribute("billsheet")
+		Attribute("role")
+		Attribute("signer")
+		Attribute("signerName")
+		Attribute("method")
+		Attribute("data")
+		Attribute("signedAt")
+		Attribute("contentHash")
+		Attribute("valid")
+	})
+})
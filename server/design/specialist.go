@@ -37,6 +37,36 @@ var _ = Resource("Specialist", func() {
 		Response(OK, SpecialistMedia)
 	})
 
+	Action("patch", func() {
+		Routing(PATCH("/:id"))
+		Payload(SpecialistPatchPayload)
+		Params(func() {
+			Param("id", Integer, "Specialist ID")
+		})
+		Description("Update only the given fields of a specialist by id.")
+		Response(OK, SpecialistMedia)
+	})
+
+	Action("password", func() {
+		Routing(PUT("/:id/password"))
+		Payload(SpecialistPasswordPayload)
+		Params(func() {
+			Param("id", Integer, "Specialist ID")
+		})
+		Description("Set a new password, which is hashed on the server.  Changing your own password needs the current one, only an admin can change anyone else's.")
+		Response(OK, SpecialistMedia)
+		Response(Unauthorized)
+	})
+
+	Action("unlock", func() {
+		Routing(PUT("/:id/unlock"))
+		Params(func() {
+			Param("id", Integer, "Specialist ID")
+		})
+		Description("Unlock a specialist who has been locked out by too many failed logins.  Only an admin can unlock.")
+		Response(OK, SpecialistMedia)
+	})
+
 	Action("delete", func() {
 		Routing(DELETE("/:id"))
 		Params(func() {
@@ -59,6 +89,7 @@ var _ = Resource("Specialist", func() {
 		Routing(POST("/list/:page"))
 		Params(func() {
 			Param("page", Integer, "Given a page number, returns an object consisting of the slice of specialists and a pager object")
+			PageParams()
 		})
 		Description("Get a page of specialists that may be filtered")
 		Payload(SpecialistQueryPayload)
@@ -67,6 +98,19 @@ var _ = Resource("Specialist", func() {
 			Media(SpecialistMedia, "paging")
 		})
 	})
+
+	Action("export", func() {
+		Routing(POST("/export"))
+		Params(func() {
+			Param("format", String, "The format of the spreadsheet", func() {
+				Enum("csv", "xlsx")
+				Default("csv")
+			})
+		})
+		Description("Export every specialist that matches the filter, not just one page, as a spreadsheet.  Only an admin can export them.")
+		Payload(SpecialistQueryPayload)
+		Response(OK)
+	})
 })
 
 var SpecialistPayload = Type("SpecialistPayload", func() {
@@ -80,7 +124,7 @@ var SpecialistPayload = Type("SpecialistPayload", func() {
 		Metadata("struct:tag:datastore", "username,noindex")
 		Metadata("struct:tag:json", "username")
 	})
-	Attribute("password", String, "Specialist password", func() {
+	Attribute("password", String, "Specialist password, only used when creating (see the `password` action)", func() {
 		Metadata("struct:tag:datastore", "password,noindex")
 		Metadata("struct:tag:json", "password")
 	})
@@ -120,12 +164,50 @@ var SpecialistPayload = Type("SpecialistPayload", func() {
 	Required("username", "password", "firstname", "lastname", "active", "email", "payrate", "authLevel", "loginTime")
 })
 
+var SpecialistPatchPayload = Type("SpecialistPatchPayload", func() {
+	Description("Specialist Patch Description, anything not given is left alone.")
+	Reference(SpecialistPayload)
+
+	Attribute("id")
+	Attribute("username")
+	Attribute("firstname")
+	Attribute("lastname")
+	Attribute("active")
+	Attribute("email")
+	Attribute("payrate")
+	Attribute("authLevel")
+	Attribute("loginTime")
+})
+
+var SpecialistPasswordPayload = Type("SpecialistPasswordPayload", func() {
+	Description("Specialist Password Description.")
+
+	Attribute("currentPassword", String, "The current password, needed to change your own", func() {
+		Metadata("struct:tag:datastore", "currentPassword,noindex")
+		Metadata("struct:tag:json", "currentPassword")
+	})
+	Attribute("password", String, "The new password", func() {
+		Metadata("struct:tag:datastore", "password,noindex")
+		Metadata("struct:tag:json", "password")
+	})
+
+	Required("password")
+})
+
 var SpecialistQueryPayload = Type("SpecialistQueryPayload", func() {
-	Description("Specialist Query Description.")
+	Description("Specialist Query Description.  Every filter that's given has to match.")
 
-	Attribute("whereClause", String, "where clause", func() {
-		Metadata("struct:tag:datastore", "whereClause,noindex")
-		Metadata("struct:tag:json", "whereClause")
+	Attribute("active", Boolean, "Only the active (or inactive) specialists", func() {
+		Metadata("struct:tag:datastore", "active,noindex")
+		Metadata("struct:tag:json", "active")
+	})
+	Attribute("lastname", String, "Only the last names that contain this", func() {
+		Metadata("struct:tag:datastore", "lastname,noindex")
+		Metadata("struct:tag:json", "lastname")
+	})
+	Attribute("firstname", String, "Only the first names that contain this", func() {
+		Metadata("struct:tag:datastore", "firstname,noindex")
+		Metadata("struct:tag:json", "firstname")
 	})
 })
 
@@ -0,0 +1,136 @@
+package design
+
+import (
+	. "github.com/goadesign/goa/design"
+	. "github.com/goadesign/goa/design/apidsl"
+)
+
+var _ = Resource("TwoFactor", func() {
+	BasePath("/twofactor")
+	// Seems that goa doesn't like setting DefaultMedia here at the top-level when the MediaType has multiple Views.
+	//	DefaultMedia(TwoFactorMedia)
+	Description("Describes the two-factor authentication (TOTP) of a specialist.  It's mandatory for admins.")
+
+	Action("show", func() {
+		Routing(GET("/:id"))
+		Params(func() {
+			Param("id", Integer, "Specialist ID")
+		})
+		Description("Get whether a specialist has two-factor authentication and how many recovery codes are left.")
+		Response(OK, TwoFactorMedia)
+	})
+
+	Action("enroll", func() {
+		Routing(POST("/:id/enroll"))
+		Params(func() {
+			Param("id", Integer, "Specialist ID")
+		})
+		Description("Get a new secret for the authenticator app.  It isn't used until it's confirmed.")
+		Payload(TwoFactorEnrollPayload)
+		Response(OK, func() {
+			Status(200)
+			Media(TwoFactorMedia, "enroll")
+		})
+		Response(Unauthorized)
+	})
+
+	Action("confirm", func() {
+		Routing(POST("/:id/confirm"))
+		Params(func() {
+			Param("id", Integer, "Specialist ID")
+		})
+		Description("Turn on two-factor authentication with a code from the app.  The recovery codes are only shown this once.")
+		Payload(TwoFactorCodePayload)
+		Response(OK, func() {
+			Status(200)
+			Media(TwoFactorMedia, "recovery")
+		})
+	})
+
+	Action("recovery", func() {
+		Routing(POST("/:id/recovery"))
+		Params(func() {
+			Param("id", Integer, "Specialist ID")
+		})
+		Description("Replace the recovery codes.")
+		Payload(TwoFactorCodePayload)
+		Response(OK, func() {
+			Status(200)
+			Media(TwoFactorMedia, "recovery")
+		})
+		Response(Unauthorized)
+	})
+
+	Action("disable", func() {
+		Routing(POST("/:id/disable"))
+		Params(func() {
+			Param("id", Integer, "Specialist ID")
+		})
+		Description("Turn off two-factor authentication.  An admin cannot turn it off.")
+		Payload(TwoFactorCodePayload)
+		Response(NoContent)
+		Response(Unauthorized)
+	})
+})
+
+var TwoFactorEnrollPayload = Type("TwoFactorEnrollPayload", func() {
+	Description("TwoFactor Enroll Description.")
+
+	Attribute("password", String, "The specialist's password", func() {
+		Metadata("struct:tag:datastore", "password,noindex")
+		Metadata("struct:tag:json", "password")
+	})
+	Attribute("code", String, "A code from the current app or a recovery code, only when already enrolled", func() {
+		Metadata("struct:tag:datastore", "code,noindex")
+		Metadata("struct:tag:json", "code")
+	})
+
+	Required("password")
+})
+
+var TwoFactorCodePayload = Type("TwoFactorCodePayload", func() {
+	Description("TwoFactor Code Description.")
+
+	Attribute("code", String, "A code from the authenticator app", func() {
+		Metadata("struct:tag:datastore", "code,noindex")
+		Metadata("struct:tag:json", "code")
+	})
+
+	Required("code")
+})
+
+var TwoFactorMedia = MediaType("application/twofactorapi.twofactorentity", func() {
+	Description("TwoFactor response")
+	TypeName("TwoFactorMedia")
+	ContentType("application/json")
+
+	Attributes(func() {
+		Attribute("specialist", Integer, "Specialist ID")
+		Attribute("enabled", Boolean, "Is two-factor authentication on?")
+		Attribute("required", Boolean, "Is two-factor authentication mandatory for this specialist?")
+		Attribute("recoveryCodesLeft", Integer, "How many recovery codes haven't been used")
+		Attribute("secret", String, "The secret for the authenticator app (base32)")
+		Attribute("uri", String, "The otpauth:// URI of the secret, for a QR code")
+		Attribute("recoveryCodes", ArrayOf(String), "Single-use codes for when the device is lost")
+
+		Required("specialist", "enabled", "required", "recoveryCodesLeft", "secret", "uri", "recoveryCodes")
+	})
+
+	View("default", func() {
+		Attribute("specialist")
+		Attribute("enabled")
+		Attribute("required")
+		Attribute("recoveryCodesLeft")
+	})
+
+	View("enroll", func() {
+		Attribute("specialist")
+		Attribute("secret")
+		Attribute("uri")
+	})
+
+	View("recovery", func() {
+		Attribute("specialist")
+		Attribute("recoveryCodes")
+	})
+})
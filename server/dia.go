@@ -9,22 +9,26 @@ import (
 // DIAController implements the DIA resource.
 type DIAController struct {
 	*goa.Controller
+	dias sql.DIARepository
 }
 
 // NewDIAController creates a DIA controller.
-func NewDIAController(service *goa.Service) *DIAController {
-	return &DIAController{Controller: service.NewController("DIAController")}
+func NewDIAController(service *goa.Service, dias sql.DIARepository) *DIAController {
+	return &DIAController{
+		Controller: service.NewController("DIAController"),
+		dias:       dias,
+	}
 }
 
 // Create runs the create action.
 func (c *DIAController) Create(ctx *app.CreateDIAContext) error {
 	// DIAController_Create: start_implement
 
-	res, err := sql.Create(sql.NewDIA(ctx.Payload))
+	res, err := c.dias.Create(ctx, ctx.Payload)
 	if err != nil {
 		return err
 	}
-	return ctx.OK(res.(*app.DIAMedia))
+	return ctx.OK(res)
 
 	// DIAController_Create: end_implement
 }
@@ -33,7 +37,7 @@ func (c *DIAController) Create(ctx *app.CreateDIAContext) error {
 func (c *DIAController) Delete(ctx *app.DeleteDIAContext) error {
 	// DIAController_Delete: start_implement
 
-	err := sql.Delete(sql.NewDIA(ctx.ID))
+	err := c.dias.Delete(ctx, ctx.ID)
 	if err != nil {
 		return err
 	}
@@ -46,11 +50,11 @@ func (c *DIAController) Delete(ctx *app.DeleteDIAContext) error {
 func (c *DIAController) List(ctx *app.ListDIAContext) error {
 	// DIAController_List: start_implement
 
-	collection, err := sql.List(sql.NewDIA(nil))
+	collection, err := c.dias.List(ctx)
 	if err != nil {
 		return err
 	}
-	return ctx.OK(collection.(app.DIAMediaCollection))
+	return ctx.OK(collection)
 
 	// DIAController_List: end_implement
 }
@@ -59,11 +63,15 @@ func (c *DIAController) List(ctx *app.ListDIAContext) error {
 func (c *DIAController) Page(ctx *app.PageDIAContext) error {
 	// DIAController_Page: start_implement
 
-	collection, err := sql.Page(sql.NewDIA(ctx.Page))
+	query := pageQuery(ctx.Page, ctx.Sort, ctx.PerPage, ctx.Fields)
+	collection, err := c.dias.Page(ctx, &query)
 	if err != nil {
 		return err
 	}
-	return ctx.OKPaging(collection.(*app.DIAMediaPaging))
+	if len(query.Fields) > 0 {
+		return sendFields(ctx, ctx.ResponseData, query.Fields, collection)
+	}
+	return ctx.OKPaging(collection)
 
 	// DIAController_Page: end_implement
 }
@@ -72,11 +80,11 @@ func (c *DIAController) Page(ctx *app.PageDIAContext) error {
 func (c *DIAController) Update(ctx *app.UpdateDIAContext) error {
 	// DIAController_Update: start_implement
 
-	rec, err := sql.Update(sql.NewDIA(ctx.Payload))
+	rec, err := c.dias.Update(ctx, ctx.Payload)
 	if err != nil {
 		return err
 	}
-	return ctx.OK(rec.(*app.DIAMedia))
+	return ctx.OK(rec)
 
 	// DIAController_Update: end_implement
 }
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/goadesign/goa"
+)
+
+// The ETag of a record is its version.
+func setETag(rd *goa.ResponseData, version *int) {
+	if version != nil {
+		rd.Header().Set("ETag", fmt.Sprintf("\"%d\"", *version))
+	}
+}
+
+// Returns the version that an update must match.  An If-Match header takes precedence over the version
+// in the payload, and `*` matches any version.
+func ifMatch(header *string, version *int) (*int, error) {
+	if header == nil {
+		return version, nil
+	}
+	tag := strings.TrimPrefix(strings.TrimSpace(*header), "W/")
+	if tag == "*" {
+		return nil, nil
+	}
+	v, err := strconv.Atoi(strings.Trim(tag, "\""))
+	if err != nil {
+		return nil, goa.ErrBadRequest("Bad If-Match header, expected the ETag of the record")
+	}
+	return &v, nil
+}
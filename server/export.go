@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+
+	"github.com/btoll/cpss/server/sql"
+	"github.com/goadesign/goa"
+	"github.com/tealeg/xlsx"
+)
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func (c *csvWriter) Write(record []string) error {
+	return c.w.Write(record)
+}
+
+func (c *csvWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// An XLSX file is a zip archive, so unlike a CSV file it can't be sent until all of the rows are in.
+type xlsxWriter struct {
+	rd    *goa.ResponseData
+	file  *xlsx.File
+	sheet *xlsx.Sheet
+}
+
+func (x *xlsxWriter) Write(record []string) error {
+	row := x.sheet.AddRow()
+	for _, value := range record {
+		row.AddCell().SetString(value)
+	}
+	return nil
+}
+
+func (x *xlsxWriter) Flush() error {
+	return x.file.Write(x.rd)
+}
+
+// Returns the writer for the requested format and sets the headers so that the browser downloads the file.
+func newExportWriter(rd *goa.ResponseData, format, name string) (sql.RowWriter, error) {
+	rd.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.%s\"", name, format))
+	switch format {
+	case "csv":
+		rd.Header().Set("Content-Type", "text/csv")
+		return &csvWriter{w: csv.NewWriter(rd)}, nil
+	case "xlsx":
+		file := xlsx.NewFile()
+		sheet, err := file.AddSheet(name)
+		if err != nil {
+			return nil, err
+		}
+		rd.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		return &xlsxWriter{rd: rd, file: file, sheet: sheet}, nil
+	}
+	return nil, goa.ErrBadRequest(fmt.Sprintf("Bad format: %s", format))
+}
@@ -9,22 +9,26 @@ import (
 // FundingSourceController implements the FundingSource resource.
 type FundingSourceController struct {
 	*goa.Controller
+	fundingSources sql.FundingSourceRepository
 }
 
 // NewFundingSourceController creates a FundingSource controller.
-func NewFundingSourceController(service *goa.Service) *FundingSourceController {
-	return &FundingSourceController{Controller: service.NewController("FundingSourceController")}
+func NewFundingSourceController(service *goa.Service, fundingSources sql.FundingSourceRepository) *FundingSourceController {
+	return &FundingSourceController{
+		Controller:     service.NewController("FundingSourceController"),
+		fundingSources: fundingSources,
+	}
 }
 
 // Create runs the create action.
 func (c *FundingSourceController) Create(ctx *app.CreateFundingSourceContext) error {
 	// FundingSourceController_Create: start_implement
 
-	res, err := sql.Create(sql.NewFundingSource(ctx.Payload))
+	res, err := c.fundingSources.Create(ctx, ctx.Payload)
 	if err != nil {
 		return err
 	}
-	return ctx.OK(res.(*app.FundingSourceMedia))
+	return ctx.OK(res)
 
 	// FundingSourceController_Create: end_implement
 }
@@ -33,7 +37,7 @@ func (c *FundingSourceController) Create(ctx *app.CreateFundingSourceContext) er
 func (c *FundingSourceController) Delete(ctx *app.DeleteFundingSourceContext) error {
 	// FundingSourceController_Delete: start_implement
 
-	err := sql.Delete(sql.NewFundingSource(ctx.ID))
+	err := c.fundingSources.Delete(ctx, ctx.ID)
 	if err != nil {
 		return err
 	}
@@ -46,11 +50,11 @@ func (c *FundingSourceController) Delete(ctx *app.DeleteFundingSourceContext) er
 func (c *FundingSourceController) List(ctx *app.ListFundingSourceContext) error {
 	// FundingSourceController_List: start_implement
 
-	collection, err := sql.List(sql.NewFundingSource(nil))
+	collection, err := c.fundingSources.List(ctx)
 	if err != nil {
 		return err
 	}
-	return ctx.OK(collection.(app.FundingSourceMediaCollection))
+	return ctx.OK(collection)
 
 	// FundingSourceController_List: end_implement
 }
@@ -59,11 +63,15 @@ func (c *FundingSourceController) List(ctx *app.ListFundingSourceContext) error
 func (c *FundingSourceController) Page(ctx *app.PageFundingSourceContext) error {
 	// FundingSourceController_Page: start_implement
 
-	collection, err := sql.Page(sql.NewFundingSource(ctx.Page))
+	query := pageQuery(ctx.Page, ctx.Sort, ctx.PerPage, ctx.Fields)
+	collection, err := c.fundingSources.Page(ctx, &query)
 	if err != nil {
 		return err
 	}
-	return ctx.OKPaging(collection.(*app.FundingSourceMediaPaging))
+	if len(query.Fields) > 0 {
+		return sendFields(ctx, ctx.ResponseData, query.Fields, collection)
+	}
+	return ctx.OKPaging(collection)
 
 	// FundingSourceController_Page: end_implement
 }
@@ -72,11 +80,11 @@ func (c *FundingSourceController) Page(ctx *app.PageFundingSourceContext) error
 func (c *FundingSourceController) Update(ctx *app.UpdateFundingSourceContext) error {
 	// FundingSourceController_Update: start_implement
 
-	rec, err := sql.Update(sql.NewFundingSource(ctx.Payload))
+	rec, err := c.fundingSources.Update(ctx, ctx.Payload)
 	if err != nil {
 		return err
 	}
-	return ctx.OK(rec.(*app.FundingSourceMedia))
+	return ctx.OK(rec)
 
 	// FundingSourceController_Update: end_implement
 }
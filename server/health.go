@@ -0,0 +1,77 @@
+package main
+
+import (
+	"runtime"
+
+	"github.com/btoll/cpss/server/app"
+	"github.com/btoll/cpss/server/sql"
+	"github.com/goadesign/goa"
+	goaversion "github.com/goadesign/goa/version"
+)
+
+// Set when building, see the Makefile.
+var (
+	GitSHA    = "unknown"
+	BuildTime = "unknown"
+)
+
+// HealthController implements the Health resource.
+type HealthController struct {
+	*goa.Controller
+	health sql.HealthRepository
+}
+
+// NewHealthController creates a Health controller.
+func NewHealthController(service *goa.Service, health sql.HealthRepository) *HealthController {
+	return &HealthController{
+		Controller: service.NewController("HealthController"),
+		health:     health,
+	}
+}
+
+// Healthz runs the healthz action.
+func (c *HealthController) Healthz(ctx *app.HealthzHealthContext) error {
+	// HealthController_Healthz: start_implement
+
+	return ctx.OK(&app.HealthMedia{Status: "ok"})
+
+	// HealthController_Healthz: end_implement
+}
+
+// Readyz runs the readyz action.
+func (c *HealthController) Readyz(ctx *app.ReadyzHealthContext) error {
+	// HealthController_Readyz: start_implement
+
+	expected := sql.SchemaVersion
+	version, err := c.health.CheckReady(ctx)
+	res := &app.HealthMedia{
+		Status:                "ok",
+		SchemaVersion:         &version,
+		ExpectedSchemaVersion: &expected,
+	}
+	// The probe isn't authenticated, so the reason is only logged and never sent.
+	if err != nil {
+		sql.Log(ctx).Error("not ready", "err", err)
+		message := "not ready"
+		res.Status = "unavailable"
+		res.Error = &message
+		return ctx.ServiceUnavailable(res)
+	}
+	return ctx.OK(res)
+
+	// HealthController_Readyz: end_implement
+}
+
+// Version runs the version action.
+func (c *HealthController) Version(ctx *app.VersionHealthContext) error {
+	// HealthController_Version: start_implement
+
+	return ctx.OK(&app.VersionMedia{
+		GitSHA:     GitSHA,
+		BuildTime:  BuildTime,
+		GoaVersion: goaversion.String(),
+		GoVersion:  runtime.Version(),
+	})
+
+	// HealthController_Version: end_implement
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/btoll/cpss/server/app"
+	"github.com/goadesign/goa"
+)
+
+type fakeHealth struct {
+	err error
+}
+
+func (h *fakeHealth) CheckReady(ctx context.Context) (int, error) {
+	return 3, h.err
+}
+
+func TestReadyz(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+	}{
+		{name: "ready", status: http.StatusOK},
+		{name: "not ready", err: errors.New("dial tcp 10.0.0.5:3306: connection refused"), status: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := goa.New("test")
+			rw := httptest.NewRecorder()
+			service.Encoder.Register(goa.NewJSONEncoder, "application/json")
+			req := httptest.NewRequest("GET", "/cpss/readyz", nil)
+			req.Header.Set("Accept", "application/json")
+			ctx, err := app.NewReadyzHealthContext(goa.NewContext(context.Background(), rw, req, nil), req, service)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = NewHealthController(service, &fakeHealth{err: tt.err}).Readyz(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if rw.Code != tt.status {
+				t.Errorf("Readyz() status = %d, want %d", rw.Code, tt.status)
+			}
+			if strings.Contains(rw.Body.String(), "10.0.0.5") {
+				t.Errorf("Readyz() = %s, want the error left out", rw.Body.String())
+			}
+		})
+	}
+}
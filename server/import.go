@@ -0,0 +1,72 @@
+package main
+
+import (
+	"github.com/btoll/cpss/server/app"
+	"github.com/btoll/cpss/server/sql"
+	"github.com/goadesign/goa"
+)
+
+// ImportController implements the Import resource.
+type ImportController struct {
+	*goa.Controller
+	imports sql.ImportRepository
+}
+
+// NewImportController creates a Import controller.
+func NewImportController(service *goa.Service, imports sql.ImportRepository) *ImportController {
+	return &ImportController{
+		Controller: service.NewController("ImportController"),
+		imports:    imports,
+	}
+}
+
+// Billsheets runs the billsheets action.
+func (c *ImportController) Billsheets(ctx *app.BillsheetsImportContext) error {
+	// ImportController_Billsheets: start_implement
+
+	rec, err := c.imports.Import(ctx, &sql.ImportQuery{
+		Kind:   sql.ImportBillSheets,
+		Data:   ctx.Payload.Data,
+		DryRun: ctx.Payload.DryRun,
+	})
+	if err != nil {
+		return err
+	}
+	return ctx.OK(rec)
+
+	// ImportController_Billsheets: end_implement
+}
+
+// Consumers runs the consumers action.
+func (c *ImportController) Consumers(ctx *app.ConsumersImportContext) error {
+	// ImportController_Consumers: start_implement
+
+	rec, err := c.imports.Import(ctx, &sql.ImportQuery{
+		Kind:   sql.ImportConsumers,
+		Data:   ctx.Payload.Data,
+		DryRun: ctx.Payload.DryRun,
+	})
+	if err != nil {
+		return err
+	}
+	return ctx.OK(rec)
+
+	// ImportController_Consumers: end_implement
+}
+
+// UnitBlocks runs the unitBlocks action.
+func (c *ImportController) UnitBlocks(ctx *app.UnitBlocksImportContext) error {
+	// ImportController_UnitBlocks: start_implement
+
+	rec, err := c.imports.Import(ctx, &sql.ImportQuery{
+		Kind:   sql.ImportUnitBlocks,
+		Data:   ctx.Payload.Data,
+		DryRun: ctx.Payload.DryRun,
+	})
+	if err != nil {
+		return err
+	}
+	return ctx.OK(rec)
+
+	// ImportController_UnitBlocks: end_implement
+}
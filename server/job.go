@@ -0,0 +1,99 @@
+package main
+
+import (
+	"github.com/btoll/cpss/server/app"
+	"github.com/btoll/cpss/server/sql"
+	"github.com/goadesign/goa"
+)
+
+// JobController implements the Job resource.
+type JobController struct {
+	*goa.Controller
+	jobs      sql.JobRepository
+	scheduler *Scheduler
+}
+
+// NewJobController creates a Job controller.
+func NewJobController(service *goa.Service, jobs sql.JobRepository, scheduler *Scheduler) *JobController {
+	return &JobController{
+		Controller: service.NewController("JobController"),
+		jobs:       jobs,
+		scheduler:  scheduler,
+	}
+}
+
+// List runs the list action.
+func (c *JobController) List(ctx *app.ListJobContext) error {
+	// JobController_List: start_implement
+
+	if err := sql.RequireAdmin(ctx); err != nil {
+		return err
+	}
+	coll := make([]*app.JobItem, len(c.scheduler.Jobs))
+	for i, job := range c.scheduler.Jobs {
+		coll[i] = &app.JobItem{
+			Name:        job.Name,
+			Description: job.Description,
+			Schedule:    job.Spec,
+			NextRun:     int(c.scheduler.NextRun(job).Unix()),
+		}
+	}
+	return ctx.OK(coll)
+
+	// JobController_List: end_implement
+}
+
+// Runs runs the runs action.
+func (c *JobController) Runs(ctx *app.RunsJobContext) error {
+	// JobController_Runs: start_implement
+
+	if err := sql.RequireAdmin(ctx); err != nil {
+		return err
+	}
+	collection, err := c.jobs.List(ctx, &sql.JobRunQuery{
+		Job:   ctx.Name,
+		Limit: ctx.Limit,
+	})
+	if err != nil {
+		return err
+	}
+	return ctx.OK(collection)
+
+	// JobController_Runs: end_implement
+}
+
+// Show runs the show action.
+func (c *JobController) Show(ctx *app.ShowJobContext) error {
+	// JobController_Show: start_implement
+
+	if err := sql.RequireAdmin(ctx); err != nil {
+		return err
+	}
+	rec, err := c.jobs.Read(ctx, ctx.ID)
+	if err != nil {
+		return err
+	}
+	return ctx.OK(rec)
+
+	// JobController_Show: end_implement
+}
+
+// Trigger runs the trigger action.
+func (c *JobController) Trigger(ctx *app.TriggerJobContext) error {
+	// JobController_Trigger: start_implement
+
+	if err := sql.RequireAdmin(ctx); err != nil {
+		return err
+	}
+	job := c.scheduler.Find(ctx.Name)
+	if job == nil {
+		return ctx.NotFound()
+	}
+	run, err := c.scheduler.Trigger(ctx, job, triggerManual)
+	if err != nil {
+		return err
+	}
+	return ctx.OK(run)
+
+	// JobController_Trigger: end_implement
+}
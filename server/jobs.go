@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/btoll/cpss/server/sql"
+)
+
+// A unit block with fewer units than this is running low.
+var lowUnitBlockThreshold = 20.0
+
+// Where the nightly exports are written, overridden by the CPSS_EXPORT_DIR environment variable.
+var exportDir = "exports"
+
+func defaultJobs(mailer Mailer, billSheets sql.BillSheetRepository, jobs sql.JobRepository, notifications sql.NotificationRepository, sessions sql.SessionRepository) []*Job {
+	return []*Job{
+		{
+			Name:        "sendEmail",
+			Description: "Send the queued emails, retrying the ones that failed.",
+			Spec:        "* * * * *",
+			Run: func(ctx context.Context) (string, error) {
+				return sendEmail(ctx, mailer, notifications)
+			},
+		},
+		{
+			Name:        "expireSessions",
+			Description: "End the sessions that have gone on longer than the session length.",
+			Spec:        "*/15 * * * *",
+			Run: func(ctx context.Context) (string, error) {
+				return expireSessions(ctx, sessions)
+			},
+		},
+		{
+			Name:        "lowUnitBlocks",
+			Description: "Report the unit blocks of active consumers that are running low.",
+			Spec:        "0 7 * * *",
+			Run: func(ctx context.Context) (string, error) {
+				return lowUnitBlocks(ctx, jobs, notifications)
+			},
+		},
+		{
+			Name:        "closeBillingPeriod",
+			Description: "Bill every approved billsheet from before this month.",
+			Spec:        "0 2 1 * *",
+			Run: func(ctx context.Context) (string, error) {
+				return closeBillingPeriod(ctx, jobs)
+			},
+		},
+		{
+			Name:        "nightlyExport",
+			Description: "Export all of the billsheets to a CSV file.",
+			Spec:        "0 1 * * *",
+			Run: func(ctx context.Context) (string, error) {
+				return nightlyExport(ctx, billSheets)
+			},
+		},
+		{
+			Name:        "timesheetReminders",
+			Description: "Remind the specialists who haven't finished their billsheets for the week.",
+			Spec:        "0 15 * * 5",
+			Run: func(ctx context.Context) (string, error) {
+				return timesheetReminders(ctx, notifications)
+			},
+		},
+	}
+}
+
+func expireSessions(ctx context.Context, sessions sql.SessionRepository) (string, error) {
+	n, err := sessions.Expire(ctx)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Ended %d sessions", n), nil
+}
+
+func lowUnitBlocks(ctx context.Context, jobs sql.JobRepository, notifications sql.NotificationRepository) (string, error) {
+	coll, err := jobs.GetLowUnitBlocks(ctx, lowUnitBlockThreshold)
+	if err != nil {
+		return "", err
+	}
+	if len(coll) == 0 {
+		return "No unit blocks are running low", nil
+	}
+	admins, err := notifications.GetAdmins(ctx)
+	if err != nil {
+		return "", err
+	}
+	for _, admin := range admins {
+		err = notifications.Notify(ctx, sql.NotifyLowUnitBlock, admin, map[string]interface{}{
+			"UnitBlocks": coll,
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	return strings.Join(coll, "\n"), nil
+}
+
+func closeBillingPeriod(ctx context.Context, jobs sql.JobRepository) (string, error) {
+	year, month, _ := time.Now().Date()
+	before := fmt.Sprintf("%d-%02d-01", year, month)
+	n, err := jobs.CloseBillingPeriod(ctx, before)
+	if err != nil {
+		return fmt.Sprintf("Billed %d billsheets before failing", n), err
+	}
+	return fmt.Sprintf("Billed %d billsheets from before %s", n, before), nil
+}
+
+func nightlyExport(ctx context.Context, billSheets sql.BillSheetRepository) (string, error) {
+	dir := exportDir
+	if env := os.Getenv("CPSS_EXPORT_DIR"); env != "" {
+		dir = env
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	name := filepath.Join(dir, fmt.Sprintf("billsheets-%s.csv", time.Now().Format("2006-01-02")))
+	f, err := os.Create(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	err = billSheets.Export(ctx, &sql.BillSheetExportQuery{}, &csvWriter{w: csv.NewWriter(f)})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Exported the billsheets to %s", name), nil
+}
+
+// A failed email is left in the queue to be tried again later, so one bad address doesn't hold up the rest.
+func sendEmail(ctx context.Context, mailer Mailer, notifications sql.NotificationRepository) (string, error) {
+	coll, err := notifications.GetQueuedEmails(ctx, emailBatchSize)
+	if err != nil {
+		return "", err
+	}
+	from := mailFrom()
+	sent := 0
+	failed := 0
+	for _, email := range coll {
+		err = mailer.Send(from, []string{email.Address}, formatMessage(from, email.Address, email.Subject, email.Body))
+		if err != nil {
+			failed++
+			err = notifications.MarkEmailFailed(ctx, email, err)
+		} else {
+			sent++
+			err = notifications.MarkEmailSent(ctx, email)
+		}
+		if err != nil {
+			return fmt.Sprintf("Sent %d emails, %d failed", sent, failed), err
+		}
+	}
+	return fmt.Sprintf("Sent %d emails, %d failed", sent, failed), nil
+}
+
+func timesheetReminders(ctx context.Context, notifications sql.NotificationRepository) (string, error) {
+	n, err := notifications.SendTimesheetReminders(ctx)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Reminded %d specialists", n), nil
+}
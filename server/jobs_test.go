@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/btoll/cpss/server/sql"
+)
+
+// Only the queue is faked, anything else that's called panics.
+type fakeNotifications struct {
+	sql.NotificationRepository
+	queue  []*sql.QueuedEmail
+	sent   []int
+	failed []int
+}
+
+func (n *fakeNotifications) GetQueuedEmails(ctx context.Context, limit int) ([]*sql.QueuedEmail, error) {
+	if len(n.queue) > limit {
+		return n.queue[:limit], nil
+	}
+	return n.queue, nil
+}
+
+func (n *fakeNotifications) MarkEmailSent(ctx context.Context, email *sql.QueuedEmail) error {
+	n.sent = append(n.sent, email.ID)
+	return nil
+}
+
+func (n *fakeNotifications) MarkEmailFailed(ctx context.Context, email *sql.QueuedEmail, sendErr error) error {
+	n.failed = append(n.failed, email.ID)
+	return nil
+}
+
+func TestSendEmail(t *testing.T) {
+	queue := []*sql.QueuedEmail{
+		{ID: 1, Address: "a@example.com", Subject: "Approved", Body: "Your billsheet\nwas approved."},
+		{ID: 2, Address: "b@example.com", Subject: "Rejected", Body: "Your billsheet was rejected."},
+	}
+	tests := []struct {
+		name    string
+		sendErr error
+		output  string
+		sent    int
+		failed  int
+	}{
+		{name: "sent", output: "Sent 2 emails, 0 failed", sent: 2},
+		{name: "failed", sendErr: errors.New("connection refused"), output: "Sent 0 emails, 2 failed", failed: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mailer := &FakeMailer{Err: tt.sendErr}
+			notifications := &fakeNotifications{queue: queue}
+			output, err := sendEmail(context.Background(), mailer, notifications)
+			if err != nil {
+				t.Fatalf("sendEmail() error = %v", err)
+			}
+			if output != tt.output {
+				t.Errorf("sendEmail() = %q, want %q", output, tt.output)
+			}
+			if len(notifications.sent) != tt.sent || len(notifications.failed) != tt.failed {
+				t.Errorf("marked %d sent and %d failed, want %d and %d", len(notifications.sent), len(notifications.failed), tt.sent, tt.failed)
+			}
+			if len(mailer.Sent) != tt.sent {
+				t.Fatalf("mailed %d emails, want %d", len(mailer.Sent), tt.sent)
+			}
+			for i, msg := range mailer.Sent {
+				email := queue[i]
+				if len(msg.To) != 1 || msg.To[0] != email.Address {
+					t.Errorf("mailed to %v, want %s", msg.To, email.Address)
+				}
+				body := string(msg.Msg)
+				if !strings.Contains(body, "Subject: "+email.Subject+"\r\n") {
+					t.Errorf("mailed %q, want the subject %q", body, email.Subject)
+				}
+				if !strings.HasSuffix(body, "\r\n\r\n"+strings.Replace(email.Body, "\n", "\r\n", -1)) {
+					t.Errorf("mailed %q, want the body %q", body, email.Body)
+				}
+			}
+		})
+	}
+}
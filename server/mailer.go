@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How many queued emails are sent each time the queue is drained.
+var emailBatchSize = 50
+
+// Mailer delivers a single message.  The message is the complete email, headers included.
+type Mailer interface {
+	Send(from string, to []string, msg []byte) error
+}
+
+type smtpMailer struct {
+	addr string
+	auth smtp.Auth
+}
+
+func (m *smtpMailer) Send(from string, to []string, msg []byte) error {
+	return smtp.SendMail(m.addr, m.auth, from, to, msg)
+}
+
+// FakeMailer keeps every message in memory instead of sending it.  It's used when no SMTP server is
+// configured, and by tests that want to see what would have been sent.
+type FakeMailer struct {
+	sync.Mutex
+	Sent []*FakeMessage
+	// When set, every send fails with this error so that retries can be tested.
+	Err error
+}
+
+type FakeMessage struct {
+	From string
+	To   []string
+	Msg  []byte
+}
+
+func (m *FakeMailer) Send(from string, to []string, msg []byte) error {
+	m.Lock()
+	defer m.Unlock()
+	if m.Err != nil {
+		return m.Err
+	}
+	m.Sent = append(m.Sent, &FakeMessage{
+		From: from,
+		To:   to,
+		Msg:  msg,
+	})
+	return nil
+}
+
+// The SMTP server is configured by the CPSS_SMTP_HOST, CPSS_SMTP_PORT, CPSS_SMTP_USER and
+// CPSS_SMTP_PASSWORD environment variables.  Without a host the emails are only kept in memory.
+func NewMailer() Mailer {
+	host := os.Getenv("CPSS_SMTP_HOST")
+	if host == "" {
+		return &FakeMailer{}
+	}
+	port := os.Getenv("CPSS_SMTP_PORT")
+	if port == "" {
+		port = "25"
+	}
+	var auth smtp.Auth
+	if user := os.Getenv("CPSS_SMTP_USER"); user != "" {
+		auth = smtp.PlainAuth("", user, os.Getenv("CPSS_SMTP_PASSWORD"), host)
+	}
+	return &smtpMailer{
+		addr: fmt.Sprintf("%s:%s", host, port),
+		auth: auth,
+	}
+}
+
+// Who the emails are from, overridden by the CPSS_MAIL_FROM environment variable.
+func mailFrom() string {
+	if from := os.Getenv("CPSS_MAIL_FROM"); from != "" {
+		return from
+	}
+	return "cpss@localhost"
+}
+
+func formatMessage(from, to, subject, body string) []byte {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.Replace(body, "\n", "\r\n", -1))
+	return msg.Bytes()
+}
@@ -5,6 +5,8 @@ package main
 import (
 	"context"
 	"net/http"
+	"os"
+	"regexp"
 	"strconv"
 	"strings"
 
@@ -12,25 +14,99 @@ import (
 	"github.com/btoll/cpss/server/sql"
 	"github.com/goadesign/goa"
 	"github.com/goadesign/goa/middleware"
+	"golang.org/x/crypto/bcrypt"
 )
 
-func CheckSession() goa.Middleware {
+// Authenticate finds out who is making the request from the `Authorization: Bearer <token>` header, and
+// puts them in the context for the actions that need to know.  A request without a good token is turned
+// away, unless it's logging in (or resetting a password) or a CORS preflight.
+//
+// A specialist who has to enroll in two-factor authentication before they can log in doesn't have a
+// session yet, so they send `Authorization: Challenge <challenge>` instead, which is only good for enrolling
+// and confirming themselves.
+func Authenticate(sessions sql.SessionRepository, twoFactor sql.TwoFactorRepository) goa.Middleware {
 	return func(h goa.Handler) goa.Handler {
 		return func(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
-			// If parts[3] == "list" then the endpoint is "/cpss/specialist/list" which we want to ignore.
-			// We're only interested in GET requests for a particular specialist ID, such as "/cpss/specialist/117".
-			if parts := strings.SplitN(req.URL.String(), "/", -1); req.Method == "GET" && parts[3] != "list" {
-				n, err := strconv.Atoi(parts[3])
-				if err != nil {
-					return err
-				}
-				err = sql.CheckSession(n)
-				if err != nil {
-					return err
-				}
+			if req.Method == "OPTIONS" || publicPaths[req.URL.Path] {
+				return h(ctx, rw, req)
 			}
-			h(ctx, rw, req)
-			return nil
+			auth := req.Header.Get("Authorization")
+			if strings.HasPrefix(auth, "Challenge ") {
+				return authenticateChallenge(ctx, twoFactor, strings.TrimPrefix(auth, "Challenge "), h, rw, req)
+			}
+			if !strings.HasPrefix(auth, "Bearer ") {
+				return ErrUnauthorized(sql.ErrNoPrincipal)
+			}
+			p, err := sessions.Authenticate(ctx, strings.TrimPrefix(auth, "Bearer "))
+			if err == sql.ErrNoPrincipal {
+				return ErrUnauthorized(err)
+			}
+			if err != nil {
+				return err
+			}
+			return h(sql.WithPrincipal(ctx, p), rw, req)
+		}
+	}
+}
+
+var ErrUnauthorized = goa.NewErrorClass("unauthorized", http.StatusUnauthorized)
+
+// The only actions that a login challenge can be used for, and only for the specialist it was given to.
+var enrollPath = regexp.MustCompile(`^/cpss/twofactor/(\d+)/(enroll|confirm)$`)
+
+func authenticateChallenge(ctx context.Context, twoFactor sql.TwoFactorRepository, challenge string, h goa.Handler, rw http.ResponseWriter, req *http.Request) error {
+	m := enrollPath.FindStringSubmatch(req.URL.Path)
+	if m == nil || req.Method != "POST" {
+		return ErrUnauthorized(sql.ErrNoPrincipal)
+	}
+	p, err := twoFactor.AuthenticateChallenge(ctx, challenge)
+	if err == sql.ErrNoPrincipal {
+		return ErrUnauthorized(err)
+	}
+	if err != nil {
+		return err
+	}
+	if strconv.Itoa(p.ID) != m[1] {
+		return ErrUnauthorized(sql.ErrNoPrincipal)
+	}
+	return h(sql.WithPrincipal(ctx, p), rw, req)
+}
+
+// The only actions that can be called before there's a session.
+var publicPaths = map[string]bool{
+	"/cpss/session/auth":     true,
+	"/cpss/session/verify":   true,
+	"/cpss/session/reset":    true,
+	"/cpss/session/password": true,
+}
+
+// WithLogger gives every request a logger that adds the request's id to everything it writes, including
+// the errors of the sql package.  It has to be mounted after the RequestID middleware.
+func WithLogger(logger *sql.Logger) goa.Middleware {
+	return func(h goa.Handler) goa.Handler {
+		return func(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+			ctx = sql.WithLogger(ctx, logger.With("requestID", middleware.ContextRequestID(ctx)))
+			return h(ctx, rw, req)
+		}
+	}
+}
+
+// The probes are polled all of the time and never need a session, so they skip the middleware that logs
+// every request and checks the session.
+var probePaths = map[string]bool{
+	"/healthz": true,
+	"/readyz":  true,
+	"/version": true,
+}
+
+func SkipProbes(m goa.Middleware) goa.Middleware {
+	return func(h goa.Handler) goa.Handler {
+		wrapped := m(h)
+		return func(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+			if probePaths[req.URL.Path] {
+				return h(ctx, rw, req)
+			}
+			return wrapped(ctx, rw, req)
 		}
 	}
 }
@@ -39,34 +115,104 @@ func main() {
 	// Create service
 	service := goa.New("cpss")
 
+	// Everything is logged as JSON, including goa's own logs, at CPSS_LOG_LEVEL (info by default).
+	level := sql.LevelInfo
+	if env := os.Getenv("CPSS_LOG_LEVEL"); env != "" {
+		var err error
+		if level, err = sql.ParseLevel(env); err != nil {
+			service.LogError("startup", "err", err)
+			return
+		}
+	}
+	logger := sql.NewLogger(os.Stdout, level)
+	sql.DefaultLogger = logger
+	service.WithLogger(logger)
+
+	if err := configureTimeouts(); err != nil {
+		service.LogError("startup", "err", err)
+		return
+	}
+
+	// New password hashes use this bcrypt cost, and older ones are upgraded as their specialists log in.
+	if cost, err := strconv.Atoi(os.Getenv("CPSS_BCRYPT_COST")); err == nil && cost >= bcrypt.MinCost && cost <= bcrypt.MaxCost {
+		sql.PasswordCost = cost
+	}
+
+	// The repositories share one pool for as long as the service runs.
+	db, err := sql.Open()
+	if err != nil {
+		service.LogError("startup", "err", err)
+		return
+	}
+	defer sql.Close(db)
+	specialists := sql.NewSpecialist(db)
+	billSheets := sql.NewBillSheet(db)
+	sessions := sql.NewSession(db)
+	twoFactor := sql.NewTwoFactor(db)
+	notifications := sql.NewNotification(db)
+	jobs := sql.NewJob(db)
+
 	// Mount middleware
 	service.Use(middleware.RequestID())
-	service.Use(middleware.LogRequest(true))
+	service.Use(WithLogger(logger))
+	service.Use(Metrics())
+	// Only the start and end of a request are logged, never its headers or payload.
+	service.Use(SkipProbes(middleware.LogRequest(false)))
 	service.Use(middleware.ErrorHandler(service, true))
 	service.Use(middleware.Recover())
-	service.Use(CheckSession())
+	service.Use(Deadline())
+	service.Use(SkipProbes(Authenticate(sessions, twoFactor)))
 
 	// Mount "Specialist" controller
-	c := NewSpecialistController(service)
+	c := NewSpecialistController(service, specialists)
 	app.MountSpecialistController(service, c)
-	d := NewBillSheetController(service)
+	d := NewBillSheetController(service, billSheets)
 	app.MountBillSheetController(service, d)
-	e := NewConsumerController(service)
+	e := NewConsumerController(service, sql.NewConsumer(db))
 	app.MountConsumerController(service, e)
-	f := NewSessionController(service)
+	f := NewSessionController(service, sessions, twoFactor)
 	app.MountSessionController(service, f)
-	g := NewStatusController(service)
+	g := NewStatusController(service, sql.NewStatus(db))
 	app.MountStatusController(service, g)
-	h := NewCountyController(service)
+	h := NewCountyController(service, sql.NewCounty(db))
 	app.MountCountyController(service, h)
-	j := NewServiceCodeController(service)
+	j := NewServiceCodeController(service, sql.NewServiceCode(db))
 	app.MountServiceCodeController(service, j)
-	k := NewDIAController(service)
+	k := NewDIAController(service, sql.NewDIA(db))
 	app.MountDIAController(service, k)
-	l := NewFundingSourceController(service)
+	l := NewFundingSourceController(service, sql.NewFundingSource(db))
 	app.MountFundingSourceController(service, l)
-	m := NewPayHistoryController(service)
+	m := NewPayHistoryController(service, sql.NewPayHistory(db))
 	app.MountPayHistoryController(service, m)
+	n := NewCaseloadController(service, sql.NewCaseload(db))
+	app.MountCaseloadController(service, n)
+	o := NewNoteTemplateController(service, sql.NewNoteTemplate(db))
+	app.MountNoteTemplateController(service, o)
+	p := NewSignatureController(service, sql.NewSignature(db))
+	app.MountSignatureController(service, p)
+	q := NewImportController(service, sql.NewImport(db))
+	app.MountImportController(service, q)
+	r := NewReportController(service, sql.NewReport(db))
+	app.MountReportController(service, r)
+	t := NewNotificationController(service, notifications)
+	app.MountNotificationController(service, t)
+	u := NewTwoFactorController(service, twoFactor)
+	app.MountTwoFactorController(service, u)
+	v := NewSearchController(service, sql.NewSearch(db))
+	app.MountSearchController(service, v)
+	w := NewHealthController(service, sql.NewHealth(db))
+	app.MountHealthController(service, w)
+	MountMetrics(service)
+
+	// The scheduled jobs run inside the server, including sending the queued emails.
+	scheduler, err := NewScheduler(service, jobs, defaultJobs(NewMailer(), billSheets, jobs, notifications, sessions))
+	if err != nil {
+		service.LogError("startup", "err", err)
+		return
+	}
+	s := NewJobController(service, jobs, scheduler)
+	app.MountJobController(service, s)
+	scheduler.Start()
 
 	// Start service
 	if err := service.ListenAndServe(":8080"); err != nil {
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/btoll/cpss/server/sql"
+	"github.com/goadesign/goa"
+)
+
+// Only the tokens are faked, anything else that's called panics.
+type fakeSessions struct {
+	sql.SessionRepository
+	tokens map[string]*sql.Principal
+}
+
+func (s *fakeSessions) Authenticate(ctx context.Context, token string) (*sql.Principal, error) {
+	p, ok := s.tokens[token]
+	if !ok {
+		return nil, sql.ErrNoPrincipal
+	}
+	return p, nil
+}
+
+// Only the challenges are faked, anything else that's called panics.
+type fakeTwoFactor struct {
+	sql.TwoFactorRepository
+	challenges map[string]*sql.Principal
+}
+
+func (f *fakeTwoFactor) AuthenticateChallenge(ctx context.Context, challenge string) (*sql.Principal, error) {
+	p, ok := f.challenges[challenge]
+	if !ok {
+		return nil, sql.ErrNoPrincipal
+	}
+	return p, nil
+}
+
+func TestAuthenticate(t *testing.T) {
+	sessions := &fakeSessions{tokens: map[string]*sql.Principal{
+		"good": {ID: 7, AuthLevel: sql.AuthLevelUser},
+	}}
+	twoFactor := &fakeTwoFactor{challenges: map[string]*sql.Principal{
+		"enrolling": {ID: 3, AuthLevel: sql.AuthLevelAdmin, Challenge: true},
+	}}
+	errStale := errors.New("stale")
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		auth   string
+		status int
+		err    error
+		id     int
+	}{
+		{name: "good token", path: "/cpss/billsheet/1", auth: "Bearer good", id: 7},
+		{name: "handler error", path: "/cpss/billsheet/1", auth: "Bearer good", err: errStale, id: 7},
+		{name: "no token", path: "/cpss/billsheet/1", status: http.StatusUnauthorized},
+		{name: "bad token", path: "/cpss/billsheet/1", auth: "Bearer bad", status: http.StatusUnauthorized},
+		{name: "not a bearer", path: "/cpss/billsheet/1", auth: "Basic good", status: http.StatusUnauthorized},
+		{name: "public", path: "/cpss/session/auth"},
+		{name: "enroll with a challenge", method: "POST", path: "/cpss/twofactor/3/enroll", auth: "Challenge enrolling", id: 3},
+		{name: "confirm with a challenge", method: "POST", path: "/cpss/twofactor/3/confirm", auth: "Challenge enrolling", id: 3},
+		{name: "someone else's enroll", method: "POST", path: "/cpss/twofactor/4/enroll", auth: "Challenge enrolling", status: http.StatusUnauthorized},
+		{name: "anything else with a challenge", method: "POST", path: "/cpss/twofactor/3/disable", auth: "Challenge enrolling", status: http.StatusUnauthorized},
+		{name: "a bad challenge", method: "POST", path: "/cpss/twofactor/3/enroll", auth: "Challenge bad", status: http.StatusUnauthorized},
+		{name: "a session token as a challenge", method: "POST", path: "/cpss/twofactor/7/enroll", auth: "Challenge good", status: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen *sql.Principal
+			called := false
+			h := Authenticate(sessions, twoFactor)(func(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+				called = true
+				seen = sql.PrincipalFromContext(ctx)
+				return tt.err
+			})
+			method := tt.method
+			if method == "" {
+				method = "GET"
+			}
+			req := httptest.NewRequest(method, tt.path, nil)
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			err := h(context.Background(), httptest.NewRecorder(), req)
+			if tt.status != 0 {
+				e, ok := err.(goa.ServiceError)
+				if !ok || e.ResponseStatus() != tt.status {
+					t.Fatalf("Authenticate() error = %v, want a %d", err, tt.status)
+				}
+				if called {
+					t.Errorf("Authenticate() called the handler")
+				}
+				return
+			}
+			if err != tt.err {
+				t.Errorf("Authenticate() error = %v, want the handler's %v", err, tt.err)
+			}
+			if tt.id == 0 {
+				if seen != nil {
+					t.Errorf("Authenticate() principal = %+v, want none", seen)
+				}
+				return
+			}
+			if seen == nil || seen.ID != tt.id {
+				t.Errorf("Authenticate() principal = %+v, want specialist %d", seen, tt.id)
+			}
+		})
+	}
+}
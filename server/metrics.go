@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/goadesign/goa"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "cpss",
+	Subsystem: "http",
+	Name:      "request_duration_seconds",
+	Help:      "How long a request took, by controller, action and status.",
+	Buckets:   prometheus.DefBuckets,
+}, []string{"controller", "action", "status"})
+
+func init() {
+	prometheus.MustRegister(requestDuration)
+}
+
+// Metrics times every request by its controller and action.  It has to be mounted before the ErrorHandler,
+// so that the status is the one of the error that was sent back.
+func Metrics() goa.Middleware {
+	return func(h goa.Handler) goa.Handler {
+		return func(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+			start := time.Now()
+			err := h(ctx, rw, req)
+			status := http.StatusOK
+			if resp := goa.ContextResponse(ctx); resp != nil && resp.Status != 0 {
+				status = resp.Status
+			} else if err != nil {
+				status = http.StatusInternalServerError
+			}
+			requestDuration.WithLabelValues(goa.ContextController(ctx), goa.ContextAction(ctx), strconv.Itoa(status)).Observe(time.Since(start).Seconds())
+			return err
+		}
+	}
+}
+
+// MountMetrics serves the metrics at `/metrics`, outside of the API and its middleware, the same as the
+// probes.
+func MountMetrics(service *goa.Service) {
+	handler := promhttp.Handler()
+	service.Mux.Handle("GET", "/metrics", func(rw http.ResponseWriter, req *http.Request, _ url.Values) {
+		handler.ServeHTTP(rw, req)
+	})
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"github.com/btoll/cpss/server/app"
+	"github.com/btoll/cpss/server/sql"
+	"github.com/goadesign/goa"
+)
+
+// NoteTemplateController implements the NoteTemplate resource.
+type NoteTemplateController struct {
+	*goa.Controller
+	noteTemplates sql.NoteTemplateRepository
+}
+
+// NewNoteTemplateController creates a NoteTemplate controller.
+func NewNoteTemplateController(service *goa.Service, noteTemplates sql.NoteTemplateRepository) *NoteTemplateController {
+	return &NoteTemplateController{
+		Controller:    service.NewController("NoteTemplateController"),
+		noteTemplates: noteTemplates,
+	}
+}
+
+// Delete runs the delete action.
+func (c *NoteTemplateController) Delete(ctx *app.DeleteNoteTemplateContext) error {
+	// NoteTemplateController_Delete: start_implement
+
+	err := c.noteTemplates.Delete(ctx, ctx.ID)
+	if err != nil {
+		return err
+	}
+	return ctx.OKTiny(&app.NoteFieldMediaTiny{ctx.ID})
+
+	// NoteTemplateController_Delete: end_implement
+}
+
+// Show runs the show action.
+func (c *NoteTemplateController) Show(ctx *app.ShowNoteTemplateContext) error {
+	// NoteTemplateController_Show: start_implement
+
+	collection, err := c.noteTemplates.Read(ctx, ctx.ID)
+	if err != nil {
+		return err
+	}
+	return ctx.OK(collection)
+
+	// NoteTemplateController_Show: end_implement
+}
+
+// Update runs the update action.
+func (c *NoteTemplateController) Update(ctx *app.UpdateNoteTemplateContext) error {
+	// NoteTemplateController_Update: start_implement
+
+	collection, err := c.noteTemplates.Update(ctx, ctx.Payload)
+	if err != nil {
+		return err
+	}
+	return ctx.OK(collection)
+
+	// NoteTemplateController_Update: end_implement
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"github.com/btoll/cpss/server/app"
+	"github.com/btoll/cpss/server/sql"
+	"github.com/goadesign/goa"
+)
+
+// NotificationController implements the Notification resource.
+type NotificationController struct {
+	*goa.Controller
+	notifications sql.NotificationRepository
+}
+
+// NewNotificationController creates a Notification controller.
+func NewNotificationController(service *goa.Service, notifications sql.NotificationRepository) *NotificationController {
+	return &NotificationController{
+		Controller:    service.NewController("NotificationController"),
+		notifications: notifications,
+	}
+}
+
+// Show runs the show action.
+func (c *NotificationController) Show(ctx *app.ShowNotificationContext) error {
+	// NotificationController_Show: start_implement
+
+	rec, err := c.notifications.Read(ctx, ctx.ID)
+	if err != nil {
+		return err
+	}
+	return ctx.OK(rec)
+
+	// NotificationController_Show: end_implement
+}
+
+// Update runs the update action.
+func (c *NotificationController) Update(ctx *app.UpdateNotificationContext) error {
+	// NotificationController_Update: start_implement
+
+	// The id in the route is the specialist whose preferences are being replaced.
+	ctx.Payload.Specialist = ctx.ID
+	rec, err := c.notifications.Update(ctx, ctx.Payload)
+	if err != nil {
+		return err
+	}
+	return ctx.OK(rec)
+
+	// NotificationController_Update: end_implement
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/btoll/cpss/server/sql"
+	"github.com/goadesign/goa"
+)
+
+// Returns the page query of the query string that every page action takes.
+func pageQuery(page int, sort *string, perPage *int, fields *string) sql.PageQuery {
+	query := sql.PageQuery{
+		Page: page,
+		Sort: stringOrEmpty(sort),
+	}
+	if perPage != nil {
+		query.PerPage = *perPage
+	}
+	if fields != nil {
+		for _, field := range strings.Split(*fields, ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				query.Fields = append(query.Fields, field)
+			}
+		}
+	}
+	return query
+}
+
+// Sends a page with only the given fields of each record.  The id is always sent so that the client
+// can still tell the records apart, and the pager is always sent whole.
+func sendFields(ctx context.Context, rd *goa.ResponseData, fields []string, paging interface{}) error {
+	b, err := json.Marshal(paging)
+	if err != nil {
+		return err
+	}
+	body := map[string]interface{}{}
+	if err = json.Unmarshal(b, &body); err != nil {
+		return err
+	}
+	keep := map[string]bool{"id": true}
+	for _, field := range fields {
+		keep[field] = true
+	}
+	for key, value := range body {
+		records, ok := value.([]interface{})
+		if key == "pager" || !ok {
+			continue
+		}
+		for _, record := range records {
+			if r, ok := record.(map[string]interface{}); ok {
+				for field := range r {
+					if !keep[field] {
+						delete(r, field)
+					}
+				}
+			}
+		}
+	}
+	rd.Header().Set("Content-Type", "application/json")
+	return rd.Service.Send(ctx, 200, body)
+}
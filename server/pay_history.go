@@ -1,6 +1,8 @@
 package main
 
 import (
+	"strconv"
+
 	"github.com/btoll/cpss/server/app"
 	"github.com/btoll/cpss/server/sql"
 	"github.com/goadesign/goa"
@@ -9,22 +11,43 @@ import (
 // PayHistoryController implements the PayHistory resource.
 type PayHistoryController struct {
 	*goa.Controller
+	payHistory sql.PayHistoryRepository
 }
 
 // NewPayHistoryController creates a PayHistory controller.
-func NewPayHistoryController(service *goa.Service) *PayHistoryController {
-	return &PayHistoryController{Controller: service.NewController("PayHistoryController")}
+func NewPayHistoryController(service *goa.Service, payHistory sql.PayHistoryRepository) *PayHistoryController {
+	return &PayHistoryController{
+		Controller: service.NewController("PayHistoryController"),
+		payHistory: payHistory,
+	}
+}
+
+// Export runs the export action.
+func (c *PayHistoryController) Export(ctx *app.ExportPayHistoryContext) error {
+	// PayHistoryController_Export: start_implement
+
+	w, err := newExportWriter(ctx.ResponseData, ctx.Format, "payhistory")
+	if err != nil {
+		return err
+	}
+	return c.payHistory.Export(ctx, &sql.PayHistoryExportQuery{Filter: ctx.Payload}, w)
+
+	// PayHistoryController_Export: end_implement
 }
 
 // List runs the show action.
 func (c *PayHistoryController) Show(ctx *app.ShowPayHistoryContext) error {
 	// PayHistoryController_List: start_implement
 
-	collection, err := sql.List(sql.NewPayHistory(ctx.ID))
+	specialist, err := strconv.Atoi(ctx.ID)
+	if err != nil {
+		return goa.ErrBadRequest("Bad id: expected the id of a specialist")
+	}
+	collection, err := c.payHistory.List(ctx, specialist)
 	if err != nil {
 		return err
 	}
-	return ctx.OK(collection.(app.PayHistoryMediaCollection))
+	return ctx.OK(collection)
 
 	// PayHistoryController_Show: end_implement
 }
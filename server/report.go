@@ -0,0 +1,70 @@
+package main
+
+import (
+	"github.com/btoll/cpss/server/app"
+	"github.com/btoll/cpss/server/sql"
+	"github.com/goadesign/goa"
+)
+
+// ReportController implements the Report resource.
+type ReportController struct {
+	*goa.Controller
+	reports sql.ReportRepository
+}
+
+// NewReportController creates a Report controller.
+func NewReportController(service *goa.Service, reports sql.ReportRepository) *ReportController {
+	return &ReportController{
+		Controller: service.NewController("ReportController"),
+		reports:    reports,
+	}
+}
+
+// Billing runs the billing action.
+func (c *ReportController) Billing(ctx *app.BillingReportContext) error {
+	// ReportController_Billing: start_implement
+
+	collection, err := c.reports.Billing(ctx, newReportQuery(ctx.Payload))
+	if err != nil {
+		return err
+	}
+	return ctx.OK(collection)
+
+	// ReportController_Billing: end_implement
+}
+
+// Productivity runs the productivity action.
+func (c *ReportController) Productivity(ctx *app.ProductivityReportContext) error {
+	// ReportController_Productivity: start_implement
+
+	collection, err := c.reports.Productivity(ctx, newReportQuery(ctx.Payload))
+	if err != nil {
+		return err
+	}
+	return ctx.OK(collection)
+
+	// ReportController_Productivity: end_implement
+}
+
+// Utilization runs the utilization action.
+func (c *ReportController) Utilization(ctx *app.UtilizationReportContext) error {
+	// ReportController_Utilization: start_implement
+
+	collection, err := c.reports.Utilization(ctx, newReportQuery(ctx.Payload))
+	if err != nil {
+		return err
+	}
+	return ctx.OK(collection)
+
+	// ReportController_Utilization: end_implement
+}
+
+func newReportQuery(payload *app.ReportQueryPayload) *sql.ReportQuery {
+	return &sql.ReportQuery{
+		StartDate: payload.StartDate,
+		EndDate:   payload.EndDate,
+		Statuses:  payload.Statuses,
+		States:    payload.States,
+		GroupBy:   payload.GroupBy,
+	}
+}
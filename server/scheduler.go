@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/btoll/cpss/server/app"
+	"github.com/btoll/cpss/server/sql"
+	"github.com/goadesign/goa"
+	"github.com/robfig/cron"
+)
+
+// What started a job run.
+const (
+	triggerSchedule = "schedule"
+	triggerManual   = "manual"
+)
+
+// A job holds the lock for at most this long, after which another instance can run it.
+var jobLockTTL = time.Hour
+
+type Job struct {
+	Name        string
+	Description string
+	// Standard cron syntax, e.g. "0 2 * * *" is every day at 2am.
+	Spec string
+	// Returns what should be recorded as the output of the run.  The context carries the logger of the run.
+	Run func(ctx context.Context) (string, error)
+
+	schedule cron.Schedule
+	next     time.Time
+}
+
+// Runs the jobs on their schedules.  Every instance of the server has a scheduler, but a job's lock
+// makes sure that only one of them runs it at a time.
+type Scheduler struct {
+	Service  *goa.Service
+	Instance string
+	Jobs     []*Job
+
+	runs sql.JobRepository
+
+	mutex sync.Mutex
+}
+
+func NewScheduler(service *goa.Service, runs sql.JobRepository, jobs []*Job) (*Scheduler, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for _, job := range jobs {
+		job.schedule, err = cron.ParseStandard(job.Spec)
+		if err != nil {
+			return nil, fmt.Errorf("Bad schedule for job %s: %s", job.Name, err.Error())
+		}
+		job.next = job.schedule.Next(now)
+	}
+	return &Scheduler{
+		Service:  service,
+		Instance: fmt.Sprintf("%s:%d", hostname, os.Getpid()),
+		Jobs:     jobs,
+		runs:     runs,
+	}, nil
+}
+
+func (s *Scheduler) Find(name string) *Job {
+	for _, job := range s.Jobs {
+		if job.Name == name {
+			return job
+		}
+	}
+	return nil
+}
+
+func (s *Scheduler) NextRun(job *Job) time.Time {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return job.next
+}
+
+// Checks the schedules every minute, which is as fine-grained as cron gets.
+func (s *Scheduler) Start() {
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		for now := range ticker.C {
+			s.tick(now)
+		}
+	}()
+}
+
+func (s *Scheduler) tick(now time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, job := range s.Jobs {
+		if job.next.After(now) {
+			continue
+		}
+		job.next = job.schedule.Next(now)
+		// It's expected that another instance sometimes gets the lock first.
+		if _, err := s.Trigger(context.Background(), job, triggerSchedule); err != nil {
+			s.Service.LogInfo("job skipped", "job", job.Name, "err", err)
+		}
+	}
+}
+
+// Starts a run of the job and returns right away.  The run outlives the request that triggered it, so it
+// only keeps the request's logger.
+func (s *Scheduler) Trigger(ctx context.Context, job *Job, trigger string) (*app.JobRunMedia, error) {
+	run, err := s.runs.StartRun(ctx, job.Name, trigger, s.Instance, jobLockTTL)
+	if err != nil {
+		return nil, err
+	}
+	runCtx := sql.WithLogger(context.Background(), sql.Log(ctx).With("job", job.Name, "run", run.ID))
+	go s.finish(runCtx, job, run)
+	return run, nil
+}
+
+// A run is cancelled once its lock has expired, since by then another instance could start it again.
+func (s *Scheduler) finish(ctx context.Context, job *Job, run *app.JobRunMedia) {
+	var output string
+	var err error
+	runCtx, cancel := context.WithTimeout(ctx, jobLockTTL)
+	defer cancel()
+	// A job that panics must still release its lock.
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+		if err != nil {
+			sql.Log(ctx).Error("job failed", "err", err)
+		}
+		if finishErr := s.runs.FinishRun(ctx, run, output, err); finishErr != nil {
+			sql.Log(ctx).Error("job not finished", "err", finishErr)
+		}
+	}()
+	output, err = job.Run(runCtx)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"github.com/btoll/cpss/server/app"
+	"github.com/btoll/cpss/server/sql"
+	"github.com/goadesign/goa"
+)
+
+// SearchController implements the Search resource.
+type SearchController struct {
+	*goa.Controller
+	search sql.SearchRepository
+}
+
+// NewSearchController creates a Search controller.
+func NewSearchController(service *goa.Service, search sql.SearchRepository) *SearchController {
+	return &SearchController{
+		Controller: service.NewController("SearchController"),
+		search:     search,
+	}
+}
+
+// Search runs the search action.
+func (c *SearchController) Search(ctx *app.SearchSearchContext) error {
+	// SearchController_Search: start_implement
+
+	principal := sql.PrincipalFromContext(ctx)
+	if principal == nil {
+		return ctx.Unauthorized()
+	}
+	collection, err := c.search.Search(ctx, &sql.SearchQuery{
+		Terms:     ctx.Q,
+		Types:     ctx.Types,
+		Limit:     ctx.Limit,
+		Principal: principal,
+	})
+	if err != nil {
+		return err
+	}
+	return ctx.OK(collection)
+
+	// SearchController_Search: end_implement
+}
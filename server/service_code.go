@@ -9,22 +9,26 @@ import (
 // ServiceCodeController implements the ServiceCode resource.
 type ServiceCodeController struct {
 	*goa.Controller
+	serviceCodes sql.ServiceCodeRepository
 }
 
 // NewServiceCodeController creates a ServiceCode controller.
-func NewServiceCodeController(service *goa.Service) *ServiceCodeController {
-	return &ServiceCodeController{Controller: service.NewController("ServiceCodeController")}
+func NewServiceCodeController(service *goa.Service, serviceCodes sql.ServiceCodeRepository) *ServiceCodeController {
+	return &ServiceCodeController{
+		Controller:   service.NewController("ServiceCodeController"),
+		serviceCodes: serviceCodes,
+	}
 }
 
 // Create runs the create action.
 func (c *ServiceCodeController) Create(ctx *app.CreateServiceCodeContext) error {
 	// ServiceCodeController_Create: start_implement
 
-	res, err := sql.Create(sql.NewServiceCode(ctx.Payload))
+	res, err := c.serviceCodes.Create(ctx, ctx.Payload)
 	if err != nil {
 		return err
 	}
-	return ctx.OK(res.(*app.ServiceCodeMedia))
+	return ctx.OK(res)
 
 	// ServiceCodeController_Create: end_implement
 }
@@ -33,7 +37,7 @@ func (c *ServiceCodeController) Create(ctx *app.CreateServiceCodeContext) error
 func (c *ServiceCodeController) Delete(ctx *app.DeleteServiceCodeContext) error {
 	// ServiceCodeController_Delete: start_implement
 
-	err := sql.Delete(sql.NewServiceCode(ctx.ID))
+	err := c.serviceCodes.Delete(ctx, ctx.ID)
 	if err != nil {
 		return err
 	}
@@ -46,24 +50,39 @@ func (c *ServiceCodeController) Delete(ctx *app.DeleteServiceCodeContext) error
 func (c *ServiceCodeController) List(ctx *app.ListServiceCodeContext) error {
 	// ServiceCodeController_List: start_implement
 
-	collection, err := sql.List(sql.NewServiceCode(nil))
+	collection, err := c.serviceCodes.List(ctx)
 	if err != nil {
 		return err
 	}
-	return ctx.OK(collection.(app.ServiceCodeMediaCollection))
+	return ctx.OK(collection)
 
 	// ServiceCodeController_List: end_implement
 }
 
+// Patch runs the patch action.
+func (c *ServiceCodeController) Patch(ctx *app.PatchServiceCodeContext) error {
+	// ServiceCodeController_Patch: start_implement
+
+	// The id in the route is the record that's being patched.
+	ctx.Payload.ID = &ctx.ID
+	rec, err := c.serviceCodes.Patch(ctx, ctx.Payload)
+	if err != nil {
+		return err
+	}
+	return ctx.OK(rec)
+
+	// ServiceCodeController_Patch: end_implement
+}
+
 // Update runs the update action.
 func (c *ServiceCodeController) Update(ctx *app.UpdateServiceCodeContext) error {
 	// ServiceCodeController_Update: start_implement
 
-	rec, err := sql.Update(sql.NewServiceCode(ctx.Payload))
+	rec, err := c.serviceCodes.Update(ctx, ctx.Payload)
 	if err != nil {
 		return err
 	}
-	return ctx.OK(rec.(*app.ServiceCodeMedia))
+	return ctx.OK(rec)
 
 	// ServiceCodeController_Update: end_implement
 }
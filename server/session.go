@@ -1,7 +1,8 @@
 package main
 
 import (
-	"time"
+	"context"
+	"os"
 
 	"github.com/btoll/cpss/server/app"
 	"github.com/btoll/cpss/server/sql"
@@ -11,50 +12,113 @@ import (
 // SessionController implements the Session resource.
 type SessionController struct {
 	*goa.Controller
+	sessions  sql.SessionRepository
+	twoFactor sql.TwoFactorRepository
 }
 
 // NewSessionController creates a Session controller.
-func NewSessionController(service *goa.Service) *SessionController {
-	return &SessionController{Controller: service.NewController("SessionController")}
+func NewSessionController(service *goa.Service, sessions sql.SessionRepository, twoFactor sql.TwoFactorRepository) *SessionController {
+	return &SessionController{
+		Controller: service.NewController("SessionController"),
+		sessions:   sessions,
+		twoFactor:  twoFactor,
+	}
 }
 
 // Auth runs the auth action.
 func (c *SessionController) Auth(ctx *app.AuthSessionContext) error {
 	// SessionController_Auth: start_implement
 
-	rec, err := sql.VerifyPassword(*ctx.Payload.Username, ctx.Payload.Password)
+	if ctx.Payload.Username == nil {
+		return ctx.Unauthorized()
+	}
+	r, err := c.sessions.VerifyPassword(ctx, *ctx.Payload.Username, ctx.Payload.Password)
+	if err == sql.ErrBadLogin {
+		return ctx.Unauthorized()
+	}
 	if err != nil {
 		return err
 	}
-	r := rec.(*app.SessionMedia)
-	_, err = sql.Update(sql.NewSpecialist(&app.SpecialistPayload{
-		ID:        &r.ID,
-		Username:  r.Username,
-		Password:  r.Password,
-		Firstname: r.Firstname,
-		Lastname:  r.Lastname,
-		Active:    r.Active,
-		Email:     r.Email,
-		Payrate:   r.Payrate,
-		AuthLevel: r.AuthLevel,
-		LoginTime: int(time.Now().Unix()),
-	}))
+	challenge, err := c.twoFactor.Start(ctx, r.ID, r.AuthLevel)
 	if err != nil {
 		return err
 	}
-	return ctx.OK(rec.(*app.SessionMedia))
+	if challenge != nil {
+		return ctx.Accepted(challenge)
+	}
+	if err = c.startSession(ctx, r); err != nil {
+		return err
+	}
+	return ctx.OK(r)
 
 	// SessionController_Auth: end_implement
 }
 
-// Hash runs the hash action.
-func (c *SessionController) Hash(ctx *app.HashSessionContext) error {
-	// SessionController_Hash: start_implement
+// Password runs the password action.
+func (c *SessionController) Password(ctx *app.PasswordSessionContext) error {
+	// SessionController_Password: start_implement
+
+	err := c.sessions.ResetPassword(ctx, ctx.Payload.Token, ctx.Payload.Password)
+	if err != nil {
+		return err
+	}
+	return ctx.NoContent()
+
+	// SessionController_Password: end_implement
+}
+
+// Reset runs the reset action.
+func (c *SessionController) Reset(ctx *app.ResetSessionContext) error {
+	// SessionController_Reset: start_implement
+
+	err := c.sessions.RequestPasswordReset(ctx, ctx.Payload.Username, resetLinkFormat())
+	if err != nil {
+		return err
+	}
+	return ctx.NoContent()
+
+	// SessionController_Reset: end_implement
+}
 
-	return ctx.OKTiny(&app.SessionMediaTiny{
-		ID:       *ctx.Payload.ID,
-		Password: string(sql.SaltAndHash(ctx.Payload.Password)),
-	})
+// Verify runs the verify action.
+func (c *SessionController) Verify(ctx *app.VerifySessionContext) error {
+	// SessionController_Verify: start_implement
 
-	// SessionController_Hash: end_implement
+	id, err := c.twoFactor.Verify(ctx, ctx.Payload.Challenge, ctx.Payload.Code)
+	if err == sql.ErrBadLogin {
+		return ctx.Unauthorized()
+	}
+	if err != nil {
+		return err
+	}
+	r, err := c.sessions.Read(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err = c.startSession(ctx, r); err != nil {
+		return err
+	}
+	return ctx.OK(r)
+
+	// SessionController_Verify: end_implement
+}
+
+// A session starts once every step of authenticating is done.  The token it returns is how every
+// request after this one is authenticated.
+func (c *SessionController) startSession(ctx context.Context, r *app.SessionMedia) error {
+	token, err := c.sessions.Start(ctx, r.ID)
+	if err != nil {
+		return err
+	}
+	r.Token = &token
+	return nil
+}
+
+// Where the reset links point, overridden by the CPSS_RESET_URL environment variable.  The token is
+// put in place of the %s.
+func resetLinkFormat() string {
+	if url := os.Getenv("CPSS_RESET_URL"); url != "" {
+		return url
+	}
+	return "http://localhost:8080/#reset/%s"
 }
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"github.com/btoll/cpss/server/app"
+	"github.com/btoll/cpss/server/sql"
+	"github.com/goadesign/goa"
+)
+
+// SignatureController implements the Signature resource.
+type SignatureController struct {
+	*goa.Controller
+	signatures sql.SignatureRepository
+}
+
+// NewSignatureController creates a Signature controller.
+func NewSignatureController(service *goa.Service, signatures sql.SignatureRepository) *SignatureController {
+	return &SignatureController{
+		Controller: service.NewController("SignatureController"),
+		signatures: signatures,
+	}
+}
+
+// Create runs the create action.
+func (c *SignatureController) Create(ctx *app.CreateSignatureContext) error {
+	// SignatureController_Create: start_implement
+
+	rec, err := c.signatures.Create(ctx, ctx.Payload)
+	if err != nil {
+		return err
+	}
+	return ctx.OK(rec)
+
+	// SignatureController_Create: end_implement
+}
+
+// Show runs the show action.
+func (c *SignatureController) Show(ctx *app.ShowSignatureContext) error {
+	// SignatureController_Show: start_implement
+
+	collection, err := c.signatures.Read(ctx, ctx.ID)
+	if err != nil {
+		return err
+	}
+	return ctx.OK(collection)
+
+	// SignatureController_Show: end_implement
+}
+
+// Verify runs the verify action.
+func (c *SignatureController) Verify(ctx *app.VerifySignatureContext) error {
+	// SignatureController_Verify: start_implement
+
+	collection, err := c.signatures.Verify(ctx, ctx.ID)
+	if err != nil {
+		return err
+	}
+	return ctx.OK(collection)
+
+	// SignatureController_Verify: end_implement
+}
@@ -10,22 +10,26 @@ import (
 // SpecialistController implements the Specialist resource.
 type SpecialistController struct {
 	*goa.Controller
+	specialists sql.SpecialistRepository
 }
 
 // NewSpecialistController creates a Specialist controller.
-func NewSpecialistController(service *goa.Service) *SpecialistController {
-	return &SpecialistController{Controller: service.NewController("SpecialistController")}
+func NewSpecialistController(service *goa.Service, specialists sql.SpecialistRepository) *SpecialistController {
+	return &SpecialistController{
+		Controller:  service.NewController("SpecialistController"),
+		specialists: specialists,
+	}
 }
 
 // Create runs the create action.
 func (c *SpecialistController) Create(ctx *app.CreateSpecialistContext) error {
 	// SpecialistController_Create: start_implement
 
-	res, err := sql.Create(sql.NewSpecialist(ctx.Payload))
+	res, err := c.specialists.Create(ctx, ctx.Payload)
 	if err != nil {
 		return err
 	}
-	return ctx.OK(res.(*app.SpecialistMedia))
+	return ctx.OK(res)
 
 	// SpecialistController_Create: end_implement
 }
@@ -34,7 +38,7 @@ func (c *SpecialistController) Create(ctx *app.CreateSpecialistContext) error {
 func (c *SpecialistController) Delete(ctx *app.DeleteSpecialistContext) error {
 	// SpecialistController_Delete: start_implement
 
-	err := sql.Delete(sql.NewSpecialist(ctx.ID))
+	err := c.specialists.Delete(ctx, ctx.ID)
 	if err != nil {
 		return err
 	}
@@ -43,15 +47,28 @@ func (c *SpecialistController) Delete(ctx *app.DeleteSpecialistContext) error {
 	// SpecialistController_Delete: end_implement
 }
 
+// Export runs the export action.
+func (c *SpecialistController) Export(ctx *app.ExportSpecialistContext) error {
+	// SpecialistController_Export: start_implement
+
+	w, err := newExportWriter(ctx.ResponseData, ctx.Format, "specialists")
+	if err != nil {
+		return err
+	}
+	return c.specialists.Export(ctx, &sql.SpecialistExportQuery{Filter: ctx.Payload}, w)
+
+	// SpecialistController_Export: end_implement
+}
+
 // List runs the list action.
 func (c *SpecialistController) List(ctx *app.ListSpecialistContext) error {
 	// SpecialistController_List: start_implement
 
-	collection, err := sql.List(sql.NewSpecialist(nil))
+	collection, err := c.specialists.List(ctx)
 	if err != nil {
 		return err
 	}
-	return ctx.OK(collection.([]*app.SpecialistItem))
+	return ctx.OK(collection)
 
 	// SpecialistController_List: end_implement
 }
@@ -60,37 +77,96 @@ func (c *SpecialistController) List(ctx *app.ListSpecialistContext) error {
 func (c *SpecialistController) Page(ctx *app.PageSpecialistContext) error {
 	// SpecialistController_Page: start_implement
 
-	collection, err := sql.Page(sql.NewSpecialist(&sql.PageQuery{ctx.Page, *ctx.Payload.WhereClause}))
+	query := pageQuery(ctx.Page, ctx.Sort, ctx.PerPage, ctx.Fields)
+	collection, err := c.specialists.Page(ctx, &sql.SpecialistPageQuery{
+		PageQuery: query,
+		Filter:    ctx.Payload,
+	})
 	if err != nil {
 		return err
 	}
-	return ctx.OKPaging(collection.(*app.SpecialistMediaPaging))
+	if len(query.Fields) > 0 {
+		return sendFields(ctx, ctx.ResponseData, query.Fields, collection)
+	}
+	return ctx.OKPaging(collection)
 
 	// SpecialistController_Page: end_implement
 }
 
+// Patch runs the patch action.
+func (c *SpecialistController) Patch(ctx *app.PatchSpecialistContext) error {
+	// SpecialistController_Patch: start_implement
+
+	// The id in the route is the record that's being patched.
+	ctx.Payload.ID = &ctx.ID
+	rec, err := c.specialists.Patch(ctx, ctx.Payload)
+	if err != nil {
+		return err
+	}
+	return ctx.OK(rec)
+
+	// SpecialistController_Patch: end_implement
+}
+
+// Password runs the password action.
+func (c *SpecialistController) Password(ctx *app.PasswordSpecialistContext) error {
+	// SpecialistController_Password: start_implement
+
+	err := c.specialists.ChangePassword(ctx, ctx.ID, ctx.Payload.CurrentPassword, ctx.Payload.Password)
+	if err == sql.ErrBadLogin || err == sql.ErrNoPrincipal {
+		return ctx.Unauthorized()
+	}
+	if err != nil {
+		return err
+	}
+	rec, err := c.specialists.Read(ctx, ctx.ID)
+	if err != nil {
+		return err
+	}
+	return ctx.OK(rec)
+
+	// SpecialistController_Password: end_implement
+}
+
 // Show runs the show action.
 func (c *SpecialistController) Show(ctx *app.ShowSpecialistContext) error {
 	// SpecialistController_Show: start_implement
 
-	rec, err := sql.Read(sql.NewSpecialist(ctx.ID))
+	rec, err := c.specialists.Read(ctx, ctx.ID)
 	if err != nil {
 		return err
 	}
-	return ctx.OK(rec.(*app.SpecialistMedia))
+	return ctx.OK(rec)
 
 	// SpecialistController_Show: end_implement
 }
 
+// Unlock runs the unlock action.
+func (c *SpecialistController) Unlock(ctx *app.UnlockSpecialistContext) error {
+	// SpecialistController_Unlock: start_implement
+
+	err := c.specialists.Unlock(ctx, ctx.ID)
+	if err != nil {
+		return err
+	}
+	rec, err := c.specialists.Read(ctx, ctx.ID)
+	if err != nil {
+		return err
+	}
+	return ctx.OK(rec)
+
+	// SpecialistController_Unlock: end_implement
+}
+
 // Update runs the update action.
 func (c *SpecialistController) Update(ctx *app.UpdateSpecialistContext) error {
 	// SpecialistController_Update: start_implement
 
-	rec, err := sql.Update(sql.NewSpecialist(ctx.Payload))
+	rec, err := c.specialists.Update(ctx, ctx.Payload)
 	if err != nil {
 		return err
 	}
-	return ctx.OK(rec.(*app.SpecialistMedia))
+	return ctx.OK(rec)
 
 	// SpecialistController_Update: end_implement
 }
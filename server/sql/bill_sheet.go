@@ -1,6 +1,7 @@
 package sql
 
 import (
+	"context"
 	mysql "database/sql"
 	"errors"
 	"fmt"
@@ -13,25 +14,155 @@ import (
 )
 
 type BillSheet struct {
-	Data interface{}
-	Stmt map[string]string
+	db *mysql.DB
 }
 
-func NewBillSheet(payload interface{}) *BillSheet {
-	return &BillSheet{
-		Data: payload,
-		Stmt: map[string]string{
-			"CONSUMER_INNER_JOIN": "INNER JOIN consumer ON consumer.id = billsheet.consumer INNER JOIN active ON consumer.active = active.id",
-			"DELETE":              "DELETE FROM billsheet WHERE id=?",
-			"GET_AUTH_LEVEL":      "SELECT authLevel FROM specialist WHERE id=%d",
-			"GET_UNIT_RATE":       "SELECT unitRate FROM service_code WHERE id=%d",
-			"INSERT":              "INSERT billsheet SET specialist=?,consumer=?,units=?,serviceDate=?,serviceCode=?,status=?,billedAmount=?,confirmation=?,description=?",
-			"SELECT":              "SELECT %s FROM billsheet %s",
-			"SELECT_UNIT_BLOCK":   "SELECT %s FROM unit_block WHERE consumer=%d AND serviceCode=%d",
-			"UPDATE_UNIT_BLOCK":   "UPDATE unit_block SET units=? WHERE id=?",
-			"UPDATE":              "UPDATE billsheet SET specialist=?,consumer=?,units=?,serviceDate=?,serviceCode=?,status=?,billedAmount=?,confirmation=?,description=? WHERE id=?",
-		},
+func NewBillSheet(db *mysql.DB) *BillSheet {
+	return &BillSheet{db: db}
+}
+
+var billSheetStmt = struct {
+	ConsumerInnerJoin string
+	Delete            string
+	DeleteNotes       string
+	GetAuthLevel      string
+	GetUnitRate       string
+	IsAssigned        string
+	InsertNote        string
+	Insert            string
+	Select            string
+	SelectNotes       string
+	SelectNotesIn     string
+	SelectUnitBlock   string
+	UpdateConsumer    string
+	UpdateUnitBlock   string
+	Update            string
+}{
+	ConsumerInnerJoin: "INNER JOIN consumer ON consumer.id = billsheet.consumer INNER JOIN active ON consumer.active = active.id",
+	Delete:            "DELETE FROM billsheet WHERE id=?",
+	DeleteNotes:       "DELETE FROM billsheet_note WHERE billsheet=?",
+	GetAuthLevel:      "SELECT authLevel FROM specialist WHERE id=%d",
+	GetUnitRate:       "SELECT unitRate FROM service_code WHERE id=%d",
+	IsAssigned:        "SELECT COUNT(*) FROM caseload WHERE specialist=%d AND consumer=%d AND %s",
+	InsertNote:        "INSERT billsheet_note SET billsheet=?,field=?,value=?",
+	Insert:            "INSERT billsheet SET specialist=?,consumer=?,units=?,serviceDate=?,serviceCode=?,status=?,billedAmount=?,confirmation=?,description=?",
+	Select:            "SELECT %s FROM billsheet %s",
+	SelectNotes:       "SELECT %s FROM billsheet_note WHERE billsheet=%d",
+	SelectNotesIn:     "SELECT billsheet,field,value FROM billsheet_note WHERE billsheet IN (%s)",
+	SelectUnitBlock:   "SELECT %s FROM unit_block WHERE consumer=%d AND serviceCode=%d",
+	UpdateConsumer:    "UPDATE consumer SET version=version+1 WHERE id=?",
+	UpdateUnitBlock:   "UPDATE unit_block SET units=? WHERE id=?",
+	Update:            "UPDATE billsheet SET specialist=?,consumer=?,units=?,serviceDate=?,serviceCode=?,status=?,billedAmount=?,confirmation=?,description=?,version=version+1 WHERE id=? AND version=?",
+}
+
+func init() {
+	registerStmts("BillSheet", billSheetStmt)
+}
+
+func (s *BillSheet) Bulk(ctx context.Context, query *BulkQuery) (_ []*app.TransitionResultItem, err error) {
+	defer logError(ctx, "Bulk BillSheet", &err)
+	return NewBillSheetBulk(query).Bulk(ctx, s.db)
+}
+
+func (s *BillSheet) Create(ctx context.Context, payload *app.BillSheetPayload) (_ *app.BillSheetMedia, err error) {
+	defer logError(ctx, "Create BillSheet", &err)
+	return s.create(ctx, s.db, payload)
+}
+
+func (s *BillSheet) Delete(ctx context.Context, id int) (err error) {
+	defer logError(ctx, "Delete BillSheet", &err)
+	if err = s.CheckScope(ctx, s.db, PrincipalFromContext(ctx), id); err != nil {
+		return err
+	}
+	return s.delete(ctx, s.db, id)
+}
+
+func (s *BillSheet) Export(ctx context.Context, query *BillSheetExportQuery, w RowWriter) (err error) {
+	defer logError(ctx, "Export BillSheet", &err)
+	return s.export(ctx, s.db, query, w)
+}
+
+func (s *BillSheet) List(ctx context.Context, principal *Principal) (_ []*app.BillSheetItem, err error) {
+	defer logError(ctx, "List BillSheet", &err)
+	return s.list(ctx, s.db, principal)
+}
+
+func (s *BillSheet) Page(ctx context.Context, query *BillSheetPageQuery) (_ *app.BillSheetMediaPaging, err error) {
+	defer logError(ctx, "Page BillSheet", &err)
+	return s.page(ctx, s.db, query)
+}
+
+func (s *BillSheet) Patch(ctx context.Context, payload *app.BillSheetPatchPayload) (_ *app.BillSheetMedia, err error) {
+	defer logError(ctx, "Patch BillSheet", &err)
+	if err = s.CheckScope(ctx, s.db, PrincipalFromContext(ctx), *payload.ID); err != nil {
+		return nil, err
+	}
+	return s.patch(ctx, s.db, payload)
+}
+
+func (s *BillSheet) Read(ctx context.Context, id int) (_ *app.BillSheetMedia, err error) {
+	defer logError(ctx, "Read BillSheet", &err)
+	if err = s.CheckScope(ctx, s.db, PrincipalFromContext(ctx), id); err != nil {
+		return nil, err
 	}
+	return s.read(ctx, s.db, id)
+}
+
+func (s *BillSheet) Transition(ctx context.Context, query *TransitionQuery) (_ []*app.TransitionResultItem, err error) {
+	defer logError(ctx, "Transition BillSheet", &err)
+	return NewWorkflow(query).Transition(ctx, s.db)
+}
+
+func (s *BillSheet) Update(ctx context.Context, payload *app.BillSheetPayload) (_ *app.BillSheetMedia, err error) {
+	defer logError(ctx, "Update BillSheet", &err)
+	if err = s.CheckScope(ctx, s.db, PrincipalFromContext(ctx), *payload.ID); err != nil {
+		return nil, err
+	}
+	return s.update(ctx, s.db, payload)
+}
+
+// The columns that are selected when collecting rows.
+const billSheetColumns = "id,specialist,consumer,units,DATE_FORMAT(serviceDate, '%m/%d/%y') AS serviceDate,serviceCode,status,billedAmount,confirmation,description,state,version"
+
+// The columns of an export.  The foreign keys are resolved to names so that the spreadsheet can be read on its own.
+const billSheetExportColumns = "billsheet.id," +
+	"(SELECT CONCAT(lastname,', ',firstname) FROM specialist WHERE specialist.id = billsheet.specialist) AS specialistName," +
+	"CONCAT(consumer.lastname,', ',consumer.firstname) AS consumerName," +
+	"billsheet.units," +
+	"DATE_FORMAT(billsheet.serviceDate, '%m/%d/%y') AS serviceDate," +
+	"(SELECT name FROM service_code WHERE service_code.id = billsheet.serviceCode) AS serviceCodeName," +
+	"(SELECT name FROM status WHERE status.id = billsheet.status) AS statusName," +
+	"billsheet.billedAmount,billsheet.confirmation,billsheet.description,billsheet.state"
+
+var billSheetExportHeader = []string{"ID", "Specialist", "Consumer", "Units", "Service Date", "Service Code", "Status", "Billed Amount", "Confirmation", "Description", "State"}
+
+// A page or an export of billsheets narrowed down by the structured filters and sorted as asked.
+type BillSheetPageQuery struct {
+	PageQuery
+	Filter *app.BillSheetQueryPayload
+}
+
+type BillSheetExportQuery struct {
+	ExportQuery
+	Sort   string
+	Filter *app.BillSheetQueryPayload
+}
+
+// The keys that a billsheet can be sorted by.  The joins are made from the consumer (and the billsheet
+// itself), which is always joined.
+var billSheetSorts = map[string]sortKey{
+	"id":            {[]string{"billsheet.id"}, ""},
+	"serviceDate":   {[]string{"billsheet.serviceDate"}, ""},
+	"billedAmount":  {[]string{"billsheet.billedAmount"}, ""},
+	"units":         {[]string{"billsheet.units"}, ""},
+	"state":         {[]string{"billsheet.state"}, ""},
+	"status":        {[]string{"status.name"}, "LEFT JOIN status ON status.id = billsheet.status"},
+	"consumer":      {[]string{"consumer.lastname", "consumer.firstname"}, ""},
+	"specialist":    {[]string{"specialist.lastname", "specialist.firstname"}, "LEFT JOIN specialist ON specialist.id = billsheet.specialist"},
+	"county":        {[]string{"county.name"}, "LEFT JOIN county ON county.id = consumer.county"},
+	"fundingSource": {[]string{"funding_source.name"}, "LEFT JOIN funding_source ON funding_source.id = consumer.fundingSource"},
+	"dia":           {[]string{"dia.name"}, "LEFT JOIN dia ON dia.id = consumer.dia"},
+	"bsu":           {[]string{"consumer.bsu"}, ""},
 }
 
 func floatToString(f float64) string {
@@ -39,7 +170,8 @@ func floatToString(f float64) string {
 	return strconv.FormatFloat(f, 'f', 2, 64)
 }
 
-func (s *BillSheet) CollectRows(rows *mysql.Rows, coll []*app.BillSheetItem) error {
+// The notes of every row are loaded with one query once all of the rows are in.
+func (s *BillSheet) CollectRows(ctx context.Context, db *mysql.DB, rows *mysql.Rows, coll []*app.BillSheetItem) error {
 	i := 0
 	for rows.Next() {
 		var id int
@@ -52,7 +184,9 @@ func (s *BillSheet) CollectRows(rows *mysql.Rows, coll []*app.BillSheetItem) err
 		var billedAmount float64
 		var confirmation string
 		var description string
-		err := rows.Scan(&id, &specialist, &consumer, &units, &serviceDate, &serviceCode, &status, &billedAmount, &confirmation, &description)
+		var state string
+		var version int
+		err := rows.Scan(&id, &specialist, &consumer, &units, &serviceDate, &serviceCode, &status, &billedAmount, &confirmation, &description, &state, &version)
 		if err != nil {
 			return err
 		}
@@ -67,33 +201,89 @@ func (s *BillSheet) CollectRows(rows *mysql.Rows, coll []*app.BillSheetItem) err
 			BilledAmount: &billedAmount,
 			Confirmation: &confirmation,
 			Description:  &description,
+			Notes:        []*app.NoteItem{},
+			State:        &state,
+			Version:      &version,
 		}
 		i++
 	}
-	return nil
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return s.collectNotes(ctx, db, coll[:i])
 }
 
-func (s *BillSheet) Create(db *mysql.DB) (interface{}, error) {
-	payload := s.Data.(*app.BillSheetPayload)
+func (s *BillSheet) collectNotes(ctx context.Context, db Queryer, coll []*app.BillSheetItem) error {
+	if len(coll) == 0 {
+		return nil
+	}
+	byID := make(map[int]*app.BillSheetItem, len(coll))
+	ids := make([]interface{}, len(coll))
+	for i, b := range coll {
+		byID[b.ID] = b
+		ids[i] = b.ID
+	}
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(billSheetStmt.SelectNotesIn, placeholders(len(ids))), ids...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var billsheet int
+		var field string
+		var value string
+		err = rows.Scan(&billsheet, &field, &value)
+		if err != nil {
+			return err
+		}
+		if b, ok := byID[billsheet]; ok {
+			b.Notes = append(b.Notes, &app.NoteItem{
+				Field: field,
+				Value: value,
+			})
+		}
+	}
+	return rows.Err()
+}
+
+// Runs all of the checks that a new billsheet must pass and returns the formatted service date.
+func (s *BillSheet) Validate(ctx context.Context, db *mysql.DB, payload *app.BillSheetPayload) (string, error) {
 	var formattedDate string
-	isLegal, formattedDate, err := s.IsLegalDate(db, payload)
+	isLegal, formattedDate, err := s.IsLegalDate(ctx, db, payload)
 	if isLegal == false {
-		return nil, err
+		return "", err
 	}
-	if isDuplicate, err := s.IsDuplicateEntry(db, payload, formattedDate); isDuplicate == true {
+	if err = s.CheckSpecialist(ctx, db, PrincipalFromContext(ctx), payload.Specialist); err != nil {
+		return "", err
+	}
+	if isAssigned, err := s.IsAssigned(ctx, db, payload, formattedDate); isAssigned == false {
+		return "", err
+	}
+	if isDuplicate, err := s.IsDuplicateEntry(ctx, db, payload, formattedDate); isDuplicate == true {
+		return "", err
+	}
+	if err = s.ValidateNotes(ctx, db, payload); err != nil {
+		return "", err
+	}
+	return formattedDate, nil
+}
+
+func (s *BillSheet) create(ctx context.Context, db *mysql.DB, payload *app.BillSheetPayload) (*app.BillSheetMedia, error) {
+	formattedDate, err := s.Validate(ctx, db, payload)
+	if err != nil {
 		return nil, err
 	}
-	unitRate, err := s.GetUnitRate(db, payload.ServiceCode)
+	unitRate, err := s.GetUnitRate(ctx, db, payload.ServiceCode)
 	if err != nil {
 		return nil, err
 	}
 	// For now, don't update the billsheet table if the update on consumer fails!
 	// 4 units per hour!
-	err = s.UpdateUnitBlock(db, payload, 0)
+	err = s.UpdateUnitBlock(ctx, db, payload, 0)
 	if err != nil {
 		return nil, err
 	}
-	stmt, err := db.Prepare(s.Stmt["INSERT"])
+	stmt, err := db.PrepareContext(ctx, billSheetStmt.Insert)
 	if err != nil {
 		return nil, err
 	}
@@ -105,16 +295,22 @@ func (s *BillSheet) Create(db *mysql.DB) (interface{}, error) {
 	// Round to the second decimal place.
 	// https://yourbasic.org/golang/round-float-2-decimal-places/
 	f = math.Ceil(f*100) / 100
-	res, err := stmt.Exec(payload.Specialist, payload.Consumer, units, formattedDate, payload.ServiceCode, payload.Status, f, payload.Confirmation, payload.Description)
+	res, err := stmt.ExecContext(ctx, payload.Specialist, payload.Consumer, units, formattedDate, payload.ServiceCode, payload.Status, f, payload.Confirmation, payload.Description)
 	if err != nil {
-		return -1, err
+		return nil, err
 	}
 	var lastID int64
 	lastID, err = res.LastInsertId()
 	if err != nil {
-		return -1, err
+		return nil, err
+	}
+	if err = s.SetNotes(ctx, db, int(lastID), payload.Notes); err != nil {
+		return nil, err
 	}
+	billSheetsCreated.Inc()
 	toStr := floatToString(units)
+	state := StateDraft
+	version := 1
 	return &app.BillSheetMedia{
 		ID:           int(lastID),
 		Specialist:   payload.Specialist,
@@ -126,21 +322,126 @@ func (s *BillSheet) Create(db *mysql.DB) (interface{}, error) {
 		BilledAmount: &f,
 		Confirmation: payload.Confirmation,
 		Description:  payload.Description,
+		Notes:        payload.Notes,
+		State:        &state,
+		Version:      &version,
 	}, nil
 }
 
-func (s *BillSheet) Delete(db *mysql.DB) error {
-	stmt, err := db.Prepare(s.Stmt["DELETE"])
+func (s *BillSheet) delete(ctx context.Context, db *mysql.DB, id int) error {
+	if _, err := s.IsLocked(ctx, db, id); err != nil {
+		return err
+	}
+	stmt, err := db.PrepareContext(ctx, billSheetStmt.Delete)
 	if err != nil {
 		return err
 	}
-	id := s.Data.(int)
-	_, err = stmt.Exec(&id)
+	_, err = stmt.ExecContext(ctx, &id)
 	return err
 }
 
-func (s *BillSheet) GetAuthLevel(db *mysql.DB, specialist int) (int, error) {
-	rows, err := db.Query(fmt.Sprintf(s.Stmt["GET_AUTH_LEVEL"], specialist))
+// Exports every billsheet that the page action would return, in the same order.
+func (s *BillSheet) export(ctx context.Context, db *mysql.DB, query *BillSheetExportQuery, w RowWriter) error {
+	scope := ""
+	if query.Principal != nil {
+		var err error
+		if scope, err = query.Principal.BillSheetScope(); err != nil {
+			return err
+		}
+	}
+	filter, args, err := s.GetFilter(query.Filter)
+	if err != nil {
+		return err
+	}
+	joins, orderBy, _, err := (&PageQuery{Sort: query.Sort}).GetSort(billSheetSorts, "-serviceDate", "billsheet.id")
+	if err != nil {
+		return err
+	}
+	whereClause := ""
+	if w := andWhere(scope, filter); w != "" {
+		whereClause = fmt.Sprintf(" AND %s", w)
+	}
+	return exportRows(ctx, db, fmt.Sprintf(billSheetStmt.Select, billSheetExportColumns, fmt.Sprintf("%s %s WHERE active.id = 1 %s ORDER BY %s", billSheetStmt.ConsumerInnerJoin, joins, whereClause, orderBy)), billSheetExportHeader, w, args...)
+}
+
+// Returns the WHERE clause of the structured filters and its arguments.  A filter that isn't given
+// doesn't narrow anything down.
+func (s *BillSheet) GetFilter(filter *app.BillSheetQueryPayload) (string, []interface{}, error) {
+	if filter == nil {
+		return "", nil, nil
+	}
+	clauses := []string{}
+	args := []interface{}{}
+	if filter.Specialist != nil {
+		clauses = append(clauses, "billsheet.specialist = ?")
+		args = append(args, *filter.Specialist)
+	}
+	if filter.Consumer != nil {
+		clauses = append(clauses, "billsheet.consumer = ?")
+		args = append(args, *filter.Consumer)
+	}
+	if filter.County != nil {
+		clauses = append(clauses, "consumer.county = ?")
+		args = append(args, *filter.County)
+	}
+	if filter.FundingSource != nil {
+		clauses = append(clauses, "consumer.fundingSource = ?")
+		args = append(args, *filter.FundingSource)
+	}
+	if filter.Dia != nil {
+		clauses = append(clauses, "consumer.dia = ?")
+		args = append(args, *filter.Dia)
+	}
+	if filter.Bsu != nil && *filter.Bsu != "" {
+		clauses = append(clauses, "consumer.bsu = ?")
+		args = append(args, *filter.Bsu)
+	}
+	var from, to string
+	var err error
+	if filter.ServiceDateFrom != nil && *filter.ServiceDateFrom != "" {
+		if from, err = formatDate(*filter.ServiceDateFrom); err != nil {
+			return "", nil, err
+		}
+		clauses = append(clauses, "billsheet.serviceDate >= ?")
+		args = append(args, from)
+	}
+	if filter.ServiceDateTo != nil && *filter.ServiceDateTo != "" {
+		if to, err = formatDate(*filter.ServiceDateTo); err != nil {
+			return "", nil, err
+		}
+		if from != "" && to < from {
+			return "", nil, errors.New("Bad date: the end of the service date range cannot be before its start")
+		}
+		clauses = append(clauses, "billsheet.serviceDate <= ?")
+		args = append(args, to)
+	}
+	if len(filter.Statuses) > 0 {
+		clauses = append(clauses, fmt.Sprintf("billsheet.status IN (%s)", placeholders(len(filter.Statuses))))
+		for _, status := range filter.Statuses {
+			args = append(args, status)
+		}
+	}
+	if len(filter.States) > 0 {
+		clauses = append(clauses, fmt.Sprintf("billsheet.state IN (%s)", placeholders(len(filter.States))))
+		for _, state := range filter.States {
+			args = append(args, state)
+		}
+	}
+	if filter.MinAmount != nil && filter.MaxAmount != nil && *filter.MaxAmount < *filter.MinAmount {
+		return "", nil, errors.New("Bad amount: the largest billed amount cannot be less than the smallest")
+	}
+	if filter.MinAmount != nil {
+		clauses = append(clauses, "billsheet.billedAmount >= ?")
+		args = append(args, *filter.MinAmount)
+	}
+	if filter.MaxAmount != nil {
+		clauses = append(clauses, "billsheet.billedAmount <= ?")
+		args = append(args, *filter.MaxAmount)
+	}
+	return strings.Join(clauses, " AND "), args, nil
+}
+func (s *BillSheet) GetAuthLevel(ctx context.Context, db *mysql.DB, specialist int) (int, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(billSheetStmt.GetAuthLevel, specialist))
 	if err != nil {
 		return -1, err
 	}
@@ -154,8 +455,29 @@ func (s *BillSheet) GetAuthLevel(db *mysql.DB, specialist int) (int, error) {
 	return id, nil
 }
 
-func (s *BillSheet) GetUnitRate(db *mysql.DB, serviceCode int) (float64, error) {
-	rows, err := db.Query(fmt.Sprintf(s.Stmt["GET_UNIT_RATE"], serviceCode))
+func (s *BillSheet) GetNotes(ctx context.Context, db Queryer, id int) ([]*app.NoteItem, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(billSheetStmt.SelectNotes, "field,value", id))
+	if err != nil {
+		return nil, err
+	}
+	notes := []*app.NoteItem{}
+	for rows.Next() {
+		var field string
+		var value string
+		err = rows.Scan(&field, &value)
+		if err != nil {
+			return nil, err
+		}
+		notes = append(notes, &app.NoteItem{
+			Field: field,
+			Value: value,
+		})
+	}
+	return notes, nil
+}
+
+func (s *BillSheet) GetUnitRate(ctx context.Context, db *mysql.DB, serviceCode int) (float64, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(billSheetStmt.GetUnitRate, serviceCode))
 	if err != nil {
 		return -1, err
 	}
@@ -169,9 +491,65 @@ func (s *BillSheet) GetUnitRate(db *mysql.DB, serviceCode int) (float64, error)
 	return unitRate, nil
 }
 
-func (s *BillSheet) IsDuplicateEntry(db *mysql.DB, payload *app.BillSheetPayload, formattedDate string) (bool, error) {
+// The Specialist must have a current caseload assignment for the Consumer on the ServiceDate.
+func (s *BillSheet) IsAssigned(ctx context.Context, db *mysql.DB, payload *app.BillSheetPayload, formattedDate string) (bool, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(billSheetStmt.IsAssigned, payload.Specialist, payload.Consumer, currentCaseloadClause(fmt.Sprintf("'%s'", formattedDate))))
+	if err != nil {
+		return false, err
+	}
+	var count int
+	for rows.Next() {
+		err = rows.Scan(&count)
+		if err != nil {
+			return false, err
+		}
+	}
+	if count == 0 {
+		return false, errors.New("This Consumer is not assigned to this Specialist on this ServiceDate!")
+	}
+	return true, nil
+}
+
+// The notes must match the note template of the service code, i.e., every required field must be filled in
+// and there can't be any fields that the template doesn't define.
+func (s *BillSheet) ValidateNotes(ctx context.Context, db *mysql.DB, payload *app.BillSheetPayload) error {
+	fields, err := NewNoteTemplate(db).GetFields(ctx, db, payload.ServiceCode)
+	if err != nil {
+		return err
+	}
+	values := map[string]string{}
+	for _, note := range payload.Notes {
+		values[note.Field] = strings.TrimSpace(note.Value)
+	}
+	for _, field := range fields {
+		value, ok := values[field.Name]
+		if field.Required && (!ok || value == "") {
+			return fmt.Errorf("Missing note: %s is required for this Service Code!", field.Label)
+		}
+		delete(values, field.Name)
+	}
+	for name := range values {
+		return fmt.Errorf("Bad note: %s is not a field for this Service Code!", name)
+	}
+	return nil
+}
+
+// Returns the current version of the record, or a StaleError if it isn't the version that the client read.
+// A nil version skips the check.
+func (s *BillSheet) CheckVersion(ctx context.Context, db *mysql.DB, id int, version *int) (int, error) {
+	current, err := s.read(ctx, db, id)
+	if err != nil {
+		return -1, err
+	}
+	if version != nil && *version != *current.Version {
+		return -1, &StaleError{BillSheet: current}
+	}
+	return *current.Version, nil
+}
+
+func (s *BillSheet) IsDuplicateEntry(ctx context.Context, db *mysql.DB, payload *app.BillSheetPayload, formattedDate string) (bool, error) {
 	// Check to see if this is a duplicate entry!
-	rows, err := db.Query(fmt.Sprintf(s.Stmt["SELECT"], "COUNT(*)", fmt.Sprintf("WHERE specialist=%d AND consumer=%d AND serviceCode=%d AND serviceDate='%s'", payload.Specialist, payload.Consumer, payload.ServiceCode, formattedDate)))
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(billSheetStmt.Select, "COUNT(*)", fmt.Sprintf("WHERE specialist=%d AND consumer=%d AND serviceCode=%d AND serviceDate='%s'", payload.Specialist, payload.Consumer, payload.ServiceCode, formattedDate)))
 	if err != nil {
 		return true, err
 	}
@@ -188,43 +566,94 @@ func (s *BillSheet) IsDuplicateEntry(db *mysql.DB, payload *app.BillSheetPayload
 	return false, nil
 }
 
-func (s *BillSheet) IsLegalDate(db *mysql.DB, payload *app.BillSheetPayload) (bool, string, error) {
-	var id int
-	id, err := s.GetAuthLevel(db, *payload.RealSpecialist)
+// Returns the same error as a missing billsheet unless the principal can see it, so that the ids of the
+// billsheets that can't be seen aren't given away either.
+func (s *BillSheet) CheckScope(ctx context.Context, db Queryer, principal *Principal, id int) error {
+	scope, err := principal.BillSheetScope()
 	if err != nil {
-		return false, "", err
+		return err
+	}
+	if scope == "" {
+		return nil
 	}
-	parts := strings.Split(payload.ServiceDate, "/")
-	month, err := strconv.Atoi(parts[0])
+	var count int
+	err = db.QueryRowContext(ctx, fmt.Sprintf(billSheetStmt.Select, "COUNT(*)", fmt.Sprintf("WHERE billsheet.id=? AND %s", scope)), id).Scan(&count)
 	if err != nil {
-		return false, "", errors.New("Bad date: month is incorrect")
+		return err
+	}
+	if count == 0 {
+		return errors.New("There is no BillSheet with that id!")
 	}
-	day, err := strconv.Atoi(parts[1])
+	return nil
+}
+
+// A billsheet can only be written for a specialist that the principal can see, i.e., themselves, their team
+// for a supervisor or anyone for an admin.  The consumer is then checked against that specialist's caseload
+// by IsAssigned.
+func (s *BillSheet) CheckSpecialist(ctx context.Context, db Queryer, principal *Principal, specialist int) error {
+	ok, err := canSeeSpecialist(ctx, db, principal, specialist)
 	if err != nil {
-		return false, "", errors.New("Bad date: day is incorrect")
+		return err
+	}
+	if !ok {
+		return errors.New("You cannot write a BillSheet for that Specialist!")
+	}
+	return nil
+}
+
+// Returns the current workflow state, or an error if the billsheet can no longer be changed.
+func (s *BillSheet) IsLocked(ctx context.Context, db *mysql.DB, id int) (string, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(billSheetStmt.Select, "state", fmt.Sprintf("WHERE id=%d", id)))
+	if err != nil {
+		return "", err
+	}
+	var state string
+	for rows.Next() {
+		err = rows.Scan(&state)
+		if err != nil {
+			return "", err
+		}
+	}
+	if isLocked(state) {
+		return state, errors.New("This BillSheet has been approved and can no longer be changed!")
+	}
+	return state, nil
+}
+
+func (s *BillSheet) IsLegalDate(ctx context.Context, db *mysql.DB, payload *app.BillSheetPayload) (bool, string, error) {
+	p := PrincipalFromContext(ctx)
+	if p == nil {
+		return false, "", ErrNoPrincipal
+	}
+	formattedDate, err := formatDate(payload.ServiceDate)
+	if err != nil {
+		return false, "", err
+	}
+	// The whole date is compared, year included, so that a date in an earlier year is in the past too.
+	userEntered, err := time.Parse("2006-01-02", formattedDate)
+	if err != nil {
+		return false, "", err
 	}
-	//
-	// Note that since dates can't be backdated, it's safe to use the current year!
-	//
 	tyear, tmonth, tday := time.Now().Date()
-	userEntered := time.Date(tyear, time.Month(month), day, 0, 0, 0, 0, time.UTC)
 	today := time.Date(tyear, tmonth, tday, 0, 0, 0, 0, time.UTC)
-	// https://golang.org/pkg/time/#Time.Sub
-	// When the day before is selected, will appear as `-24h0m0s`.  -- Illegal!
-	// For the same day, will appear as `0s`.                       -- Legal!
-	// When the day after is selected, will appear as `-24h0m0s`.   -- Legal!
-	//
-	// Note that admins (id == 1) can back date!
-	if userEntered.Sub(today) < 0 && id == 2 {
+	// Note that admins can back date!
+	if userEntered.Before(today) && p.AuthLevel != AuthLevelAdmin {
 		return false, "", errors.New("Bad date: Service Date cannot be in the past")
 	}
-	var formattedDate strings.Builder
-	fmt.Fprintf(&formattedDate, "20%s-%s-%s", parts[2], parts[0], parts[1])
-	return true, formattedDate.String(), nil
+	return true, formattedDate, nil
 }
 
-func (s *BillSheet) List(db *mysql.DB) (interface{}, error) {
-	rows, err := db.Query(fmt.Sprintf(s.Stmt["SELECT"], "COUNT(*)", ""))
+// Only the billsheets that the principal can see are listed.
+func (s *BillSheet) list(ctx context.Context, db *mysql.DB, principal *Principal) ([]*app.BillSheetItem, error) {
+	scope, err := principal.BillSheetScope()
+	if err != nil {
+		return nil, err
+	}
+	whereClause := ""
+	if scope != "" {
+		whereClause = fmt.Sprintf("WHERE %s", scope)
+	}
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(billSheetStmt.Select, "COUNT(*)", whereClause))
 	if err != nil {
 		return nil, err
 	}
@@ -235,29 +664,45 @@ func (s *BillSheet) List(db *mysql.DB) (interface{}, error) {
 			return nil, err
 		}
 	}
-	rows, err = db.Query(fmt.Sprintf(s.Stmt["SELECT"], "id,specialist,consumer,units,DATE_FORMAT(serviceDate, '%m/%d/%y') AS serviceDate,serviceCode,status,billedAmount,confirmation,description", ""))
+	rows, err = db.QueryContext(ctx, fmt.Sprintf(billSheetStmt.Select, billSheetColumns, whereClause))
 	if err != nil {
 		return nil, err
 	}
 	coll := make([]*app.BillSheetItem, count)
-	err = s.CollectRows(rows, coll)
+	err = s.CollectRows(ctx, db, rows, coll)
 	if err != nil {
 		return nil, err
 	}
 	return coll, nil
 }
 
-func (s *BillSheet) Page(db *mysql.DB) (interface{}, error) {
+func (s *BillSheet) page(ctx context.Context, db *mysql.DB, query *BillSheetPageQuery) (*app.BillSheetMediaPaging, error) {
 	//
 	//select billsheet.* from billsheet inner join consumer on consumer.id = billsheet.consumer inner join active on consumer.active = active.id where active.id = 1 and billsheet.specialist = 2;
 	//
-	query := s.Data.(*PageQuery)
-	limit := query.Page * RecordsPerPage
+	perPage, err := query.GetPerPage()
+	if err != nil {
+		return nil, err
+	}
+	offset := query.Page * perPage
+	// The scope is always applied, whatever the client asks for.
+	scope, err := query.Principal.BillSheetScope()
+	if err != nil {
+		return nil, err
+	}
+	filter, args, err := s.GetFilter(query.Filter)
+	if err != nil {
+		return nil, err
+	}
+	joins, orderBy, sort, err := query.GetSort(billSheetSorts, "-serviceDate", "billsheet.id")
+	if err != nil {
+		return nil, err
+	}
 	whereClause := ""
-	if query.WhereClause != "" {
-		whereClause = fmt.Sprintf(" AND %s", query.WhereClause)
+	if w := andWhere(scope, filter); w != "" {
+		whereClause = fmt.Sprintf(" AND %s", w)
 	}
-	rows, err := db.Query(fmt.Sprintf(s.Stmt["SELECT"], "COUNT(*)", fmt.Sprintf("%s WHERE active.id = 1 %s", s.Stmt["CONSUMER_INNER_JOIN"], whereClause)))
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(billSheetStmt.Select, "COUNT(*)", fmt.Sprintf("%s WHERE active.id = 1 %s", billSheetStmt.ConsumerInnerJoin, whereClause)), args...)
 	if err != nil {
 		return nil, err
 	}
@@ -268,59 +713,179 @@ func (s *BillSheet) Page(db *mysql.DB) (interface{}, error) {
 			return nil, err
 		}
 	}
-	rows, err = db.Query(fmt.Sprintf(s.Stmt["SELECT"], "billsheet.id,billsheet.specialist,billsheet.consumer,billsheet.units,DATE_FORMAT(billsheet.serviceDate, '%m/%d/%y') AS serviceDate,billsheet.serviceCode,billsheet.status,billsheet.billedAmount,billsheet.confirmation,billsheet.description", fmt.Sprintf("%s WHERE active.id = 1 %s ORDER BY billsheet.serviceDate DESC LIMIT %d,%d", s.Stmt["CONSUMER_INNER_JOIN"], whereClause, limit, RecordsPerPage)))
+	rows, err = db.QueryContext(ctx, fmt.Sprintf(billSheetStmt.Select, "billsheet.id,billsheet.specialist,billsheet.consumer,billsheet.units,DATE_FORMAT(billsheet.serviceDate, '%m/%d/%y') AS serviceDate,billsheet.serviceCode,billsheet.status,billsheet.billedAmount,billsheet.confirmation,billsheet.description,billsheet.state,billsheet.version", fmt.Sprintf("%s %s WHERE active.id = 1 %s ORDER BY %s LIMIT %d,%d", billSheetStmt.ConsumerInnerJoin, joins, whereClause, orderBy, offset, perPage)), args...)
 	if err != nil {
 		return nil, err
 	}
-	// Only get the amount of rows equal to RecordsPerPage unless the last page has been requested
-	// (determined by `totalCount - limit`).
-	capacity := totalCount - limit
-	if capacity >= RecordsPerPage {
-		capacity = RecordsPerPage
-	}
 	paging := &app.BillSheetMediaPaging{
-		Pager: &app.Pager{
-			CurrentPage:    limit / RecordsPerPage,
-			RecordsPerPage: RecordsPerPage,
-			TotalCount:     totalCount,
-			TotalPages:     int(math.Ceil(float64(totalCount) / float64(RecordsPerPage))),
-		},
-		Billsheets: make([]*app.BillSheetItem, capacity),
+		Pager:      newPager(&query.PageQuery, perPage, totalCount, sort),
+		Billsheets: make([]*app.BillSheetItem, pageCapacity(totalCount, offset, perPage)),
 	}
-	err = s.CollectRows(rows, paging.Billsheets)
+	err = s.CollectRows(ctx, db, rows, paging.Billsheets)
 	if err != nil {
 		return nil, err
 	}
 	return paging, nil
 }
 
-func (s *BillSheet) Update(db *mysql.DB) (interface{}, error) {
-	payload := s.Data.(*app.BillSheetPayload)
-	var formattedDate string
-	isLegal, formattedDate, err := s.IsLegalDate(db, payload)
-	if isLegal == false {
+// Changing any of the fields that the billed amount, the unit block or the notes depend on goes through a
+// full update so that everything is validated and recomputed.  Otherwise, only the given columns are changed.
+func (s *BillSheet) patch(ctx context.Context, db *mysql.DB, payload *app.BillSheetPatchPayload) (*app.BillSheetMedia, error) {
+	if _, err := s.IsLocked(ctx, db, *payload.ID); err != nil {
 		return nil, err
 	}
-	// For now, don't update the billsheet table if the unit rate lookup fails!
-	unitRate, err := s.GetUnitRate(db, payload.ServiceCode)
+	version, err := s.CheckVersion(ctx, db, *payload.ID, payload.Version)
 	if err != nil {
 		return nil, err
 	}
-	// We need to know the current number of units for this record so we can adjust the unit block accordingly!
-	rows, err := db.Query(fmt.Sprintf(s.Stmt["SELECT"], "units", fmt.Sprintf("WHERE id=%d", *payload.ID)))
-	var units float64
-	for rows.Next() {
-		err = rows.Scan(&units)
+	if payload.Specialist != nil || payload.Consumer != nil || payload.Units != nil || payload.ServiceDate != nil || payload.ServiceCode != nil || payload.Notes != nil {
+		current, err := s.read(ctx, db, *payload.ID)
 		if err != nil {
 			return nil, err
 		}
+		merged := &app.BillSheetPayload{
+			ID:           payload.ID,
+			Version:      payload.Version,
+			Specialist:   current.Specialist,
+			Consumer:     current.Consumer,
+			Units:        current.Units,
+			ServiceDate:  current.ServiceDate,
+			ServiceCode:  current.ServiceCode,
+			Status:       current.Status,
+			Confirmation: current.Confirmation,
+			Description:  current.Description,
+			Notes:        current.Notes,
+		}
+		if payload.Specialist != nil {
+			merged.Specialist = *payload.Specialist
+		}
+		if payload.Consumer != nil {
+			merged.Consumer = *payload.Consumer
+		}
+		if payload.Units != nil {
+			merged.Units = payload.Units
+		}
+		if payload.ServiceDate != nil {
+			merged.ServiceDate = *payload.ServiceDate
+		}
+		if payload.ServiceCode != nil {
+			merged.ServiceCode = *payload.ServiceCode
+		}
+		if payload.Status != nil {
+			merged.Status = payload.Status
+		}
+		if payload.Confirmation != nil {
+			merged.Confirmation = payload.Confirmation
+		}
+		if payload.Description != nil {
+			merged.Description = payload.Description
+		}
+		if payload.Notes != nil {
+			merged.Notes = payload.Notes
+		}
+		return s.update(ctx, db, merged)
+	}
+	p := &columnPatch{}
+	p.Set("status", payload.Status)
+	p.Set("confirmation", payload.Confirmation)
+	p.Set("description", payload.Description)
+	if p.IsEmpty() {
+		return s.read(ctx, db, *payload.ID)
+	}
+	p.Increment("version")
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.patchTx(ctx, tx, p, *payload.ID, version, payload.Description != nil); err != nil {
+		tx.Rollback()
+		// Someone else got in between the version check and the patch.
+		if _, ok := err.(*StaleError); ok {
+			rec, err := s.read(ctx, db, *payload.ID)
+			if err != nil {
+				return nil, err
+			}
+			return nil, &StaleError{BillSheet: rec}
+		}
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.read(ctx, db, *payload.ID)
+}
+
+// Only patches the billsheet if it's still at the version that was checked.
+func (s *BillSheet) patchTx(ctx context.Context, tx *mysql.Tx, p *columnPatch, id, version int, signed bool) error {
+	patched, err := p.ExecVersion(ctx, tx, "billsheet", id, version)
+	if err != nil {
+		return err
 	}
-	// For now, don't update the billsheet table if the update on unit_block fails!
-	err = s.UpdateUnitBlock(db, payload, units)
+	if !patched {
+		return &StaleError{}
+	}
+	// The description is part of what's signed.
+	if signed {
+		return (&Signature{}).InvalidateSignatures(ctx, tx, id)
+	}
+	return nil
+}
+
+func (s *BillSheet) read(ctx context.Context, db *mysql.DB, id int) (*app.BillSheetMedia, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(billSheetStmt.Select, billSheetColumns, fmt.Sprintf("WHERE id=%d", id)))
+	if err != nil {
+		return nil, err
+	}
+	coll := make([]*app.BillSheetItem, 1)
+	err = s.CollectRows(ctx, db, rows, coll)
+	if err != nil {
+		return nil, err
+	}
+	if coll[0] == nil {
+		return nil, errors.New("There is no BillSheet with that id!")
+	}
+	b := coll[0]
+	return &app.BillSheetMedia{
+		ID:           b.ID,
+		Specialist:   b.Specialist,
+		Consumer:     b.Consumer,
+		Units:        b.Units,
+		ServiceDate:  b.ServiceDate,
+		ServiceCode:  b.ServiceCode,
+		Status:       b.Status,
+		BilledAmount: b.BilledAmount,
+		Confirmation: b.Confirmation,
+		Description:  b.Description,
+		Notes:        b.Notes,
+		State:        b.State,
+		Version:      b.Version,
+	}, nil
+}
+
+func (s *BillSheet) update(ctx context.Context, db *mysql.DB, payload *app.BillSheetPayload) (*app.BillSheetMedia, error) {
+	state, err := s.IsLocked(ctx, db, *payload.ID)
+	if err != nil {
+		return nil, err
+	}
+	version, err := s.CheckVersion(ctx, db, *payload.ID, payload.Version)
 	if err != nil {
 		return nil, err
 	}
-	stmt, err := db.Prepare(s.Stmt["UPDATE"])
+	var formattedDate string
+	isLegal, formattedDate, err := s.IsLegalDate(ctx, db, payload)
+	if isLegal == false {
+		return nil, err
+	}
+	if err = s.CheckSpecialist(ctx, db, PrincipalFromContext(ctx), payload.Specialist); err != nil {
+		return nil, err
+	}
+	if isAssigned, err := s.IsAssigned(ctx, db, payload, formattedDate); isAssigned == false {
+		return nil, err
+	}
+	if err = s.ValidateNotes(ctx, db, payload); err != nil {
+		return nil, err
+	}
+	unitRate, err := s.GetUnitRate(ctx, db, payload.ServiceCode)
 	if err != nil {
 		return nil, err
 	}
@@ -332,11 +897,28 @@ func (s *BillSheet) Update(db *mysql.DB) (interface{}, error) {
 	// Round to the second decimal place.
 	// https://yourbasic.org/golang/round-float-2-decimal-places/
 	f = math.Ceil(f*100) / 100
-	_, err = stmt.Exec(payload.Specialist, payload.Consumer, unitsFromString, formattedDate, payload.ServiceCode, payload.Status, f, payload.Confirmation, payload.Description, payload.ID)
+	// The billsheet, its unit block, its notes and its signatures all change together or not at all.
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, err
 	}
+	if err = s.updateTx(ctx, tx, payload, version, formattedDate, unitsFromString, f); err != nil {
+		tx.Rollback()
+		// Someone else got in between the version check and the update.
+		if _, ok := err.(*StaleError); ok {
+			rec, err := s.read(ctx, db, *payload.ID)
+			if err != nil {
+				return nil, err
+			}
+			return nil, &StaleError{BillSheet: rec}
+		}
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
 	toStr := floatToString(unitsFromString)
+	version++
 	return &app.BillSheetMedia{
 		ID:           *payload.ID,
 		Specialist:   payload.Specialist,
@@ -348,11 +930,69 @@ func (s *BillSheet) Update(db *mysql.DB) (interface{}, error) {
 		BilledAmount: &f,
 		Confirmation: payload.Confirmation,
 		Description:  payload.Description,
+		Notes:        payload.Notes,
+		State:        &state,
+		Version:      &version,
 	}, nil
 }
 
-func (s *BillSheet) UpdateUnitBlock(db *mysql.DB, payload *app.BillSheetPayload, currentRecordUnits float64) error {
-	rows, err := db.Query(fmt.Sprintf(s.Stmt["SELECT_UNIT_BLOCK"], "COUNT(*)", payload.Consumer, payload.ServiceCode))
+// The version-guarded UPDATE goes first, so that a stale write is turned away before the unit block is
+// touched.  The row is locked until the end of the transaction.
+func (s *BillSheet) updateTx(ctx context.Context, tx *mysql.Tx, payload *app.BillSheetPayload, version int, formattedDate string, units, billedAmount float64) error {
+	// We need to know the current number of units for this record so we can adjust the unit block accordingly!
+	var currentUnits float64
+	err := tx.QueryRowContext(ctx, fmt.Sprintf(billSheetStmt.Select, "units", "WHERE id=? FOR UPDATE"), *payload.ID).Scan(&currentUnits)
+	if err == mysql.ErrNoRows {
+		return errors.New("There is no BillSheet with that id!")
+	}
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.PrepareContext(ctx, billSheetStmt.Update)
+	if err != nil {
+		return err
+	}
+	res, err := stmt.ExecContext(ctx, payload.Specialist, payload.Consumer, units, formattedDate, payload.ServiceCode, payload.Status, billedAmount, payload.Confirmation, payload.Description, payload.ID, version)
+	if err != nil {
+		return err
+	}
+	if affected, err := res.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return &StaleError{}
+	}
+	if err = s.UpdateUnitBlock(ctx, tx, payload, currentUnits); err != nil {
+		return err
+	}
+	if err = s.SetNotes(ctx, tx, *payload.ID, payload.Notes); err != nil {
+		return err
+	}
+	// Editing a signed billsheet invalidates its signatures.
+	return (&Signature{}).InvalidateSignatures(ctx, tx, *payload.ID)
+}
+
+// The notes are always replaced wholesale, there's no need to track individual note ids.
+func (s *BillSheet) SetNotes(ctx context.Context, db Queryer, id int, notes []*app.NoteItem) error {
+	_, err := db.ExecContext(ctx, billSheetStmt.DeleteNotes, id)
+	if err != nil {
+		return err
+	}
+	insertStmt, err := db.PrepareContext(ctx, billSheetStmt.InsertNote)
+	if err != nil {
+		return err
+	}
+	defer insertStmt.Close()
+	for _, note := range notes {
+		_, err = insertStmt.ExecContext(ctx, id, note.Field, note.Value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *BillSheet) UpdateUnitBlock(ctx context.Context, db Queryer, payload *app.BillSheetPayload, currentRecordUnits float64) error {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(billSheetStmt.SelectUnitBlock, "COUNT(*)", payload.Consumer, payload.ServiceCode))
 	if err != nil {
 		return err
 	}
@@ -368,7 +1008,7 @@ func (s *BillSheet) UpdateUnitBlock(db *mysql.DB, payload *app.BillSheetPayload,
 	} else if count < 1 {
 		return errors.New("This Consumer has multiple entries for this Service Code, please see Leta!")
 	} else if count == 1 {
-		rows, err := db.Query(fmt.Sprintf(s.Stmt["SELECT_UNIT_BLOCK"], "id, units", payload.Consumer, payload.ServiceCode))
+		rows, err := db.QueryContext(ctx, fmt.Sprintf(billSheetStmt.SelectUnitBlock, "id, units", payload.Consumer, payload.ServiceCode))
 		if err != nil {
 			return err
 		}
@@ -380,10 +1020,6 @@ func (s *BillSheet) UpdateUnitBlock(db *mysql.DB, payload *app.BillSheetPayload,
 				return err
 			}
 		}
-		stmt, err := db.Prepare(s.Stmt["UPDATE_UNIT_BLOCK"])
-		if err != nil {
-			return err
-		}
 		// New hours - current hours * 4 units per hour.
 		//		newUnits := currentUnits - (currentHours * 4.0)
 		units, err := strconv.ParseFloat(*payload.Units, 64)
@@ -392,7 +1028,16 @@ func (s *BillSheet) UpdateUnitBlock(db *mysql.DB, payload *app.BillSheetPayload,
 		}
 		newUnits := currentBlockUnits + (currentRecordUnits - units)
 		// TODO: What happens if it's drawn down below zero? For now, we're just entering it as-is with no reporting.
-		_, err = stmt.Exec(newUnits, id)
+		_, err = db.ExecContext(ctx, billSheetStmt.UpdateUnitBlock, newUnits, id)
+		if err != nil {
+			return err
+		}
+		// Units that are given back by lowering a billsheet aren't taken off of the count.
+		if drawn := units - currentRecordUnits; drawn > 0 {
+			unitsDrawn.Add(drawn)
+		}
+		// The unit blocks are part of the consumer record, so anyone holding the old one is now out of date.
+		_, err = db.ExecContext(ctx, billSheetStmt.UpdateConsumer, payload.Consumer)
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,192 @@
+package sql
+
+import (
+	"context"
+	mysql "database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/btoll/cpss/server/app"
+)
+
+type BulkQuery struct {
+	IDs    []int
+	Filter *app.BillSheetQueryPayload
+	Patch  *app.BillSheetPatch
+}
+
+type BillSheetBulk struct {
+	Query *BulkQuery
+}
+
+func NewBillSheetBulk(query *BulkQuery) *BillSheetBulk {
+	return &BillSheetBulk{Query: query}
+}
+
+var billSheetBulkStmt = struct {
+	Select    string
+	SelectIds string
+}{
+	Select:    "SELECT %s FROM billsheet %s",
+	SelectIds: "SELECT billsheet.id FROM billsheet INNER JOIN consumer ON consumer.id = billsheet.consumer %s FOR UPDATE",
+}
+
+func init() {
+	registerStmts("BillSheetBulk", billSheetBulkStmt)
+}
+
+// Only the billing columns can be patched in bulk.  Neither of them affects the billed amount or the
+// consumer's unit block, so nothing needs to be recomputed.
+func (b *BillSheetBulk) GetPatch(patch *app.BillSheetPatch) *columnPatch {
+	p := &columnPatch{}
+	p.Set("status", patch.Status)
+	p.Set("confirmation", patch.Confirmation)
+	if !p.IsEmpty() {
+		p.Increment("version")
+	}
+	return p
+}
+
+// Returns the ids of the billsheets that match the condition, and locks them until the end of the
+// transaction.  The condition is never the client's, only what's been built from its filters.
+func (b *BillSheetBulk) GetIDs(ctx context.Context, db Queryer, whereClause string, args ...interface{}) ([]int, error) {
+	if whereClause != "" {
+		whereClause = fmt.Sprintf("WHERE %s", whereClause)
+	}
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(billSheetBulkStmt.SelectIds, whereClause), args...)
+	if err != nil {
+		return nil, err
+	}
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (b *BillSheetBulk) PatchOne(ctx context.Context, tx *mysql.Tx, id int, workflow *Workflow, principal *Principal) (string, error) {
+	var state string
+	if workflow != nil {
+		var err error
+		state, err = workflow.TransitionOne(ctx, tx, id, principal)
+		if err != nil {
+			return state, err
+		}
+	} else {
+		if err := (&BillSheet{}).CheckScope(ctx, tx, principal, id); err != nil {
+			return "", err
+		}
+		rows, err := tx.QueryContext(ctx, fmt.Sprintf(billSheetBulkStmt.Select, "state", fmt.Sprintf("WHERE id=%d FOR UPDATE", id)))
+		if err != nil {
+			return "", err
+		}
+		count := 0
+		for rows.Next() {
+			err = rows.Scan(&state)
+			if err != nil {
+				return "", err
+			}
+			count++
+		}
+		if count == 0 {
+			return "", errors.New("There is no BillSheet with that id!")
+		}
+	}
+	return state, b.GetPatch(b.Query.Patch).Exec(ctx, tx, "billsheet", id)
+}
+
+// All of the billsheets are patched in one transaction.  If any of them fails then none of them are
+// changed, and the result of each is reported back so the caller knows which ones to fix.
+func (b *BillSheetBulk) Bulk(ctx context.Context, db *mysql.DB) ([]*app.TransitionResultItem, error) {
+	query := b.Query
+	patch := query.Patch
+	if patch.Status == nil && patch.Confirmation == nil && patch.State == nil {
+		return nil, errors.New("There is nothing to change!")
+	}
+	principal := PrincipalFromContext(ctx)
+	if principal == nil {
+		return nil, ErrNoPrincipal
+	}
+	if (patch.Status != nil || patch.Confirmation != nil) && principal.AuthLevel != AuthLevelAdmin {
+		return nil, errors.New("Only an admin can change the billing status of a BillSheet!")
+	}
+	var workflow *Workflow
+	if patch.State != nil {
+		comment := ""
+		if patch.Comment != nil {
+			comment = *patch.Comment
+		}
+		if *patch.State == StateRejected && strings.TrimSpace(comment) == "" {
+			return nil, errors.New("A comment is required when rejecting a BillSheet!")
+		}
+		workflow = NewWorkflow(&TransitionQuery{
+			State:   *patch.State,
+			Comment: comment,
+		})
+	}
+	ids := query.IDs
+	var whereClause string
+	var args []interface{}
+	if len(ids) == 0 {
+		filter, filterArgs, err := (&BillSheet{}).GetFilter(query.Filter)
+		if err != nil {
+			return nil, err
+		}
+		// Never patch everything by accident.
+		if filter == "" {
+			return nil, errors.New("Please select the BillSheets to change by id or by filter!")
+		}
+		scope, err := principal.BillSheetScope()
+		if err != nil {
+			return nil, err
+		}
+		whereClause, args = andWhere(scope, filter), filterArgs
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	// The ids are selected in the transaction so that nothing can change them before they're patched.
+	if len(ids) == 0 {
+		if ids, err = b.GetIDs(ctx, tx, whereClause, args...); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+	coll := make([]*app.TransitionResultItem, len(ids))
+	failed := false
+	for i, id := range ids {
+		state, err := b.PatchOne(ctx, tx, id, workflow, principal)
+		coll[i] = &app.TransitionResultItem{
+			ID:    id,
+			State: &state,
+		}
+		if err != nil {
+			message := err.Error()
+			coll[i].Error = &message
+			failed = true
+		}
+	}
+	if failed {
+		if err = tx.Rollback(); err != nil {
+			return nil, err
+		}
+		message := "Not changed: another BillSheet in this batch failed"
+		for _, result := range coll {
+			if result.Error == nil {
+				result.Error = &message
+			}
+		}
+		return coll, nil
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return coll, nil
+}
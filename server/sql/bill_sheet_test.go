@@ -0,0 +1,260 @@
+package sql
+
+import (
+	"context"
+	"database/sql/driver"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btoll/cpss/server/app"
+)
+
+func TestExecVersion(t *testing.T) {
+	tests := []struct {
+		name       string
+		set        bool
+		affected   int64
+		want       bool
+		statements int
+	}{
+		{name: "current", set: true, affected: 1, want: true, statements: 1},
+		{name: "stale", set: true, affected: 0, want: false, statements: 1},
+		{name: "empty", set: false, want: true, statements: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script := &fakeScript{
+				Exec: func(string, []driver.Value) (int64, error) {
+					return tt.affected, nil
+				},
+			}
+			db := openFake(t, script)
+			p := &columnPatch{}
+			if tt.set {
+				p.Set("status", 2)
+				p.Increment("version")
+			}
+			got, err := p.ExecVersion(context.Background(), db, "billsheet", 7, 3)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("ExecVersion() = %v, want %v", got, tt.want)
+			}
+			if len(script.Statements) != tt.statements {
+				t.Fatalf("ran %d statements, want %d", len(script.Statements), tt.statements)
+			}
+			if script.OpenStmts != 0 {
+				t.Errorf("left %d statements open", script.OpenStmts)
+			}
+			if tt.statements == 0 {
+				return
+			}
+			stmt := script.Statements[0]
+			if want := "UPDATE billsheet SET status=?,version=version+1 WHERE id=? AND version=?"; stmt.Query != want {
+				t.Errorf("query = %q, want %q", stmt.Query, want)
+			}
+			if want := []driver.Value{int64(2), int64(7), int64(3)}; !reflect.DeepEqual(stmt.Args, want) {
+				t.Errorf("args = %v, want %v", stmt.Args, want)
+			}
+		})
+	}
+}
+
+// A stale patch is turned away before anything else is written, and the transaction isn't committed.
+func TestBillSheetPatchTx(t *testing.T) {
+	tests := []struct {
+		name       string
+		affected   int64
+		signed     bool
+		stale      bool
+		statements int
+	}{
+		{name: "stale", affected: 0, signed: true, stale: true, statements: 1},
+		{name: "current", affected: 1, signed: false, stale: false, statements: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script := &fakeScript{
+				Exec: func(string, []driver.Value) (int64, error) {
+					return tt.affected, nil
+				},
+			}
+			db := openFake(t, script)
+			tx, err := db.Begin()
+			if err != nil {
+				t.Fatal(err)
+			}
+			p := &columnPatch{}
+			p.Set("confirmation", "abc")
+			p.Increment("version")
+			err = (&BillSheet{}).patchTx(context.Background(), tx, p, 7, 3, tt.signed)
+			if _, stale := err.(*StaleError); stale != tt.stale {
+				t.Fatalf("patchTx() error = %v, want stale %v", err, tt.stale)
+			}
+			if !tt.stale && err != nil {
+				t.Fatal(err)
+			}
+			if len(script.Statements) != tt.statements {
+				t.Errorf("ran %d statements, want %d", len(script.Statements), tt.statements)
+			}
+			if !strings.HasSuffix(script.Statements[0].Query, "WHERE id=? AND version=?") {
+				t.Errorf("query = %q, isn't guarded by the version", script.Statements[0].Query)
+			}
+		})
+	}
+}
+
+// The billsheet is updated (guarded by its version) before its unit block, so a stale update doesn't
+// change the unit block.
+func TestBillSheetUpdateTxStale(t *testing.T) {
+	script := &fakeScript{
+		Exec: func(query string, args []driver.Value) (int64, error) {
+			if strings.HasPrefix(query, "UPDATE billsheet") {
+				return 0, nil
+			}
+			return 1, nil
+		},
+		Query: func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+			return []string{"units"}, [][]driver.Value{{float64(4)}}, nil
+		},
+	}
+	db := openFake(t, script)
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := 7
+	units := "6"
+	payload := &app.BillSheetPayload{ID: &id, Specialist: 2, Consumer: 3, Units: &units, ServiceDate: "02/01/18", ServiceCode: 4}
+	err = (&BillSheet{}).updateTx(context.Background(), tx, payload, 3, "2018-02-01", 6, 60)
+	if _, ok := err.(*StaleError); !ok {
+		t.Fatalf("updateTx() error = %v, want a StaleError", err)
+	}
+	for _, stmt := range script.Statements {
+		if strings.Contains(stmt.Query, "unit_block") || strings.Contains(stmt.Query, "billsheet_note") {
+			t.Errorf("ran %q after a stale update", stmt.Query)
+		}
+	}
+	if !strings.HasSuffix(script.Statements[0].Query, "FOR UPDATE") {
+		t.Errorf("the billsheet isn't locked first: %q", script.Statements[0].Query)
+	}
+}
+
+func TestCheckSpecialist(t *testing.T) {
+	tests := []struct {
+		name    string
+		p       *Principal
+		count   int64
+		ok      bool
+		queried bool
+	}{
+		{name: "an admin for anyone", p: &Principal{ID: 1, AuthLevel: AuthLevelAdmin}, ok: true},
+		{name: "a user for themselves", p: &Principal{ID: 7, AuthLevel: AuthLevelUser}, count: 1, ok: true, queried: true},
+		{name: "a user for someone else", p: &Principal{ID: 7, AuthLevel: AuthLevelUser}, count: 0, queried: true},
+		{name: "a supervisor for their team", p: &Principal{ID: 2, AuthLevel: AuthLevelSupervisor}, count: 1, ok: true, queried: true},
+		{name: "a supervisor for another team", p: &Principal{ID: 2, AuthLevel: AuthLevelSupervisor}, count: 0, queried: true},
+		{name: "nobody"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script := &fakeScript{
+				Query: func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+					return []string{"count"}, [][]driver.Value{{tt.count}}, nil
+				},
+			}
+			db := openFake(t, script)
+			err := (&BillSheet{}).CheckSpecialist(context.Background(), db, tt.p, 8)
+			if tt.ok != (err == nil) {
+				t.Fatalf("CheckSpecialist() error = %v, want ok %v", err, tt.ok)
+			}
+			if queried := len(script.Statements) > 0; queried != tt.queried {
+				t.Fatalf("CheckSpecialist() queried = %v, want %v", queried, tt.queried)
+			}
+			if tt.queried {
+				scope, _ := tt.p.SpecialistScope()
+				if stmt := script.Statements[0]; !strings.Contains(stmt.Query, scope) || stmt.Args[0] != int64(8) {
+					t.Errorf("CheckSpecialist() ran %q %v, want the specialist limited by %q", stmt.Query, stmt.Args, scope)
+				}
+			}
+		})
+	}
+}
+
+func TestIsLegalDate(t *testing.T) {
+	user := &Principal{ID: 7, AuthLevel: AuthLevelUser}
+	admin := &Principal{ID: 1, AuthLevel: AuthLevelAdmin}
+	today := time.Now()
+	tests := []struct {
+		name string
+		p    *Principal
+		date time.Time
+		ok   bool
+	}{
+		{name: "today", p: user, date: today, ok: true},
+		{name: "tomorrow", p: user, date: today.AddDate(0, 0, 1), ok: true},
+		{name: "yesterday", p: user, date: today.AddDate(0, 0, -1)},
+		{name: "a later day last year", p: user, date: today.AddDate(-1, 0, 1)},
+		{name: "next year", p: user, date: today.AddDate(1, 0, -1), ok: true},
+		{name: "an admin's yesterday", p: admin, date: today.AddDate(0, 0, -1), ok: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := WithPrincipal(context.Background(), tt.p)
+			payload := &app.BillSheetPayload{ServiceDate: tt.date.Format("1/2/06")}
+			ok, formatted, err := (&BillSheet{}).IsLegalDate(ctx, nil, payload)
+			if ok != tt.ok {
+				t.Fatalf("IsLegalDate(%s) = %v, %v, want %v", payload.ServiceDate, ok, err, tt.ok)
+			}
+			if ok && formatted != tt.date.Format("2006-01-02") {
+				t.Errorf("IsLegalDate(%s) date = %s, want %s", payload.ServiceDate, formatted, tt.date.Format("2006-01-02"))
+			}
+		})
+	}
+}
+
+func TestCollectRowsNotes(t *testing.T) {
+	columns := []string{"id", "specialist", "consumer", "units", "serviceDate", "serviceCode", "status", "billedAmount", "confirmation", "description", "state", "version"}
+	row := func(id int64) []driver.Value {
+		return []driver.Value{id, int64(7), int64(3), "4", "10/01/26", int64(2), int64(1), 0.0, "", "", "draft", int64(1)}
+	}
+	script := &fakeScript{
+		Query: func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+			switch {
+			case strings.HasPrefix(query, "SELECT COUNT(*)"):
+				return []string{"COUNT(*)"}, [][]driver.Value{{int64(3)}}, nil
+			case strings.HasPrefix(query, "SELECT billsheet,field,value"):
+				return []string{"billsheet", "field", "value"}, [][]driver.Value{{int64(1), "goal", "a"}, {int64(3), "goal", "b"}, {int64(3), "mood", "c"}}, nil
+			}
+			return columns, [][]driver.Value{row(1), row(2), row(3)}, nil
+		},
+	}
+	db := openFake(t, script)
+	coll, err := NewBillSheet(db).List(context.Background(), &Principal{ID: 1, AuthLevel: AuthLevelAdmin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	notesQueries := 0
+	for _, stmt := range script.Statements {
+		if strings.Contains(stmt.Query, "billsheet_note") {
+			notesQueries++
+			if want := []driver.Value{int64(1), int64(2), int64(3)}; !reflect.DeepEqual(stmt.Args, want) {
+				t.Errorf("notes args = %v, want %v", stmt.Args, want)
+			}
+		}
+	}
+	if notesQueries != 1 {
+		t.Errorf("ran %d notes queries, want 1", notesQueries)
+	}
+	want := []int{1, 0, 2}
+	if len(coll) != len(want) {
+		t.Fatalf("List() = %d billsheets, want %d", len(coll), len(want))
+	}
+	for i, n := range want {
+		if len(coll[i].Notes) != n {
+			t.Errorf("billsheet %d has %d notes, want %d", coll[i].ID, len(coll[i].Notes), n)
+		}
+	}
+}
@@ -0,0 +1,446 @@
+package sql
+
+import (
+	"context"
+	mysql "database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/btoll/cpss/server/app"
+	"github.com/goadesign/goa"
+)
+
+type Caseload struct {
+	db *mysql.DB
+}
+
+func NewCaseload(db *mysql.DB) *Caseload {
+	return &Caseload{db: db}
+}
+
+var caseloadStmt = struct {
+	ClearPrimary string
+	Delete       string
+	Insert       string
+	Select       string
+	Update       string
+}{
+	ClearPrimary: "UPDATE caseload SET isPrimary=0 WHERE consumer=? AND id<>?",
+	Delete:       "DELETE FROM caseload WHERE id=?",
+	Insert:       "INSERT caseload SET specialist=?,consumer=?,startDate=?,endDate=?,isPrimary=?",
+	Select:       "SELECT %s FROM caseload %s",
+	Update:       "UPDATE caseload SET specialist=?,consumer=?,startDate=?,endDate=?,isPrimary=? WHERE id=?",
+}
+
+func init() {
+	registerStmts("Caseload", caseloadStmt)
+}
+
+func (s *Caseload) Create(ctx context.Context, payload *app.CaseloadPayload) (_ *app.CaseloadMedia, err error) {
+	defer logError(ctx, "Create Caseload", &err)
+	return s.create(ctx, s.db, payload)
+}
+
+func (s *Caseload) Delete(ctx context.Context, id int) (err error) {
+	defer logError(ctx, "Delete Caseload", &err)
+	return s.delete(ctx, s.db, id)
+}
+
+func (s *Caseload) List(ctx context.Context) (_ []*app.CaseloadItem, err error) {
+	defer logError(ctx, "List Caseload", &err)
+	return s.list(ctx, s.db)
+}
+
+func (s *Caseload) Page(ctx context.Context, query *CaseloadPageQuery) (_ *app.CaseloadMediaPaging, err error) {
+	defer logError(ctx, "Page Caseload", &err)
+	return s.page(ctx, s.db, query)
+}
+
+func (s *Caseload) Patch(ctx context.Context, payload *app.CaseloadPatchPayload) (_ *app.CaseloadMedia, err error) {
+	defer logError(ctx, "Patch Caseload", &err)
+	return s.patch(ctx, s.db, payload)
+}
+
+func (s *Caseload) Update(ctx context.Context, payload *app.CaseloadPayload) (_ *app.CaseloadMedia, err error) {
+	defer logError(ctx, "Update Caseload", &err)
+	return s.update(ctx, s.db, payload)
+}
+
+type CaseloadPageQuery struct {
+	PageQuery
+	Filter *app.CaseloadQueryPayload
+}
+
+// The columns that are selected when collecting rows.  Note that the dates are returned in the same
+// format that the client sends them (MM/DD/YY).
+const caseloadColumns = "id,specialist,consumer,DATE_FORMAT(startDate, '%m/%d/%y') AS startDate,IFNULL(DATE_FORMAT(endDate, '%m/%d/%y'), '') AS endDate,isPrimary"
+
+// The keys that a caseload assignment can be sorted by.
+var caseloadSorts = map[string]sortKey{
+	"id":         {[]string{"id"}, ""},
+	"specialist": {[]string{"(SELECT CONCAT(lastname,', ',firstname) FROM specialist WHERE specialist.id = caseload.specialist)"}, ""},
+	"consumer":   {[]string{"(SELECT CONCAT(lastname,', ',firstname) FROM consumer WHERE consumer.id = caseload.consumer)"}, ""},
+	"startDate":  {[]string{"startDate"}, ""},
+	"endDate":    {[]string{"endDate"}, ""},
+	"isPrimary":  {[]string{"isPrimary"}, ""},
+}
+
+// A caseload assignment is current for a given date when the date falls between its start and end dates.
+// A NULL end date means that the assignment is open-ended.
+func currentCaseloadClause(date string) string {
+	return fmt.Sprintf("startDate <= %s AND (endDate IS NULL OR endDate >= %s)", date, date)
+}
+
+func (s *Caseload) CollectRows(rows *mysql.Rows, coll []*app.CaseloadItem) error {
+	i := 0
+	for rows.Next() {
+		var id int
+		var specialist int
+		var consumer int
+		var startDate string
+		var endDate string
+		var isPrimary bool
+		err := rows.Scan(&id, &specialist, &consumer, &startDate, &endDate, &isPrimary)
+		if err != nil {
+			return err
+		}
+		coll[i] = &app.CaseloadItem{
+			ID:         id,
+			Specialist: specialist,
+			Consumer:   consumer,
+			StartDate:  startDate,
+			EndDate:    &endDate,
+			IsPrimary:  isPrimary,
+		}
+		i++
+	}
+	return nil
+}
+
+// Returns the formatted start and end dates.  An empty end date is returned as nil so that it's stored as NULL.
+func (s *Caseload) FormatDates(payload *app.CaseloadPayload) (string, interface{}, error) {
+	startDate, err := formatDate(payload.StartDate)
+	if err != nil {
+		return "", nil, err
+	}
+	if payload.EndDate == nil || *payload.EndDate == "" {
+		return startDate, nil, nil
+	}
+	endDate, err := formatDate(*payload.EndDate)
+	if err != nil {
+		return "", nil, err
+	}
+	if endDate < startDate {
+		return "", nil, goa.ErrBadRequest("Bad date: End Date cannot be before Start Date")
+	}
+	return startDate, endDate, nil
+}
+
+func (s *Caseload) IsOverlapping(ctx context.Context, db *mysql.DB, payload *app.CaseloadPayload, startDate string, endDate interface{}) (bool, error) {
+	id := -1
+	if payload.ID != nil {
+		id = *payload.ID
+	}
+	end := "9999-12-31"
+	if endDate != nil {
+		end = endDate.(string)
+	}
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(caseloadStmt.Select, "COUNT(*)", "WHERE specialist=? AND consumer=? AND id<>? AND startDate <= ? AND (endDate IS NULL OR endDate >= ?)"), payload.Specialist, payload.Consumer, id, end, startDate)
+	if err != nil {
+		return true, err
+	}
+	var count int
+	for rows.Next() {
+		err = rows.Scan(&count)
+		if err != nil {
+			return true, err
+		}
+	}
+	if count > 0 {
+		return true, errors.New("This Consumer is already assigned to this Specialist for an overlapping period!")
+	}
+	return false, nil
+}
+
+// Only an admin or a supervisor can change who is assigned to whom, and a supervisor only for themselves
+// and their team.  An assignment is what lets a specialist see a consumer and bill for them.
+func (s *Caseload) CheckWrite(ctx context.Context, db Queryer, specialists ...int) error {
+	p := PrincipalFromContext(ctx)
+	if p == nil {
+		return ErrNoPrincipal
+	}
+	if p.Challenge || (p.AuthLevel != AuthLevelAdmin && p.AuthLevel != AuthLevelSupervisor) {
+		return errors.New("Only an admin or a supervisor can change a caseload!")
+	}
+	for _, specialist := range specialists {
+		ok, err := canSeeSpecialist(ctx, db, p, specialist)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.New("You cannot change the caseload of that Specialist!")
+		}
+	}
+	return nil
+}
+
+// Returns the WHERE clause of the structured filters and its arguments.  A filter that isn't given
+// doesn't narrow anything down.
+func (s *Caseload) GetFilter(filter *app.CaseloadQueryPayload) (string, []interface{}) {
+	if filter == nil {
+		return "", nil
+	}
+	clauses := []string{}
+	args := []interface{}{}
+	if filter.Specialist != nil {
+		clauses = append(clauses, "caseload.specialist = ?")
+		args = append(args, *filter.Specialist)
+	}
+	if filter.Consumer != nil {
+		clauses = append(clauses, "caseload.consumer = ?")
+		args = append(args, *filter.Consumer)
+	}
+	if filter.Current != nil && *filter.Current {
+		clauses = append(clauses, currentCaseloadClause("CURDATE()"))
+	}
+	return strings.Join(clauses, " AND "), args
+}
+
+// A consumer can only have one primary specialist, so flagging an assignment as primary unflags all the others.
+func (s *Caseload) SetPrimary(ctx context.Context, db *mysql.DB, consumer int, id int) error {
+	stmt, err := db.PrepareContext(ctx, caseloadStmt.ClearPrimary)
+	if err != nil {
+		return err
+	}
+	_, err = stmt.ExecContext(ctx, consumer, id)
+	return err
+}
+
+func (s *Caseload) create(ctx context.Context, db *mysql.DB, payload *app.CaseloadPayload) (*app.CaseloadMedia, error) {
+	if err := s.CheckWrite(ctx, db, payload.Specialist); err != nil {
+		return nil, err
+	}
+	startDate, endDate, err := s.FormatDates(payload)
+	if err != nil {
+		return nil, err
+	}
+	if isOverlapping, err := s.IsOverlapping(ctx, db, payload, startDate, endDate); isOverlapping == true {
+		return nil, err
+	}
+	stmt, err := db.PrepareContext(ctx, caseloadStmt.Insert)
+	if err != nil {
+		return nil, err
+	}
+	res, err := stmt.ExecContext(ctx, payload.Specialist, payload.Consumer, startDate, endDate, payload.IsPrimary)
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	if payload.IsPrimary {
+		if err = s.SetPrimary(ctx, db, payload.Consumer, int(id)); err != nil {
+			return nil, err
+		}
+	}
+	return &app.CaseloadMedia{
+		ID:         int(id),
+		Specialist: payload.Specialist,
+		Consumer:   payload.Consumer,
+		StartDate:  payload.StartDate,
+		EndDate:    payload.EndDate,
+		IsPrimary:  payload.IsPrimary,
+	}, nil
+}
+
+// Both the specialist that the assignment is taken from and the one it's given to have to be allowed.
+func (s *Caseload) update(ctx context.Context, db *mysql.DB, payload *app.CaseloadPayload) (*app.CaseloadMedia, error) {
+	current, err := s.read(ctx, db, *payload.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.CheckWrite(ctx, db, current.Specialist, payload.Specialist); err != nil {
+		return nil, err
+	}
+	startDate, endDate, err := s.FormatDates(payload)
+	if err != nil {
+		return nil, err
+	}
+	if isOverlapping, err := s.IsOverlapping(ctx, db, payload, startDate, endDate); isOverlapping == true {
+		return nil, err
+	}
+	stmt, err := db.PrepareContext(ctx, caseloadStmt.Update)
+	if err != nil {
+		return nil, err
+	}
+	_, err = stmt.ExecContext(ctx, payload.Specialist, payload.Consumer, startDate, endDate, payload.IsPrimary, payload.ID)
+	if err != nil {
+		return nil, err
+	}
+	if payload.IsPrimary {
+		if err = s.SetPrimary(ctx, db, payload.Consumer, *payload.ID); err != nil {
+			return nil, err
+		}
+	}
+	return &app.CaseloadMedia{
+		ID:         *payload.ID,
+		Specialist: payload.Specialist,
+		Consumer:   payload.Consumer,
+		StartDate:  payload.StartDate,
+		EndDate:    payload.EndDate,
+		IsPrimary:  payload.IsPrimary,
+	}, nil
+}
+
+// The dates and the primary flag all depend on each other, so the patch is merged into the current record
+// and then validated the same as a full update.
+func (s *Caseload) patch(ctx context.Context, db *mysql.DB, payload *app.CaseloadPatchPayload) (*app.CaseloadMedia, error) {
+	current, err := s.read(ctx, db, *payload.ID)
+	if err != nil {
+		return nil, err
+	}
+	merged := &app.CaseloadPayload{
+		ID:         payload.ID,
+		Specialist: current.Specialist,
+		Consumer:   current.Consumer,
+		StartDate:  current.StartDate,
+		EndDate:    current.EndDate,
+		IsPrimary:  current.IsPrimary,
+	}
+	if payload.Specialist != nil {
+		merged.Specialist = *payload.Specialist
+	}
+	if payload.Consumer != nil {
+		merged.Consumer = *payload.Consumer
+	}
+	if payload.StartDate != nil {
+		merged.StartDate = *payload.StartDate
+	}
+	if payload.EndDate != nil {
+		merged.EndDate = payload.EndDate
+	}
+	if payload.IsPrimary != nil {
+		merged.IsPrimary = *payload.IsPrimary
+	}
+	return s.update(ctx, db, merged)
+}
+
+func (s *Caseload) read(ctx context.Context, db *mysql.DB, id int) (*app.CaseloadMedia, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(caseloadStmt.Select, caseloadColumns, fmt.Sprintf("WHERE id=%d", id)))
+	if err != nil {
+		return nil, err
+	}
+	coll := make([]*app.CaseloadItem, 1)
+	err = s.CollectRows(rows, coll)
+	if err != nil {
+		return nil, err
+	}
+	if coll[0] == nil {
+		return nil, errors.New("There is no Caseload with that id!")
+	}
+	c := coll[0]
+	return &app.CaseloadMedia{
+		ID:         c.ID,
+		Specialist: c.Specialist,
+		Consumer:   c.Consumer,
+		StartDate:  c.StartDate,
+		EndDate:    c.EndDate,
+		IsPrimary:  c.IsPrimary,
+	}, nil
+}
+
+func (s *Caseload) delete(ctx context.Context, db *mysql.DB, id int) error {
+	current, err := s.read(ctx, db, id)
+	if err != nil {
+		return err
+	}
+	if err = s.CheckWrite(ctx, db, current.Specialist); err != nil {
+		return err
+	}
+	stmt, err := db.PrepareContext(ctx, caseloadStmt.Delete)
+	if err != nil {
+		return err
+	}
+	_, err = stmt.ExecContext(ctx, &id)
+	return err
+}
+
+func (s *Caseload) list(ctx context.Context, db *mysql.DB) ([]*app.CaseloadItem, error) {
+	scope, err := PrincipalFromContext(ctx).CaseloadScope()
+	if err != nil {
+		return nil, err
+	}
+	whereClause := ""
+	if scope != "" {
+		whereClause = fmt.Sprintf("WHERE %s", scope)
+	}
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(caseloadStmt.Select, "COUNT(*)", whereClause))
+	if err != nil {
+		return nil, err
+	}
+	var count int
+	for rows.Next() {
+		err = rows.Scan(&count)
+		if err != nil {
+			return nil, err
+		}
+	}
+	rows, err = db.QueryContext(ctx, fmt.Sprintf(caseloadStmt.Select, caseloadColumns, fmt.Sprintf("%s ORDER BY startDate DESC", whereClause)))
+	if err != nil {
+		return nil, err
+	}
+	coll := make([]*app.CaseloadItem, count)
+	err = s.CollectRows(rows, coll)
+	if err != nil {
+		return nil, err
+	}
+	return coll, nil
+}
+
+func (s *Caseload) page(ctx context.Context, db *mysql.DB, query *CaseloadPageQuery) (*app.CaseloadMediaPaging, error) {
+	perPage, err := query.GetPerPage()
+	if err != nil {
+		return nil, err
+	}
+	offset := query.Page * perPage
+	_, orderBy, sort, err := query.GetSort(caseloadSorts, "-startDate", "id")
+	if err != nil {
+		return nil, err
+	}
+	// The scope is always applied, whatever the client asks for.
+	scope, err := query.Principal.CaseloadScope()
+	if err != nil {
+		return nil, err
+	}
+	filter, args := s.GetFilter(query.Filter)
+	whereClause := ""
+	if w := andWhere(scope, filter); w != "" {
+		whereClause = fmt.Sprintf("WHERE %s", w)
+	}
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(caseloadStmt.Select, "COUNT(*)", whereClause), args...)
+	if err != nil {
+		return nil, err
+	}
+	var totalCount int
+	for rows.Next() {
+		err = rows.Scan(&totalCount)
+		if err != nil {
+			return nil, err
+		}
+	}
+	rows, err = db.QueryContext(ctx, fmt.Sprintf(caseloadStmt.Select, caseloadColumns, fmt.Sprintf("%s ORDER BY %s LIMIT %d,%d", whereClause, orderBy, offset, perPage)), args...)
+	if err != nil {
+		return nil, err
+	}
+	paging := &app.CaseloadMediaPaging{
+		Pager:     newPager(&query.PageQuery, perPage, totalCount, sort),
+		Caseloads: make([]*app.CaseloadItem, pageCapacity(totalCount, offset, perPage)),
+	}
+	err = s.CollectRows(rows, paging.Caseloads)
+	if err != nil {
+		return nil, err
+	}
+	return paging, nil
+}
@@ -0,0 +1,80 @@
+package sql
+
+import (
+	"context"
+	"database/sql/driver"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/btoll/cpss/server/app"
+)
+
+func TestCaseloadCheckWrite(t *testing.T) {
+	// The supervisor's team is specialist 8.
+	team := map[int64]bool{2: true, 8: true}
+	tests := []struct {
+		name        string
+		p           *Principal
+		specialists []int
+		ok          bool
+	}{
+		{name: "an admin", p: &Principal{ID: 1, AuthLevel: AuthLevelAdmin}, specialists: []int{9}, ok: true},
+		{name: "a supervisor for their team", p: &Principal{ID: 2, AuthLevel: AuthLevelSupervisor}, specialists: []int{2, 8}, ok: true},
+		{name: "a supervisor for someone else", p: &Principal{ID: 2, AuthLevel: AuthLevelSupervisor}, specialists: []int{8, 9}},
+		{name: "a user for themselves", p: &Principal{ID: 7, AuthLevel: AuthLevelUser}, specialists: []int{7}},
+		{name: "an admin's challenge", p: &Principal{ID: 1, AuthLevel: AuthLevelAdmin, Challenge: true}, specialists: []int{1}},
+		{name: "nobody", specialists: []int{7}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openFake(t, &fakeScript{
+				Query: func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+					count := int64(0)
+					if team[args[0].(int64)] {
+						count = 1
+					}
+					return []string{"COUNT(*)"}, [][]driver.Value{{count}}, nil
+				},
+			})
+			ctx := context.Background()
+			if tt.p != nil {
+				ctx = WithPrincipal(ctx, tt.p)
+			}
+			if err := NewCaseload(db).CheckWrite(ctx, db, tt.specialists...); tt.ok != (err == nil) {
+				t.Errorf("CheckWrite(%v) error = %v, want ok %v", tt.specialists, err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestCaseloadGetFilter(t *testing.T) {
+	current := true
+	tests := []struct {
+		name   string
+		filter *app.CaseloadQueryPayload
+		where  []string
+		args   []interface{}
+	}{
+		{name: "none"},
+		{name: "empty", filter: &app.CaseloadQueryPayload{}},
+		{name: "specialist and consumer", filter: &app.CaseloadQueryPayload{Specialist: intPtr(7), Consumer: intPtr(3)}, where: []string{"caseload.specialist = ?", "caseload.consumer = ?"}, args: []interface{}{7, 3}},
+		{name: "current", filter: &app.CaseloadQueryPayload{Current: &current}, where: []string{"CURDATE()"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			where, args := (&Caseload{}).GetFilter(tt.filter)
+			for _, w := range tt.where {
+				if !strings.Contains(where, w) {
+					t.Errorf("GetFilter() = %q, want it to contain %q", where, w)
+				}
+			}
+			if len(tt.where) == 0 && where != "" {
+				t.Errorf("GetFilter() = %q, want nothing", where)
+			}
+			if len(args) != len(tt.args) || (len(args) > 0 && !reflect.DeepEqual(args, tt.args)) {
+				t.Errorf("GetFilter() args = %v, want %v", args, tt.args)
+			}
+		})
+	}
+}
@@ -1,39 +1,121 @@
 package sql
 
 import (
+	"context"
 	mysql "database/sql"
 	"errors"
 	"fmt"
-	"math"
 
 	"github.com/btoll/cpss/server/app"
 )
 
 type Consumer struct {
-	Data interface{}
-	Stmt map[string]string
+	db *mysql.DB
 }
 
-func NewConsumer(payload interface{}) *Consumer {
-	return &Consumer{
-		Data: payload,
-		Stmt: map[string]string{
-			"DELETE":               "DELETE FROM consumer WHERE id=?",
-			"DELETE_SERVICE_CODE":  "DELETE FROM unit_block WHERE id=?",
-			"INSERT":               "INSERT consumer SET firstname=?,lastname=?,active=?,county=?,fundingSource=?,bsu=?,recipientID=?,dia=?,other=?",
-			"INSERT_SERVICE_CODES": "INSERT unit_block SET consumer=?,serviceCode=?,units=?",
-			"SELECT":               "SELECT %s FROM consumer %s",
-			"SELECT_SERVICE_CODES": "SELECT %s FROM consumer INNER JOIN unit_block ON unit_block.consumer = consumer.id INNER JOIN service_code ON service_code.id = unit_block.serviceCode %s",
-			"UPDATE":               "UPDATE consumer SET firstname=?,lastname=?,active=?,county=?,fundingSource=?,bsu=?,recipientID=?,dia=?,other=? WHERE id=?",
-			"UPDATE_SERVICE_CODES": "UPDATE unit_block SET serviceCode=?,units=? WHERE id=?",
-		},
+func NewConsumer(db *mysql.DB) *Consumer {
+	return &Consumer{db: db}
+}
+
+var consumerStmt = struct {
+	Delete             string
+	DeleteServiceCode  string
+	InCaseload         string
+	Insert             string
+	InsertServiceCodes string
+	Select             string
+	SelectServiceCodes string
+	Update             string
+	UpdateServiceCodes string
+}{
+	Delete:             "DELETE FROM consumer WHERE id=?",
+	DeleteServiceCode:  "DELETE FROM unit_block WHERE id=?",
+	InCaseload:         "id IN (SELECT consumer FROM caseload WHERE specialist=%d AND %s)",
+	Insert:             "INSERT consumer SET firstname=?,lastname=?,active=?,county=?,fundingSource=?,bsu=?,recipientID=?,dia=?,other=?",
+	InsertServiceCodes: "INSERT unit_block SET consumer=?,serviceCode=?,units=?",
+	Select:             "SELECT %s FROM consumer %s",
+	SelectServiceCodes: "SELECT %s FROM consumer INNER JOIN unit_block ON unit_block.consumer = consumer.id INNER JOIN service_code ON service_code.id = unit_block.serviceCode %s",
+	Update:             "UPDATE consumer SET firstname=?,lastname=?,active=?,county=?,fundingSource=?,bsu=?,recipientID=?,dia=?,other=?,version=version+1 WHERE id=? AND version=?",
+	UpdateServiceCodes: "UPDATE unit_block SET serviceCode=?,units=? WHERE id=?",
+}
+
+func init() {
+	registerStmts("Consumer", consumerStmt)
+}
+
+func (s *Consumer) Create(ctx context.Context, payload *app.ConsumerPayload) (_ int, err error) {
+	defer logError(ctx, "Create Consumer", &err)
+	return s.create(ctx, s.db, payload)
+}
+
+func (s *Consumer) Delete(ctx context.Context, id int) (err error) {
+	defer logError(ctx, "Delete Consumer", &err)
+	return s.delete(ctx, s.db, id)
+}
+
+func (s *Consumer) Export(ctx context.Context, query *ConsumerExportQuery, w RowWriter) (err error) {
+	defer logError(ctx, "Export Consumer", &err)
+	return s.export(ctx, s.db, query, w)
+}
+
+func (s *Consumer) List(ctx context.Context, mine bool) (_ []*app.ConsumerItem, err error) {
+	defer logError(ctx, "List Consumer", &err)
+	return s.list(ctx, s.db, mine)
+}
+
+func (s *Consumer) Page(ctx context.Context, query *ConsumerPageQuery) (_ *app.ConsumerMediaPaging, err error) {
+	defer logError(ctx, "Page Consumer", &err)
+	return s.page(ctx, s.db, query)
+}
+
+func (s *Consumer) Patch(ctx context.Context, payload *app.ConsumerPatchPayload) (_ *app.ConsumerMedia, err error) {
+	defer logError(ctx, "Patch Consumer", &err)
+	return s.patch(ctx, s.db, payload)
+}
+
+func (s *Consumer) Read(ctx context.Context, id int) (_ *app.ConsumerMedia, err error) {
+	defer logError(ctx, "Read Consumer", &err)
+	if err = s.CheckScope(ctx, s.db, PrincipalFromContext(ctx), id); err != nil {
+		return nil, err
 	}
+	return s.read(ctx, s.db, id)
 }
 
-func (s *Consumer) GetServiceCodes(db *mysql.DB, id int) ([]*app.UnitBlockItem, error) {
+func (s *Consumer) Update(ctx context.Context, payload *app.ConsumerPayload) (_ *app.ConsumerMedia, err error) {
+	defer logError(ctx, "Update Consumer", &err)
+	return s.update(ctx, s.db, payload)
+}
+
+// The keys that a consumer can be sorted by.  The foreign keys are sorted by their names.
+var consumerSorts = map[string]sortKey{
+	"id":            {[]string{"id"}, ""},
+	"name":          {[]string{"lastname", "firstname"}, ""},
+	"firstname":     {[]string{"firstname"}, ""},
+	"lastname":      {[]string{"lastname"}, ""},
+	"active":        {[]string{"active"}, ""},
+	"county":        {[]string{"(SELECT name FROM county WHERE county.id = consumer.county)"}, ""},
+	"fundingSource": {[]string{"(SELECT name FROM funding_source WHERE funding_source.id = consumer.fundingSource)"}, ""},
+	"bsu":           {[]string{"bsu"}, ""},
+	"recipientID":   {[]string{"recipientID"}, ""},
+	"dia":           {[]string{"(SELECT name FROM dia WHERE dia.id = consumer.dia)"}, ""},
+}
+
+// The columns of an export.  The foreign keys are resolved to names, and the unit blocks are flattened into
+// a single column.
+const consumerExportColumns = "id,CONCAT(lastname,', ',firstname) AS fullname,IF(active=1,'Yes','No') AS active," +
+	"(SELECT name FROM county WHERE county.id = consumer.county) AS countyName," +
+	"(SELECT name FROM funding_source WHERE funding_source.id = consumer.fundingSource) AS fundingSourceName," +
+	"bsu,recipientID," +
+	"(SELECT name FROM dia WHERE dia.id = consumer.dia) AS diaName," +
+	"(SELECT GROUP_CONCAT(CONCAT(service_code.name,': ',unit_block.units) ORDER BY service_code.name SEPARATOR '; ') FROM unit_block INNER JOIN service_code ON service_code.id = unit_block.serviceCode WHERE unit_block.consumer = consumer.id) AS unitBlocks," +
+	"other"
+
+var consumerExportHeader = []string{"ID", "Name", "Active", "County", "Funding Source", "BSU", "Recipient ID", "DIA", "Unit Blocks", "Other"}
+
+func (s *Consumer) GetServiceCodes(ctx context.Context, db *mysql.DB, id int) ([]*app.UnitBlockItem, error) {
 	whereClause := fmt.Sprintf("WHERE consumer.id = %d", id)
 	i := 0
-	rows, err := db.Query(fmt.Sprintf(s.Stmt["SELECT_SERVICE_CODES"], "COUNT(*)", whereClause))
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(consumerStmt.SelectServiceCodes, "COUNT(*)", whereClause))
 	if err != nil {
 		return nil, err
 	}
@@ -44,7 +126,7 @@ func (s *Consumer) GetServiceCodes(db *mysql.DB, id int) ([]*app.UnitBlockItem,
 			return nil, err
 		}
 	}
-	rows, err = db.Query(fmt.Sprintf(s.Stmt["SELECT_SERVICE_CODES"], "unit_block.id, service_code.id, unit_block.units", whereClause))
+	rows, err = db.QueryContext(ctx, fmt.Sprintf(consumerStmt.SelectServiceCodes, "unit_block.id, service_code.id, unit_block.units", whereClause))
 	if err != nil {
 		return nil, err
 	}
@@ -67,25 +149,82 @@ func (s *Consumer) GetServiceCodes(db *mysql.DB, id int) ([]*app.UnitBlockItem,
 	return coll, nil
 }
 
-func (s *Consumer) SetServiceCodes(db *mysql.DB, consumer int, serviceCodes []*app.UnitBlockItem) ([]*app.UnitBlockItem, error) {
-	updateStmt, err := db.Prepare(s.Stmt["UPDATE_SERVICE_CODES"])
+type ConsumerPageQuery struct {
+	PageQuery
+	Filter *app.ConsumerQueryPayload
+}
+
+type ConsumerExportQuery struct {
+	ExportQuery
+	Filter *app.ConsumerQueryPayload
+}
+
+// Returns the WHERE clause of the structured filters and its arguments.
+func (s *Consumer) GetFilter(filter *app.ConsumerQueryPayload) (string, []interface{}) {
+	if filter == nil {
+		return "", nil
+	}
+	return nameFilter(filter.Active, filter.Lastname, filter.Firstname)
+}
+
+// Returns the same error as a missing consumer unless the principal can see it, so that the ids of the
+// consumers that can't be seen aren't given away either.
+func (s *Consumer) CheckScope(ctx context.Context, db Queryer, principal *Principal, id int) error {
+	scope, err := principal.ConsumerScope()
+	if err != nil {
+		return err
+	}
+	if scope == "" {
+		return nil
+	}
+	var count int
+	err = db.QueryRowContext(ctx, fmt.Sprintf(consumerStmt.Select, "COUNT(*)", fmt.Sprintf("WHERE consumer.id=? AND %s", scope)), id).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return errors.New("There is no Consumer with that id!")
+	}
+	return nil
+}
+
+// Exports every consumer that the page action would return, in the same order.  Only the consumers that
+// the principal can see are exported.
+func (s *Consumer) export(ctx context.Context, db *mysql.DB, query *ConsumerExportQuery, w RowWriter) error {
+	scope, err := query.Principal.ConsumerScope()
+	if err != nil {
+		return err
+	}
+	filter, args := s.GetFilter(query.Filter)
+	whereClause := ""
+	if where := andWhere(scope, filter); where != "" {
+		whereClause = fmt.Sprintf("WHERE %s", where)
+	}
+	return exportRows(ctx, db, fmt.Sprintf(consumerStmt.Select, consumerExportColumns, fmt.Sprintf("%s ORDER BY fullname ASC", whereClause)), consumerExportHeader, w, args...)
+}
+
+func (s *Consumer) SetServiceCodes(ctx context.Context, db Queryer, consumer int, serviceCodes []*app.UnitBlockItem) ([]*app.UnitBlockItem, error) {
+	updateStmt, err := db.PrepareContext(ctx, consumerStmt.UpdateServiceCodes)
 	if err != nil {
 		return nil, err
 	}
-	insertStmt, err := db.Prepare(s.Stmt["INSERT_SERVICE_CODES"])
+	defer updateStmt.Close()
+	insertStmt, err := db.PrepareContext(ctx, consumerStmt.InsertServiceCodes)
 	if err != nil {
 		return nil, err
 	}
-	deleteStmt, err := db.Prepare(s.Stmt["DELETE_SERVICE_CODE"])
+	defer insertStmt.Close()
+	deleteStmt, err := db.PrepareContext(ctx, consumerStmt.DeleteServiceCode)
 	if err != nil {
 		return nil, err
 	}
+	defer deleteStmt.Close()
 	var serviceCode *app.UnitBlockItem
 	coll := []*app.UnitBlockItem{}
 	for i := 0; i < len(serviceCodes); i++ {
 		serviceCode = serviceCodes[i]
 		if serviceCode.ID == -1 {
-			res, err := insertStmt.Exec(consumer, serviceCode.ServiceCode, serviceCode.Units)
+			res, err := insertStmt.ExecContext(ctx, consumer, serviceCode.ServiceCode, serviceCode.Units)
 			if err != nil {
 				return nil, err
 			}
@@ -98,13 +237,13 @@ func (s *Consumer) SetServiceCodes(db *mysql.DB, consumer int, serviceCodes []*a
 		} else if serviceCode.ID < -1 {
 			// For an explanation of why we bitwise NOT the id,
 			// see https://github.com/btoll/cpss/blob/master/client/src/Page/Consumer.elm.
-			_, err := deleteStmt.Exec(^serviceCode.ID)
+			_, err := deleteStmt.ExecContext(ctx, ^serviceCode.ID)
 			if err != nil {
 				return nil, err
 			}
 			// Note we're not adding these to the returned collection!
 		} else {
-			_, err = updateStmt.Exec(serviceCode.ServiceCode, serviceCode.Units, serviceCode.ID)
+			_, err = updateStmt.ExecContext(ctx, serviceCode.ServiceCode, serviceCode.Units, serviceCode.ID)
 			if err != nil {
 				return nil, err
 			}
@@ -114,7 +253,7 @@ func (s *Consumer) SetServiceCodes(db *mysql.DB, consumer int, serviceCodes []*a
 	return coll, nil
 }
 
-func (s *Consumer) CollectRows(db *mysql.DB, rows *mysql.Rows, coll []*app.ConsumerItem) error {
+func (s *Consumer) CollectRows(ctx context.Context, db *mysql.DB, rows *mysql.Rows, coll []*app.ConsumerItem) error {
 	i := 0
 	for rows.Next() {
 		var id int
@@ -127,13 +266,14 @@ func (s *Consumer) CollectRows(db *mysql.DB, rows *mysql.Rows, coll []*app.Consu
 		var recipientID string
 		var dia int
 		var other string
+		var version int
 		var fullname string
-		err := rows.Scan(&id, &firstname, &lastname, &active, &county, &fundingSource, &bsu, &recipientID, &dia, &other, &fullname)
+		err := rows.Scan(&id, &firstname, &lastname, &active, &county, &fundingSource, &bsu, &recipientID, &dia, &other, &version, &fullname)
 		if err != nil {
 			return err
 		}
 		// First, get the Service Codes (inner joining consumer, service_code and unit_block tables).
-		serviceCodes, err := s.GetServiceCodes(db, id)
+		serviceCodes, err := s.GetServiceCodes(ctx, db, id)
 		if err != nil {
 			return err
 		}
@@ -149,33 +289,53 @@ func (s *Consumer) CollectRows(db *mysql.DB, rows *mysql.Rows, coll []*app.Consu
 			RecipientID:   recipientID,
 			Dia:           dia,
 			Other:         other,
+			Version:       &version,
 		}
 		i++
 	}
 	return nil
 }
 
-func (s *Consumer) Create(db *mysql.DB) (interface{}, error) {
-	payload := s.Data.(*app.ConsumerPayload)
-	rows, err := db.Query(fmt.Sprintf(s.Stmt["SELECT"], "COUNT(*)", fmt.Sprintf("WHERE firstname='%s' AND lastname='%s'", payload.Firstname, payload.Lastname)))
+// Returns the current version of the record, or a StaleError if it isn't the version that the client read.
+// A nil version skips the check.
+func (s *Consumer) CheckVersion(ctx context.Context, db *mysql.DB, id int, version *int) (int, error) {
+	current, err := s.read(ctx, db, id)
 	if err != nil {
-		return nil, err
+		return -1, err
+	}
+	if version != nil && *version != *current.Version {
+		return -1, &StaleError{Consumer: current}
+	}
+	return *current.Version, nil
+}
+
+func (s *Consumer) IsDuplicateName(ctx context.Context, db *mysql.DB, firstname, lastname string) (bool, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(consumerStmt.Select, "COUNT(*)", fmt.Sprintf("WHERE firstname='%s' AND lastname='%s'", firstname, lastname)))
+	if err != nil {
+		return true, err
 	}
 	var count int
 	for rows.Next() {
 		err = rows.Scan(&count)
 		if err != nil {
-			return nil, err
+			return true, err
 		}
 	}
 	if count > 0 {
-		return nil, errors.New("There is already a Consumer by that name!")
+		return true, errors.New("There is already a Consumer by that name!")
+	}
+	return false, nil
+}
+
+func (s *Consumer) create(ctx context.Context, db *mysql.DB, payload *app.ConsumerPayload) (int, error) {
+	if isDuplicate, err := s.IsDuplicateName(ctx, db, payload.Firstname, payload.Lastname); isDuplicate == true {
+		return -1, err
 	}
-	stmt, err := db.Prepare(s.Stmt["INSERT"])
+	stmt, err := db.PrepareContext(ctx, consumerStmt.Insert)
 	if err != nil {
 		return -1, err
 	}
-	res, err := stmt.Exec(payload.Firstname, payload.Lastname, payload.Active, payload.County, payload.FundingSource, payload.Bsu, payload.RecipientID, payload.Dia, payload.Other)
+	res, err := stmt.ExecContext(ctx, payload.Firstname, payload.Lastname, payload.Active, payload.County, payload.FundingSource, payload.Bsu, payload.RecipientID, payload.Dia, payload.Other)
 	if err != nil {
 		return -1, err
 	}
@@ -184,28 +344,40 @@ func (s *Consumer) Create(db *mysql.DB) (interface{}, error) {
 		return -1, err
 	}
 	// If setting the service codes fails, abort everything!
-	_, err = s.SetServiceCodes(db, int(id), payload.ServiceCodes)
+	_, err = s.SetServiceCodes(ctx, db, int(id), payload.ServiceCodes)
 	if err != nil {
 		return -1, err
 	}
 	return int(id), nil
 }
 
-func (s *Consumer) Update(db *mysql.DB) (interface{}, error) {
-	payload := s.Data.(*app.ConsumerPayload)
-	// If setting the service codes fails, abort everything!
-	serviceCodes, err := s.SetServiceCodes(db, *payload.ID, payload.ServiceCodes)
+func (s *Consumer) update(ctx context.Context, db *mysql.DB, payload *app.ConsumerPayload) (*app.ConsumerMedia, error) {
+	version, err := s.CheckVersion(ctx, db, *payload.ID, payload.Version)
 	if err != nil {
-		return -1, err
+		return nil, err
 	}
-	stmt, err := db.Prepare(s.Stmt["UPDATE"])
+	// If setting the service codes fails, abort everything!
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, err
 	}
-	_, err = stmt.Exec(payload.Firstname, payload.Lastname, payload.Active, payload.County, payload.FundingSource, payload.Bsu, payload.RecipientID, payload.Dia, payload.Other, payload.ID)
+	serviceCodes, err := s.updateTx(ctx, tx, payload, version)
 	if err != nil {
+		tx.Rollback()
+		// Someone else got in between the version check and the update.
+		if _, ok := err.(*StaleError); ok {
+			rec, err := s.read(ctx, db, *payload.ID)
+			if err != nil {
+				return nil, err
+			}
+			return nil, &StaleError{Consumer: rec}
+		}
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
 		return nil, err
 	}
+	version++
 	return &app.ConsumerMedia{
 		ID:            *payload.ID,
 		Firstname:     payload.Firstname,
@@ -218,21 +390,141 @@ func (s *Consumer) Update(db *mysql.DB) (interface{}, error) {
 		RecipientID:   payload.RecipientID,
 		Dia:           payload.Dia,
 		Other:         payload.Other,
+		Version:       &version,
 	}, nil
 }
 
-func (s *Consumer) Delete(db *mysql.DB) error {
-	stmt, err := db.Prepare(s.Stmt["DELETE"])
+// The version-guarded UPDATE goes first, so that a stale write is turned away before the unit blocks
+// are touched.
+func (s *Consumer) updateTx(ctx context.Context, tx *mysql.Tx, payload *app.ConsumerPayload, version int) ([]*app.UnitBlockItem, error) {
+	stmt, err := tx.PrepareContext(ctx, consumerStmt.Update)
+	if err != nil {
+		return nil, err
+	}
+	res, err := stmt.ExecContext(ctx, payload.Firstname, payload.Lastname, payload.Active, payload.County, payload.FundingSource, payload.Bsu, payload.RecipientID, payload.Dia, payload.Other, payload.ID, version)
+	if err != nil {
+		return nil, err
+	}
+	if affected, err := res.RowsAffected(); err != nil {
+		return nil, err
+	} else if affected == 0 {
+		return nil, &StaleError{}
+	}
+	return s.SetServiceCodes(ctx, tx, *payload.ID, payload.ServiceCodes)
+}
+
+func (s *Consumer) patch(ctx context.Context, db *mysql.DB, payload *app.ConsumerPatchPayload) (*app.ConsumerMedia, error) {
+	version, err := s.CheckVersion(ctx, db, *payload.ID, payload.Version)
+	if err != nil {
+		return nil, err
+	}
+	p := &columnPatch{}
+	p.Set("firstname", payload.Firstname)
+	p.Set("lastname", payload.Lastname)
+	p.Set("active", payload.Active)
+	p.Set("county", payload.County)
+	p.Set("fundingSource", payload.FundingSource)
+	p.Set("bsu", payload.Bsu)
+	p.Set("recipientID", payload.RecipientID)
+	p.Set("dia", payload.Dia)
+	p.Set("other", payload.Other)
+	if p.IsEmpty() && payload.ServiceCodes == nil {
+		return s.read(ctx, db, *payload.ID)
+	}
+	p.Increment("version")
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.patchTx(ctx, tx, p, *payload.ID, version, payload.ServiceCodes); err != nil {
+		tx.Rollback()
+		// Someone else got in between the version check and the patch.
+		if _, ok := err.(*StaleError); ok {
+			rec, err := s.read(ctx, db, *payload.ID)
+			if err != nil {
+				return nil, err
+			}
+			return nil, &StaleError{Consumer: rec}
+		}
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.read(ctx, db, *payload.ID)
+}
+
+// Only patches the consumer if it's still at the version that was checked.  The unit blocks are only
+// touched if they were sent.
+func (s *Consumer) patchTx(ctx context.Context, tx *mysql.Tx, p *columnPatch, id, version int, serviceCodes []*app.UnitBlockItem) error {
+	patched, err := p.ExecVersion(ctx, tx, "consumer", id, version)
 	if err != nil {
 		return err
 	}
-	id := s.Data.(int)
-	_, err = stmt.Exec(&id)
+	if !patched {
+		return &StaleError{}
+	}
+	if serviceCodes != nil {
+		if _, err = s.SetServiceCodes(ctx, tx, id, serviceCodes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Consumer) read(ctx context.Context, db *mysql.DB, id int) (*app.ConsumerMedia, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(consumerStmt.Select, "*, CONCAT(lastname,', ',firstname) AS fullname", fmt.Sprintf("WHERE id=%d", id)))
+	if err != nil {
+		return nil, err
+	}
+	coll := make([]*app.ConsumerItem, 1)
+	err = s.CollectRows(ctx, db, rows, coll)
+	if err != nil {
+		return nil, err
+	}
+	if coll[0] == nil {
+		return nil, errors.New("There is no Consumer with that id!")
+	}
+	c := coll[0]
+	return &app.ConsumerMedia{
+		ID:            c.ID,
+		Firstname:     c.Firstname,
+		Lastname:      c.Lastname,
+		Active:        c.Active,
+		County:        c.County,
+		ServiceCodes:  c.ServiceCodes,
+		FundingSource: c.FundingSource,
+		Bsu:           c.Bsu,
+		RecipientID:   c.RecipientID,
+		Dia:           c.Dia,
+		Other:         c.Other,
+		Version:       c.Version,
+	}, nil
+}
+
+func (s *Consumer) delete(ctx context.Context, db *mysql.DB, id int) error {
+	stmt, err := db.PrepareContext(ctx, consumerStmt.Delete)
+	if err != nil {
+		return err
+	}
+	_, err = stmt.ExecContext(ctx, &id)
 	return err
 }
 
-func (s *Consumer) List(db *mysql.DB) (interface{}, error) {
-	rows, err := db.Query(fmt.Sprintf(s.Stmt["SELECT"], "COUNT(*)", "WHERE active=1"))
+// Only the consumers that the principal can see are listed.
+func (s *Consumer) list(ctx context.Context, db *mysql.DB, mine bool) ([]*app.ConsumerItem, error) {
+	p := PrincipalFromContext(ctx)
+	scope, err := p.ConsumerScope()
+	if err != nil {
+		return nil, err
+	}
+	// The `mine` filter only lists the consumers currently assigned to whoever is logged in.
+	inCaseload := ""
+	if mine {
+		inCaseload = fmt.Sprintf(consumerStmt.InCaseload, p.ID, currentCaseloadClause("CURDATE()"))
+	}
+	whereClause := fmt.Sprintf("WHERE %s", andWhere("active=1", scope, inCaseload))
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(consumerStmt.Select, "COUNT(*)", whereClause))
 	if err != nil {
 		return nil, err
 	}
@@ -243,28 +535,39 @@ func (s *Consumer) List(db *mysql.DB) (interface{}, error) {
 			return nil, err
 		}
 	}
-	rows, err = db.Query(fmt.Sprintf(s.Stmt["SELECT"], "*, CONCAT(lastname,', ',firstname) AS fullname", "WHERE active=1 ORDER BY fullname ASC"))
+	rows, err = db.QueryContext(ctx, fmt.Sprintf(consumerStmt.Select, "*, CONCAT(lastname,', ',firstname) AS fullname", fmt.Sprintf("%s ORDER BY fullname ASC", whereClause)))
 	if err != nil {
 		return nil, err
 	}
 	coll := make([]*app.ConsumerItem, count)
-	err = s.CollectRows(db, rows, coll)
+	err = s.CollectRows(ctx, db, rows, coll)
 	if err != nil {
 		return nil, err
 	}
 	return coll, nil
 }
 
-func (s *Consumer) Page(db *mysql.DB) (interface{}, error) {
-	query := s.Data.(*PageQuery)
-	limit := query.Page * RecordsPerPage
-	var whereClause string
-	if query.WhereClause == "" {
-		whereClause = ""
-	} else {
-		whereClause = fmt.Sprintf("WHERE %s", query.WhereClause)
+func (s *Consumer) page(ctx context.Context, db *mysql.DB, query *ConsumerPageQuery) (*app.ConsumerMediaPaging, error) {
+	perPage, err := query.GetPerPage()
+	if err != nil {
+		return nil, err
+	}
+	offset := query.Page * perPage
+	_, orderBy, sort, err := query.GetSort(consumerSorts, "name", "id")
+	if err != nil {
+		return nil, err
+	}
+	// The scope is always applied, whatever the client asks for.
+	scope, err := query.Principal.ConsumerScope()
+	if err != nil {
+		return nil, err
+	}
+	filter, args := s.GetFilter(query.Filter)
+	whereClause := ""
+	if where := andWhere(scope, filter); where != "" {
+		whereClause = fmt.Sprintf("WHERE %s", where)
 	}
-	rows, err := db.Query(fmt.Sprintf(s.Stmt["SELECT"], "COUNT(*)", whereClause))
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(consumerStmt.Select, "COUNT(*)", whereClause), args...)
 	if err != nil {
 		return nil, err
 	}
@@ -275,26 +578,15 @@ func (s *Consumer) Page(db *mysql.DB) (interface{}, error) {
 			return nil, err
 		}
 	}
-	rows, err = db.Query(fmt.Sprintf(s.Stmt["SELECT"], "*, CONCAT(lastname,', ',firstname) AS fullname", fmt.Sprintf("%s ORDER BY fullname ASC LIMIT %d,%d", whereClause, limit, RecordsPerPage)))
+	rows, err = db.QueryContext(ctx, fmt.Sprintf(consumerStmt.Select, "*, CONCAT(lastname,', ',firstname) AS fullname", fmt.Sprintf("%s ORDER BY %s LIMIT %d,%d", whereClause, orderBy, offset, perPage)), args...)
 	if err != nil {
 		return nil, err
 	}
-	// Only the amount of rows equal to recordsPerPage unless the last page has been requested
-	// (determined by `totalCount - limit`).
-	capacity := totalCount - limit
-	if capacity >= RecordsPerPage {
-		capacity = RecordsPerPage
-	}
 	paging := &app.ConsumerMediaPaging{
-		Pager: &app.Pager{
-			CurrentPage:    limit / RecordsPerPage,
-			RecordsPerPage: RecordsPerPage,
-			TotalCount:     totalCount,
-			TotalPages:     int(math.Ceil(float64(totalCount) / float64(RecordsPerPage))),
-		},
-		Consumers: make([]*app.ConsumerItem, capacity),
-	}
-	err = s.CollectRows(db, rows, paging.Consumers)
+		Pager:     newPager(&query.PageQuery, perPage, totalCount, sort),
+		Consumers: make([]*app.ConsumerItem, pageCapacity(totalCount, offset, perPage)),
+	}
+	err = s.CollectRows(ctx, db, rows, paging.Consumers)
 	if err != nil {
 		return nil, err
 	}
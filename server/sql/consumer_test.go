@@ -0,0 +1,102 @@
+package sql
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"github.com/btoll/cpss/server/app"
+)
+
+func TestConsumerScope(t *testing.T) {
+	user := &Principal{ID: 7, AuthLevel: AuthLevelUser}
+	admin := &Principal{ID: 1, AuthLevel: AuthLevelAdmin}
+	userScope := "consumer.id IN (SELECT consumer FROM caseload WHERE specialist=7"
+	tests := []struct {
+		name string
+		p    *Principal
+		run  func(ctx context.Context, s *Consumer) error
+		ok   bool
+		// Every statement that's run has to contain this, or none may when it's empty.
+		scope string
+	}{
+		{name: "a user's list", p: user, ok: true, scope: userScope, run: func(ctx context.Context, s *Consumer) error {
+			_, err := s.List(ctx, false)
+			return err
+		}},
+		{name: "an admin's list", p: admin, ok: true, run: func(ctx context.Context, s *Consumer) error {
+			_, err := s.List(ctx, false)
+			return err
+		}},
+		{name: "nobody's list", run: func(ctx context.Context, s *Consumer) error {
+			_, err := s.List(ctx, true)
+			return err
+		}},
+		{name: "a user's page", p: user, ok: true, scope: userScope, run: func(ctx context.Context, s *Consumer) error {
+			_, err := s.Page(ctx, &ConsumerPageQuery{PageQuery: PageQuery{Principal: user}})
+			return err
+		}},
+		{name: "nobody's page", run: func(ctx context.Context, s *Consumer) error {
+			_, err := s.Page(ctx, &ConsumerPageQuery{})
+			return err
+		}},
+		{name: "a user's read of someone else's consumer", p: user, scope: userScope, run: func(ctx context.Context, s *Consumer) error {
+			_, err := s.Read(ctx, 3)
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script := &fakeScript{
+				// Nothing is found.
+				Query: func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+					if strings.Contains(query, "COUNT(*)") {
+						return []string{"COUNT(*)"}, [][]driver.Value{{int64(0)}}, nil
+					}
+					return nil, nil, nil
+				},
+			}
+			db := openFake(t, script)
+			ctx := context.Background()
+			if tt.p != nil {
+				ctx = WithPrincipal(ctx, tt.p)
+			}
+			err := tt.run(ctx, NewConsumer(db))
+			if tt.ok != (err == nil) {
+				t.Fatalf("error = %v, want ok %v", err, tt.ok)
+			}
+			for _, stmt := range script.Statements {
+				if tt.scope != "" && !strings.Contains(stmt.Query, tt.scope) {
+					t.Errorf("ran %q, want it to contain %q", stmt.Query, tt.scope)
+				}
+				if tt.scope == "" && strings.Contains(stmt.Query, "caseload") {
+					t.Errorf("ran %q, want it unscoped", stmt.Query)
+				}
+			}
+		})
+	}
+}
+
+func TestSetServiceCodes(t *testing.T) {
+	script := &fakeScript{}
+	db := openFake(t, script)
+	serviceCodes := []*app.UnitBlockItem{
+		{ID: -1, ServiceCode: 2, Units: 10},
+		{ID: ^5, ServiceCode: 3, Units: 20},
+		{ID: 6, ServiceCode: 4, Units: 30},
+	}
+	coll, err := NewConsumer(db).SetServiceCodes(context.Background(), db, 3, serviceCodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(coll) != 2 {
+		t.Errorf("SetServiceCodes() = %d service codes, want the inserted and the updated one", len(coll))
+	}
+	if len(script.Statements) != 3 {
+		t.Errorf("ran %d statements, want an insert, a delete and an update", len(script.Statements))
+	}
+	if script.OpenStmts != 0 {
+		t.Errorf("left %d statements open", script.OpenStmts)
+	}
+}
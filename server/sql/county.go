@@ -1,189 +1,81 @@
 package sql
 
 import (
+	"context"
 	mysql "database/sql"
-	"fmt"
-	"math"
 
 	"github.com/btoll/cpss/server/app"
 )
 
+var CountyTable = &LookupTable{
+	Table:       "county",
+	Label:       "County",
+	DefaultSort: "name",
+}
+
 type County struct {
-	Data interface{}
-	Stmt map[string]string
+	lookup *Lookup
 }
 
-func NewCounty(payload interface{}) *County {
-	return &County{
-		Data: payload,
-		Stmt: map[string]string{
-			"DELETE":       "DELETE FROM county WHERE id=?",
-			"INSERT":       "INSERT county SET name=?",
-			"SELECT":       "SELECT %s FROM county ORDER BY name %s",
-			"GET_COUNTIES": "SELECT %s FROM county WHERE id=%d",
-			"UPDATE":       "UPDATE county SET name=? WHERE id=?",
-		},
-	}
+func NewCounty(db *mysql.DB) *County {
+	return &County{lookup: NewLookup(CountyTable, db)}
 }
 
-func (c *County) Create(db *mysql.DB) (interface{}, error) {
-	payload := c.Data.(*app.CountyPayload)
-	stmt, err := db.Prepare(c.Stmt["INSERT"])
-	if err != nil {
-		return -1, err
-	}
-	res, err := stmt.Exec(payload.Name)
-	if err != nil {
-		return -1, err
-	}
-	id, err := res.LastInsertId()
-	if err != nil {
-		return -1, err
-	}
-	return int(id), nil
+func countyMedia(row *LookupRow) *app.CountyMedia {
+	return &app.CountyMedia{ID: row.ID, Name: row.Name}
 }
 
-func (c *County) Read(db *mysql.DB) (interface{}, error) {
-	countyID := c.Data.(int)
-	rows, err := db.Query(fmt.Sprintf(c.Stmt["GET_COUNTIES"], "COUNT(id)", countyID))
+func (c *County) Create(ctx context.Context, payload *app.CountyPayload) (*app.CountyMedia, error) {
+	row, err := c.lookup.Create(ctx, &LookupRow{Name: payload.Name})
 	if err != nil {
 		return nil, err
 	}
-	var count int
-	for rows.Next() {
-		err = rows.Scan(&count)
-		if err != nil {
-			return nil, err
-		}
-	}
-	rows, err = db.Query(fmt.Sprintf(c.Stmt["GET_COUNTIES"], "*", countyID))
+	return countyMedia(row), nil
+}
+
+func (c *County) Delete(ctx context.Context, id int) error {
+	return c.lookup.Delete(ctx, id)
+}
+
+func (c *County) List(ctx context.Context) (app.CountyMediaCollection, error) {
+	rows, err := c.lookup.List(ctx)
 	if err != nil {
 		return nil, err
 	}
-	coll := make(app.CountyMediaCollection, count)
-	i := 0
-	for rows.Next() {
-		var id int
-		var name string
-		err := rows.Scan(&id, &name)
-		if err != nil {
-			return nil, err
-		}
-		coll[i] = &app.CountyMedia{
-			ID:   id,
-			Name: name,
-		}
-		i++
+	coll := make(app.CountyMediaCollection, len(rows))
+	for i, row := range rows {
+		coll[i] = countyMedia(row)
 	}
 	return coll, nil
 }
 
-func (c *County) Update(db *mysql.DB) (interface{}, error) {
-	payload := c.Data.(*app.CountyPayload)
-	stmt, err := db.Prepare(c.Stmt["UPDATE"])
+func (c *County) Page(ctx context.Context, query *PageQuery) (*app.CountyMediaPaging, error) {
+	pager, rows, err := c.lookup.Page(ctx, query)
 	if err != nil {
 		return nil, err
 	}
-	_, err = stmt.Exec(payload.Name, payload.ID)
-	if err != nil {
-		return nil, err
+	paging := &app.CountyMediaPaging{
+		Pager:    pager,
+		Counties: make([]*app.CountyItem, len(rows)),
 	}
-	return &app.CountyMedia{
-		ID:   *payload.ID,
-		Name: payload.Name,
-	}, nil
-}
-
-func (c *County) Delete(db *mysql.DB) error {
-	stmt, err := db.Prepare(c.Stmt["DELETE"])
-	if err != nil {
-		return err
+	for i, row := range rows {
+		paging.Counties[i] = &app.CountyItem{ID: row.ID, Name: row.Name}
 	}
-	id := c.Data.(int)
-	_, err = stmt.Exec(&id)
-	return err
+	return paging, nil
 }
 
-func (c *County) List(db *mysql.DB) (interface{}, error) {
-	rows, err := db.Query(fmt.Sprintf(c.Stmt["SELECT"], "COUNT(*)", ""))
+func (c *County) Read(ctx context.Context, id int) (*app.CountyMedia, error) {
+	row, err := c.lookup.Read(ctx, id)
 	if err != nil {
 		return nil, err
 	}
-	var totalCount int
-	for rows.Next() {
-		err = rows.Scan(&totalCount)
-		if err != nil {
-			return nil, err
-		}
-	}
-	rows, err = db.Query(fmt.Sprintf(c.Stmt["SELECT"], "*", ""))
-	if err != nil {
-		return nil, err
-	}
-	coll := make(app.CountyMediaCollection, totalCount)
-	i := 0
-	for rows.Next() {
-		var id int
-		var name string
-		err := rows.Scan(&id, &name)
-		if err != nil {
-			return nil, err
-		}
-		coll[i] = &app.CountyMedia{
-			ID:   id,
-			Name: name,
-		}
-		i++
-	}
-	return coll, nil
+	return countyMedia(row), nil
 }
 
-func (c *County) Page(db *mysql.DB) (interface{}, error) {
-	// page * RecordsPerPage = limit
-	limit := c.Data.(int) * RecordsPerPage
-	rows, err := db.Query(fmt.Sprintf(c.Stmt["SELECT"], "COUNT(*)", ""))
+func (c *County) Update(ctx context.Context, payload *app.CountyPayload) (*app.CountyMedia, error) {
+	row, err := c.lookup.Update(ctx, &LookupRow{ID: intOrZero(payload.ID), Name: payload.Name})
 	if err != nil {
 		return nil, err
 	}
-	var totalCount int
-	for rows.Next() {
-		err = rows.Scan(&totalCount)
-		if err != nil {
-			return nil, err
-		}
-	}
-	rows, err = db.Query(fmt.Sprintf(c.Stmt["SELECT"], "*", fmt.Sprintf("LIMIT %d,%d", limit, RecordsPerPage)))
-	if err != nil {
-		return nil, err
-	}
-	// Only the amount of rows equal to RecordsPerPage unless the last page has been requested
-	// (determined by `totalCount - limit`).
-	capacity := totalCount - limit
-	if capacity >= RecordsPerPage {
-		capacity = RecordsPerPage
-	}
-	paging := &app.CountyMediaPaging{
-		Pager: &app.Pager{
-			CurrentPage:    limit / RecordsPerPage,
-			RecordsPerPage: RecordsPerPage,
-			TotalCount:     totalCount,
-			TotalPages:     int(math.Ceil(float64(totalCount) / float64(RecordsPerPage))),
-		},
-		Counties: make([]*app.CountyItem, capacity),
-	}
-	i := 0
-	for rows.Next() {
-		var id int
-		var name string
-		err := rows.Scan(&id, &name)
-		if err != nil {
-			return nil, err
-		}
-		paging.Counties[i] = &app.CountyItem{
-			ID:   id,
-			Name: name,
-		}
-		i++
-	}
-	return paging, nil
+	return countyMedia(row), nil
 }
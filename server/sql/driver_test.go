@@ -0,0 +1,187 @@
+package sql
+
+import (
+	mysql "database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+)
+
+// A database driver that answers from a script instead of a server, so that the statements a function
+// runs (and what it does with the answers) can be tested.  Every statement is recorded.
+type fakeStatement struct {
+	Query string
+	Args  []driver.Value
+}
+
+type fakeScript struct {
+	// How many rows an Exec affected.  Nil means 1.
+	Exec func(query string, args []driver.Value) (int64, error)
+	// The rows a Query returns.  Nil means none.
+	Query func(query string, args []driver.Value) ([]string, [][]driver.Value, error)
+
+	mu         sync.Mutex
+	Statements []fakeStatement
+	Committed  bool
+	RolledBack bool
+	// How many prepared statements haven't been closed.
+	OpenStmts int
+}
+
+func (s *fakeScript) record(query string, args []driver.Value) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Statements = append(s.Statements, fakeStatement{query, args})
+}
+
+type fakeDriver struct {
+	mu      sync.Mutex
+	scripts map[string]*fakeScript
+}
+
+var fakeDrivers = &fakeDriver{scripts: map[string]*fakeScript{}}
+
+func init() {
+	mysql.Register("fake", fakeDrivers)
+}
+
+func (d *fakeDriver) Open(name string) (driver.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	script, ok := d.scripts[name]
+	if !ok {
+		return nil, fmt.Errorf("no script named %q", name)
+	}
+	return &fakeConn{script}, nil
+}
+
+// Opens a database that answers from the script for as long as the test runs.
+func openFake(t *testing.T, script *fakeScript) *mysql.DB {
+	t.Helper()
+	fakeDrivers.mu.Lock()
+	fakeDrivers.scripts[t.Name()] = script
+	fakeDrivers.mu.Unlock()
+	db, err := mysql.Open("fake", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		fakeDrivers.mu.Lock()
+		delete(fakeDrivers.scripts, t.Name())
+		fakeDrivers.mu.Unlock()
+	})
+	return db
+}
+
+type fakeConn struct {
+	script *fakeScript
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	c.script.mu.Lock()
+	defer c.script.mu.Unlock()
+	c.script.OpenStmts++
+	return &fakeStmt{c.script, query}, nil
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return &fakeTx{c.script}, nil
+}
+
+type fakeTx struct {
+	script *fakeScript
+}
+
+func (tx *fakeTx) Commit() error {
+	tx.script.Committed = true
+	return nil
+}
+
+func (tx *fakeTx) Rollback() error {
+	tx.script.RolledBack = true
+	return nil
+}
+
+type fakeStmt struct {
+	script *fakeScript
+	query  string
+}
+
+func (s *fakeStmt) Close() error {
+	s.script.mu.Lock()
+	defer s.script.mu.Unlock()
+	s.script.OpenStmts--
+	return nil
+}
+
+func (s *fakeStmt) NumInput() int {
+	return -1
+}
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.script.record(s.query, args)
+	if s.script.Exec == nil {
+		return fakeResult(1), nil
+	}
+	affected, err := s.script.Exec(s.query, args)
+	if err != nil {
+		return nil, err
+	}
+	return fakeResult(affected), nil
+}
+
+// Every insert gets id 1.
+type fakeResult int64
+
+func (r fakeResult) LastInsertId() (int64, error) {
+	return 1, nil
+}
+
+func (r fakeResult) RowsAffected() (int64, error) {
+	return int64(r), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.script.record(s.query, args)
+	if s.script.Query == nil {
+		return &fakeRows{}, nil
+	}
+	columns, values, err := s.script.Query(s.query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{columns: columns, values: values}, nil
+}
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string {
+	return r.columns
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	if len(dest) != len(r.values[0]) {
+		return errors.New("wrong number of columns")
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
@@ -0,0 +1,53 @@
+package sql
+
+import (
+	"context"
+	mysql "database/sql"
+)
+
+// Receives the rows of an export one at a time, so that every matching row can be sent to the client
+// without first collecting them all.
+type RowWriter interface {
+	Write(record []string) error
+	Flush() error
+}
+
+type ExportQuery struct {
+	// Who is asking, for the resources whose rows are scoped.  Only the server's own jobs leave it nil.
+	Principal *Principal
+}
+
+// Writes the header and then every row that the query returns.  Every column is written as a string
+// and a NULL is written as an empty string.
+func exportRows(ctx context.Context, db *mysql.DB, query string, header []string, w RowWriter, args ...interface{}) error {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	if err = w.Write(header); err != nil {
+		return err
+	}
+	values := make([]mysql.NullString, len(header))
+	dest := make([]interface{}, len(header))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	for rows.Next() {
+		err = rows.Scan(dest...)
+		if err != nil {
+			return err
+		}
+		record := make([]string, len(values))
+		for i, value := range values {
+			record[i] = value.String
+		}
+		if err = w.Write(record); err != nil {
+			return err
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	return w.Flush()
+}
@@ -0,0 +1,95 @@
+package sql
+
+import (
+	"context"
+	mysql "database/sql"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/btoll/cpss/server/app"
+)
+
+// Throws the rows away.
+type discardWriter struct{}
+
+func (discardWriter) Write(record []string) error {
+	return nil
+}
+
+func (discardWriter) Flush() error {
+	return nil
+}
+
+func TestExport(t *testing.T) {
+	user := &Principal{ID: 7, AuthLevel: AuthLevelUser}
+	admin := &Principal{ID: 1, AuthLevel: AuthLevelAdmin}
+	active := true
+	lastname := "50%_off"
+	specialist := 7
+	filter := &app.ConsumerQueryPayload{Active: &active, Lastname: &lastname}
+	tests := []struct {
+		name   string
+		p      *Principal
+		export func(ctx context.Context, db *mysql.DB) error
+		ok     bool
+		// The statement has to contain these, and is given these arguments.
+		where []string
+		args  []interface{}
+	}{
+		{name: "specialists by an admin", p: admin, ok: true, export: func(ctx context.Context, db *mysql.DB) error {
+			return NewSpecialist(nil).export(ctx, db, &SpecialistExportQuery{Filter: &app.SpecialistQueryPayload{Lastname: &lastname}}, discardWriter{})
+		}, where: []string{"WHERE lastname LIKE ?"}, args: []interface{}{`%50\%\_off%`}},
+		{name: "specialists by a user", p: user, export: func(ctx context.Context, db *mysql.DB) error {
+			return NewSpecialist(nil).export(ctx, db, &SpecialistExportQuery{}, discardWriter{})
+		}},
+		{name: "pay history by an admin", p: admin, ok: true, export: func(ctx context.Context, db *mysql.DB) error {
+			return NewPayHistory(nil).export(ctx, db, &PayHistoryExportQuery{Filter: &app.PayHistoryQueryPayload{Specialist: &specialist}}, discardWriter{})
+		}, where: []string{"WHERE specialist = ?"}, args: []interface{}{int64(7)}},
+		{name: "pay history by a user", p: user, export: func(ctx context.Context, db *mysql.DB) error {
+			return NewPayHistory(nil).export(ctx, db, &PayHistoryExportQuery{}, discardWriter{})
+		}},
+		{name: "consumers by a user", p: user, ok: true, export: func(ctx context.Context, db *mysql.DB) error {
+			return NewConsumer(nil).export(ctx, db, &ConsumerExportQuery{ExportQuery: ExportQuery{Principal: user}, Filter: filter}, discardWriter{})
+		}, where: []string{"consumer.id IN (SELECT consumer FROM caseload WHERE specialist=7", "active = ? AND lastname LIKE ?"}, args: []interface{}{true, `%50\%\_off%`}},
+		{name: "consumers by nobody", export: func(ctx context.Context, db *mysql.DB) error {
+			return NewConsumer(nil).export(ctx, db, &ConsumerExportQuery{}, discardWriter{})
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script := &fakeScript{}
+			db := openFake(t, script)
+			ctx := context.Background()
+			if tt.p != nil {
+				ctx = WithPrincipal(ctx, tt.p)
+			}
+			err := tt.export(ctx, db)
+			if tt.ok != (err == nil) {
+				t.Fatalf("export() error = %v, want ok %v", err, tt.ok)
+			}
+			if !tt.ok {
+				if len(script.Statements) > 0 {
+					t.Errorf("export() ran %q", script.Statements[0].Query)
+				}
+				return
+			}
+			if len(script.Statements) != 1 {
+				t.Fatalf("export() ran %d statements, want 1", len(script.Statements))
+			}
+			stmt := script.Statements[0]
+			for _, w := range tt.where {
+				if !strings.Contains(stmt.Query, w) {
+					t.Errorf("export() ran %q, want it to contain %q", stmt.Query, w)
+				}
+			}
+			args := []interface{}{}
+			for _, arg := range stmt.Args {
+				args = append(args, arg)
+			}
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("export() args = %v, want %v", args, tt.args)
+			}
+		})
+	}
+}
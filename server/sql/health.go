@@ -0,0 +1,41 @@
+package sql
+
+import (
+	"context"
+	mysql "database/sql"
+	"fmt"
+)
+
+// The version of the schema that this build expects, the highest version in `schema_version`.  The
+// migrations are in `migration/alters`, each one adds its own version.
+const SchemaVersion = 9
+
+type Health struct {
+	db *mysql.DB
+}
+
+func NewHealth(db *mysql.DB) *Health {
+	return &Health{db: db}
+}
+
+// Returns the version of the schema that's been applied.  The database isn't ready when it can't be reached
+// or when a migration hasn't been applied yet.
+func (h *Health) CheckReady(ctx context.Context) (_ int, err error) {
+	defer logError(ctx, "CheckReady Health", &err)
+	return h.checkReady(ctx, h.db)
+}
+
+func (h *Health) checkReady(ctx context.Context, db *mysql.DB) (int, error) {
+	if err := db.PingContext(ctx); err != nil {
+		return 0, err
+	}
+	var version int
+	err := db.QueryRowContext(ctx, "SELECT IFNULL(MAX(version),0) FROM schema_version").Scan(&version)
+	if err != nil {
+		return 0, err
+	}
+	if version < SchemaVersion {
+		return version, fmt.Errorf("The schema is at version %d but this build needs version %d!", version, SchemaVersion)
+	}
+	return version, nil
+}
@@ -0,0 +1,510 @@
+package sql
+
+import (
+	"context"
+	mysql "database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/btoll/cpss/server/app"
+)
+
+// What can be imported.
+const (
+	ImportConsumers  = "consumers"
+	ImportUnitBlocks = "unitBlocks"
+	ImportBillSheets = "billsheets"
+)
+
+type ImportQuery struct {
+	Kind   string
+	Data   string
+	DryRun bool
+}
+
+// The repository of the imports.
+type Import struct {
+	db *mysql.DB
+}
+
+func NewImport(db *mysql.DB) *Import {
+	return &Import{db: db}
+}
+
+func (s *Import) Import(ctx context.Context, query *ImportQuery) (_ *app.ImportMedia, err error) {
+	defer logError(ctx, "Import", &err)
+	return NewCSVImport(query).Import(ctx, s.db)
+}
+
+var csvImportStmt = struct {
+	SelectNames     string
+	SelectUnitBlock string
+	UpdateConsumer  string
+}{
+	SelectNames:     "SELECT id,%s FROM %s",
+	SelectUnitBlock: "SELECT COUNT(*) FROM unit_block WHERE consumer=%d AND serviceCode=%d",
+	UpdateConsumer:  "UPDATE consumer SET version=version+1 WHERE id=?",
+}
+
+func init() {
+	registerStmts("CSVImport", csvImportStmt)
+}
+
+type CSVImport struct {
+	Query *ImportQuery
+}
+
+func NewCSVImport(query *ImportQuery) *CSVImport {
+	return &CSVImport{
+		Query: query,
+	}
+}
+
+// Names are matched without regard to case or surrounding whitespace, since they're typed by hand.
+func normalizeName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// Maps the names in a lookup table to their ids.
+type nameMap map[string]int
+
+func (m nameMap) ID(kind, name string) (int, error) {
+	if strings.TrimSpace(name) == "" {
+		return -1, fmt.Errorf("Missing %s", kind)
+	}
+	id, ok := m[normalizeName(name)]
+	if !ok {
+		return -1, fmt.Errorf("Unknown %s: %s", kind, name)
+	}
+	return id, nil
+}
+
+func (i *CSVImport) GetNames(ctx context.Context, db *mysql.DB, table, column string) (nameMap, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(csvImportStmt.SelectNames, column, table))
+	if err != nil {
+		return nil, err
+	}
+	names := nameMap{}
+	for rows.Next() {
+		var id int
+		var name string
+		err = rows.Scan(&id, &name)
+		if err != nil {
+			return nil, err
+		}
+		names[normalizeName(name)] = id
+	}
+	return names, nil
+}
+
+// A row of the file.  The known columns are keyed by their lower-cased header, anything else is kept
+// under its header as it was given.
+type importRow struct {
+	Values map[string]string
+	Extra  map[string]string
+}
+
+func (r *importRow) Get(column string) string {
+	return strings.TrimSpace(r.Values[strings.ToLower(column)])
+}
+
+// Reads the file, the first row being the header.  It's an error to have a column that isn't known
+// unless extra columns are allowed.
+func (i *CSVImport) ReadRows(known []string, allowExtra bool) ([]*importRow, error) {
+	query := i.Query
+	r := csv.NewReader(strings.NewReader(query.Data))
+	r.TrimLeadingSpace = true
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("Bad file: %s", err.Error())
+	}
+	if len(records) < 2 {
+		return nil, errors.New("Bad file: there is nothing to import!")
+	}
+	isKnown := map[string]bool{}
+	for _, column := range known {
+		isKnown[strings.ToLower(column)] = true
+	}
+	header := records[0]
+	for _, column := range header {
+		if !isKnown[strings.ToLower(strings.TrimSpace(column))] && !allowExtra {
+			return nil, fmt.Errorf("Bad file: %s is not a column, expected %s", column, strings.Join(known, ", "))
+		}
+	}
+	rows := make([]*importRow, len(records)-1)
+	for n, record := range records[1:] {
+		row := &importRow{
+			Values: map[string]string{},
+			Extra:  map[string]string{},
+		}
+		for j, column := range header {
+			column = strings.TrimSpace(column)
+			if isKnown[strings.ToLower(column)] {
+				row.Values[strings.ToLower(column)] = record[j]
+			} else {
+				row.Extra[column] = record[j]
+			}
+		}
+		rows[n] = row
+	}
+	return rows, nil
+}
+
+// One row of the file once it's been mapped to ids, ready to be written.
+type importRecord struct {
+	Result  *app.ImportRowItem
+	Payload interface{}
+}
+
+func newImportRecord(n int) *importRecord {
+	// Counting the header as row 1, just like a spreadsheet does.
+	return &importRecord{
+		Result: &app.ImportRowItem{
+			Row: n + 2,
+		},
+	}
+}
+
+func (r *importRecord) Fail(err error) {
+	message := err.Error()
+	r.Result.Error = &message
+}
+
+func parseBool(value string) (bool, error) {
+	switch normalizeName(value) {
+	case "", "1", "y", "yes", "true":
+		return true, nil
+	case "0", "n", "no", "false":
+		return false, nil
+	}
+	return false, fmt.Errorf("Bad value: %s is not yes or no", value)
+}
+
+func (i *CSVImport) PrepareConsumers(ctx context.Context, db *mysql.DB) ([]*importRecord, error) {
+	rows, err := i.ReadRows([]string{"firstname", "lastname", "active", "county", "fundingSource", "bsu", "recipientID", "dia", "other"}, false)
+	if err != nil {
+		return nil, err
+	}
+	counties, err := i.GetNames(ctx, db, "county", "name")
+	if err != nil {
+		return nil, err
+	}
+	fundingSources, err := i.GetNames(ctx, db, "funding_source", "name")
+	if err != nil {
+		return nil, err
+	}
+	dias, err := i.GetNames(ctx, db, "dia", "name")
+	if err != nil {
+		return nil, err
+	}
+	consumer := NewConsumer(db)
+	seen := map[string]bool{}
+	records := make([]*importRecord, len(rows))
+	for n, row := range rows {
+		record := newImportRecord(n)
+		records[n] = record
+		payload := &app.ConsumerPayload{
+			Firstname:    row.Get("firstname"),
+			Lastname:     row.Get("lastname"),
+			Bsu:          row.Get("bsu"),
+			RecipientID:  row.Get("recipientID"),
+			Other:        row.Get("other"),
+			ServiceCodes: []*app.UnitBlockItem{},
+		}
+		if payload.Firstname == "" || payload.Lastname == "" {
+			record.Fail(errors.New("Missing firstname or lastname"))
+			continue
+		}
+		if payload.Active, err = parseBool(row.Get("active")); err != nil {
+			record.Fail(err)
+			continue
+		}
+		if payload.County, err = counties.ID("county", row.Get("county")); err != nil {
+			record.Fail(err)
+			continue
+		}
+		if payload.FundingSource, err = fundingSources.ID("funding source", row.Get("fundingSource")); err != nil {
+			record.Fail(err)
+			continue
+		}
+		if payload.Dia, err = dias.ID("DIA", row.Get("dia")); err != nil {
+			record.Fail(err)
+			continue
+		}
+		name := normalizeName(fmt.Sprintf("%s, %s", payload.Lastname, payload.Firstname))
+		if seen[name] {
+			record.Fail(errors.New("This Consumer is already in the file!"))
+			continue
+		}
+		seen[name] = true
+		if isDuplicate, err := consumer.IsDuplicateName(ctx, db, payload.Firstname, payload.Lastname); isDuplicate == true {
+			record.Fail(err)
+			continue
+		}
+		record.Payload = payload
+	}
+	return records, nil
+}
+
+type unitBlockImport struct {
+	Consumer  int
+	UnitBlock *app.UnitBlockItem
+}
+
+func (i *CSVImport) PrepareUnitBlocks(ctx context.Context, db *mysql.DB) ([]*importRecord, error) {
+	rows, err := i.ReadRows([]string{"consumer", "serviceCode", "units"}, false)
+	if err != nil {
+		return nil, err
+	}
+	consumers, err := i.GetNames(ctx, db, "consumer", "CONCAT(lastname,', ',firstname)")
+	if err != nil {
+		return nil, err
+	}
+	serviceCodes, err := i.GetNames(ctx, db, "service_code", "name")
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	records := make([]*importRecord, len(rows))
+	for n, row := range rows {
+		record := newImportRecord(n)
+		records[n] = record
+		consumer, err := consumers.ID("consumer", row.Get("consumer"))
+		if err != nil {
+			record.Fail(err)
+			continue
+		}
+		serviceCode, err := serviceCodes.ID("service code", row.Get("serviceCode"))
+		if err != nil {
+			record.Fail(err)
+			continue
+		}
+		units, err := strconv.ParseFloat(row.Get("units"), 64)
+		if err != nil || units < 0 {
+			record.Fail(fmt.Errorf("Bad units: %s", row.Get("units")))
+			continue
+		}
+		key := fmt.Sprintf("%d:%d", consumer, serviceCode)
+		if seen[key] {
+			record.Fail(errors.New("This unit block is already in the file!"))
+			continue
+		}
+		seen[key] = true
+		count, err := i.CountUnitBlocks(ctx, db, consumer, serviceCode)
+		if err != nil {
+			return nil, err
+		}
+		// A consumer can only have one unit block per service code, see BillSheet.UpdateUnitBlock.
+		if count > 0 {
+			record.Fail(errors.New("This Consumer already has a unit block for this Service Code!"))
+			continue
+		}
+		record.Payload = &unitBlockImport{
+			Consumer: consumer,
+			UnitBlock: &app.UnitBlockItem{
+				ID:          -1,
+				ServiceCode: serviceCode,
+				Units:       units,
+			},
+		}
+	}
+	return records, nil
+}
+
+var billSheetImportColumns = []string{"specialist", "consumer", "units", "serviceDate", "serviceCode", "status", "confirmation", "description"}
+
+func (i *CSVImport) PrepareBillSheets(ctx context.Context, db *mysql.DB) ([]*importRecord, error) {
+	// Any column that isn't one of the billsheet columns is a note field.
+	rows, err := i.ReadRows(billSheetImportColumns, true)
+	if err != nil {
+		return nil, err
+	}
+	specialists, err := i.GetNames(ctx, db, "specialist", "username")
+	if err != nil {
+		return nil, err
+	}
+	consumers, err := i.GetNames(ctx, db, "consumer", "CONCAT(lastname,', ',firstname)")
+	if err != nil {
+		return nil, err
+	}
+	serviceCodes, err := i.GetNames(ctx, db, "service_code", "name")
+	if err != nil {
+		return nil, err
+	}
+	statuses, err := i.GetNames(ctx, db, "status", "name")
+	if err != nil {
+		return nil, err
+	}
+	billSheet := NewBillSheet(db)
+	seen := map[string]bool{}
+	records := make([]*importRecord, len(rows))
+	for n, row := range rows {
+		record := newImportRecord(n)
+		records[n] = record
+		payload := &app.BillSheetPayload{
+			ServiceDate: row.Get("serviceDate"),
+			Notes:       []*app.NoteItem{},
+		}
+		if payload.Specialist, err = specialists.ID("specialist", row.Get("specialist")); err != nil {
+			record.Fail(err)
+			continue
+		}
+		if payload.Consumer, err = consumers.ID("consumer", row.Get("consumer")); err != nil {
+			record.Fail(err)
+			continue
+		}
+		if payload.ServiceCode, err = serviceCodes.ID("service code", row.Get("serviceCode")); err != nil {
+			record.Fail(err)
+			continue
+		}
+		if row.Get("status") != "" {
+			status, err := statuses.ID("status", row.Get("status"))
+			if err != nil {
+				record.Fail(err)
+				continue
+			}
+			payload.Status = &status
+		}
+		units := row.Get("units")
+		if _, err := strconv.ParseFloat(units, 64); err != nil {
+			record.Fail(fmt.Errorf("Bad units: %s", units))
+			continue
+		}
+		payload.Units = &units
+		if confirmation := row.Get("confirmation"); confirmation != "" {
+			payload.Confirmation = &confirmation
+		}
+		if description := row.Get("description"); description != "" {
+			payload.Description = &description
+		}
+		for field, value := range row.Extra {
+			if value = strings.TrimSpace(value); value != "" {
+				payload.Notes = append(payload.Notes, &app.NoteItem{
+					Field: field,
+					Value: value,
+				})
+			}
+		}
+		formattedDate, err := formatDate(payload.ServiceDate)
+		if err != nil {
+			record.Fail(err)
+			continue
+		}
+		key := fmt.Sprintf("%d:%d:%d:%s", payload.Specialist, payload.Consumer, payload.ServiceCode, formattedDate)
+		if seen[key] {
+			record.Fail(errors.New("Duplicate entry: This billsheet is already in the file!"))
+			continue
+		}
+		seen[key] = true
+		if _, err = billSheet.Validate(ctx, db, payload); err != nil {
+			record.Fail(err)
+			continue
+		}
+		count, err := i.CountUnitBlocks(ctx, db, payload.Consumer, payload.ServiceCode)
+		if err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			record.Fail(errors.New("This Consumer is not authorized for that Service Code!"))
+			continue
+		}
+		record.Payload = payload
+	}
+	return records, nil
+}
+
+func (i *CSVImport) CountUnitBlocks(ctx context.Context, db *mysql.DB, consumer, serviceCode int) (int, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(csvImportStmt.SelectUnitBlock, consumer, serviceCode))
+	if err != nil {
+		return -1, err
+	}
+	var count int
+	for rows.Next() {
+		err = rows.Scan(&count)
+		if err != nil {
+			return -1, err
+		}
+	}
+	return count, nil
+}
+
+// Writes a record that has passed validation and returns its new id.
+func (i *CSVImport) Write(ctx context.Context, db *mysql.DB, payload interface{}) (int, error) {
+	switch p := payload.(type) {
+	case *app.ConsumerPayload:
+		return NewConsumer(db).create(ctx, db, p)
+	case *unitBlockImport:
+		coll, err := NewConsumer(db).SetServiceCodes(ctx, db, p.Consumer, []*app.UnitBlockItem{p.UnitBlock})
+		if err != nil {
+			return -1, err
+		}
+		stmt, err := db.PrepareContext(ctx, csvImportStmt.UpdateConsumer)
+		if err != nil {
+			return -1, err
+		}
+		_, err = stmt.ExecContext(ctx, p.Consumer)
+		if err != nil {
+			return -1, err
+		}
+		return coll[0].ID, nil
+	case *app.BillSheetPayload:
+		rec, err := NewBillSheet(db).create(ctx, db, p)
+		if err != nil {
+			return -1, err
+		}
+		return rec.ID, nil
+	}
+	return -1, errors.New("Bad import: unknown record")
+}
+
+// Every row is validated before anything is written.  If any of them fails (or it's a dry run) then
+// nothing is written, and the result of each row is reported back so the file can be fixed.
+func (i *CSVImport) Import(ctx context.Context, db *mysql.DB) (*app.ImportMedia, error) {
+	query := i.Query
+	// The rows are written as the principal, who has to be an admin.
+	if err := RequireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	var err error
+	var records []*importRecord
+	switch query.Kind {
+	case ImportConsumers:
+		records, err = i.PrepareConsumers(ctx, db)
+	case ImportUnitBlocks:
+		records, err = i.PrepareUnitBlocks(ctx, db)
+	case ImportBillSheets:
+		records, err = i.PrepareBillSheets(ctx, db)
+	default:
+		err = fmt.Errorf("Bad import: cannot import %s", query.Kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+	result := &app.ImportMedia{
+		DryRun: query.DryRun,
+		Rows:   make([]*app.ImportRowItem, len(records)),
+	}
+	for n, record := range records {
+		result.Rows[n] = record.Result
+		if record.Result.Error != nil {
+			result.Failed++
+		}
+	}
+	if query.DryRun || result.Failed > 0 {
+		return result, nil
+	}
+	for _, record := range records {
+		id, err := i.Write(ctx, db, record.Payload)
+		if err != nil {
+			record.Fail(err)
+			result.Failed++
+			continue
+		}
+		record.Result.ID = &id
+		result.Imported++
+	}
+	return result, nil
+}
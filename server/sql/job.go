@@ -0,0 +1,252 @@
+package sql
+
+import (
+	"context"
+	mysql "database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/btoll/cpss/server/app"
+)
+
+// The states of a job run.
+const (
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// Who a transition is recorded against when a job makes it rather than a specialist.
+const SystemSpecialist = 0
+
+type JobRunQuery struct {
+	Job   string
+	Limit int
+}
+
+type Job struct {
+	db *mysql.DB
+}
+
+func NewJob(db *mysql.DB) *Job {
+	return &Job{db: db}
+}
+
+var jobStmt = struct {
+	Insert    string
+	InsertRun string
+	Lock      string
+	SelectRun string
+	Unlock    string
+	UpdateRun string
+}{
+	Insert:    "INSERT IGNORE job SET name=?",
+	InsertRun: "INSERT job_run SET job=?,`trigger`=?,status=?,instance=?,startTime=?,output=''",
+	Lock:      "UPDATE job SET lockedBy=?,lockedUntil=? WHERE name=? AND (lockedBy IS NULL OR lockedUntil < ?)",
+	SelectRun: "SELECT id,job,`trigger`,status,instance,startTime,endTime,IFNULL(output,'') FROM job_run %s",
+	Unlock:    "UPDATE job SET lockedBy=NULL,lockedUntil=0 WHERE name=? AND lockedBy=?",
+	UpdateRun: "UPDATE job_run SET status=?,endTime=?,output=? WHERE id=?",
+}
+
+func init() {
+	registerStmts("Job", jobStmt)
+}
+
+func (j *Job) List(ctx context.Context, query *JobRunQuery) (_ app.JobRunMediaCollection, err error) {
+	defer logError(ctx, "List Job", &err)
+	return j.list(ctx, j.db, query)
+}
+
+func (j *Job) Read(ctx context.Context, id int) (_ *app.JobRunMedia, err error) {
+	defer logError(ctx, "Read Job", &err)
+	return j.read(ctx, j.db, id)
+}
+
+func (j *Job) CollectRows(rows *mysql.Rows) (app.JobRunMediaCollection, error) {
+	coll := app.JobRunMediaCollection{}
+	for rows.Next() {
+		run := &app.JobRunMedia{}
+		err := rows.Scan(&run.ID, &run.Job, &run.Trigger, &run.Status, &run.Instance, &run.StartTime, &run.EndTime, &run.Output)
+		if err != nil {
+			return nil, err
+		}
+		coll = append(coll, run)
+	}
+	return coll, nil
+}
+
+// Only one instance can hold the lock of a job.  The lock expires after the given time in case the
+// instance that holds it goes away without releasing it.
+func (j *Job) Lock(ctx context.Context, db *mysql.DB, name, instance string, ttl time.Duration) (bool, error) {
+	stmt, err := db.PrepareContext(ctx, jobStmt.Insert)
+	if err != nil {
+		return false, err
+	}
+	_, err = stmt.ExecContext(ctx, name)
+	if err != nil {
+		return false, err
+	}
+	stmt, err = db.PrepareContext(ctx, jobStmt.Lock)
+	if err != nil {
+		return false, err
+	}
+	now := time.Now()
+	res, err := stmt.ExecContext(ctx, instance, int(now.Add(ttl).Unix()), name, int(now.Unix()))
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+func (j *Job) Unlock(ctx context.Context, db *mysql.DB, name, instance string) error {
+	stmt, err := db.PrepareContext(ctx, jobStmt.Unlock)
+	if err != nil {
+		return err
+	}
+	_, err = stmt.ExecContext(ctx, name, instance)
+	return err
+}
+
+func (j *Job) list(ctx context.Context, db *mysql.DB, query *JobRunQuery) (app.JobRunMediaCollection, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(jobStmt.SelectRun, "WHERE job=? ORDER BY id DESC LIMIT ?"), query.Job, query.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return j.CollectRows(rows)
+}
+
+func (j *Job) read(ctx context.Context, db *mysql.DB, id int) (*app.JobRunMedia, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(jobStmt.SelectRun, "WHERE id=?"), id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	coll, err := j.CollectRows(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(coll) == 0 {
+		return nil, errors.New("There is no job run with that id!")
+	}
+	return coll[0], nil
+}
+
+// Locks the job and records the start of a run.  It's an error if another instance is already running it.
+func (j *Job) StartRun(ctx context.Context, name, trigger, instance string, ttl time.Duration) (_ *app.JobRunMedia, err error) {
+	defer logError(ctx, "StartRun Job", &err)
+	return j.startRun(ctx, j.db, name, trigger, instance, ttl)
+}
+
+func (j *Job) startRun(ctx context.Context, db *mysql.DB, name, trigger, instance string, ttl time.Duration) (*app.JobRunMedia, error) {
+	isLocked, err := j.Lock(ctx, db, name, instance, ttl)
+	if err != nil {
+		return nil, err
+	}
+	if !isLocked {
+		return nil, errors.New("This job is already running!")
+	}
+	stmt, err := db.PrepareContext(ctx, jobStmt.InsertRun)
+	if err != nil {
+		j.Unlock(ctx, db, name, instance)
+		return nil, err
+	}
+	startTime := int(time.Now().Unix())
+	res, err := stmt.ExecContext(ctx, name, trigger, JobRunning, instance, startTime)
+	if err != nil {
+		j.Unlock(ctx, db, name, instance)
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		j.Unlock(ctx, db, name, instance)
+		return nil, err
+	}
+	return &app.JobRunMedia{
+		ID:        int(id),
+		Job:       name,
+		Trigger:   trigger,
+		Status:    JobRunning,
+		Instance:  instance,
+		StartTime: startTime,
+	}, nil
+}
+
+// Records the end of a run and releases the lock.
+func (j *Job) FinishRun(ctx context.Context, run *app.JobRunMedia, output string, runErr error) (err error) {
+	defer logError(ctx, "FinishRun Job", &err)
+	return j.finishRun(ctx, j.db, run, output, runErr)
+}
+
+func (j *Job) finishRun(ctx context.Context, db *mysql.DB, run *app.JobRunMedia, output string, runErr error) error {
+	status := JobSucceeded
+	if runErr != nil {
+		status = JobFailed
+		output = runErr.Error()
+	}
+	stmt, err := db.PrepareContext(ctx, jobStmt.UpdateRun)
+	if err != nil {
+		return err
+	}
+	_, err = stmt.ExecContext(ctx, status, int(time.Now().Unix()), output, run.ID)
+	if err != nil {
+		return err
+	}
+	return j.Unlock(ctx, db, run.Job, run.Instance)
+}
+
+// The unit blocks that are running low, for the alert.
+func (j *Job) GetLowUnitBlocks(ctx context.Context, threshold float64) (_ []string, err error) {
+	defer logError(ctx, "GetLowUnitBlocks Job", &err)
+	return j.getLowUnitBlocks(ctx, j.db, threshold)
+}
+
+func (j *Job) getLowUnitBlocks(ctx context.Context, db *mysql.DB, threshold float64) ([]string, error) {
+	rows, err := db.QueryContext(ctx, "SELECT CONCAT(consumer.lastname,', ',consumer.firstname),service_code.name,unit_block.units FROM unit_block INNER JOIN consumer ON consumer.id = unit_block.consumer INNER JOIN service_code ON service_code.id = unit_block.serviceCode WHERE consumer.active = 1 AND unit_block.units < ? ORDER BY unit_block.units ASC", threshold)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	coll := []string{}
+	for rows.Next() {
+		var consumer string
+		var serviceCode string
+		var units float64
+		err = rows.Scan(&consumer, &serviceCode, &units)
+		if err != nil {
+			return nil, err
+		}
+		coll = append(coll, fmt.Sprintf("%s (%s): %s units left", consumer, serviceCode, floatToString(units)))
+	}
+	return coll, nil
+}
+
+// Bills every approved billsheet with a service date before the given date (YYYY-MM-DD).  Returns how
+// many were billed.
+func (j *Job) CloseBillingPeriod(ctx context.Context, before string) (_ int, err error) {
+	defer logError(ctx, "CloseBillingPeriod Job", &err)
+	return j.closeBillingPeriod(ctx, j.db, before)
+}
+
+func (j *Job) closeBillingPeriod(ctx context.Context, db *mysql.DB, before string) (int, error) {
+	ids, err := NewBillSheetBulk(nil).GetIDs(ctx, db, "billsheet.state=? AND billsheet.serviceDate < ?", StateApproved, before)
+	if err != nil {
+		return 0, err
+	}
+	w := NewWorkflow(&TransitionQuery{
+		State:   StateBilled,
+		Comment: fmt.Sprintf("Billing period closed before %s", before),
+	})
+	system := &Principal{ID: SystemSpecialist, AuthLevel: AuthLevelAdmin}
+	for n, id := range ids {
+		if _, err = w.transitionTx(ctx, db, id, system); err != nil {
+			return n, err
+		}
+	}
+	return len(ids), nil
+}
@@ -0,0 +1,245 @@
+package sql
+
+import (
+	"bytes"
+	"context"
+	mysql "database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	gomysql "github.com/go-sql-driver/mysql"
+	"github.com/goadesign/goa"
+)
+
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = map[Level]string{
+	LevelDebug: "debug",
+	LevelInfo:  "info",
+	LevelWarn:  "warn",
+	LevelError: "error",
+}
+
+// Parses the name of a level, e.g. from the CPSS_LOG_LEVEL environment variable.
+func ParseLevel(name string) (Level, error) {
+	for level, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) {
+			return level, nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("Bad log level: %s", name)
+}
+
+// The logs contain PHI, so the values of these keys are never written.  The keys are matched without
+// regard to case.  `data` is an imported file and `whereClause` and `q` are what was searched for.
+var redactedKeys = map[string]bool{
+	"authorization":   true,
+	"code":            true,
+	"currentpassword": true,
+	"data":            true,
+	"firstname":       true,
+	"lastname":        true,
+	"password":        true,
+	"pwd":             true,
+	"q":               true,
+	"recipientid":     true,
+	"token":           true,
+	"whereclause":     true,
+}
+
+const redacted = "[REDACTED]"
+
+var (
+	// The same keys inside a JSON document, e.g. a raw payload.
+	redactedJSON = regexp.MustCompile(`(?i)("(?:authorization|code|currentPassword|data|firstname|lastname|password|pwd|q|recipientID|token|whereClause)"\s*:\s*)("(?:[^"\\]|\\.)*"|[^,}\]]+)`)
+	// The same keys as the parameters of a URL.
+	redactedParams = regexp.MustCompile(`(?i)([?&](?:code|q|token|whereClause)=)[^&\s]*`)
+)
+
+func redact(key string, value interface{}) interface{} {
+	if redactedKeys[strings.ToLower(key)] {
+		return redacted
+	}
+	switch v := value.(type) {
+	case string:
+		return redactString(v)
+	case []string:
+		if len(v) > 0 {
+			coll := make([]string, len(v))
+			for i, s := range v {
+				coll[i] = redactString(s)
+			}
+			return coll
+		}
+	case []interface{}:
+		// The elements have no keys of their own, but the maps among them do.
+		coll := make([]interface{}, len(v))
+		for i, value := range v {
+			coll[i] = redact("", value)
+		}
+		return coll
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, value := range v {
+			m[k] = redact(k, value)
+		}
+		return m
+	case error:
+		return redactString(v.Error())
+	}
+	return value
+}
+
+func redactString(s string) string {
+	s = redactedJSON.ReplaceAllString(s, `$1"`+redacted+`"`)
+	return redactedParams.ReplaceAllString(s, "${1}"+redacted)
+}
+
+// A leveled logger that writes one JSON object per line.  It's also goa's LogAdapter, so that the logs of
+// goa's own middleware are written the same way.
+type Logger struct {
+	out    io.Writer
+	mutex  *sync.Mutex
+	level  Level
+	fields []interface{}
+}
+
+func NewLogger(out io.Writer, level Level) *Logger {
+	return &Logger{
+		out:   out,
+		mutex: &sync.Mutex{},
+		level: level,
+	}
+}
+
+// Used when there's no logger in the context, e.g. for the jobs.
+var DefaultLogger = NewLogger(os.Stderr, LevelInfo)
+
+// Returns a logger that adds the key/value pairs to everything it writes.
+func (l *Logger) With(keyvals ...interface{}) *Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(keyvals))
+	fields = append(append(fields, l.fields...), keyvals...)
+	return &Logger{
+		out:    l.out,
+		mutex:  l.mutex,
+		level:  l.level,
+		fields: fields,
+	}
+}
+
+func (l *Logger) log(level Level, msg string, keyvals ...interface{}) {
+	if level < l.level {
+		return
+	}
+	entry := map[string]interface{}{
+		"time":  time.Now().UTC().Format(time.RFC3339Nano),
+		"level": levelNames[level],
+		"msg":   msg,
+	}
+	all := append(append([]interface{}{}, l.fields...), keyvals...)
+	if len(all)%2 != 0 {
+		all = append(all, "MISSING")
+	}
+	for i := 0; i < len(all); i += 2 {
+		key := fmt.Sprint(all[i])
+		entry[key] = redact(key, all[i+1])
+	}
+	var line bytes.Buffer
+	enc := json.NewEncoder(&line)
+	// The URLs are easier to read without `&` escaped.
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(entry); err != nil {
+		// A value that can't be marshaled is written as text instead.
+		for key, value := range entry {
+			entry[key] = fmt.Sprint(value)
+		}
+		line.Reset()
+		enc.Encode(entry)
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.out.Write(line.Bytes())
+}
+
+func (l *Logger) Debug(msg string, keyvals ...interface{}) {
+	l.log(LevelDebug, msg, keyvals...)
+}
+
+func (l *Logger) Info(msg string, keyvals ...interface{}) {
+	l.log(LevelInfo, msg, keyvals...)
+}
+
+func (l *Logger) Warn(msg string, keyvals ...interface{}) {
+	l.log(LevelWarn, msg, keyvals...)
+}
+
+func (l *Logger) Error(msg string, keyvals ...interface{}) {
+	l.log(LevelError, msg, keyvals...)
+}
+
+func (l *Logger) New(keyvals ...interface{}) goa.LogAdapter {
+	return l.With(keyvals...)
+}
+
+type loggerKey struct{}
+
+func WithLogger(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// Returns the logger of the request, which knows the request's id.
+func Log(ctx context.Context) *Logger {
+	if ctx != nil {
+		if l, ok := ctx.Value(loggerKey{}).(*Logger); ok {
+			return l
+		}
+	}
+	return DefaultLogger
+}
+
+// Whether an error came from the database rather than from a check of what the client asked for.
+func isDBError(err error) bool {
+	if _, ok := err.(*gomysql.MySQLError); ok {
+		return true
+	}
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+	switch err {
+	case driver.ErrBadConn, gomysql.ErrInvalidConn, mysql.ErrConnDone, mysql.ErrTxDone:
+		return true
+	}
+	return false
+}
+
+// Logs the error that an entry point of the package is returning, if any.  It's deferred with a pointer
+// to the named error so that every return is covered.  An error of the database is logged as an error,
+// anything else is a rejection of what the client asked for (or the client going away) and is logged as
+// a warning.
+func logError(ctx context.Context, op string, err *error) {
+	if *err == nil {
+		return
+	}
+	if *err == context.Canceled || *err == context.DeadlineExceeded {
+		Log(ctx).Warn("cancelled", "op", op, "err", *err)
+	} else if isDBError(*err) {
+		Log(ctx).Error("sql error", "op", op, "err", *err)
+	} else {
+		Log(ctx).Warn("rejected", "op", op, "err", *err)
+	}
+}
@@ -0,0 +1,88 @@
+package sql
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name  string
+		key   string
+		value interface{}
+		want  interface{}
+	}{
+		{"password", "password", "hunter2", redacted},
+		{"key in another case", "CurrentPassword", "hunter2", redacted},
+		{"import data", "data", "firstname,lastname\nJane,Doe", redacted},
+		{"where clause", "whereClause", "lastname LIKE 'Doe%'", redacted},
+		{"search", "q", "Doe", redacted},
+		{"anything else", "units", 4, 4},
+		{
+			"url",
+			"GET",
+			"/cpss/search?q=Doe&page=1&whereClause=x",
+			"/cpss/search?q=" + redacted + "&page=1&whereClause=" + redacted,
+		},
+		{
+			"json",
+			"raw",
+			`{"firstname":"Jane","units":4,"whereClause":"lastname='Doe'"}`,
+			`{"firstname":"` + redacted + `","units":4,"whereClause":"` + redacted + `"}`,
+		},
+		{
+			"error",
+			"err",
+			errors.New(`bad row {"lastname":"Doe"}`),
+			`bad row {"lastname":"` + redacted + `"}`,
+		},
+		{
+			"map",
+			"payload",
+			map[string]interface{}{"lastname": "Doe", "units": 4},
+			map[string]interface{}{"lastname": redacted, "units": 4},
+		},
+		{
+			"list of maps",
+			"payload",
+			[]interface{}{map[string]interface{}{"firstname": "Jane", "id": 1}, "?token=abc"},
+			[]interface{}{map[string]interface{}{"firstname": redacted, "id": 1}, "?token=" + redacted},
+		},
+		{
+			"nested lists",
+			"rows",
+			map[string]interface{}{"rows": []interface{}{[]interface{}{map[string]interface{}{"data": "x"}}}},
+			map[string]interface{}{"rows": []interface{}{[]interface{}{map[string]interface{}{"data": redacted}}}},
+		},
+		{"strings", "values", []string{"a", "?code=123456"}, []string{"a", "?code=" + redacted}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redact(tt.key, tt.value); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("redact(%q, %v) = %v, want %v", tt.key, tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+// Nothing that's redacted makes it into a line of the log, however deep it is.
+func TestLoggerRedacts(t *testing.T) {
+	var out bytes.Buffer
+	NewLogger(&out, LevelDebug).With("token", "abc").Info("payload",
+		"data", "Jane,Doe",
+		"rows", []interface{}{map[string]interface{}{"lastname": "Doe"}},
+	)
+	var entry map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+		t.Fatalf("the line isn't JSON: %v: %s", err, out.String())
+	}
+	for _, secret := range []string{"abc", "Jane", "Doe"} {
+		if strings.Contains(out.String(), secret) {
+			t.Errorf("the log contains %q: %s", secret, out.String())
+		}
+	}
+}
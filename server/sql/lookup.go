@@ -0,0 +1,282 @@
+package sql
+
+import (
+	"context"
+	mysql "database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/btoll/cpss/server/app"
+)
+
+// A column of a lookup table besides its id and name.
+type LookupColumn struct {
+	Name string
+	// The zero value of the column's Go type, which is what it's scanned into.
+	Zero interface{}
+}
+
+// A row of a lookup table.  The values of the other columns are in the same order as the table's Columns.
+type LookupRow struct {
+	ID     int
+	Name   string
+	Values []interface{}
+}
+
+// Declares a lookup table, a table of unique names (and maybe a few other columns) that the other tables
+// refer to by id.  The repository of the resource only has to convert its payloads and media to and from
+// the rows.
+type LookupTable struct {
+	Table   string
+	Label   string
+	Columns []LookupColumn
+	// lookupSorts when it's not given.
+	Sorts       map[string]sortKey
+	DefaultSort string
+}
+
+// The keys that any of the lookup tables can be sorted by.
+var lookupSorts = map[string]sortKey{
+	"id":   {[]string{"id"}, ""},
+	"name": {[]string{"name"}, ""},
+}
+
+// The statements of a lookup table, made from its columns.
+type lookupStmts struct {
+	Count   string
+	Delete  string
+	Insert  string
+	IsTaken string
+	Select  string
+	Update  string
+}
+
+type Lookup struct {
+	db    *mysql.DB
+	stmt  lookupStmts
+	Table *LookupTable
+}
+
+func NewLookup(table *LookupTable, db *mysql.DB) *Lookup {
+	columns := []string{"id", "name"}
+	set := []string{"name=?"}
+	for _, column := range table.Columns {
+		columns = append(columns, column.Name)
+		set = append(set, fmt.Sprintf("%s=?", column.Name))
+	}
+	stmt := lookupStmts{
+		Count:   fmt.Sprintf("SELECT COUNT(*) FROM %s", table.Table),
+		Delete:  fmt.Sprintf("DELETE FROM %s WHERE id=?", table.Table),
+		Insert:  fmt.Sprintf("INSERT %s SET %s", table.Table, strings.Join(set, ",")),
+		IsTaken: fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE LOWER(name)=LOWER(?) AND id<>?", table.Table),
+		Select:  fmt.Sprintf("SELECT %s FROM %s %%s", strings.Join(columns, ","), table.Table),
+		Update:  fmt.Sprintf("UPDATE %s SET %s WHERE id=?", table.Table, strings.Join(set, ",")),
+	}
+	registerStmts(table.Label, stmt)
+	return &Lookup{
+		db:    db,
+		Table: table,
+		stmt:  stmt,
+	}
+}
+
+func (l *Lookup) CollectRows(rows *mysql.Rows) ([]*LookupRow, error) {
+	defer rows.Close()
+	coll := []*LookupRow{}
+	for rows.Next() {
+		row := &LookupRow{}
+		dest := []interface{}{&row.ID, &row.Name}
+		values := make([]reflect.Value, len(l.Table.Columns))
+		for i, column := range l.Table.Columns {
+			values[i] = reflect.New(reflect.TypeOf(column.Zero))
+			dest = append(dest, values[i].Interface())
+		}
+		err := rows.Scan(dest...)
+		if err != nil {
+			return nil, err
+		}
+		for _, value := range values {
+			row.Values = append(row.Values, value.Elem().Interface())
+		}
+		coll = append(coll, row)
+	}
+	return coll, rows.Err()
+}
+
+func (l *Lookup) GetSorts() map[string]sortKey {
+	if l.Table.Sorts != nil {
+		return l.Table.Sorts
+	}
+	return lookupSorts
+}
+
+// Returns the ORDER BY of the table's default sort.
+func (l *Lookup) GetOrderBy() (string, error) {
+	_, orderBy, _, err := (&PageQuery{}).GetSort(l.GetSorts(), l.Table.DefaultSort, "id")
+	return orderBy, err
+}
+
+// The names are unique, ignoring case and the surrounding spaces.
+func (l *Lookup) Validate(ctx context.Context, db *mysql.DB, row *LookupRow) error {
+	row.Name = strings.TrimSpace(row.Name)
+	if row.Name == "" {
+		return fmt.Errorf("Please give the %s a name!", l.Table.Label)
+	}
+	rows, err := db.QueryContext(ctx, l.stmt.IsTaken, row.Name, row.ID)
+	if err != nil {
+		return err
+	}
+	var count int
+	for rows.Next() {
+		err = rows.Scan(&count)
+		if err != nil {
+			return err
+		}
+	}
+	if count > 0 {
+		return fmt.Errorf("There is already a %s named %s!", l.Table.Label, row.Name)
+	}
+	return nil
+}
+
+// The values of the row's columns in the order of the INSERT and UPDATE statements.
+func (l *Lookup) GetArgs(row *LookupRow) []interface{} {
+	return append([]interface{}{row.Name}, row.Values...)
+}
+
+func (l *Lookup) Create(ctx context.Context, row *LookupRow) (_ *LookupRow, err error) {
+	defer logError(ctx, "Create "+l.Table.Label, &err)
+	row.ID = 0
+	if err := l.Validate(ctx, l.db, row); err != nil {
+		return nil, err
+	}
+	stmt, err := l.db.PrepareContext(ctx, l.stmt.Insert)
+	if err != nil {
+		return nil, err
+	}
+	res, err := stmt.ExecContext(ctx, l.GetArgs(row)...)
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	row.ID = int(id)
+	return row, nil
+}
+
+func (l *Lookup) Read(ctx context.Context, id int) (_ *LookupRow, err error) {
+	defer logError(ctx, "Read "+l.Table.Label, &err)
+	return l.read(ctx, id)
+}
+
+func (l *Lookup) Update(ctx context.Context, row *LookupRow) (_ *LookupRow, err error) {
+	defer logError(ctx, "Update "+l.Table.Label, &err)
+	return l.update(ctx, row)
+}
+
+// The patch is merged into the current row and then validated the same as a full update.
+func (l *Lookup) Patch(ctx context.Context, id int, merge func(row *LookupRow)) (_ *LookupRow, err error) {
+	defer logError(ctx, "Patch "+l.Table.Label, &err)
+	row, err := l.read(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	merge(row)
+	return l.update(ctx, row)
+}
+
+func (l *Lookup) Delete(ctx context.Context, id int) (err error) {
+	defer logError(ctx, "Delete "+l.Table.Label, &err)
+	stmt, err := l.db.PrepareContext(ctx, l.stmt.Delete)
+	if err != nil {
+		return err
+	}
+	_, err = stmt.ExecContext(ctx, id)
+	return err
+}
+
+func (l *Lookup) List(ctx context.Context) (_ []*LookupRow, err error) {
+	defer logError(ctx, "List "+l.Table.Label, &err)
+	orderBy, err := l.GetOrderBy()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := l.db.QueryContext(ctx, fmt.Sprintf(l.stmt.Select, fmt.Sprintf("ORDER BY %s", orderBy)))
+	if err != nil {
+		return nil, err
+	}
+	return l.CollectRows(rows)
+}
+
+func (l *Lookup) Page(ctx context.Context, query *PageQuery) (_ *app.Pager, _ []*LookupRow, err error) {
+	defer logError(ctx, "Page "+l.Table.Label, &err)
+	perPage, err := query.GetPerPage()
+	if err != nil {
+		return nil, nil, err
+	}
+	offset := query.Page * perPage
+	_, orderBy, sort, err := query.GetSort(l.GetSorts(), l.Table.DefaultSort, "id")
+	if err != nil {
+		return nil, nil, err
+	}
+	rows, err := l.db.QueryContext(ctx, l.stmt.Count)
+	if err != nil {
+		return nil, nil, err
+	}
+	var totalCount int
+	for rows.Next() {
+		err = rows.Scan(&totalCount)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	rows, err = l.db.QueryContext(ctx, fmt.Sprintf(l.stmt.Select, fmt.Sprintf("ORDER BY %s LIMIT %d,%d", orderBy, offset, perPage)))
+	if err != nil {
+		return nil, nil, err
+	}
+	coll, err := l.CollectRows(rows)
+	if err != nil {
+		return nil, nil, err
+	}
+	return newPager(query, perPage, totalCount, sort), coll, nil
+}
+
+func (l *Lookup) read(ctx context.Context, id int) (*LookupRow, error) {
+	rows, err := l.db.QueryContext(ctx, fmt.Sprintf(l.stmt.Select, "WHERE id=?"), id)
+	if err != nil {
+		return nil, err
+	}
+	coll, err := l.CollectRows(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(coll) == 0 {
+		return nil, fmt.Errorf("There is no %s with that id!", l.Table.Label)
+	}
+	return coll[0], nil
+}
+
+func (l *Lookup) update(ctx context.Context, row *LookupRow) (*LookupRow, error) {
+	if err := l.Validate(ctx, l.db, row); err != nil {
+		return nil, err
+	}
+	stmt, err := l.db.PrepareContext(ctx, l.stmt.Update)
+	if err != nil {
+		return nil, err
+	}
+	_, err = stmt.ExecContext(ctx, append(l.GetArgs(row), row.ID)...)
+	if err != nil {
+		return nil, err
+	}
+	return row, nil
+}
+
+func intOrZero(i *int) int {
+	if i == nil {
+		return 0
+	}
+	return *i
+}
@@ -0,0 +1,446 @@
+package sql
+
+import (
+	"context"
+	mysql "database/sql"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	gomysql "github.com/go-sql-driver/mysql"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Every connection goes through this driver, which times each statement and counts its errors by the type
+// and the field of the type's statements that the statement was made from.
+const driverName = "cpss-mysql"
+
+var (
+	queryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "cpss",
+		Subsystem: "sql",
+		Name:      "query_duration_seconds",
+		Help:      "How long a statement took, by the type and the key of its Stmt.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"type", "stmt"})
+	queryErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "cpss",
+		Subsystem: "sql",
+		Name:      "query_errors_total",
+		Help:      "How many statements failed, by the type and the key of its Stmt.",
+	}, []string{"type", "stmt"})
+
+	billSheetsCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "cpss",
+		Name:      "billsheets_created_total",
+		Help:      "How many billsheets have been created.",
+	})
+	unitsDrawn = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "cpss",
+		Name:      "units_drawn_total",
+		Help:      "How many units have been drawn from the consumers' unit blocks.",
+	})
+	failedLogins = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "cpss",
+		Name:      "failed_logins_total",
+		Help:      "How many logins have failed, including the second factor.",
+	})
+	sessionsExpired = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "cpss",
+		Name:      "sessions_expired_total",
+		Help:      "How many sessions have been ended for going on too long.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(queryDuration, queryErrors, billSheetsCreated, unitsDrawn, failedLogins, sessionsExpired)
+	mysql.Register(driverName, &instrumentedDriver{&gomysql.MySQLDriver{}})
+}
+
+// A statement of a type's Stmt map, as a pattern that matches any query that was made from it.
+type stmtPattern struct {
+	Type string
+	Key  string
+	// How much of the statement isn't a verb, the more the better the match.
+	Literal int
+	re      *regexp.Regexp
+}
+
+// A statement that isn't from any Stmt map.
+var otherStmt = &stmtPattern{Type: "other", Key: "other"}
+
+// The registered statements.  They're never changed once they're stored, a registration stores new ones
+// instead, so that a statement can be labeled without taking a lock.
+type stmtRegistry struct {
+	types map[string]bool
+	// The statements that are run as they are, by their query.
+	exact map[string]*stmtPattern
+	// The statements that are formatted first, the most specific first.
+	formatted []*stmtPattern
+}
+
+var (
+	stmtsMutex sync.Mutex
+	stmts      atomic.Value
+)
+
+// The statements are registered as the package's variables are set, before any init runs.
+func loadStmts() *stmtRegistry {
+	if r, ok := stmts.Load().(*stmtRegistry); ok {
+		return r
+	}
+	return &stmtRegistry{}
+}
+
+// Turns a statement into a regexp.  A `%s` can be anything and a `%d` is a number.  Any other verb is
+// taken literally, since some of the statements have a `DATE_FORMAT` that's never passed to `Sprintf`.
+func stmtRegexp(stmt string) (*regexp.Regexp, int) {
+	var b strings.Builder
+	literal := 0
+	b.WriteString(`^`)
+	for i := 0; i < len(stmt); i++ {
+		if stmt[i] == '%' && i+1 < len(stmt) {
+			switch stmt[i+1] {
+			case 's':
+				b.WriteString(`(?s:.*)`)
+				i++
+				continue
+			case 'd':
+				b.WriteString(`(?:-?\d+|%d)`)
+				i++
+				continue
+			case '%':
+				i++
+			}
+		}
+		b.WriteString(regexp.QuoteMeta(stmt[i : i+1]))
+		literal++
+	}
+	b.WriteString(`$`)
+	return regexp.MustCompile(b.String()), literal
+}
+
+// Whether a statement is formatted before it's run, rather than run as it is.
+func isFormatted(stmt string) bool {
+	return strings.Contains(strings.Replace(stmt, "%%", "", -1), "%s") || strings.Contains(stmt, "%d")
+}
+
+// Registers the statements of a type (only the first time for the same type).  The statements are the
+// string fields of a struct, and the name of a field is the key that its statement is labeled with.
+func registerStmts(kind string, fields interface{}) {
+	stmtsMutex.Lock()
+	defer stmtsMutex.Unlock()
+	old := loadStmts()
+	if old.types[kind] {
+		return
+	}
+	v := reflect.ValueOf(fields)
+	r := &stmtRegistry{
+		types:     make(map[string]bool, len(old.types)+1),
+		exact:     make(map[string]*stmtPattern, len(old.exact)+v.NumField()),
+		formatted: append([]*stmtPattern{}, old.formatted...),
+	}
+	for k := range old.types {
+		r.types[k] = true
+	}
+	r.types[kind] = true
+	for k, p := range old.exact {
+		r.exact[k] = p
+	}
+	for i := 0; i < v.NumField(); i++ {
+		key := v.Type().Field(i).Name
+		stmt := v.Field(i).String()
+		if !isFormatted(stmt) {
+			if _, ok := r.exact[stmt]; !ok {
+				r.exact[stmt] = &stmtPattern{Type: kind, Key: key, Literal: len(stmt)}
+			}
+			continue
+		}
+		re, literal := stmtRegexp(stmt)
+		r.formatted = append(r.formatted, &stmtPattern{kind, key, literal, re})
+	}
+	// The most specific statement wins when more than one matches.
+	sort.SliceStable(r.formatted, func(i, j int) bool {
+		return r.formatted[i].Literal > r.formatted[j].Literal
+	})
+	stmts.Store(r)
+}
+
+// Returns the statement that a query was made from.  A prepared statement is labeled once, when it's
+// prepared, however many times it's run.
+func matchStmt(query string) *stmtPattern {
+	r := loadStmts()
+	if p, ok := r.exact[query]; ok {
+		return p
+	}
+	for _, p := range r.formatted {
+		if p.re.MatchString(query) {
+			return p
+		}
+	}
+	return otherStmt
+}
+
+func (p *stmtPattern) observe(start time.Time, err error) {
+	queryDuration.WithLabelValues(p.Type, p.Key).Observe(time.Since(start).Seconds())
+	if err != nil && err != driver.ErrSkip {
+		queryErrors.WithLabelValues(p.Type, p.Key).Inc()
+	}
+}
+
+// Wraps the MySQL driver.  Only the statements are timed, the connection is otherwise the driver's own.
+// A query is timed until its first row is ready, not until all of its rows have been read.
+type instrumentedDriver struct {
+	driver driver.Driver
+}
+
+func (d *instrumentedDriver) Open(dsn string) (driver.Conn, error) {
+	conn, err := d.driver.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedConn{conn}, nil
+}
+
+type instrumentedConn struct {
+	conn driver.Conn
+}
+
+func (c *instrumentedConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+// The context is passed on when the driver takes one, so that a statement can be cancelled.
+func (c *instrumentedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	p := matchStmt(query)
+	start := time.Now()
+	var stmt driver.Stmt
+	var err error
+	if cp, ok := c.conn.(driver.ConnPrepareContext); ok {
+		stmt, err = cp.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.conn.Prepare(query)
+	}
+	if err != nil {
+		p.observe(start, err)
+		return nil, err
+	}
+	return &instrumentedStmt{stmt, p}, nil
+}
+
+// A statement without arguments can be run without preparing it first, when the driver can.  Otherwise
+// driver.ErrSkip has it prepared, and it's timed as a prepared statement instead.
+func (c *instrumentedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	var res driver.Result
+	var err error
+	if ec, ok := c.conn.(driver.ExecerContext); ok {
+		res, err = ec.ExecContext(ctx, query, args)
+	} else if e, ok := c.conn.(driver.Execer); ok {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		res, err = e.Exec(query, namedValues(args))
+	} else {
+		return nil, driver.ErrSkip
+	}
+	if err != driver.ErrSkip {
+		matchStmt(query).observe(start, err)
+	}
+	return res, err
+}
+
+func (c *instrumentedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	var rows driver.Rows
+	var err error
+	if qc, ok := c.conn.(driver.QueryerContext); ok {
+		rows, err = qc.QueryContext(ctx, query, args)
+	} else if q, ok := c.conn.(driver.Queryer); ok {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		rows, err = q.Query(query, namedValues(args))
+	} else {
+		return nil, driver.ErrSkip
+	}
+	if err != driver.ErrSkip {
+		matchStmt(query).observe(start, err)
+	}
+	return rows, err
+}
+
+func (c *instrumentedConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *instrumentedConn) Begin() (driver.Tx, error) {
+	return c.conn.Begin()
+}
+
+func (c *instrumentedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if cb, ok := c.conn.(driver.ConnBeginTx); ok {
+		return cb.BeginTx(ctx, opts)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.conn.Begin()
+}
+
+func (c *instrumentedConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+type instrumentedStmt struct {
+	stmt    driver.Stmt
+	pattern *stmtPattern
+}
+
+func (s *instrumentedStmt) Close() error {
+	return s.stmt.Close()
+}
+
+func (s *instrumentedStmt) NumInput() int {
+	return s.stmt.NumInput()
+}
+
+func (s *instrumentedStmt) Exec(args []driver.Value) (driver.Result, error) {
+	start := time.Now()
+	res, err := s.stmt.Exec(args)
+	s.pattern.observe(start, err)
+	return res, err
+}
+
+func (s *instrumentedStmt) Query(args []driver.Value) (driver.Rows, error) {
+	start := time.Now()
+	rows, err := s.stmt.Query(args)
+	s.pattern.observe(start, err)
+	return rows, err
+}
+
+func (s *instrumentedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	se, ok := s.stmt.(driver.StmtExecContext)
+	if !ok {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return s.Exec(namedValues(args))
+	}
+	start := time.Now()
+	res, err := se.ExecContext(ctx, args)
+	s.pattern.observe(start, err)
+	return res, err
+}
+
+func (s *instrumentedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	sq, ok := s.stmt.(driver.StmtQueryContext)
+	if !ok {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return s.Query(namedValues(args))
+	}
+	start := time.Now()
+	rows, err := sq.QueryContext(ctx, args)
+	s.pattern.observe(start, err)
+	return rows, err
+}
+
+// For a driver that doesn't take a context.  The statements only use `?`, so the names are never set.
+func namedValues(named []driver.NamedValue) []driver.Value {
+	args := make([]driver.Value, len(named))
+	for i, arg := range named {
+		args[i] = arg.Value
+	}
+	return args
+}
+
+// The driver converts some of the arguments itself.
+func (s *instrumentedStmt) ColumnConverter(idx int) driver.ValueConverter {
+	if cc, ok := s.stmt.(driver.ColumnConverter); ok {
+		return cc.ColumnConverter(idx)
+	}
+	return driver.DefaultParameterConverter
+}
+
+// The stats of the pool that the repositories share.  The waits only ever go up, so they're counters.
+type dbStatsCollector struct {
+	db *mysql.DB
+
+	maxOpen      *prometheus.Desc
+	open         *prometheus.Desc
+	inUse        *prometheus.Desc
+	idle         *prometheus.Desc
+	waitCount    *prometheus.Desc
+	waitDuration *prometheus.Desc
+}
+
+func newDBStatsCollector(db *mysql.DB) *dbStatsCollector {
+	return &dbStatsCollector{
+		db:           db,
+		maxOpen:      prometheus.NewDesc("cpss_db_connections_max_open", "How many connections the pool can open, 0 for no limit.", nil, nil),
+		open:         prometheus.NewDesc("cpss_db_connections_open", "How many connections are open, in use or idle.", nil, nil),
+		inUse:        prometheus.NewDesc("cpss_db_connections_in_use", "How many connections are in use.", nil, nil),
+		idle:         prometheus.NewDesc("cpss_db_connections_idle", "How many connections are idle.", nil, nil),
+		waitCount:    prometheus.NewDesc("cpss_db_connections_waits_total", "How many times the pool has waited for a connection.", nil, nil),
+		waitDuration: prometheus.NewDesc("cpss_db_connections_wait_seconds_total", "How long the pool has waited for a connection.", nil, nil),
+	}
+}
+
+func (c *dbStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.maxOpen
+	ch <- c.open
+	ch <- c.inUse
+	ch <- c.idle
+	ch <- c.waitCount
+	ch <- c.waitDuration
+}
+
+func (c *dbStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.db.Stats()
+	ch <- prometheus.MustNewConstMetric(c.maxOpen, prometheus.GaugeValue, float64(stats.MaxOpenConnections))
+	ch <- prometheus.MustNewConstMetric(c.open, prometheus.GaugeValue, float64(stats.OpenConnections))
+	ch <- prometheus.MustNewConstMetric(c.inUse, prometheus.GaugeValue, float64(stats.InUse))
+	ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(stats.Idle))
+	ch <- prometheus.MustNewConstMetric(c.waitCount, prometheus.CounterValue, float64(stats.WaitCount))
+	ch <- prometheus.MustNewConstMetric(c.waitDuration, prometheus.CounterValue, stats.WaitDuration.Seconds())
+}
+
+// The stats of the shared pool, while it's open.
+var poolStats struct {
+	sync.Mutex
+	collector *dbStatsCollector
+}
+
+func reportPoolStats(db *mysql.DB) error {
+	poolStats.Lock()
+	defer poolStats.Unlock()
+	if poolStats.collector != nil {
+		return errors.New("The stats of another pool are already reported")
+	}
+	collector := newDBStatsCollector(db)
+	if err := prometheus.Register(collector); err != nil {
+		return err
+	}
+	poolStats.collector = collector
+	return nil
+}
+
+func stopPoolStats(db *mysql.DB) {
+	poolStats.Lock()
+	defer poolStats.Unlock()
+	if poolStats.collector != nil && poolStats.collector.db == db {
+		prometheus.Unregister(poolStats.collector)
+		poolStats.collector = nil
+	}
+}
@@ -0,0 +1,46 @@
+package sql
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestMatchStmt(t *testing.T) {
+	m := struct {
+		Delete  string
+		Select  string
+		Select1 string
+		Date    string
+	}{
+		Delete:  "DELETE FROM metrics_test WHERE id=?",
+		Select:  "SELECT %s FROM metrics_test %s",
+		Select1: "SELECT name FROM metrics_test WHERE id=%d",
+		Date:    "SELECT DATE_FORMAT(day, '%m/%d/%y') FROM metrics_test",
+	}
+	registerStmts("MetricsTest", m)
+	tests := []struct {
+		name  string
+		query string
+		key   string
+	}{
+		{"as it is", m.Delete, "Delete"},
+		{"formatted", fmt.Sprintf(m.Select, "COUNT(*)", "WHERE name=?"), "Select"},
+		{"the most specific", fmt.Sprintf(m.Select1, 7), "Select1"},
+		{"a verb that isn't formatted", m.Date, "Date"},
+		{"another type's", "DELETE FROM something_else WHERE id=?", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := matchStmt(tt.query)
+			if tt.key == "" {
+				if p.Type == "MetricsTest" {
+					t.Errorf("matchStmt(%q) = %s, want it not to match", tt.query, p.Key)
+				}
+				return
+			}
+			if p.Type != "MetricsTest" || p.Key != tt.key {
+				t.Errorf("matchStmt(%q) = %s.%s, want MetricsTest.%s", tt.query, p.Type, p.Key, tt.key)
+			}
+		})
+	}
+}
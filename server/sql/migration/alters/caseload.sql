@@ -0,0 +1,19 @@
+-- The caseload assignments that a specialist needs before they can bill for a consumer.
+
+USE cpss;
+
+CREATE TABLE IF NOT EXISTS `caseload` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `specialist` int(11) NOT NULL,
+  `consumer` int(11) NOT NULL,
+  `startDate` date NOT NULL,
+  `endDate` date DEFAULT NULL,
+  `isPrimary` tinyint DEFAULT 0,
+  PRIMARY KEY (`id`),
+  KEY `ID` (`id`),
+  KEY `specialistConsumer` (`specialist`, `consumer`),
+  CONSTRAINT `fkcaseloadspecialist` FOREIGN KEY (`specialist`) REFERENCES `specialist` (`id`),
+  CONSTRAINT `fkcaseloadconsumer` FOREIGN KEY (`consumer`) REFERENCES `consumer` (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=latin1 ;
+
+INSERT INTO `schema_version` (version, description) VALUES (2, 'caseloads');
@@ -0,0 +1,28 @@
+-- The scheduled jobs, their locks and their runs.
+
+USE cpss;
+
+-- A job is locked by the server instance that's running it, so that only one instance runs it at a time.
+-- The lock expires on its own in case the instance dies while holding it.
+CREATE TABLE IF NOT EXISTS `job` (
+  `name` varchar(50) NOT NULL,
+  `lockedBy` varchar(255) DEFAULT NULL,
+  `lockedUntil` int(25) DEFAULT 0,
+  PRIMARY KEY (`name`)
+) ENGINE=InnoDB DEFAULT CHARSET=latin1 ;
+
+CREATE TABLE IF NOT EXISTS `job_run` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `job` varchar(50) NOT NULL,
+  `trigger` enum('schedule','manual') NOT NULL,
+  `status` enum('running','succeeded','failed') NOT NULL DEFAULT 'running',
+  `instance` varchar(255) NOT NULL,
+  `startTime` int(25) NOT NULL,
+  `endTime` int(25) DEFAULT 0,
+  `output` text DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `ID` (`id`),
+  KEY `job` (`job`)
+) ENGINE=InnoDB DEFAULT CHARSET=latin1 ;
+
+INSERT INTO `schema_version` (version, description) VALUES (7, 'jobs');
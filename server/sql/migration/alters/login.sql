@@ -0,0 +1,99 @@
+-- The lockout, password resets, second factor, password history, sessions and supervisors' teams.
+
+USE cpss;
+
+-- The failed logins since the last good one.  A specialist with too many is locked out until `lockedUntil`.
+CREATE TABLE IF NOT EXISTS `login_attempt` (
+  `specialist` int(11) NOT NULL,
+  `failures` int DEFAULT 0,
+  `lastFailure` int(25) DEFAULT 0,
+  `lockedUntil` int(25) DEFAULT 0,
+  PRIMARY KEY (`specialist`),
+  CONSTRAINT `fkloginattemptspecialist` FOREIGN KEY (`specialist`) REFERENCES `specialist` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=latin1 ;
+
+-- Only a hash of the token is kept, the token itself is only ever in the email.
+CREATE TABLE IF NOT EXISTS `password_reset` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `specialist` int(11) NOT NULL,
+  `tokenHash` char(64) NOT NULL,
+  `createdTime` int(25) NOT NULL,
+  `expires` int(25) NOT NULL,
+  `usedTime` int(25) DEFAULT 0,
+  PRIMARY KEY (`id`),
+  KEY `ID` (`id`),
+  UNIQUE KEY `tokenHash` (`tokenHash`),
+  CONSTRAINT `fkpasswordresetspecialist` FOREIGN KEY (`specialist`) REFERENCES `specialist` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=latin1 ;
+
+-- A TOTP secret isn't used until the specialist has confirmed it with a code.  `lastStep` is the time step
+-- of the last code that was used, so that a code can't be used twice.
+CREATE TABLE IF NOT EXISTS `two_factor` (
+  `specialist` int(11) NOT NULL,
+  `secret` varchar(64) NOT NULL,
+  `enabled` tinyint DEFAULT 0,
+  `enrolledTime` int(25) DEFAULT 0,
+  `lastStep` int(25) DEFAULT 0,
+  PRIMARY KEY (`specialist`),
+  CONSTRAINT `fktwofactorspecialist` FOREIGN KEY (`specialist`) REFERENCES `specialist` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=latin1 ;
+
+CREATE TABLE IF NOT EXISTS `recovery_code` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `specialist` int(11) NOT NULL,
+  `codeHash` char(64) NOT NULL,
+  `usedTime` int(25) DEFAULT 0,
+  PRIMARY KEY (`id`),
+  KEY `ID` (`id`),
+  KEY `specialist` (`specialist`),
+  CONSTRAINT `fkrecoverycodespecialist` FOREIGN KEY (`specialist`) REFERENCES `specialist` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=latin1 ;
+
+-- Proves that the password was right while waiting for the second factor.
+CREATE TABLE IF NOT EXISTS `login_challenge` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `specialist` int(11) NOT NULL,
+  `tokenHash` char(64) NOT NULL,
+  `expires` int(25) NOT NULL,
+  `usedTime` int(25) DEFAULT 0,
+  PRIMARY KEY (`id`),
+  KEY `ID` (`id`),
+  UNIQUE KEY `tokenHash` (`tokenHash`),
+  CONSTRAINT `fkloginchallengespecialist` FOREIGN KEY (`specialist`) REFERENCES `specialist` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=latin1 ;
+
+-- The hashes of the last few passwords of each specialist, so that they can't be used again.
+CREATE TABLE IF NOT EXISTS `password_history` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `specialist` int(11) NOT NULL,
+  `password` varchar(255) NOT NULL,
+  `changedTime` int(25) NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `ID` (`id`),
+  KEY `specialist` (`specialist`),
+  CONSTRAINT `fkpasswordhistoryspecialist` FOREIGN KEY (`specialist`) REFERENCES `specialist` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=latin1 ;
+
+-- A session lasts as long as it's used at least once every SessionLength seconds.
+CREATE TABLE IF NOT EXISTS `login_session` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `specialist` int(11) NOT NULL,
+  `tokenHash` char(64) NOT NULL,
+  `createdTime` int(25) NOT NULL,
+  `lastSeen` int(25) NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `ID` (`id`),
+  UNIQUE KEY `tokenHash` (`tokenHash`),
+  CONSTRAINT `fkloginsessionspecialist` FOREIGN KEY (`specialist`) REFERENCES `specialist` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=latin1 ;
+
+-- The specialists that a supervisor looks after.
+CREATE TABLE IF NOT EXISTS `team_member` (
+  `supervisor` int(11) NOT NULL,
+  `specialist` int(11) NOT NULL,
+  PRIMARY KEY (`supervisor`, `specialist`),
+  CONSTRAINT `fkteamsupervisor` FOREIGN KEY (`supervisor`) REFERENCES `specialist` (`id`) ON DELETE CASCADE,
+  CONSTRAINT `fkteamspecialist` FOREIGN KEY (`specialist`) REFERENCES `specialist` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=latin1 ;
+
+INSERT INTO `schema_version` (version, description) VALUES (9, 'logins and sessions');
@@ -0,0 +1,29 @@
+-- The progress note template of each service code and the notes of each billsheet.
+
+USE cpss;
+
+-- Each service code defines its own progress note template, which is the set of fields below.
+-- The old `appTimeEntry` columns (`Intake`, `PlanI`, `IdSkill`, etc.) are good candidates for field names.
+CREATE TABLE IF NOT EXISTS `note_field` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `serviceCode` int(11) NOT NULL,
+  `name` varchar(50) NOT NULL,
+  `label` varchar(100) NOT NULL,
+  `required` tinyint DEFAULT 0,
+  PRIMARY KEY (`id`),
+  KEY `ID` (`id`),
+  UNIQUE KEY `serviceCodeName` (`serviceCode`, `name`)
+) ENGINE=InnoDB DEFAULT CHARSET=latin1 ;
+
+CREATE TABLE IF NOT EXISTS `billsheet_note` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `billsheet` int(11) NOT NULL,
+  `field` varchar(50) NOT NULL,
+  `value` text DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `ID` (`id`),
+  KEY `billsheet` (`billsheet`),
+  CONSTRAINT `fkbillsheetnote` FOREIGN KEY (`billsheet`) REFERENCES `billsheet` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=latin1 ;
+
+INSERT INTO `schema_version` (version, description) VALUES (3, 'billsheet notes');
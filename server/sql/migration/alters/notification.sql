@@ -0,0 +1,31 @@
+-- The queued emails and the notifications that each specialist has opted out of.
+
+USE cpss;
+
+CREATE TABLE IF NOT EXISTS `email_queue` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `specialist` int(11) NOT NULL,
+  `address` varchar(100) NOT NULL,
+  `kind` varchar(50) NOT NULL,
+  `subject` varchar(255) NOT NULL,
+  `body` text NOT NULL,
+  `status` enum('pending','sent','failed') NOT NULL DEFAULT 'pending',
+  `attempts` int DEFAULT 0,
+  `nextAttempt` int(25) DEFAULT 0,
+  `lastError` text DEFAULT NULL,
+  `createdTime` int(25) NOT NULL,
+  `sentTime` int(25) DEFAULT 0,
+  PRIMARY KEY (`id`),
+  KEY `ID` (`id`),
+  KEY `status` (`status`, `nextAttempt`)
+) ENGINE=InnoDB DEFAULT CHARSET=latin1 ;
+
+-- A specialist gets every kind of notification unless they've opted out of it.
+CREATE TABLE IF NOT EXISTS `notification_opt_out` (
+  `specialist` int(11) NOT NULL,
+  `kind` varchar(50) NOT NULL,
+  PRIMARY KEY (`specialist`, `kind`),
+  CONSTRAINT `fkoptoutspecialist` FOREIGN KEY (`specialist`) REFERENCES `specialist` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=latin1 ;
+
+INSERT INTO `schema_version` (version, description) VALUES (8, 'email notifications');
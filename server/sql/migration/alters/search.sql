@@ -0,0 +1,19 @@
+-- The indexes of the search action.  A FULLTEXT index can't be made over a BLOB, so the billsheet
+-- description becomes TEXT first.
+
+USE cpss;
+
+ALTER TABLE `billsheet` MODIFY `description` text DEFAULT NULL;
+
+ALTER TABLE `consumer` ADD FULLTEXT KEY `search` (`firstname`,`lastname`,`recipientID`,`bsu`);
+ALTER TABLE `specialist` ADD FULLTEXT KEY `search` (`firstname`,`lastname`,`email`);
+ALTER TABLE `billsheet` ADD FULLTEXT KEY `search` (`description`,`confirmation`);
+
+CREATE TABLE IF NOT EXISTS `schema_version` (
+  `version` int NOT NULL,
+  `description` varchar(255) NOT NULL,
+  `appliedAt` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`version`)
+) ENGINE=InnoDB DEFAULT CHARSET=latin1 ;
+
+INSERT INTO `schema_version` (version, description) VALUES (1, 'search indexes');
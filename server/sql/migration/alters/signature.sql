@@ -0,0 +1,22 @@
+-- The signatures of the billsheets.
+
+USE cpss;
+
+CREATE TABLE IF NOT EXISTS `billsheet_signature` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `billsheet` int(11) NOT NULL,
+  `role` enum('specialist','consumer') NOT NULL,
+  `signer` int(11) DEFAULT NULL,
+  `signerName` varchar(100) NOT NULL,
+  `method` enum('image','typed') NOT NULL,
+  `data` mediumtext NOT NULL,
+  `signedAt` int(25) NOT NULL,
+  `contentHash` char(64) NOT NULL,
+  `valid` tinyint DEFAULT 1,
+  PRIMARY KEY (`id`),
+  KEY `ID` (`id`),
+  KEY `billsheet` (`billsheet`),
+  CONSTRAINT `fkbillsheetsignature` FOREIGN KEY (`billsheet`) REFERENCES `billsheet` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=latin1 ;
+
+INSERT INTO `schema_version` (version, description) VALUES (4, 'billsheet signatures');
@@ -0,0 +1,8 @@
+-- The versions of the billsheets and consumers, so that a stale update is turned away.
+
+USE cpss;
+
+ALTER TABLE `billsheet` ADD `version` int NOT NULL DEFAULT 1 AFTER `state`;
+ALTER TABLE `consumer` ADD `version` int NOT NULL DEFAULT 1 AFTER `other`;
+
+INSERT INTO `schema_version` (version, description) VALUES (6, 'record versions');
@@ -0,0 +1,24 @@
+-- The approval workflow of the billsheets.  The billsheets that are already there start out as drafts,
+-- the same as a new one.
+
+USE cpss;
+
+ALTER TABLE `billsheet` ADD `state` enum('draft','submitted','approved','rejected','billed','paid','denied','void') NOT NULL DEFAULT 'draft' AFTER `description`;
+
+INSERT INTO `auth_level` VALUES (3,'Supervisor');
+
+CREATE TABLE IF NOT EXISTS `billsheet_transition` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `billsheet` int(11) NOT NULL,
+  `fromState` varchar(20) NOT NULL,
+  `toState` varchar(20) NOT NULL,
+  `specialist` int(11) NOT NULL,
+  `comment` text DEFAULT NULL,
+  `transitionTime` int(25) NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `ID` (`id`),
+  KEY `billsheet` (`billsheet`),
+  CONSTRAINT `fkbillsheettransition` FOREIGN KEY (`billsheet`) REFERENCES `billsheet` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=latin1 ;
+
+INSERT INTO `schema_version` (version, description) VALUES (5, 'billsheet workflow');
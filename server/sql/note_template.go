@@ -0,0 +1,133 @@
+package sql
+
+import (
+	"context"
+	mysql "database/sql"
+	"fmt"
+
+	"github.com/btoll/cpss/server/app"
+)
+
+type NoteTemplate struct {
+	db *mysql.DB
+}
+
+func NewNoteTemplate(db *mysql.DB) *NoteTemplate {
+	return &NoteTemplate{db: db}
+}
+
+var noteTemplateStmt = struct {
+	Delete      string
+	DeleteField string
+	InsertField string
+	Select      string
+	UpdateField string
+}{
+	Delete:      "DELETE FROM note_field WHERE serviceCode=?",
+	DeleteField: "DELETE FROM note_field WHERE id=?",
+	InsertField: "INSERT note_field SET serviceCode=?,name=?,label=?,required=?",
+	Select:      "SELECT %s FROM note_field WHERE serviceCode=%d ORDER BY id",
+	UpdateField: "UPDATE note_field SET name=?,label=?,required=? WHERE id=? AND serviceCode=?",
+}
+
+func init() {
+	registerStmts("NoteTemplate", noteTemplateStmt)
+}
+
+func (s *NoteTemplate) Delete(ctx context.Context, serviceCode int) (err error) {
+	defer logError(ctx, "Delete NoteTemplate", &err)
+	return s.delete(ctx, s.db, serviceCode)
+}
+
+func (s *NoteTemplate) Read(ctx context.Context, serviceCode int) (_ app.NoteFieldMediaCollection, err error) {
+	defer logError(ctx, "Read NoteTemplate", &err)
+	return s.read(ctx, s.db, serviceCode)
+}
+
+func (s *NoteTemplate) Update(ctx context.Context, payload *app.NoteTemplatePayload) (_ app.NoteFieldMediaCollection, err error) {
+	defer logError(ctx, "Update NoteTemplate", &err)
+	return s.update(ctx, s.db, payload)
+}
+
+func (s *NoteTemplate) GetFields(ctx context.Context, db *mysql.DB, serviceCode int) (app.NoteFieldMediaCollection, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(noteTemplateStmt.Select, "COUNT(*)", serviceCode))
+	if err != nil {
+		return nil, err
+	}
+	var count int
+	for rows.Next() {
+		err = rows.Scan(&count)
+		if err != nil {
+			return nil, err
+		}
+	}
+	rows, err = db.QueryContext(ctx, fmt.Sprintf(noteTemplateStmt.Select, "id,serviceCode,name,label,required", serviceCode))
+	if err != nil {
+		return nil, err
+	}
+	coll := make(app.NoteFieldMediaCollection, count)
+	i := 0
+	for rows.Next() {
+		var id int
+		var serviceCode int
+		var name string
+		var label string
+		var required bool
+		err = rows.Scan(&id, &serviceCode, &name, &label, &required)
+		if err != nil {
+			return nil, err
+		}
+		coll[i] = &app.NoteFieldMedia{
+			ID:          id,
+			ServiceCode: serviceCode,
+			Name:        name,
+			Label:       label,
+			Required:    required,
+		}
+		i++
+	}
+	return coll, nil
+}
+
+func (s *NoteTemplate) read(ctx context.Context, db *mysql.DB, serviceCode int) (app.NoteFieldMediaCollection, error) {
+	return s.GetFields(ctx, db, serviceCode)
+}
+
+// A template is created by setting its fields, so there's no create.
+func (s *NoteTemplate) update(ctx context.Context, db *mysql.DB, payload *app.NoteTemplatePayload) (app.NoteFieldMediaCollection, error) {
+	updateStmt, err := db.PrepareContext(ctx, noteTemplateStmt.UpdateField)
+	if err != nil {
+		return nil, err
+	}
+	insertStmt, err := db.PrepareContext(ctx, noteTemplateStmt.InsertField)
+	if err != nil {
+		return nil, err
+	}
+	deleteStmt, err := db.PrepareContext(ctx, noteTemplateStmt.DeleteField)
+	if err != nil {
+		return nil, err
+	}
+	for _, field := range payload.Fields {
+		if field.ID == -1 {
+			_, err = insertStmt.ExecContext(ctx, payload.ServiceCode, field.Name, field.Label, field.Required)
+		} else if field.ID < -1 {
+			// The same convention as a consumer's unit blocks, the id of a removed field is bitwise NOT'd.
+			_, err = deleteStmt.ExecContext(ctx, ^field.ID)
+		} else {
+			_, err = updateStmt.ExecContext(ctx, field.Name, field.Label, field.Required, field.ID, payload.ServiceCode)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s.GetFields(ctx, db, payload.ServiceCode)
+}
+
+func (s *NoteTemplate) delete(ctx context.Context, db *mysql.DB, serviceCode int) error {
+	stmt, err := db.PrepareContext(ctx, noteTemplateStmt.Delete)
+	if err != nil {
+		return err
+	}
+	_, err = stmt.ExecContext(ctx, serviceCode)
+	return err
+}
@@ -0,0 +1,370 @@
+package sql
+
+import (
+	"bytes"
+	"context"
+	mysql "database/sql"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/btoll/cpss/server/app"
+)
+
+// The kinds of notifications.
+const (
+	NotifyPasswordReset     = "passwordReset"
+	NotifyLowUnitBlock      = "lowUnitBlock"
+	NotifyRejectedBillSheet = "rejectedBillSheet"
+	NotifyTimesheetReminder = "timesheetReminder"
+)
+
+// The states of a queued email.
+const (
+	EmailPending = "pending"
+	EmailSent    = "sent"
+	EmailFailed  = "failed"
+)
+
+// A queued email is given up on after this many attempts.
+var MaxEmailAttempts = 5
+
+// Every template defines a `subject` and a `body`.  The recipient's name is always given as `.Name`.
+var notificationTemplates = map[string]*template.Template{
+	NotifyPasswordReset: template.Must(template.New(NotifyPasswordReset).Parse(`
+{{define "subject"}}Reset your password{{end}}
+{{define "body"}}Hi {{.Name}},
+
+Someone asked to reset the password of your account.  If it was you, follow this link within {{.Expires}}:
+
+{{.Link}}
+
+If it wasn't you, you can ignore this email.
+{{end}}`)),
+	NotifyLowUnitBlock: template.Must(template.New(NotifyLowUnitBlock).Parse(`
+{{define "subject"}}{{len .UnitBlocks}} unit blocks are running low{{end}}
+{{define "body"}}Hi {{.Name}},
+
+The following unit blocks are running low:
+{{range .UnitBlocks}}
+  {{.}}{{end}}
+{{end}}`)),
+	NotifyRejectedBillSheet: template.Must(template.New(NotifyRejectedBillSheet).Parse(`
+{{define "subject"}}BillSheet {{.BillSheet}} was rejected{{end}}
+{{define "body"}}Hi {{.Name}},
+
+Your billsheet {{.BillSheet}} was rejected:
+
+{{.Comment}}
+
+Please fix it and submit it again.
+{{end}}`)),
+	NotifyTimesheetReminder: template.Must(template.New(NotifyTimesheetReminder).Parse(`
+{{define "subject"}}Please finish your billsheets for the week{{end}}
+{{define "body"}}Hi {{.Name}},
+{{if eq .Entered 0}}
+You haven't entered any billsheets this week.
+{{else}}
+You have {{.Drafts}} billsheets this week that haven't been submitted yet.
+{{end}}
+{{end}}`)),
+}
+
+// A specialist can opt out of anything except for password resets.
+func canOptOut(kind string) bool {
+	return kind != NotifyPasswordReset
+}
+
+type QueuedEmail struct {
+	ID       int
+	Address  string
+	Subject  string
+	Body     string
+	Attempts int
+}
+
+type Notification struct {
+	db *mysql.DB
+}
+
+func NewNotification(db *mysql.DB) *Notification {
+	return &Notification{db: db}
+}
+
+var notificationStmt = struct {
+	DeleteOptOut    string
+	InsertOptOut    string
+	InsertQueue     string
+	SelectOptOut    string
+	SelectQueue     string
+	SelectRecipient string
+	UpdateFailed    string
+	UpdateSent      string
+}{
+	DeleteOptOut:    "DELETE FROM notification_opt_out WHERE specialist=?",
+	InsertOptOut:    "INSERT notification_opt_out SET specialist=?,kind=?",
+	InsertQueue:     "INSERT email_queue SET specialist=?,address=?,kind=?,subject=?,body=?,status=?,createdTime=?",
+	SelectOptOut:    "SELECT kind FROM notification_opt_out WHERE specialist=%d ORDER BY kind",
+	SelectQueue:     "SELECT id,address,subject,body,attempts FROM email_queue WHERE status=? AND nextAttempt <= ? ORDER BY id LIMIT ?",
+	SelectRecipient: "SELECT IFNULL(email,''),CONCAT(firstname,' ',lastname),(SELECT COUNT(*) FROM notification_opt_out WHERE notification_opt_out.specialist = specialist.id AND kind=?) FROM specialist WHERE id=? AND active=1",
+	UpdateFailed:    "UPDATE email_queue SET status=?,attempts=?,nextAttempt=?,lastError=? WHERE id=?",
+	UpdateSent:      "UPDATE email_queue SET status=?,attempts=attempts+1,sentTime=? WHERE id=?",
+}
+
+func init() {
+	registerStmts("Notification", notificationStmt)
+}
+
+func (n *Notification) Read(ctx context.Context, specialist int) (_ *app.NotificationMedia, err error) {
+	defer logError(ctx, "Read Notification", &err)
+	return n.read(ctx, n.db, specialist)
+}
+
+func (n *Notification) Update(ctx context.Context, payload *app.NotificationPayload) (_ *app.NotificationMedia, err error) {
+	defer logError(ctx, "Update Notification", &err)
+	return n.update(ctx, n.db, payload)
+}
+
+func (n *Notification) Render(kind string, data map[string]interface{}) (string, string, error) {
+	t, ok := notificationTemplates[kind]
+	if !ok {
+		return "", "", fmt.Errorf("There is no %s notification!", kind)
+	}
+	var subject bytes.Buffer
+	if err := t.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return "", "", err
+	}
+	var body bytes.Buffer
+	if err := t.ExecuteTemplate(&body, "body", data); err != nil {
+		return "", "", err
+	}
+	return strings.TrimSpace(subject.String()), strings.TrimSpace(body.String()) + "\n", nil
+}
+
+// Queues an email to the specialist.  Nothing is queued if the specialist is inactive, doesn't have an
+// email address or has opted out.  Takes a Queryer so that the email is only sent if the transaction
+// that caused it is committed.
+func (n *Notification) Enqueue(ctx context.Context, db Queryer, kind string, specialist int, data map[string]interface{}) error {
+	rows, err := db.QueryContext(ctx, notificationStmt.SelectRecipient, kind, specialist)
+	if err != nil {
+		return err
+	}
+	var address string
+	var name string
+	var optedOut int
+	count := 0
+	for rows.Next() {
+		err = rows.Scan(&address, &name, &optedOut)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		count++
+	}
+	rows.Close()
+	if count == 0 || address == "" || (optedOut > 0 && canOptOut(kind)) {
+		return nil
+	}
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	data["Name"] = name
+	subject, body, err := n.Render(kind, data)
+	if err != nil {
+		return err
+	}
+	stmt, err := db.PrepareContext(ctx, notificationStmt.InsertQueue)
+	if err != nil {
+		return err
+	}
+	_, err = stmt.ExecContext(ctx, specialist, address, kind, subject, body, EmailPending, int(time.Now().Unix()))
+	return err
+}
+
+// Returns the kinds of notifications that the specialist has opted out of.
+func (n *Notification) read(ctx context.Context, db *mysql.DB, specialist int) (*app.NotificationMedia, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(notificationStmt.SelectOptOut, specialist))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	optOut := []string{}
+	for rows.Next() {
+		var kind string
+		err = rows.Scan(&kind)
+		if err != nil {
+			return nil, err
+		}
+		optOut = append(optOut, kind)
+	}
+	return &app.NotificationMedia{
+		Specialist: specialist,
+		OptOut:     optOut,
+	}, nil
+}
+
+// The opt-outs are always replaced wholesale, so there's no create or delete.
+func (n *Notification) update(ctx context.Context, db *mysql.DB, payload *app.NotificationPayload) (*app.NotificationMedia, error) {
+	for _, kind := range payload.OptOut {
+		if !canOptOut(kind) {
+			return nil, fmt.Errorf("You cannot opt out of %s emails!", kind)
+		}
+	}
+	stmt, err := db.PrepareContext(ctx, notificationStmt.DeleteOptOut)
+	if err != nil {
+		return nil, err
+	}
+	_, err = stmt.ExecContext(ctx, payload.Specialist)
+	if err != nil {
+		return nil, err
+	}
+	stmt, err = db.PrepareContext(ctx, notificationStmt.InsertOptOut)
+	if err != nil {
+		return nil, err
+	}
+	for _, kind := range payload.OptOut {
+		_, err = stmt.ExecContext(ctx, payload.Specialist, kind)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &app.NotificationMedia{
+		Specialist: payload.Specialist,
+		OptOut:     payload.OptOut,
+	}, nil
+}
+
+// Queues an email to the specialist outside of any transaction.
+func (n *Notification) Notify(ctx context.Context, kind string, specialist int, data map[string]interface{}) (err error) {
+	defer logError(ctx, "Notify Notification", &err)
+	return n.Enqueue(ctx, n.db, kind, specialist, data)
+}
+
+// Returns the emails that are due to be sent.
+func (n *Notification) GetQueuedEmails(ctx context.Context, limit int) (_ []*QueuedEmail, err error) {
+	defer logError(ctx, "GetQueuedEmails Notification", &err)
+	return n.getQueuedEmails(ctx, n.db, limit)
+}
+
+func (n *Notification) getQueuedEmails(ctx context.Context, db *mysql.DB, limit int) ([]*QueuedEmail, error) {
+	rows, err := db.QueryContext(ctx, notificationStmt.SelectQueue, EmailPending, int(time.Now().Unix()), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	coll := []*QueuedEmail{}
+	for rows.Next() {
+		email := &QueuedEmail{}
+		err = rows.Scan(&email.ID, &email.Address, &email.Subject, &email.Body, &email.Attempts)
+		if err != nil {
+			return nil, err
+		}
+		coll = append(coll, email)
+	}
+	return coll, nil
+}
+
+func (n *Notification) MarkEmailSent(ctx context.Context, email *QueuedEmail) (err error) {
+	defer logError(ctx, "MarkEmailSent Notification", &err)
+	return n.markEmailSent(ctx, n.db, email)
+}
+
+func (n *Notification) markEmailSent(ctx context.Context, db *mysql.DB, email *QueuedEmail) error {
+	stmt, err := db.PrepareContext(ctx, notificationStmt.UpdateSent)
+	if err != nil {
+		return err
+	}
+	_, err = stmt.ExecContext(ctx, EmailSent, int(time.Now().Unix()), email.ID)
+	return err
+}
+
+// A failed email is tried again later, waiting twice as long each time, until it's given up on.
+func (n *Notification) MarkEmailFailed(ctx context.Context, email *QueuedEmail, sendErr error) (err error) {
+	defer logError(ctx, "MarkEmailFailed Notification", &err)
+	return n.markEmailFailed(ctx, n.db, email, sendErr)
+}
+
+func (n *Notification) markEmailFailed(ctx context.Context, db *mysql.DB, email *QueuedEmail, sendErr error) error {
+	attempts := email.Attempts + 1
+	status := EmailPending
+	if attempts >= MaxEmailAttempts {
+		status = EmailFailed
+	}
+	nextAttempt := time.Now().Add(time.Duration(1<<uint(attempts)) * time.Minute)
+	stmt, err := db.PrepareContext(ctx, notificationStmt.UpdateFailed)
+	if err != nil {
+		return err
+	}
+	_, err = stmt.ExecContext(ctx, status, attempts, int(nextAttempt.Unix()), sendErr.Error(), email.ID)
+	return err
+}
+
+// Returns the ids of the active admins.
+func (n *Notification) GetAdmins(ctx context.Context) (_ []int, err error) {
+	defer logError(ctx, "GetAdmins Notification", &err)
+	return n.getAdmins(ctx, n.db)
+}
+
+func (n *Notification) getAdmins(ctx context.Context, db *mysql.DB) ([]int, error) {
+	rows, err := db.QueryContext(ctx, "SELECT id FROM specialist WHERE active=1 AND authLevel=?", AuthLevelAdmin)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// Reminds every active specialist who hasn't entered any billsheets this week, or who still has drafts.
+// Returns how many were reminded.
+func (n *Notification) SendTimesheetReminders(ctx context.Context) (_ int, err error) {
+	defer logError(ctx, "SendTimesheetReminders Notification", &err)
+	return n.sendTimesheetReminders(ctx, n.db)
+}
+
+func (n *Notification) sendTimesheetReminders(ctx context.Context, db *mysql.DB) (int, error) {
+	rows, err := db.QueryContext(ctx, "SELECT specialist.id,"+
+		"(SELECT COUNT(*) FROM billsheet WHERE billsheet.specialist = specialist.id AND YEARWEEK(billsheet.serviceDate, 1) = YEARWEEK(CURDATE(), 1)),"+
+		"(SELECT COUNT(*) FROM billsheet WHERE billsheet.specialist = specialist.id AND YEARWEEK(billsheet.serviceDate, 1) = YEARWEEK(CURDATE(), 1) AND billsheet.state = ?) "+
+		"FROM specialist WHERE active=1 AND authLevel=?", StateDraft, AuthLevelUser)
+	if err != nil {
+		return 0, err
+	}
+	type reminder struct {
+		specialist int
+		entered    int
+		drafts     int
+	}
+	reminders := []*reminder{}
+	for rows.Next() {
+		r := &reminder{}
+		err = rows.Scan(&r.specialist, &r.entered, &r.drafts)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if r.entered == 0 || r.drafts > 0 {
+			reminders = append(reminders, r)
+		}
+	}
+	rows.Close()
+	for _, r := range reminders {
+		err = n.Enqueue(ctx, db, NotifyTimesheetReminder, r.specialist, map[string]interface{}{
+			"Entered": r.entered,
+			"Drafts":  r.drafts,
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(reminders), nil
+}
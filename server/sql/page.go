@@ -0,0 +1,123 @@
+package sql
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/btoll/cpss/server/app"
+	"github.com/goadesign/goa"
+)
+
+// The number of records on a page when the client doesn't ask for a number.
+var RecordsPerPage = 50
+
+// The most records that a client can ask for on one page.
+var MaxRecordsPerPage = 500
+
+type PageQuery struct {
+	Page int
+	// Who is asking, for the resources whose rows are scoped.
+	Principal *Principal
+	// RecordsPerPage when it's not given.
+	PerPage int
+	// The keys to sort by separated by commas, each one descending when it starts with `-`
+	// (e.g. `lastname,-serviceDate`).  The resource's default sort when it's not given.
+	Sort string
+	// The fields of each record to send back, all of them when there aren't any.  The records are trimmed
+	// when the response is written, they're only here so that the pager can echo them.
+	Fields []string
+}
+
+// The columns that a sort key orders by and the join that they need, if any.
+type sortKey struct {
+	Columns []string
+	Join    string
+}
+
+// Returns the number of records on a page.  A page or page size that can't be asked for is a bad
+// request.
+func (q *PageQuery) GetPerPage() (int, error) {
+	if q.Page < 0 {
+		return 0, goa.ErrBadRequest("Bad page: the first page is 0")
+	}
+	if q.PerPage == 0 {
+		return RecordsPerPage, nil
+	}
+	if q.PerPage < 0 || q.PerPage > MaxRecordsPerPage {
+		return 0, goa.ErrBadRequest(fmt.Sprintf("Bad page size: a page can have between 1 and %d records", MaxRecordsPerPage))
+	}
+	return q.PerPage, nil
+}
+
+// Returns the joins that the sort needs, the ORDER BY and the sort that was used.  Only the keys of
+// `sorts` can be sorted by, so nothing that the client sends ends up in the ORDER BY.  The tie breaker
+// is always sorted by last so that the pages are stable.  Any other key is a bad request.
+func (q *PageQuery) GetSort(sorts map[string]sortKey, defaultSort, tieBreaker string) (string, string, string, error) {
+	sort := strings.TrimSpace(q.Sort)
+	if sort == "" {
+		sort = defaultSort
+	}
+	joins := []string{}
+	columns := []string{}
+	keys := []string{}
+	seen := map[string]bool{}
+	for _, key := range strings.Split(sort, ",") {
+		key = strings.TrimSpace(key)
+		dir := "ASC"
+		if strings.HasPrefix(key, "-") {
+			key = key[1:]
+			dir = "DESC"
+		}
+		s, ok := sorts[key]
+		if !ok {
+			return "", "", "", goa.ErrBadRequest(fmt.Sprintf("Bad sort: cannot sort by %s", key))
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if s.Join != "" {
+			joins = append(joins, s.Join)
+		}
+		for _, column := range s.Columns {
+			columns = append(columns, fmt.Sprintf("%s %s", column, dir))
+			if column == tieBreaker {
+				tieBreaker = ""
+			}
+		}
+		if dir == "DESC" {
+			key = "-" + key
+		}
+		keys = append(keys, key)
+	}
+	if tieBreaker != "" {
+		columns = append(columns, fmt.Sprintf("%s ASC", tieBreaker))
+	}
+	return strings.Join(joins, " "), strings.Join(columns, ","), strings.Join(keys, ","), nil
+}
+
+// Only the amount of rows equal to perPage unless the last page has been requested (determined by
+// `totalCount - offset`), and none past the last page.
+func pageCapacity(totalCount, offset, perPage int) int {
+	capacity := totalCount - offset
+	if capacity >= perPage {
+		capacity = perPage
+	}
+	if capacity < 0 {
+		capacity = 0
+	}
+	return capacity
+}
+
+// The pager echoes the settings that the page was made with.
+func newPager(query *PageQuery, perPage, totalCount int, sort string) *app.Pager {
+	return &app.Pager{
+		CurrentPage:    query.Page,
+		RecordsPerPage: perPage,
+		TotalCount:     totalCount,
+		TotalPages:     int(math.Ceil(float64(totalCount) / float64(perPage))),
+		Sort:           &sort,
+		Fields:         query.Fields,
+	}
+}
@@ -0,0 +1,88 @@
+package sql
+
+import (
+	"testing"
+
+	"github.com/goadesign/goa"
+)
+
+func isBadRequest(err error) bool {
+	e, ok := err.(goa.ServiceError)
+	return ok && e.ResponseStatus() == 400
+}
+
+func TestGetSort(t *testing.T) {
+	sorts := map[string]sortKey{
+		"name":        {Columns: []string{"lastname", "firstname"}},
+		"serviceDate": {Columns: []string{"serviceDate"}},
+		"county":      {Columns: []string{"county.name"}, Join: "LEFT JOIN county ON county.id=consumer.county"},
+		"id":          {Columns: []string{"id"}},
+	}
+	tests := []struct {
+		name    string
+		sort    string
+		joins   string
+		orderBy string
+		used    string
+		bad     bool
+	}{
+		{name: "default", sort: "", orderBy: "lastname ASC,firstname ASC,id ASC", used: "name"},
+		{name: "descending", sort: "-serviceDate", orderBy: "serviceDate DESC,id ASC", used: "-serviceDate"},
+		{name: "several", sort: "serviceDate, -name", orderBy: "serviceDate ASC,lastname DESC,firstname DESC,id ASC", used: "serviceDate,-name"},
+		{name: "repeated", sort: "name,-name", orderBy: "lastname ASC,firstname ASC,id ASC", used: "name"},
+		{name: "by the tie breaker", sort: "-id", orderBy: "id DESC", used: "-id"},
+		{name: "joined", sort: "county", joins: "LEFT JOIN county ON county.id=consumer.county", orderBy: "county.name ASC,id ASC", used: "county"},
+		{name: "unknown", sort: "password", bad: true},
+		{name: "injected", sort: "name; DROP TABLE consumer", bad: true},
+		{name: "empty key", sort: "name,", bad: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			joins, orderBy, used, err := (&PageQuery{Sort: tt.sort}).GetSort(sorts, "name", "id")
+			if tt.bad {
+				if !isBadRequest(err) {
+					t.Errorf("GetSort(%q) error = %v, want a bad request", tt.sort, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetSort(%q) error = %v", tt.sort, err)
+			}
+			if joins != tt.joins || orderBy != tt.orderBy || used != tt.used {
+				t.Errorf("GetSort(%q) = %q, %q, %q, want %q, %q, %q", tt.sort, joins, orderBy, used, tt.joins, tt.orderBy, tt.used)
+			}
+		})
+	}
+}
+
+func TestGetPerPage(t *testing.T) {
+	tests := []struct {
+		page    int
+		perPage int
+		want    int
+		bad     bool
+	}{
+		{page: 0, perPage: 0, want: RecordsPerPage},
+		{page: 3, perPage: 10, want: 10},
+		{page: 0, perPage: MaxRecordsPerPage, want: MaxRecordsPerPage},
+		{page: 0, perPage: MaxRecordsPerPage + 1, bad: true},
+		{page: 0, perPage: -1, bad: true},
+		{page: -1, perPage: 10, bad: true},
+	}
+	for _, tt := range tests {
+		got, err := (&PageQuery{Page: tt.page, PerPage: tt.perPage}).GetPerPage()
+		if tt.bad {
+			if !isBadRequest(err) {
+				t.Errorf("GetPerPage(%d, %d) error = %v, want a bad request", tt.page, tt.perPage, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("GetPerPage(%d, %d) error = %v", tt.page, tt.perPage, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("GetPerPage(%d, %d) = %d, want %d", tt.page, tt.perPage, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package sql
+
+import (
+	"context"
+	mysql "database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// The password policy.
+var (
+	MinPasswordLength = 10
+	// bcrypt ignores anything after 72 bytes.
+	MaxPasswordLength = 72
+	// A new password can't be the same as the current one or any of this many before it.
+	PasswordHistoryLength = 5
+)
+
+// The bcrypt cost of new hashes.  A hash with a lower cost is upgraded the next time its specialist logs in.
+var PasswordCost = bcrypt.DefaultCost
+
+var ErrPasswordReused = errors.New("That password has been used recently, please choose another!")
+
+// A password has to be long enough, mix letters with something else and not contain the username.
+func CheckPasswordPolicy(username, password string) error {
+	if len(password) < MinPasswordLength {
+		return fmt.Errorf("A password must be at least %d characters long!", MinPasswordLength)
+	}
+	if len(password) > MaxPasswordLength {
+		return fmt.Errorf("A password cannot be more than %d characters long!", MaxPasswordLength)
+	}
+	var letters, others int
+	for _, c := range password {
+		if unicode.IsLetter(c) {
+			letters++
+		} else {
+			others++
+		}
+	}
+	if letters == 0 || others == 0 {
+		return errors.New("A password must have both letters and numbers or symbols!")
+	}
+	if len(username) >= 3 && strings.Contains(strings.ToLower(password), strings.ToLower(username)) {
+		return errors.New("A password cannot contain the username!")
+	}
+	return nil
+}
+
+// Checks the new password against the current one and the recent ones.
+func checkPasswordHistory(ctx context.Context, db Queryer, id int, password string) error {
+	rows, err := db.QueryContext(ctx, "(SELECT password FROM specialist WHERE id=?) UNION ALL (SELECT password FROM password_history WHERE specialist=? ORDER BY id DESC LIMIT ?)", id, id, PasswordHistoryLength)
+	if err != nil {
+		return err
+	}
+	hashes := []string{}
+	for rows.Next() {
+		var hash string
+		if err = rows.Scan(&hash); err != nil {
+			rows.Close()
+			return err
+		}
+		hashes = append(hashes, hash)
+	}
+	rows.Close()
+	for _, hash := range hashes {
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil {
+			return ErrPasswordReused
+		}
+	}
+	return nil
+}
+
+// Hashes and stores a new password after checking it against the policy and the history.  The old
+// password goes into the history.
+func setPassword(ctx context.Context, db Queryer, id int, username, password string) error {
+	if err := CheckPasswordPolicy(username, password); err != nil {
+		return err
+	}
+	if err := checkPasswordHistory(ctx, db, id, password); err != nil {
+		return err
+	}
+	now := int(time.Now().Unix())
+	_, err := db.ExecContext(ctx, "INSERT password_history (specialist,password,changedTime) SELECT id,password,? FROM specialist WHERE id=?", now, id)
+	if err != nil {
+		return err
+	}
+	hash, err := SaltAndHash(password)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, "UPDATE specialist SET password=? WHERE id=?", hash, id)
+	if err != nil {
+		return err
+	}
+	// Only the history that's checked is kept.
+	_, err = db.ExecContext(ctx, "DELETE FROM password_history WHERE specialist=? AND id NOT IN (SELECT id FROM (SELECT id FROM password_history WHERE specialist=? ORDER BY id DESC LIMIT ?) AS recent)", id, id, PasswordHistoryLength)
+	return err
+}
+
+// Sets the password of a specialist.  Changing your own password needs the current one, and only an admin
+// can change anyone else's (which ends their session).  Who's asking comes from the request's principal.
+func (s *Specialist) ChangePassword(ctx context.Context, id int, currentPassword *string, password string) (err error) {
+	defer logError(ctx, "ChangePassword Specialist", &err)
+	return s.changePassword(ctx, s.db, id, currentPassword, password)
+}
+
+func (s *Specialist) changePassword(ctx context.Context, db *mysql.DB, id int, currentPassword *string, password string) error {
+	p := PrincipalFromContext(ctx)
+	if p == nil {
+		return ErrNoPrincipal
+	}
+	if id == p.ID {
+		if currentPassword == nil {
+			return ErrBadLogin
+		}
+		if err := checkPassword(ctx, db, id, *currentPassword); err != nil {
+			return err
+		}
+	} else if p.AuthLevel != AuthLevelAdmin {
+		return errors.New("Only an admin can change someone else's password!")
+	}
+	var username string
+	if err := db.QueryRowContext(ctx, "SELECT username FROM specialist WHERE id=?", id).Scan(&username); err != nil {
+		if err == mysql.ErrNoRows {
+			return errors.New("There is no Specialist with that id!")
+		}
+		return err
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err = setPassword(ctx, tx, id, username, password); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if id != p.ID {
+		if _, err = tx.ExecContext(ctx, "UPDATE specialist SET loginTime=0 WHERE id=?", id); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if _, err = tx.ExecContext(ctx, "DELETE FROM login_session WHERE specialist=?", id); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Rehashes the password if its hash was made with a lower cost than PasswordCost.  The password has
+// already been checked.
+func upgradePasswordCost(ctx context.Context, db *mysql.DB, id int, hash, password string) error {
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil || cost >= PasswordCost {
+		return err
+	}
+	newHash, err := SaltAndHash(password)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, "UPDATE specialist SET password=? WHERE id=?", newHash, id)
+	return err
+}
@@ -0,0 +1,129 @@
+package sql
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	mysql "database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// How long a reset link can be used for.
+var ResetTokenLength = time.Hour
+
+var ErrBadResetToken = errors.New("This reset link is invalid or has expired!")
+
+// Tokens are random and only a hash of them is ever stored, the same as a password.
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Emails a reset link to the specialist.  The link is `linkFormat` with the token in place of the %s.
+// Nothing is said about whether the username exists, so a username that doesn't is not an error.
+func (s *Session) RequestPasswordReset(ctx context.Context, username, linkFormat string) (err error) {
+	defer logError(ctx, "RequestPasswordReset Session", &err)
+	return s.requestPasswordReset(ctx, s.db, username, linkFormat)
+}
+
+func (s *Session) requestPasswordReset(ctx context.Context, db *mysql.DB, username, linkFormat string) error {
+	rows, err := db.QueryContext(ctx, "SELECT id FROM specialist WHERE username=? AND active=1", username)
+	if err != nil {
+		return err
+	}
+	id := -1
+	for rows.Next() {
+		err = rows.Scan(&id)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+	}
+	rows.Close()
+	if id == -1 {
+		return nil
+	}
+	token, err := newToken()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	stmt, err := db.PrepareContext(ctx, "INSERT password_reset SET specialist=?,tokenHash=?,createdTime=?,expires=?")
+	if err != nil {
+		return err
+	}
+	_, err = stmt.ExecContext(ctx, id, hashToken(token), int(now.Unix()), int(now.Add(ResetTokenLength).Unix()))
+	if err != nil {
+		return err
+	}
+	return NewNotification(db).Enqueue(ctx, db, NotifyPasswordReset, id, map[string]interface{}{
+		"Link":    fmt.Sprintf(linkFormat, token),
+		"Expires": ResetTokenLength.String(),
+	})
+}
+
+// Sets a new password with a reset token.  The token can only be used once, and using it throws away
+// every other outstanding token of the specialist and unlocks the account.
+func (s *Session) ResetPassword(ctx context.Context, token, password string) (err error) {
+	defer logError(ctx, "ResetPassword Session", &err)
+	return s.resetPassword(ctx, s.db, token, password)
+}
+
+func (s *Session) resetPassword(ctx context.Context, db *mysql.DB, token, password string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	rows, err := tx.QueryContext(ctx, "SELECT password_reset.specialist,specialist.username FROM password_reset INNER JOIN specialist ON password_reset.specialist = specialist.id WHERE tokenHash=? AND usedTime=0 AND expires > ? FOR UPDATE", hashToken(token), int(time.Now().Unix()))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	id := -1
+	var username string
+	for rows.Next() {
+		err = rows.Scan(&id, &username)
+		if err != nil {
+			rows.Close()
+			tx.Rollback()
+			return err
+		}
+	}
+	rows.Close()
+	if id == -1 {
+		tx.Rollback()
+		return ErrBadResetToken
+	}
+	// A password that breaks the policy doesn't use up the token, so another one can be tried.
+	if err = setPassword(ctx, tx, id, username, password); err != nil {
+		tx.Rollback()
+		return err
+	}
+	now := int(time.Now().Unix())
+	for _, q := range []struct {
+		stmt string
+		args []interface{}
+	}{
+		{"UPDATE specialist SET loginTime=0 WHERE id=?", []interface{}{id}},
+		{"UPDATE password_reset SET usedTime=? WHERE specialist=? AND usedTime=0", []interface{}{now, id}},
+		{"DELETE FROM login_attempt WHERE specialist=?", []interface{}{id}},
+		{"DELETE FROM login_session WHERE specialist=?", []interface{}{id}},
+	} {
+		if _, err = tx.ExecContext(ctx, q.stmt, q.args...); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
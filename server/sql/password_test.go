@@ -0,0 +1,95 @@
+package sql
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestCheckPasswordPolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		username string
+		password string
+		ok       bool
+	}{
+		{name: "good", username: "jsmith", password: "correct horse 42", ok: true},
+		{name: "letters and symbols", username: "jsmith", password: "correct-horse", ok: true},
+		{name: "shortest", username: "jsmith", password: "abcdefghi1", ok: true},
+		{name: "too short", username: "jsmith", password: "abcdefgh1"},
+		{name: "longest", username: "jsmith", password: strings.Repeat("a1", 36), ok: true},
+		{name: "too long", username: "jsmith", password: strings.Repeat("a1", 36) + "a"},
+		{name: "only letters", username: "jsmith", password: "correcthorsebattery"},
+		{name: "only numbers", username: "jsmith", password: "12345678901"},
+		{name: "contains the username", username: "jsmith", password: "JSmith-2024!"},
+		{name: "short username", username: "jo", password: "jo-jo-jo-jo-1", ok: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckPasswordPolicy(tt.username, tt.password)
+			if tt.ok != (err == nil) {
+				t.Errorf("CheckPasswordPolicy(%q, %q) error = %v, want ok %v", tt.username, tt.password, err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestSetPassword(t *testing.T) {
+	cost := PasswordCost
+	PasswordCost = bcrypt.MinCost
+	defer func() { PasswordCost = cost }()
+	hash := func(password string) []byte {
+		h, err := SaltAndHash(password)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+	// The current password and the ones before it.
+	history := [][]driver.Value{{hash("current-password-1")}, {hash("older-password-2")}}
+	tests := []struct {
+		name     string
+		password string
+		want     error
+		bad      bool
+	}{
+		{name: "new", password: "brand-new-password-3"},
+		{name: "the current one", password: "current-password-1", want: ErrPasswordReused},
+		{name: "a recent one", password: "older-password-2", want: ErrPasswordReused},
+		{name: "against the policy", password: "short", bad: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script := &fakeScript{
+				Query: func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+					return []string{"password"}, history, nil
+				},
+			}
+			db := openFake(t, script)
+			err := setPassword(context.Background(), db, 2, "jsmith", tt.password)
+			switch {
+			case tt.bad:
+				if err == nil {
+					t.Fatalf("setPassword(%q) error = nil, want an error", tt.password)
+				}
+			case err != tt.want:
+				t.Fatalf("setPassword(%q) error = %v, want %v", tt.password, err, tt.want)
+			}
+			updated := false
+			for _, stmt := range script.Statements {
+				if strings.HasPrefix(stmt.Query, "UPDATE specialist SET password") {
+					updated = true
+					if bcrypt.CompareHashAndPassword(stmt.Args[0].([]byte), []byte(tt.password)) != nil {
+						t.Errorf("setPassword(%q) stored a hash of something else", tt.password)
+					}
+				}
+			}
+			if ok := err == nil; updated != ok {
+				t.Errorf("setPassword(%q) updated the password = %v, want %v", tt.password, updated, ok)
+			}
+		})
+	}
+}
@@ -1,33 +1,69 @@
 package sql
 
 import (
+	"context"
 	mysql "database/sql"
 	"fmt"
-	"strconv"
 
 	"github.com/btoll/cpss/server/app"
 )
 
 type PayHistory struct {
-	Data interface{}
-	Stmt map[string]string
+	db *mysql.DB
 }
 
-func NewPayHistory(payload interface{}) *PayHistory {
-	return &PayHistory{
-		Data: payload,
-		Stmt: map[string]string{
-			"SELECT": "SELECT %s FROM pay_history %s",
-		},
-	}
+func NewPayHistory(db *mysql.DB) *PayHistory {
+	return &PayHistory{db: db}
 }
 
-func (s *PayHistory) List(db *mysql.DB) (interface{}, error) {
-	id, err := strconv.Atoi(s.Data.(string))
-	if err != nil {
-		return false, err
+var payHistoryStmt = struct {
+	Select string
+}{
+	Select: "SELECT %s FROM pay_history %s",
+}
+
+func init() {
+	registerStmts("PayHistory", payHistoryStmt)
+}
+
+func (s *PayHistory) Export(ctx context.Context, query *PayHistoryExportQuery, w RowWriter) (err error) {
+	defer logError(ctx, "Export PayHistory", &err)
+	return s.export(ctx, s.db, query, w)
+}
+
+func (s *PayHistory) List(ctx context.Context, specialist int) (_ app.PayHistoryMediaCollection, err error) {
+	defer logError(ctx, "List PayHistory", &err)
+	return s.list(ctx, s.db, specialist)
+}
+
+// The columns of an export.  The specialist is resolved to a name.
+const payHistoryExportColumns = "id," +
+	"(SELECT CONCAT(lastname,', ',firstname) FROM specialist WHERE specialist.id = pay_history.specialist) AS specialistName," +
+	"changeDate,payrate"
+
+var payHistoryExportHeader = []string{"ID", "Specialist", "Change Date", "Payrate"}
+
+type PayHistoryExportQuery struct {
+	ExportQuery
+	Filter *app.PayHistoryQueryPayload
+}
+
+// Only an admin can export the pay history, since it has the payrates of everyone.
+func (s *PayHistory) export(ctx context.Context, db *mysql.DB, query *PayHistoryExportQuery, w RowWriter) error {
+	if err := RequireAdmin(ctx); err != nil {
+		return err
+	}
+	whereClause := ""
+	args := []interface{}{}
+	if query.Filter != nil && query.Filter.Specialist != nil {
+		whereClause = "WHERE specialist = ?"
+		args = append(args, *query.Filter.Specialist)
 	}
-	rows, err := db.Query(fmt.Sprintf(s.Stmt["SELECT"], "COUNT(*)", fmt.Sprintf("WHERE specialist = %d", id)))
+	return exportRows(ctx, db, fmt.Sprintf(payHistoryStmt.Select, payHistoryExportColumns, fmt.Sprintf("%s ORDER BY specialistName ASC, changeDate DESC", whereClause)), payHistoryExportHeader, w, args...)
+}
+
+func (s *PayHistory) list(ctx context.Context, db *mysql.DB, specialist int) (app.PayHistoryMediaCollection, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(payHistoryStmt.Select, "COUNT(*)", fmt.Sprintf("WHERE specialist = %d", specialist)))
 	if err != nil {
 		return nil, err
 	}
@@ -38,7 +74,7 @@ func (s *PayHistory) List(db *mysql.DB) (interface{}, error) {
 			return nil, err
 		}
 	}
-	rows, err = db.Query(fmt.Sprintf(s.Stmt["SELECT"], "*", fmt.Sprintf("WHERE specialist = %d", id)))
+	rows, err = db.QueryContext(ctx, fmt.Sprintf(payHistoryStmt.Select, "*", fmt.Sprintf("WHERE specialist = %d", specialist)))
 	if err != nil {
 		return nil, err
 	}
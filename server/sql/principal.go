@@ -0,0 +1,134 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// The specialist that a request was authenticated as.
+type Principal struct {
+	ID        int
+	AuthLevel int
+	// Authenticated with a login challenge rather than a session, which is only good for enrolling in
+	// two-factor authentication.
+	Challenge bool
+}
+
+type principalKey struct{}
+
+var ErrNoPrincipal = errors.New("Please log in!")
+
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// Returns nil when the request wasn't authenticated.
+func PrincipalFromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
+
+// A scope returns the condition that limits the rows a principal can see.  An empty condition means
+// every row.
+type Scope func(p *Principal) string
+
+// Who can see which billsheets, by auth level.  An auth level that isn't here can't see any.
+var BillSheetScopes = map[int]Scope{
+	AuthLevelAdmin: func(p *Principal) string {
+		return ""
+	},
+	AuthLevelSupervisor: func(p *Principal) string {
+		return fmt.Sprintf("(billsheet.specialist=%d OR billsheet.specialist IN (SELECT specialist FROM team_member WHERE supervisor=%d))", p.ID, p.ID)
+	},
+	AuthLevelUser: func(p *Principal) string {
+		return fmt.Sprintf("billsheet.specialist=%d", p.ID)
+	},
+}
+
+// Who can see which consumers, by auth level.  A consumer can be seen by the specialists whose caseload
+// it's currently in (and their supervisors).
+var ConsumerScopes = map[int]Scope{
+	AuthLevelAdmin: func(p *Principal) string {
+		return ""
+	},
+	AuthLevelSupervisor: func(p *Principal) string {
+		return fmt.Sprintf("consumer.id IN (SELECT consumer FROM caseload WHERE (specialist=%d OR specialist IN (SELECT specialist FROM team_member WHERE supervisor=%d)) AND %s)", p.ID, p.ID, currentCaseloadClause("CURDATE()"))
+	},
+	AuthLevelUser: func(p *Principal) string {
+		return fmt.Sprintf("consumer.id IN (SELECT consumer FROM caseload WHERE specialist=%d AND %s)", p.ID, currentCaseloadClause("CURDATE()"))
+	},
+}
+
+// Who can see which caseload assignments, by auth level.  They're the assignments of the specialists that
+// can be seen.
+var CaseloadScopes = map[int]Scope{
+	AuthLevelAdmin: func(p *Principal) string {
+		return ""
+	},
+	AuthLevelSupervisor: func(p *Principal) string {
+		return fmt.Sprintf("(caseload.specialist=%d OR caseload.specialist IN (SELECT specialist FROM team_member WHERE supervisor=%d))", p.ID, p.ID)
+	},
+	AuthLevelUser: func(p *Principal) string {
+		return fmt.Sprintf("caseload.specialist=%d", p.ID)
+	},
+}
+
+// Who can see which specialists, by auth level.
+var SpecialistScopes = map[int]Scope{
+	AuthLevelAdmin: func(p *Principal) string {
+		return ""
+	},
+	AuthLevelSupervisor: func(p *Principal) string {
+		return fmt.Sprintf("(specialist.id=%d OR specialist.id IN (SELECT specialist FROM team_member WHERE supervisor=%d))", p.ID, p.ID)
+	},
+	AuthLevelUser: func(p *Principal) string {
+		return fmt.Sprintf("specialist.id=%d", p.ID)
+	},
+}
+
+func (p *Principal) getScope(scopes map[int]Scope, name string) (string, error) {
+	if p == nil {
+		return "", ErrNoPrincipal
+	}
+	scope, ok := scopes[p.AuthLevel]
+	if !ok {
+		return "", fmt.Errorf("You are not allowed to see any %s!", name)
+	}
+	return scope(p), nil
+}
+
+// Returns the condition that limits the billsheets to the ones the principal can see.
+func (p *Principal) BillSheetScope() (string, error) {
+	return p.getScope(BillSheetScopes, "BillSheets")
+}
+
+// Returns the condition that limits the caseload assignments to the ones the principal can see.
+func (p *Principal) CaseloadScope() (string, error) {
+	return p.getScope(CaseloadScopes, "Caseloads")
+}
+
+// Returns the condition that limits the consumers to the ones the principal can see.
+func (p *Principal) ConsumerScope() (string, error) {
+	return p.getScope(ConsumerScopes, "Consumers")
+}
+
+// Returns the condition that limits the specialists to the ones the principal can see.
+func (p *Principal) SpecialistScope() (string, error) {
+	return p.getScope(SpecialistScopes, "Specialists")
+}
+
+// Joins conditions with AND, skipping the empty ones.
+func andWhere(conditions ...string) string {
+	whereClause := ""
+	for _, c := range conditions {
+		if c == "" {
+			continue
+		}
+		if whereClause != "" {
+			whereClause += " AND "
+		}
+		whereClause += fmt.Sprintf("(%s)", c)
+	}
+	return whereClause
+}
@@ -0,0 +1,229 @@
+package sql
+
+import (
+	"context"
+	mysql "database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/btoll/cpss/server/app"
+)
+
+type ReportQuery struct {
+	StartDate string
+	EndDate   string
+	Statuses  []int
+	States    []string
+	GroupBy   []string
+}
+
+// The columns that the billing report can be grouped by.
+var reportDimensions = map[string]string{
+	"consumer":      "CONCAT(consumer.lastname,', ',consumer.firstname)",
+	"serviceCode":   "service_code.name",
+	"county":        "county.name",
+	"fundingSource": "funding_source.name",
+	"month":         "DATE_FORMAT(billsheet.serviceDate, '%Y-%m')",
+}
+
+type Report struct {
+	db *mysql.DB
+}
+
+func NewReport(db *mysql.DB) *Report {
+	return &Report{db: db}
+}
+
+var reportStmt = struct {
+	Billing      string
+	Productivity string
+	Utilization  string
+}{
+	Billing:      "SELECT %s FROM billsheet INNER JOIN consumer ON consumer.id = billsheet.consumer LEFT JOIN service_code ON service_code.id = billsheet.serviceCode LEFT JOIN county ON county.id = consumer.county LEFT JOIN funding_source ON funding_source.id = consumer.fundingSource WHERE %s %s",
+	Productivity: "SELECT CONCAT(specialist.lastname,', ',specialist.firstname) AS fullname,DATE_FORMAT(DATE_SUB(billsheet.serviceDate, INTERVAL WEEKDAY(billsheet.serviceDate) DAY), '%%m/%%d/%%y') AS week,SUM(billsheet.units) FROM billsheet INNER JOIN specialist ON specialist.id = billsheet.specialist WHERE %s GROUP BY specialist.id,YEARWEEK(billsheet.serviceDate, 1) ORDER BY fullname ASC,MIN(billsheet.serviceDate) ASC",
+	Utilization:  "SELECT CONCAT(consumer.lastname,', ',consumer.firstname) AS fullname,service_code.name,unit_block.units,(SELECT IFNULL(SUM(billsheet.units),0) FROM billsheet WHERE billsheet.consumer = unit_block.consumer AND billsheet.serviceCode = unit_block.serviceCode AND %s),(SELECT IFNULL(SUM(billsheet.units),0) FROM billsheet WHERE billsheet.consumer = unit_block.consumer AND billsheet.serviceCode = unit_block.serviceCode) FROM unit_block INNER JOIN consumer ON consumer.id = unit_block.consumer INNER JOIN service_code ON service_code.id = unit_block.serviceCode ORDER BY fullname ASC,service_code.name ASC",
+}
+
+func init() {
+	registerStmts("Report", reportStmt)
+}
+
+func (r *Report) Billing(ctx context.Context, query *ReportQuery) (_ []*app.BillingReportItem, err error) {
+	defer logError(ctx, "Billing Report", &err)
+	if err = r.authorize(ctx); err != nil {
+		return nil, err
+	}
+	return r.billing(ctx, r.db, query)
+}
+
+func (r *Report) Productivity(ctx context.Context, query *ReportQuery) (_ []*app.ProductivityReportItem, err error) {
+	defer logError(ctx, "Productivity Report", &err)
+	if err = r.authorize(ctx); err != nil {
+		return nil, err
+	}
+	return r.productivity(ctx, r.db, query)
+}
+
+func (r *Report) Utilization(ctx context.Context, query *ReportQuery) (_ []*app.UtilizationReportItem, err error) {
+	defer logError(ctx, "Utilization Report", &err)
+	if err = r.authorize(ctx); err != nil {
+		return nil, err
+	}
+	return r.utilization(ctx, r.db, query)
+}
+
+// Returns the WHERE clause of the date range and status filters and its arguments.
+func (r *Report) GetFilter(query *ReportQuery) (string, []interface{}, error) {
+	startDate, err := formatDate(query.StartDate)
+	if err != nil {
+		return "", nil, err
+	}
+	endDate, err := formatDate(query.EndDate)
+	if err != nil {
+		return "", nil, err
+	}
+	if endDate < startDate {
+		return "", nil, errors.New("Bad date: End Date cannot be before Start Date")
+	}
+	clauses := []string{"billsheet.serviceDate BETWEEN ? AND ?"}
+	args := []interface{}{startDate, endDate}
+	if len(query.Statuses) > 0 {
+		clauses = append(clauses, fmt.Sprintf("billsheet.status IN (%s)", placeholders(len(query.Statuses))))
+		for _, status := range query.Statuses {
+			args = append(args, status)
+		}
+	}
+	if len(query.States) > 0 {
+		clauses = append(clauses, fmt.Sprintf("billsheet.state IN (%s)", placeholders(len(query.States))))
+		for _, state := range query.States {
+			args = append(args, state)
+		}
+	}
+	return strings.Join(clauses, " AND "), args, nil
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
+
+func (r *Report) billing(ctx context.Context, db *mysql.DB, query *ReportQuery) ([]*app.BillingReportItem, error) {
+	filter, args, err := r.GetFilter(query)
+	if err != nil {
+		return nil, err
+	}
+	columns := []string{}
+	for _, dimension := range query.GroupBy {
+		column, ok := reportDimensions[dimension]
+		if !ok {
+			return nil, fmt.Errorf("Bad group: cannot group by %s", dimension)
+		}
+		columns = append(columns, column)
+	}
+	groupBy := ""
+	if len(columns) > 0 {
+		groupBy = fmt.Sprintf("GROUP BY %s ORDER BY %s", strings.Join(columns, ","), strings.Join(columns, ","))
+	}
+	totals := "COUNT(*),IFNULL(SUM(billsheet.units),0),IFNULL(ROUND(SUM(billsheet.billedAmount),2),0),IFNULL(ROUND(SUM(IF(billsheet.state = 'paid', billsheet.billedAmount, 0)),2),0)"
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(reportStmt.Billing, strings.Join(append(columns, totals), ","), filter, groupBy), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	coll := []*app.BillingReportItem{}
+	for rows.Next() {
+		names := make([]mysql.NullString, len(columns))
+		item := &app.BillingReportItem{}
+		dest := []interface{}{}
+		for i := range names {
+			dest = append(dest, &names[i])
+		}
+		dest = append(dest, &item.Billsheets, &item.Units, &item.BilledAmount, &item.PaidAmount)
+		err = rows.Scan(dest...)
+		if err != nil {
+			return nil, err
+		}
+		for i, dimension := range query.GroupBy {
+			name := names[i].String
+			switch dimension {
+			case "consumer":
+				item.Consumer = &name
+			case "serviceCode":
+				item.ServiceCode = &name
+			case "county":
+				item.County = &name
+			case "fundingSource":
+				item.FundingSource = &name
+			case "month":
+				item.Month = &name
+			}
+		}
+		coll = append(coll, item)
+	}
+	return coll, nil
+}
+
+func (r *Report) productivity(ctx context.Context, db *mysql.DB, query *ReportQuery) ([]*app.ProductivityReportItem, error) {
+	filter, args, err := r.GetFilter(query)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(reportStmt.Productivity, filter), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	coll := []*app.ProductivityReportItem{}
+	for rows.Next() {
+		item := &app.ProductivityReportItem{}
+		err = rows.Scan(&item.Specialist, &item.Week, &item.Units)
+		if err != nil {
+			return nil, err
+		}
+		// 4 units per hour!
+		item.Hours = item.Units / 4
+		coll = append(coll, item)
+	}
+	return coll, nil
+}
+
+// Note that a unit block holds what's left of the authorization, since every billsheet draws it down.  So,
+// what was authorized is what's left plus everything that has ever been billed against it.
+func (r *Report) utilization(ctx context.Context, db *mysql.DB, query *ReportQuery) ([]*app.UtilizationReportItem, error) {
+	filter, args, err := r.GetFilter(query)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(reportStmt.Utilization, filter), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	coll := []*app.UtilizationReportItem{}
+	for rows.Next() {
+		item := &app.UtilizationReportItem{}
+		var allTimeUnits float64
+		err = rows.Scan(&item.Consumer, &item.ServiceCode, &item.RemainingUnits, &item.UsedUnits, &allTimeUnits)
+		if err != nil {
+			return nil, err
+		}
+		item.AuthorizedUnits = item.RemainingUnits + allTimeUnits
+		if item.AuthorizedUnits > 0 {
+			item.Utilization = item.UsedUnits / item.AuthorizedUnits * 100
+		}
+		coll = append(coll, item)
+	}
+	return coll, nil
+}
+
+// Only admins and supervisors can see the reports.
+func (r *Report) authorize(ctx context.Context) error {
+	p := PrincipalFromContext(ctx)
+	if p == nil {
+		return ErrNoPrincipal
+	}
+	if p.AuthLevel != AuthLevelAdmin && p.AuthLevel != AuthLevelSupervisor {
+		return errors.New("Only an admin or a supervisor can see the reports!")
+	}
+	return nil
+}
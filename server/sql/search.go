@@ -0,0 +1,159 @@
+package sql
+
+import (
+	"context"
+	mysql "database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/btoll/cpss/server/app"
+)
+
+// What can be searched.
+const (
+	SearchConsumer   = "consumer"
+	SearchSpecialist = "specialist"
+	SearchBillSheet  = "billsheet"
+)
+
+type SearchQuery struct {
+	Terms     string
+	Types     []string
+	Limit     int
+	Principal *Principal
+}
+
+type Search struct {
+	db *mysql.DB
+}
+
+func NewSearch(db *mysql.DB) *Search {
+	return &Search{db: db}
+}
+
+// Every statement takes the boolean mode query twice (once to rank and once to match) and the prefix
+// of the whole query as many times as it has `LIKE`s.  A prefix match of one of the codes is worth
+// more than any full-text match, since a code is only ever typed on purpose.
+var searchStmt = struct {
+	BillSheet  string
+	Consumer   string
+	Specialist string
+}{
+	BillSheet:  "SELECT billsheet.id,CONCAT(DATE_FORMAT(billsheet.serviceDate, '%%m/%%d/%%y'),' ',consumer.lastname,', ',consumer.firstname),IFNULL(billsheet.confirmation,''),MATCH(billsheet.description,billsheet.confirmation) AGAINST(? IN BOOLEAN MODE) + IF(billsheet.confirmation LIKE ?, 10, 0) AS score FROM billsheet INNER JOIN consumer ON consumer.id = billsheet.consumer WHERE (MATCH(billsheet.description,billsheet.confirmation) AGAINST(? IN BOOLEAN MODE) OR billsheet.confirmation LIKE ?) %s ORDER BY score DESC LIMIT %d",
+	Consumer:   "SELECT consumer.id,CONCAT(consumer.lastname,', ',consumer.firstname),CONCAT_WS(' ',consumer.recipientID,consumer.bsu),MATCH(consumer.firstname,consumer.lastname,consumer.recipientID,consumer.bsu) AGAINST(? IN BOOLEAN MODE) + IF(consumer.recipientID LIKE ? OR consumer.bsu LIKE ?, 10, 0) AS score FROM consumer WHERE (MATCH(consumer.firstname,consumer.lastname,consumer.recipientID,consumer.bsu) AGAINST(? IN BOOLEAN MODE) OR consumer.recipientID LIKE ? OR consumer.bsu LIKE ?) %s ORDER BY score DESC LIMIT %d",
+	Specialist: "SELECT specialist.id,CONCAT(specialist.lastname,', ',specialist.firstname),IFNULL(specialist.email,''),MATCH(specialist.firstname,specialist.lastname,specialist.email) AGAINST(? IN BOOLEAN MODE) + IF(specialist.email LIKE ?, 10, 0) AS score FROM specialist WHERE (MATCH(specialist.firstname,specialist.lastname,specialist.email) AGAINST(? IN BOOLEAN MODE) OR specialist.email LIKE ?) %s ORDER BY score DESC LIMIT %d",
+}
+
+func init() {
+	registerStmts("Search", searchStmt)
+}
+
+func (s *Search) Search(ctx context.Context, query *SearchQuery) (_ []*app.SearchResultItem, err error) {
+	defer logError(ctx, "Search", &err)
+	return s.search(ctx, s.db, query)
+}
+
+// Turns what the client typed into a boolean mode query where every word is a prefix, so `smi jo`
+// finds John Smith.  The words are only letters and digits, so nothing that the client types can be
+// read as one of the operators of boolean mode.
+func booleanQuery(terms string) string {
+	words := strings.FieldsFunc(terms, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, word := range words {
+		words[i] = word + "*"
+	}
+	return strings.Join(words, " ")
+}
+
+// Returns the `LIKE` pattern that matches anything that starts with the whole query.
+func prefixPattern(terms string) string {
+	r := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+	return r.Replace(strings.TrimSpace(terms)) + "%"
+}
+
+// Returns the results of one type, best first.  The scope is always applied.
+func (s *Search) searchType(ctx context.Context, db *mysql.DB, query *SearchQuery, kind, stmt, scope string, args []interface{}) ([]*app.SearchResultItem, error) {
+	whereClause := ""
+	if scope != "" {
+		whereClause = fmt.Sprintf("AND %s", scope)
+	}
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(stmt, whereClause, query.Limit), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	coll := []*app.SearchResultItem{}
+	for rows.Next() {
+		var id int
+		var title string
+		var detail string
+		var score float64
+		err = rows.Scan(&id, &title, &detail, &score)
+		if err != nil {
+			return nil, err
+		}
+		coll = append(coll, &app.SearchResultItem{
+			Type:   kind,
+			ID:     id,
+			Title:  title,
+			Detail: &detail,
+			Score:  score,
+		})
+	}
+	return coll, rows.Err()
+}
+
+// Every type is searched on its own and then the results are ranked together.
+func (s *Search) search(ctx context.Context, db *mysql.DB, query *SearchQuery) ([]*app.SearchResultItem, error) {
+	boolean := booleanQuery(query.Terms)
+	if boolean == "" {
+		return nil, errors.New("Please search for at least one word!")
+	}
+	prefix := prefixPattern(query.Terms)
+	types := query.Types
+	if len(types) == 0 {
+		types = []string{SearchConsumer, SearchSpecialist, SearchBillSheet}
+	}
+	coll := []*app.SearchResultItem{}
+	for _, kind := range types {
+		var stmt string
+		var scope string
+		var args []interface{}
+		var err error
+		switch kind {
+		case SearchConsumer:
+			stmt = searchStmt.Consumer
+			scope, err = query.Principal.ConsumerScope()
+			args = []interface{}{boolean, prefix, prefix, boolean, prefix, prefix}
+		case SearchSpecialist:
+			stmt = searchStmt.Specialist
+			scope, err = query.Principal.SpecialistScope()
+			args = []interface{}{boolean, prefix, boolean, prefix}
+		case SearchBillSheet:
+			stmt = searchStmt.BillSheet
+			scope, err = query.Principal.BillSheetScope()
+			args = []interface{}{boolean, prefix, boolean, prefix}
+		default:
+			return nil, fmt.Errorf("Bad type: cannot search for %s", kind)
+		}
+		if err != nil {
+			return nil, err
+		}
+		results, err := s.searchType(ctx, db, query, kind, stmt, scope, args)
+		if err != nil {
+			return nil, err
+		}
+		coll = append(coll, results...)
+	}
+	sort.SliceStable(coll, func(i, j int) bool {
+		return coll[i].Score > coll[j].Score
+	})
+	if len(coll) > query.Limit {
+		coll = coll[:query.Limit]
+	}
+	return coll, nil
+}
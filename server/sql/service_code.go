@@ -1,114 +1,91 @@
 package sql
 
 import (
+	"context"
 	mysql "database/sql"
-	"fmt"
 
 	"github.com/btoll/cpss/server/app"
 )
 
+var ServiceCodeTable = &LookupTable{
+	Table: "service_code",
+	Label: "Service Code",
+	Columns: []LookupColumn{
+		{"unitRate", float64(0)},
+		{"description", ""},
+	},
+	Sorts: map[string]sortKey{
+		"id":       {[]string{"id"}, ""},
+		"name":     {[]string{"name"}, ""},
+		"unitRate": {[]string{"unitRate"}, ""},
+	},
+	DefaultSort: "-name",
+}
+
 type ServiceCode struct {
-	Data interface{}
-	Stmt map[string]string
+	lookup *Lookup
 }
 
-func NewServiceCode(payload interface{}) *ServiceCode {
-	return &ServiceCode{
-		Data: payload,
-		Stmt: map[string]string{
-			"DELETE": "DELETE FROM service_code WHERE id=?",
-			"INSERT": "INSERT service_code SET name=?,unitRate=?,description=?",
-			"SELECT": "SELECT %s FROM service_code ORDER BY name DESC",
-			"UPDATE": "UPDATE service_code SET name=?,unitRate=?,description=? WHERE id=?",
-		},
-	}
+func NewServiceCode(db *mysql.DB) *ServiceCode {
+	return &ServiceCode{lookup: NewLookup(ServiceCodeTable, db)}
 }
 
-func (s *ServiceCode) Create(db *mysql.DB) (interface{}, error) {
-	payload := s.Data.(*app.ServiceCodePayload)
-	stmt, err := db.Prepare(s.Stmt["INSERT"])
-	if err != nil {
-		return -1, err
-	}
-	res, err := stmt.Exec(payload.Name, payload.UnitRate, payload.Description)
-	if err != nil {
-		return -1, err
-	}
-	id, err := res.LastInsertId()
-	if err != nil {
-		return -1, err
-	}
+func serviceCodeMedia(row *LookupRow) *app.ServiceCodeMedia {
 	return &app.ServiceCodeMedia{
-		ID:          int(id),
-		Name:        payload.Name,
-		UnitRate:    payload.UnitRate,
-		Description: payload.Description,
-	}, nil
+		ID:          row.ID,
+		Name:        row.Name,
+		UnitRate:    row.Values[0].(float64),
+		Description: row.Values[1].(string),
+	}
 }
 
-func (s *ServiceCode) Update(db *mysql.DB) (interface{}, error) {
-	payload := s.Data.(*app.ServiceCodePayload)
-	stmt, err := db.Prepare(s.Stmt["UPDATE"])
+func (s *ServiceCode) Create(ctx context.Context, payload *app.ServiceCodePayload) (*app.ServiceCodeMedia, error) {
+	row, err := s.lookup.Create(ctx, &LookupRow{Name: payload.Name, Values: []interface{}{payload.UnitRate, payload.Description}})
 	if err != nil {
 		return nil, err
 	}
+	return serviceCodeMedia(row), nil
+}
 
-	_, err = stmt.Exec(payload.Name, payload.UnitRate, payload.Description, payload.ID)
-	if err != nil {
-		return nil, err
-	}
-	return &app.ServiceCodeMedia{
-		ID:          *payload.ID,
-		Name:        payload.Name,
-		UnitRate:    payload.UnitRate,
-		Description: payload.Description,
-	}, nil
+func (s *ServiceCode) Delete(ctx context.Context, id int) error {
+	return s.lookup.Delete(ctx, id)
 }
 
-func (s *ServiceCode) Delete(db *mysql.DB) error {
-	stmt, err := db.Prepare(s.Stmt["DELETE"])
+func (s *ServiceCode) List(ctx context.Context) (app.ServiceCodeMediaCollection, error) {
+	rows, err := s.lookup.List(ctx)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	coll := make(app.ServiceCodeMediaCollection, len(rows))
+	for i, row := range rows {
+		coll[i] = serviceCodeMedia(row)
 	}
-	id := s.Data.(int)
-	_, err = stmt.Exec(&id)
-	return err
+	return coll, nil
 }
 
-func (s *ServiceCode) List(db *mysql.DB) (interface{}, error) {
-	rows, err := db.Query(fmt.Sprintf(s.Stmt["SELECT"], "COUNT(*)"))
+// Only the fields that are given are changed.
+func (s *ServiceCode) Patch(ctx context.Context, payload *app.ServiceCodePatchPayload) (*app.ServiceCodeMedia, error) {
+	row, err := s.lookup.Patch(ctx, *payload.ID, func(row *LookupRow) {
+		if payload.Name != nil {
+			row.Name = *payload.Name
+		}
+		if payload.UnitRate != nil {
+			row.Values[0] = *payload.UnitRate
+		}
+		if payload.Description != nil {
+			row.Values[1] = *payload.Description
+		}
+	})
 	if err != nil {
 		return nil, err
 	}
-	var count int
-	for rows.Next() {
-		err = rows.Scan(&count)
-		if err != nil {
-			return nil, err
-		}
-	}
-	rows, err = db.Query(fmt.Sprintf(s.Stmt["SELECT"], "*"))
+	return serviceCodeMedia(row), nil
+}
+
+func (s *ServiceCode) Update(ctx context.Context, payload *app.ServiceCodePayload) (*app.ServiceCodeMedia, error) {
+	row, err := s.lookup.Update(ctx, &LookupRow{ID: intOrZero(payload.ID), Name: payload.Name, Values: []interface{}{payload.UnitRate, payload.Description}})
 	if err != nil {
 		return nil, err
 	}
-	coll := make(app.ServiceCodeMediaCollection, count)
-	i := 0
-	for rows.Next() {
-		var id int
-		var name string
-		var unitRate float64
-		var description string
-		err = rows.Scan(&id, &name, &unitRate, &description)
-		if err != nil {
-			return nil, err
-		}
-		coll[i] = &app.ServiceCodeMedia{
-			ID:          id,
-			Name:        name,
-			UnitRate:    unitRate,
-			Description: description,
-		}
-		i++
-	}
-	return coll, nil
+	return serviceCodeMedia(row), nil
 }
@@ -1,6 +1,8 @@
 package sql
 
 import (
+	"context"
+	mysql "database/sql"
 	"errors"
 	"fmt"
 	"time"
@@ -11,72 +13,225 @@ import (
 
 var SessionLength = 3600
 
-func CheckSession(userID int) error {
-	rec, err := Read(NewSpecialist(userID))
+// Logs in, keeps the sessions going and ends them.
+type Session struct {
+	db *mysql.DB
+}
+
+func NewSession(db *mysql.DB) *Session {
+	return &Session{db: db}
+}
+
+// Starts a session and returns its token.  Only a hash of the token is kept.  The specialist's login time
+// is when the session started.
+func (s *Session) Start(ctx context.Context, specialist int) (_ string, err error) {
+	defer logError(ctx, "Start Session", &err)
+	token, err := newToken()
 	if err != nil {
-		return err
+		return "", err
 	}
-	record := rec.(*app.SpecialistMedia)
-	if !record.Active {
-		return errors.New("Bad session")
+	now := int(time.Now().Unix())
+	_, err = s.db.ExecContext(ctx, "UPDATE specialist SET loginTime=? WHERE id=?", now, specialist)
+	if err != nil {
+		return "", err
 	}
-	if (int(time.Now().Unix()) - record.LoginTime) > SessionLength {
-		return errors.New("Session expired")
+	_, err = s.db.ExecContext(ctx, "INSERT login_session SET specialist=?,tokenHash=?,createdTime=?,lastSeen=?", specialist, hashToken(token), now, now)
+	if err != nil {
+		return "", err
 	}
-	return nil
+	return token, nil
+}
+
+// Returns who the token belongs to, and keeps the session going.  A token that's expired, unknown or
+// belongs to an inactive specialist is an error.
+func (s *Session) Authenticate(ctx context.Context, token string) (_ *Principal, err error) {
+	defer logError(ctx, "Authenticate Session", &err)
+	now := int(time.Now().Unix())
+	p := &Principal{}
+	err = s.db.QueryRowContext(ctx, "SELECT specialist.id,specialist.authLevel FROM login_session INNER JOIN specialist ON login_session.specialist = specialist.id WHERE tokenHash=? AND lastSeen > ? AND specialist.active=1", hashToken(token), now-SessionLength).Scan(&p.ID, &p.AuthLevel)
+	if err == mysql.ErrNoRows {
+		return nil, ErrNoPrincipal
+	}
+	if err != nil {
+		return nil, err
+	}
+	_, err = s.db.ExecContext(ctx, "UPDATE login_session SET lastSeen=? WHERE tokenHash=?", now, hashToken(token))
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
 }
 
-func SaltAndHash(pwd string) []byte {
-	byteHash, err := bcrypt.GenerateFromPassword([]byte(pwd), bcrypt.DefaultCost)
+// Ends every session that has gone on longer than SessionLength.  Returns how many were ended.
+func (s *Session) Expire(ctx context.Context) (_ int, err error) {
+	defer logError(ctx, "Expire Session", &err)
+	res, err := s.db.ExecContext(ctx, "UPDATE specialist SET loginTime=0 WHERE loginTime > 0 AND loginTime < ?", int(time.Now().Unix())-SessionLength)
 	if err != nil {
-		fmt.Println(err)
-		return []byte("Something went terribly wrong")
+		return 0, err
 	}
-	return byteHash
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	sessionsExpired.Add(float64(affected))
+	_, err = s.db.ExecContext(ctx, "DELETE FROM login_session WHERE lastSeen < ?", int(time.Now().Unix())-SessionLength)
+	return int(affected), err
 }
 
-func VerifyPassword(username, password string) (interface{}, error) {
-	db, err := connect()
+// Only an admin principal gets through.
+func RequireAdmin(ctx context.Context) error {
+	p := PrincipalFromContext(ctx)
+	if p == nil {
+		return ErrNoPrincipal
+	}
+	if p.AuthLevel != AuthLevelAdmin || p.Challenge {
+		return errors.New("Only an admin can do that!")
+	}
+	return nil
+}
+
+// Only the specialist themselves or an admin gets through.  A login challenge is only ever good for the
+// specialist it was given to.
+func RequireSelfOrAdmin(ctx context.Context, id int) error {
+	p := PrincipalFromContext(ctx)
+	if p == nil {
+		return ErrNoPrincipal
+	}
+	if p.ID != id && (p.AuthLevel != AuthLevelAdmin || p.Challenge) {
+		return errors.New("You can only do that for yourself!")
+	}
+	return nil
+}
+
+// A password that can't be hashed is an error rather than a hash that nothing matches.
+func SaltAndHash(pwd string) ([]byte, error) {
+	return bcrypt.GenerateFromPassword([]byte(pwd), PasswordCost)
+}
+
+// Every failed login gets the same error, so that it can't be used to find out whether a username exists
+// or whether an account is locked.
+var ErrBadLogin = errors.New("Bad username or password")
+
+// After this many failed logins in a row the account is locked for LockoutLength seconds.
+var MaxFailedLogins = 5
+var LockoutLength = 900
+
+// A hash to compare against when the username doesn't exist, so that a bad username takes as long as a
+// bad password.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not a password"), bcrypt.DefaultCost)
+
+func isLockedOut(ctx context.Context, db *mysql.DB, specialist int) (bool, error) {
+	rows, err := db.QueryContext(ctx, "SELECT lockedUntil FROM login_attempt WHERE specialist=?", specialist)
 	if err != nil {
 		return false, err
 	}
-	stmt, err := db.Prepare("SELECT * FROM specialist WHERE username=?")
+	defer rows.Close()
+	var lockedUntil int
+	for rows.Next() {
+		err = rows.Scan(&lockedUntil)
+		if err != nil {
+			return false, err
+		}
+	}
+	return lockedUntil > int(time.Now().Unix()), nil
+}
+
+// Counts a failed login, and locks the account once there have been too many.  The count starts over
+// after the lockout.
+func recordFailedLogin(ctx context.Context, db *mysql.DB, specialist int) error {
+	failedLogins.Inc()
+	now := int(time.Now().Unix())
+	_, err := db.ExecContext(ctx, "INSERT login_attempt SET specialist=?,failures=1,lastFailure=? ON DUPLICATE KEY UPDATE failures=failures+1,lastFailure=?", specialist, now, now)
 	if err != nil {
-		return nil, err // "Bad username or password"
+		return err
 	}
-	row := stmt.QueryRow(&username)
+	_, err = db.ExecContext(ctx, "UPDATE login_attempt SET failures=0,lockedUntil=? WHERE specialist=? AND failures >= ?", now+LockoutLength, specialist, MaxFailedLogins)
+	return err
+}
+
+func clearFailedLogins(ctx context.Context, db *mysql.DB, specialist int) error {
+	_, err := db.ExecContext(ctx, "DELETE FROM login_attempt WHERE specialist=?", specialist)
+	return err
+}
+
+// Unlocks an account and forgets its failed logins.  Only an admin can unlock an account.
+func (s *Specialist) Unlock(ctx context.Context, specialist int) (err error) {
+	defer logError(ctx, "Unlock Specialist", &err)
+	if err := RequireAdmin(ctx); err != nil {
+		return err
+	}
+	return clearFailedLogins(ctx, s.db, specialist)
+}
+
+// The columns of a session, in the order that scanSession expects them.
+const sessionColumns = "id,username,password,IFNULL(firstname,''),IFNULL(lastname,''),active,IFNULL(email,''),payrate,authLevel"
+
+func scanSession(row *mysql.Row) (*app.SessionMedia, error) {
+	session := &app.SessionMedia{}
+	err := row.Scan(&session.ID, &session.Username, &session.Password, &session.Firstname, &session.Lastname, &session.Active, &session.Email, &session.Payrate, &session.AuthLevel)
 	if err != nil {
 		return nil, err
 	}
-	var id int
-	var saltedHash string
-	var firstname string
-	var lastname string
-	var active bool
-	var email string
-	var payrate float64
-	var authLevel int
-	var loginTime int
-	err = row.Scan(&id, &username, &saltedHash, &firstname, &lastname, &active, &email, &payrate, &authLevel, &loginTime)
+	return session, nil
+}
+
+// Returns the session of a specialist who has already been authenticated.
+func (s *Session) Read(ctx context.Context, id int) (_ *app.SessionMedia, err error) {
+	defer logError(ctx, "Read Session", &err)
+	session, err := scanSession(s.db.QueryRowContext(ctx, fmt.Sprintf("SELECT %s FROM specialist WHERE id=?", sessionColumns), id))
 	if err != nil {
 		return nil, err
 	}
-	if !active {
-		return nil, errors.New("This account has been deactivated")
+	// The hash never leaves the server.
+	session.Password = ""
+	return session, nil
+}
+
+// Checks the password of a specialist by id, counting a bad password as a failed login.
+func checkPassword(ctx context.Context, db *mysql.DB, id int, password string) error {
+	session, err := scanSession(db.QueryRowContext(ctx, fmt.Sprintf("SELECT %s FROM specialist WHERE id=?", sessionColumns), id))
+	if err == mysql.ErrNoRows {
+		return ErrBadLogin
+	}
+	if err != nil {
+		return err
 	}
-	err = bcrypt.CompareHashAndPassword([]byte(saltedHash), []byte(password))
+	locked, err := isLockedOut(ctx, db, id)
 	if err != nil {
+		return err
+	}
+	err = bcrypt.CompareHashAndPassword([]byte(session.Password), []byte(password))
+	if locked || !session.Active {
+		return ErrBadLogin
+	}
+	if err != nil {
+		if err = recordFailedLogin(ctx, db, id); err != nil {
+			return err
+		}
+		return ErrBadLogin
+	}
+	return nil
+}
+
+// Returns the session of the specialist whose password it is.  A bad username or password is ErrBadLogin.
+func (s *Session) VerifyPassword(ctx context.Context, username, password string) (_ *app.SessionMedia, err error) {
+	defer logError(ctx, "VerifyPassword Session", &err)
+	session, err := scanSession(s.db.QueryRowContext(ctx, fmt.Sprintf("SELECT %s FROM specialist WHERE username=?", sessionColumns), username))
+	if err == mysql.ErrNoRows {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return nil, ErrBadLogin
+	}
+	if err != nil {
+		return nil, err
+	}
+	// The failed logins aren't forgotten until the second step is done too, see TwoFactor.Start.
+	if err = checkPassword(ctx, s.db, session.ID, password); err != nil {
+		return nil, err
+	}
+	if err = upgradePasswordCost(ctx, s.db, session.ID, session.Password, password); err != nil {
 		return nil, err
 	}
-	return &app.SessionMedia{
-		ID:        id,
-		Username:  username,
-		Password:  saltedHash,
-		Firstname: firstname,
-		Lastname:  lastname,
-		Active:    active,
-		Email:     email,
-		Payrate:   payrate,
-		AuthLevel: authLevel,
-	}, nil
+	// The hash never leaves the server.
+	session.Password = ""
+	return session, nil
 }
@@ -0,0 +1,59 @@
+package sql
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRequireSelfOrAdmin(t *testing.T) {
+	tests := []struct {
+		name string
+		p    *Principal
+		id   int
+		ok   bool
+	}{
+		{name: "themselves", p: &Principal{ID: 7, AuthLevel: AuthLevelUser}, id: 7, ok: true},
+		{name: "someone else", p: &Principal{ID: 7, AuthLevel: AuthLevelUser}, id: 8},
+		{name: "a supervisor for someone else", p: &Principal{ID: 7, AuthLevel: AuthLevelSupervisor}, id: 8},
+		{name: "an admin for someone else", p: &Principal{ID: 1, AuthLevel: AuthLevelAdmin}, id: 8, ok: true},
+		{name: "a challenge for themselves", p: &Principal{ID: 1, AuthLevel: AuthLevelAdmin, Challenge: true}, id: 1, ok: true},
+		{name: "an admin's challenge for someone else", p: &Principal{ID: 1, AuthLevel: AuthLevelAdmin, Challenge: true}, id: 8},
+		{name: "nobody", id: 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.p != nil {
+				ctx = WithPrincipal(ctx, tt.p)
+			}
+			if err := RequireSelfOrAdmin(ctx, tt.id); tt.ok != (err == nil) {
+				t.Errorf("RequireSelfOrAdmin(%d) error = %v, want ok %v", tt.id, err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestRequireAdmin(t *testing.T) {
+	tests := []struct {
+		name string
+		p    *Principal
+		ok   bool
+	}{
+		{name: "an admin", p: &Principal{ID: 1, AuthLevel: AuthLevelAdmin}, ok: true},
+		{name: "a supervisor", p: &Principal{ID: 2, AuthLevel: AuthLevelSupervisor}},
+		{name: "a user", p: &Principal{ID: 3, AuthLevel: AuthLevelUser}},
+		{name: "an admin's challenge", p: &Principal{ID: 1, AuthLevel: AuthLevelAdmin, Challenge: true}},
+		{name: "nobody"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.p != nil {
+				ctx = WithPrincipal(ctx, tt.p)
+			}
+			if err := RequireAdmin(ctx); tt.ok != (err == nil) {
+				t.Errorf("RequireAdmin() error = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
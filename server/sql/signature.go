@@ -0,0 +1,248 @@
+package sql
+
+import (
+	"context"
+	"crypto/sha256"
+	mysql "database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/btoll/cpss/server/app"
+)
+
+type Signature struct {
+	db *mysql.DB
+}
+
+func NewSignature(db *mysql.DB) *Signature {
+	return &Signature{db: db}
+}
+
+var signatureStmt = struct {
+	Insert          string
+	Invalidate      string
+	Select          string
+	SelectBillSheet string
+	SelectSigners   string
+}{
+	Insert:          "INSERT billsheet_signature SET billsheet=?,role=?,signer=?,signerName=?,method=?,data=?,signedAt=?,contentHash=?,valid=1",
+	Invalidate:      "UPDATE billsheet_signature SET valid=0 WHERE billsheet=? AND contentHash<>?",
+	Select:          "SELECT %s FROM billsheet_signature WHERE billsheet=%d ORDER BY signedAt",
+	SelectBillSheet: "SELECT specialist,consumer,units,serviceDate,serviceCode,IFNULL(description,'') FROM billsheet WHERE id=%d",
+	SelectSigners:   "SELECT billsheet.specialist,CONCAT_WS(' ',specialist.firstname,specialist.lastname),CONCAT_WS(' ',consumer.firstname,consumer.lastname) FROM billsheet INNER JOIN specialist ON specialist.id = billsheet.specialist INNER JOIN consumer ON consumer.id = billsheet.consumer WHERE billsheet.id=?",
+}
+
+func init() {
+	registerStmts("Signature", signatureStmt)
+}
+
+func (s *Signature) Create(ctx context.Context, payload *app.SignaturePayload) (_ *app.SignatureMedia, err error) {
+	defer logError(ctx, "Create Signature", &err)
+	if err = (&BillSheet{}).CheckScope(ctx, s.db, PrincipalFromContext(ctx), payload.Billsheet); err != nil {
+		return nil, err
+	}
+	return s.create(ctx, s.db, payload)
+}
+
+func (s *Signature) Read(ctx context.Context, billsheet int) (_ app.SignatureMediaCollection, err error) {
+	defer logError(ctx, "Read Signature", &err)
+	if err = (&BillSheet{}).CheckScope(ctx, s.db, PrincipalFromContext(ctx), billsheet); err != nil {
+		return nil, err
+	}
+	return s.read(ctx, s.db, billsheet)
+}
+
+func (s *Signature) Verify(ctx context.Context, billsheet int) (_ app.SignatureMediaCollection, err error) {
+	defer logError(ctx, "Verify Signature", &err)
+	if err = (&BillSheet{}).CheckScope(ctx, s.db, PrincipalFromContext(ctx), billsheet); err != nil {
+		return nil, err
+	}
+	return s.verify(ctx, s.db, billsheet)
+}
+
+// Hashes the parts of the billsheet that are attested to by a signature.  Note that the billing fields
+// (status, billedAmount and confirmation) are deliberately left out since they change after the service
+// has been signed for.
+func (s *Signature) HashBillSheet(ctx context.Context, db Queryer, id int) (string, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(signatureStmt.SelectBillSheet, id))
+	if err != nil {
+		return "", err
+	}
+	var count int
+	var specialist int
+	var consumer int
+	var units float64
+	var serviceDate string
+	var serviceCode int
+	var description string
+	for rows.Next() {
+		err = rows.Scan(&specialist, &consumer, &units, &serviceDate, &serviceCode, &description)
+		if err != nil {
+			return "", err
+		}
+		count++
+	}
+	if count == 0 {
+		return "", errors.New("There is no BillSheet with that id!")
+	}
+	notes, err := (&BillSheet{}).GetNotes(ctx, db, id)
+	if err != nil {
+		return "", err
+	}
+	sort.Slice(notes, func(i, j int) bool {
+		return notes[i].Field < notes[j].Field
+	})
+	h := sha256.New()
+	fmt.Fprintf(h, "%d|%d|%d|%s|%s|%d|%s", id, specialist, consumer, floatToString(units), serviceDate, serviceCode, description)
+	for _, note := range notes {
+		fmt.Fprintf(h, "|%s=%s", note.Field, note.Value)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Any signature whose hash no longer matches the billsheet contents is no longer valid.
+func (s *Signature) InvalidateSignatures(ctx context.Context, db Queryer, billsheet int) error {
+	contentHash, err := s.HashBillSheet(ctx, db, billsheet)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, signatureStmt.Invalidate, billsheet, contentHash)
+	return err
+}
+
+func (s *Signature) GetSignatures(ctx context.Context, db *mysql.DB, billsheet int) (app.SignatureMediaCollection, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(signatureStmt.Select, "COUNT(*)", billsheet))
+	if err != nil {
+		return nil, err
+	}
+	var count int
+	for rows.Next() {
+		err = rows.Scan(&count)
+		if err != nil {
+			return nil, err
+		}
+	}
+	rows, err = db.QueryContext(ctx, fmt.Sprintf(signatureStmt.Select, "id,billsheet,role,signer,signerName,method,data,signedAt,contentHash,valid", billsheet))
+	if err != nil {
+		return nil, err
+	}
+	coll := make(app.SignatureMediaCollection, count)
+	i := 0
+	for rows.Next() {
+		var id int
+		var billsheet int
+		var role string
+		var signer mysql.NullInt64
+		var signerName string
+		var method string
+		var data string
+		var signedAt int
+		var contentHash string
+		var valid bool
+		err = rows.Scan(&id, &billsheet, &role, &signer, &signerName, &method, &data, &signedAt, &contentHash, &valid)
+		if err != nil {
+			return nil, err
+		}
+		coll[i] = &app.SignatureMedia{
+			ID:          id,
+			Billsheet:   billsheet,
+			Role:        role,
+			SignerName:  signerName,
+			Method:      method,
+			Data:        data,
+			SignedAt:    signedAt,
+			ContentHash: contentHash,
+			Valid:       valid,
+		}
+		if signer.Valid {
+			n := int(signer.Int64)
+			coll[i].Signer = &n
+		}
+		i++
+	}
+	return coll, nil
+}
+
+// The signer is never taken from the client.  The specialist attestation is made by whoever is logged in,
+// which has to be the specialist that provided the service, and a consumer signature is in the name of the
+// consumer on the billsheet.
+func (s *Signature) create(ctx context.Context, db *mysql.DB, payload *app.SignaturePayload) (*app.SignatureMedia, error) {
+	p := PrincipalFromContext(ctx)
+	if p == nil {
+		return nil, ErrNoPrincipal
+	}
+	var specialist int
+	var specialistName string
+	var consumerName string
+	err := db.QueryRowContext(ctx, signatureStmt.SelectSigners, payload.Billsheet).Scan(&specialist, &specialistName, &consumerName)
+	if err == mysql.ErrNoRows {
+		return nil, errors.New("There is no BillSheet with that id!")
+	}
+	if err != nil {
+		return nil, err
+	}
+	var signer *int
+	signerName := consumerName
+	if payload.Role == "specialist" {
+		if p.ID != specialist || p.Challenge {
+			return nil, errors.New("Only the Specialist on this BillSheet can attest to it!")
+		}
+		id := p.ID
+		signer = &id
+		signerName = specialistName
+	}
+	contentHash, err := s.HashBillSheet(ctx, db, payload.Billsheet)
+	if err != nil {
+		return nil, err
+	}
+	stmt, err := db.PrepareContext(ctx, signatureStmt.Insert)
+	if err != nil {
+		return nil, err
+	}
+	signedAt := int(time.Now().Unix())
+	res, err := stmt.ExecContext(ctx, payload.Billsheet, payload.Role, signer, signerName, payload.Method, payload.Data, signedAt, contentHash)
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return &app.SignatureMedia{
+		ID:          int(id),
+		Billsheet:   payload.Billsheet,
+		Role:        payload.Role,
+		Signer:      signer,
+		SignerName:  signerName,
+		Method:      payload.Method,
+		Data:        payload.Data,
+		SignedAt:    signedAt,
+		ContentHash: contentHash,
+		Valid:       true,
+	}, nil
+}
+
+// Signatures are an audit trail, they can't be edited or deleted, only invalidated by editing the billsheet.
+func (s *Signature) read(ctx context.Context, db *mysql.DB, billsheet int) (app.SignatureMediaCollection, error) {
+	return s.GetSignatures(ctx, db, billsheet)
+}
+
+// Recomputes the hash of the billsheet and checks it against every signature.  A signature is only
+// valid if it hasn't been invalidated and the billsheet contents haven't changed since it was made.
+func (s *Signature) verify(ctx context.Context, db *mysql.DB, billsheet int) (app.SignatureMediaCollection, error) {
+	contentHash, err := s.HashBillSheet(ctx, db, billsheet)
+	if err != nil {
+		return nil, err
+	}
+	coll, err := s.GetSignatures(ctx, db, billsheet)
+	if err != nil {
+		return nil, err
+	}
+	for _, signature := range coll {
+		signature.Valid = signature.Valid && signature.ContentHash == contentHash
+	}
+	return coll, nil
+}
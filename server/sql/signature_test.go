@@ -0,0 +1,67 @@
+package sql
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"github.com/btoll/cpss/server/app"
+)
+
+func TestSignatureCreate(t *testing.T) {
+	tests := []struct {
+		name       string
+		p          *Principal
+		role       string
+		ok         bool
+		signer     int
+		signerName string
+	}{
+		{name: "the specialist attests", p: &Principal{ID: 7, AuthLevel: AuthLevelUser}, role: "specialist", ok: true, signer: 7, signerName: "John Smith"},
+		{name: "an admin attests", p: &Principal{ID: 1, AuthLevel: AuthLevelAdmin}, role: "specialist"},
+		{name: "the consumer signs", p: &Principal{ID: 7, AuthLevel: AuthLevelUser}, role: "consumer", ok: true, signerName: "Jane Doe"},
+		{name: "out of scope", p: &Principal{ID: 8, AuthLevel: AuthLevelUser}, role: "consumer"},
+		{name: "nobody", role: "consumer"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script := &fakeScript{
+				Query: func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+					switch {
+					case strings.Contains(query, "COUNT(*)"):
+						count := int64(0)
+						if strings.Contains(query, "billsheet.specialist=7") {
+							count = 1
+						}
+						return []string{"COUNT(*)"}, [][]driver.Value{{count}}, nil
+					case strings.HasPrefix(query, "SELECT billsheet.specialist"):
+						return []string{"specialist", "specialistName", "consumerName"}, [][]driver.Value{{int64(7), "John Smith", "Jane Doe"}}, nil
+					case strings.HasPrefix(query, "SELECT specialist,consumer"):
+						return []string{"specialist", "consumer", "units", "serviceDate", "serviceCode", "description"}, [][]driver.Value{{int64(7), int64(3), 1.0, "2026-10-01", int64(2), ""}}, nil
+					}
+					return nil, nil, nil
+				},
+			}
+			db := openFake(t, script)
+			ctx := context.Background()
+			if tt.p != nil {
+				ctx = WithPrincipal(ctx, tt.p)
+			}
+			// The client's signer is ignored.
+			signature, err := NewSignature(db).Create(ctx, &app.SignaturePayload{Billsheet: 1, Role: tt.role, Method: "typed", Data: "Someone Else"})
+			if tt.ok != (err == nil) {
+				t.Fatalf("Create() error = %v, want ok %v", err, tt.ok)
+			}
+			if err != nil {
+				return
+			}
+			if signature.SignerName != tt.signerName {
+				t.Errorf("Create() signer name = %q, want %q", signature.SignerName, tt.signerName)
+			}
+			if (signature.Signer != nil) != (tt.signer != 0) || (signature.Signer != nil && *signature.Signer != tt.signer) {
+				t.Errorf("Create() signer = %v, want %d", signature.Signer, tt.signer)
+			}
+		})
+	}
+}
@@ -1,46 +1,153 @@
 package sql
 
 import (
+	"context"
 	mysql "database/sql"
 	"errors"
 	"fmt"
-	"math"
 	"time"
 
 	"github.com/btoll/cpss/server/app"
 )
 
 type Specialist struct {
-	Data interface{}
-	Stmt map[string]string
+	db *mysql.DB
 }
 
-func NewSpecialist(payload interface{}) *Specialist {
-	return &Specialist{
-		Data: payload,
-		Stmt: map[string]string{
-			"DELETE":             "DELETE FROM specialist WHERE id=?",
-			"INSERT":             "INSERT specialist SET username=?,password=?,firstname=?,lastname=?,active=?,email=?,payrate=?,authLevel=?",
-			"INSERT_PAY_HISTORY": "INSERT pay_history VALUES (NULL, ?, ?, ?)",
-			"SELECT":             "SELECT %s FROM specialist %s",
-			"UPDATE":             "UPDATE specialist SET username=?,password=?,firstname=?,lastname=?,active=?,email=?,payrate=?,authLevel=?,loginTime=? WHERE id=?",
-		},
+func NewSpecialist(db *mysql.DB) *Specialist {
+	return &Specialist{db: db}
+}
+
+var specialistStmt = struct {
+	Delete           string
+	Insert           string
+	InsertPayHistory string
+	Select           string
+	Update           string
+}{
+	Delete:           "DELETE FROM specialist WHERE id=?",
+	Insert:           "INSERT specialist SET username=?,password=?,firstname=?,lastname=?,active=?,email=?,payrate=?,authLevel=?",
+	InsertPayHistory: "INSERT pay_history VALUES (NULL, ?, ?, ?)",
+	Select:           "SELECT %s FROM specialist %s",
+	Update:           "UPDATE specialist SET username=?,firstname=?,lastname=?,active=?,email=?,payrate=?,authLevel=?,loginTime=? WHERE id=?",
+}
+
+func init() {
+	registerStmts("Specialist", specialistStmt)
+}
+
+func (s *Specialist) Create(ctx context.Context, payload *app.SpecialistPayload) (_ *app.SpecialistMedia, err error) {
+	defer logError(ctx, "Create Specialist", &err)
+	return s.create(ctx, s.db, payload)
+}
+
+func (s *Specialist) Delete(ctx context.Context, id int) (err error) {
+	defer logError(ctx, "Delete Specialist", &err)
+	return s.delete(ctx, s.db, id)
+}
+
+func (s *Specialist) Export(ctx context.Context, query *SpecialistExportQuery, w RowWriter) (err error) {
+	defer logError(ctx, "Export Specialist", &err)
+	return s.export(ctx, s.db, query, w)
+}
+
+func (s *Specialist) List(ctx context.Context) (_ []*app.SpecialistItem, err error) {
+	defer logError(ctx, "List Specialist", &err)
+	return s.list(ctx, s.db)
+}
+
+func (s *Specialist) Page(ctx context.Context, query *SpecialistPageQuery) (_ *app.SpecialistMediaPaging, err error) {
+	defer logError(ctx, "Page Specialist", &err)
+	return s.page(ctx, s.db, query)
+}
+
+func (s *Specialist) Patch(ctx context.Context, payload *app.SpecialistPatchPayload) (_ *app.SpecialistMedia, err error) {
+	defer logError(ctx, "Patch Specialist", &err)
+	return s.patch(ctx, s.db, payload)
+}
+
+func (s *Specialist) Read(ctx context.Context, id int) (_ *app.SpecialistMedia, err error) {
+	defer logError(ctx, "Read Specialist", &err)
+	return s.read(ctx, s.db, id)
+}
+
+func (s *Specialist) Update(ctx context.Context, payload *app.SpecialistPayload) (_ *app.SpecialistMedia, err error) {
+	defer logError(ctx, "Update Specialist", &err)
+	return s.update(ctx, s.db, payload)
+}
+
+// The keys that a specialist can be sorted by.  Never the password!
+var specialistSorts = map[string]sortKey{
+	"id":        {[]string{"id"}, ""},
+	"name":      {[]string{"lastname", "firstname"}, ""},
+	"username":  {[]string{"username"}, ""},
+	"firstname": {[]string{"firstname"}, ""},
+	"lastname":  {[]string{"lastname"}, ""},
+	"active":    {[]string{"active"}, ""},
+	"email":     {[]string{"email"}, ""},
+	"payrate":   {[]string{"payrate"}, ""},
+	"authLevel": {[]string{"authLevel"}, ""},
+	"loginTime": {[]string{"loginTime"}, ""},
+}
+
+// The columns of an export.  Note that the password is never exported!
+const specialistExportColumns = "id,username,CONCAT(lastname,', ',firstname) AS fullname,IF(active=1,'Yes','No') AS active,email,payrate," +
+	"(SELECT level FROM auth_level WHERE auth_level.id = specialist.authLevel) AS authLevelName," +
+	"IF(loginTime=0,'',FROM_UNIXTIME(loginTime, '%m/%d/%y %H:%i')) AS lastLogin"
+
+var specialistExportHeader = []string{"ID", "Username", "Name", "Active", "Email", "Payrate", "Auth Level", "Last Login"}
+
+// Whether the principal can see the specialist, i.e., themselves, their team for a supervisor or anyone
+// for an admin.
+func canSeeSpecialist(ctx context.Context, db Queryer, principal *Principal, id int) (bool, error) {
+	scope, err := principal.SpecialistScope()
+	if err != nil {
+		return false, err
+	}
+	if scope == "" {
+		return true, nil
 	}
+	var count int
+	err = db.QueryRowContext(ctx, fmt.Sprintf("SELECT COUNT(*) FROM specialist WHERE specialist.id=? AND %s", scope), id).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
 }
 
 // Add an entry to the pay_history table with the initial payrate.
-func (s *Specialist) AddPayHistoryEntry(db *mysql.DB, id int64, payrate float64) error {
-	stmt, err := db.Prepare(s.Stmt["INSERT_PAY_HISTORY"])
+func (s *Specialist) AddPayHistoryEntry(ctx context.Context, db *mysql.DB, id int64, payrate float64) error {
+	stmt, err := db.PrepareContext(ctx, specialistStmt.InsertPayHistory)
 	if err != nil {
 		return err
 	}
-	_, err = stmt.Exec(id, getToday(), payrate)
+	_, err = stmt.ExecContext(ctx, id, getToday(), payrate)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// Only adds an entry to the pay_history table when the payrate has actually changed.
+func (s *Specialist) UpdatePayHistory(ctx context.Context, db *mysql.DB, id int, newPayrate float64) error {
+	row, err := db.QueryContext(ctx, fmt.Sprintf(specialistStmt.Select, "payrate", fmt.Sprintf("WHERE id=%d", id)))
+	if err != nil {
+		return err
+	}
+	var payrate float64
+	for row.Next() {
+		err := row.Scan(&payrate)
+		if err != nil {
+			return err
+		}
+	}
+	if payrate != newPayrate {
+		return s.AddPayHistoryEntry(ctx, db, int64(id), newPayrate)
+	}
+	return nil
+}
+
+// Note that the password hash is scanned but never returned, it never leaves the server.
 func (s *Specialist) CollectRows(rows *mysql.Rows, coll []*app.SpecialistItem) error {
 	i := 0
 	for rows.Next() {
@@ -62,7 +169,7 @@ func (s *Specialist) CollectRows(rows *mysql.Rows, coll []*app.SpecialistItem) e
 		coll[i] = &app.SpecialistItem{
 			ID:          id,
 			Username:    username,
-			Password:    password,
+			Password:    "",
 			Firstname:   firstname,
 			Lastname:    lastname,
 			Active:      active,
@@ -77,9 +184,15 @@ func (s *Specialist) CollectRows(rows *mysql.Rows, coll []*app.SpecialistItem) e
 	return nil
 }
 
-func (s *Specialist) Create(db *mysql.DB) (interface{}, error) {
-	payload := s.Data.(*app.SpecialistPayload)
-	rows, err := db.Query(fmt.Sprintf(s.Stmt["SELECT"], "COUNT(*)", fmt.Sprintf("WHERE username='%s'", payload.Username)))
+// Only an admin can change what a specialist is allowed to do, what they're paid and whether they can log
+// in.  Anyone else can only change their own name, username and email.
+var errSpecialistAdminFields = errors.New("Only an admin can change the auth level, payrate or active of a Specialist!")
+
+func (s *Specialist) create(ctx context.Context, db *mysql.DB, payload *app.SpecialistPayload) (*app.SpecialistMedia, error) {
+	if err := RequireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(specialistStmt.Select, "COUNT(*)", fmt.Sprintf("WHERE username='%s'", payload.Username)))
 	if err != nil {
 		return nil, err
 	}
@@ -93,7 +206,7 @@ func (s *Specialist) Create(db *mysql.DB) (interface{}, error) {
 	if count > 0 {
 		return nil, errors.New("That username is already taken!")
 	}
-	rows, err = db.Query(fmt.Sprintf(s.Stmt["SELECT"], "COUNT(*)", fmt.Sprintf("WHERE firstname='%s' AND lastname='%s'", payload.Firstname, payload.Lastname)))
+	rows, err = db.QueryContext(ctx, fmt.Sprintf(specialistStmt.Select, "COUNT(*)", fmt.Sprintf("WHERE firstname='%s' AND lastname='%s'", payload.Firstname, payload.Lastname)))
 	if err != nil {
 		return nil, err
 	}
@@ -106,26 +219,32 @@ func (s *Specialist) Create(db *mysql.DB) (interface{}, error) {
 	if count > 0 {
 		return nil, errors.New("There is already a Specialist by that name!")
 	}
-	stmt, err := db.Prepare(s.Stmt["INSERT"])
+	if err = CheckPasswordPolicy(payload.Username, payload.Password); err != nil {
+		return nil, err
+	}
+	stmt, err := db.PrepareContext(ctx, specialistStmt.Insert)
 	if err != nil {
-		return -1, err
+		return nil, err
 	}
-	saltedHash := SaltAndHash(payload.Password)
-	res, err := stmt.Exec(payload.Username, saltedHash, payload.Firstname, payload.Lastname, payload.Active, payload.Email, payload.Payrate, payload.AuthLevel)
+	saltedHash, err := SaltAndHash(payload.Password)
 	if err != nil {
-		return -1, err
+		return nil, err
+	}
+	res, err := stmt.ExecContext(ctx, payload.Username, saltedHash, payload.Firstname, payload.Lastname, payload.Active, payload.Email, payload.Payrate, payload.AuthLevel)
+	if err != nil {
+		return nil, err
 	}
 	id, err := res.LastInsertId()
 	if err != nil {
-		return -1, err
+		return nil, err
 	}
-	if err = s.AddPayHistoryEntry(db, id, payload.Payrate); err != nil {
-		return -1, err
+	if err = s.AddPayHistoryEntry(ctx, db, id, payload.Payrate); err != nil {
+		return nil, err
 	}
 	return &app.SpecialistMedia{
 		ID:        int(id),
 		Username:  payload.Username,
-		Password:  string(saltedHash),
+		Password:  "",
 		Firstname: payload.Firstname,
 		Lastname:  payload.Lastname,
 		Active:    payload.Active,
@@ -135,8 +254,8 @@ func (s *Specialist) Create(db *mysql.DB) (interface{}, error) {
 	}, nil
 }
 
-func (s *Specialist) Read(db *mysql.DB) (interface{}, error) {
-	row, err := db.Query(fmt.Sprintf(s.Stmt["SELECT"], "*", fmt.Sprintf("WHERE id=%d", s.Data.(int))))
+func (s *Specialist) read(ctx context.Context, db *mysql.DB, id int) (*app.SpecialistMedia, error) {
+	row, err := db.QueryContext(ctx, fmt.Sprintf(specialistStmt.Select, "*", fmt.Sprintf("WHERE id=%d", id)))
 	if err != nil {
 		return nil, err
 	}
@@ -159,7 +278,7 @@ func (s *Specialist) Read(db *mysql.DB) (interface{}, error) {
 		specialist = &app.SpecialistMedia{
 			ID:          id,
 			Username:    username,
-			Password:    password,
+			Password:    "",
 			Firstname:   firstname,
 			Lastname:    lastname,
 			Active:      active,
@@ -173,58 +292,127 @@ func (s *Specialist) Read(db *mysql.DB) (interface{}, error) {
 	return specialist, nil
 }
 
-func (s *Specialist) Update(db *mysql.DB) (interface{}, error) {
-	payload := s.Data.(*app.SpecialistPayload)
-	row, err := db.Query(fmt.Sprintf(s.Stmt["SELECT"], "payrate", fmt.Sprintf("WHERE id=%d", *payload.ID)))
+// The password isn't changed by an update, see ChangePassword.  Neither is the login time unless an admin
+// is doing it.
+func (s *Specialist) update(ctx context.Context, db *mysql.DB, payload *app.SpecialistPayload) (*app.SpecialistMedia, error) {
+	if err := RequireSelfOrAdmin(ctx, *payload.ID); err != nil {
+		return nil, err
+	}
+	current, err := s.read(ctx, db, *payload.ID)
 	if err != nil {
 		return nil, err
 	}
-	var payrate float64
-	for row.Next() {
-		err := row.Scan(&payrate)
-		if err != nil {
-			return nil, err
-		}
+	if current == nil {
+		return nil, errors.New("There is no Specialist with that id!")
 	}
-	if payrate != payload.Payrate {
-		if err = s.AddPayHistoryEntry(db, int64(*payload.ID), payload.Payrate); err != nil {
-			return nil, err
+	loginTime := payload.LoginTime
+	if RequireAdmin(ctx) != nil {
+		if payload.AuthLevel != current.AuthLevel || payload.Payrate != current.Payrate || payload.Active != current.Active {
+			return nil, errSpecialistAdminFields
 		}
+		loginTime = current.LoginTime
+	}
+	err = s.UpdatePayHistory(ctx, db, *payload.ID, payload.Payrate)
+	if err != nil {
+		return nil, err
 	}
-	stmt, err := db.Prepare(s.Stmt["UPDATE"])
+	stmt, err := db.PrepareContext(ctx, specialistStmt.Update)
 	if err != nil {
 		return nil, err
 	}
-	_, err = stmt.Exec(payload.Username, payload.Password, payload.Firstname, payload.Lastname, payload.Active, payload.Email, payload.Payrate, payload.AuthLevel, payload.LoginTime, payload.ID)
+	_, err = stmt.ExecContext(ctx, payload.Username, payload.Firstname, payload.Lastname, payload.Active, payload.Email, payload.Payrate, payload.AuthLevel, loginTime, payload.ID)
 	if err != nil {
 		return nil, err
 	}
 	return &app.SpecialistMedia{
 		ID:        *payload.ID,
 		Username:  payload.Username,
-		Password:  payload.Password,
+		Password:  "",
 		Firstname: payload.Firstname,
 		Lastname:  payload.Lastname,
 		Active:    payload.Active,
 		Email:     payload.Email,
 		Payrate:   payload.Payrate,
 		AuthLevel: payload.AuthLevel,
-		LoginTime: payload.LoginTime,
+		LoginTime: loginTime,
 	}, nil
 }
 
-func (s *Specialist) Delete(db *mysql.DB) error {
-	stmt, err := db.Prepare(s.Stmt["DELETE"])
+func (s *Specialist) patch(ctx context.Context, db *mysql.DB, payload *app.SpecialistPatchPayload) (*app.SpecialistMedia, error) {
+	if err := RequireSelfOrAdmin(ctx, *payload.ID); err != nil {
+		return nil, err
+	}
+	if payload.AuthLevel != nil || payload.Payrate != nil || payload.Active != nil || payload.LoginTime != nil {
+		if err := RequireAdmin(ctx); err != nil {
+			return nil, errSpecialistAdminFields
+		}
+	}
+	if payload.Payrate != nil {
+		if err := s.UpdatePayHistory(ctx, db, *payload.ID, *payload.Payrate); err != nil {
+			return nil, err
+		}
+	}
+	p := &columnPatch{}
+	p.Set("username", payload.Username)
+	p.Set("firstname", payload.Firstname)
+	p.Set("lastname", payload.Lastname)
+	p.Set("active", payload.Active)
+	p.Set("email", payload.Email)
+	p.Set("payrate", payload.Payrate)
+	p.Set("authLevel", payload.AuthLevel)
+	p.Set("loginTime", payload.LoginTime)
+	if err := p.Exec(ctx, db, "specialist", *payload.ID); err != nil {
+		return nil, err
+	}
+	return s.read(ctx, db, *payload.ID)
+}
+
+func (s *Specialist) delete(ctx context.Context, db *mysql.DB, id int) error {
+	if err := RequireAdmin(ctx); err != nil {
+		return err
+	}
+	stmt, err := db.PrepareContext(ctx, specialistStmt.Delete)
 	if err != nil {
 		return err
 	}
-	id := s.Data.(int)
-	_, err = stmt.Exec(&id)
+	_, err = stmt.ExecContext(ctx, &id)
 	return err
 }
 
-func (s *Specialist) List(db *mysql.DB) (interface{}, error) {
-	rows, err := db.Query(fmt.Sprintf(s.Stmt["SELECT"], "COUNT(*)", "WHERE active=1"))
+type SpecialistPageQuery struct {
+	PageQuery
+	Filter *app.SpecialistQueryPayload
+}
+
+type SpecialistExportQuery struct {
+	ExportQuery
+	Filter *app.SpecialistQueryPayload
+}
+
+// Returns the WHERE clause of the structured filters and its arguments.
+func (s *Specialist) GetFilter(filter *app.SpecialistQueryPayload) (string, []interface{}) {
+	if filter == nil {
+		return "", nil
+	}
+	return nameFilter(filter.Active, filter.Lastname, filter.Firstname)
+}
+
+// Exports every specialist that the page action would return, in the same order.  The export has the
+// payrates of everyone, so only an admin can export.
+func (s *Specialist) export(ctx context.Context, db *mysql.DB, query *SpecialistExportQuery, w RowWriter) error {
+	if err := RequireAdmin(ctx); err != nil {
+		return err
+	}
+	filter, args := s.GetFilter(query.Filter)
+	whereClause := ""
+	if filter != "" {
+		whereClause = fmt.Sprintf("WHERE %s", filter)
+	}
+	return exportRows(ctx, db, fmt.Sprintf(specialistStmt.Select, specialistExportColumns, fmt.Sprintf("%s ORDER BY fullname ASC", whereClause)), specialistExportHeader, w, args...)
+}
+
+func (s *Specialist) list(ctx context.Context, db *mysql.DB) ([]*app.SpecialistItem, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(specialistStmt.Select, "COUNT(*)", "WHERE active=1"))
 	if err != nil {
 		return nil, err
 	}
@@ -235,7 +423,7 @@ func (s *Specialist) List(db *mysql.DB) (interface{}, error) {
 			return nil, err
 		}
 	}
-	rows, err = db.Query(fmt.Sprintf(s.Stmt["SELECT"], "*, CONCAT(lastname,', ',firstname) AS fullname", "WHERE active=1 ORDER BY fullname ASC"))
+	rows, err = db.QueryContext(ctx, fmt.Sprintf(specialistStmt.Select, "*, CONCAT(lastname,', ',firstname) AS fullname", "WHERE active=1 ORDER BY fullname ASC"))
 	if err != nil {
 		return nil, err
 	}
@@ -247,16 +435,22 @@ func (s *Specialist) List(db *mysql.DB) (interface{}, error) {
 	return coll, nil
 }
 
-func (s *Specialist) Page(db *mysql.DB) (interface{}, error) {
-	query := s.Data.(*PageQuery)
-	limit := query.Page * RecordsPerPage
-	var whereClause string
-	if query.WhereClause == "" {
-		whereClause = ""
-	} else {
-		whereClause = fmt.Sprintf("WHERE %s", query.WhereClause)
+func (s *Specialist) page(ctx context.Context, db *mysql.DB, query *SpecialistPageQuery) (*app.SpecialistMediaPaging, error) {
+	perPage, err := query.GetPerPage()
+	if err != nil {
+		return nil, err
+	}
+	offset := query.Page * perPage
+	_, orderBy, sort, err := query.GetSort(specialistSorts, "name", "id")
+	if err != nil {
+		return nil, err
+	}
+	filter, args := s.GetFilter(query.Filter)
+	whereClause := ""
+	if filter != "" {
+		whereClause = fmt.Sprintf("WHERE %s", filter)
 	}
-	rows, err := db.Query(fmt.Sprintf(s.Stmt["SELECT"], "COUNT(*)", whereClause))
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(specialistStmt.Select, "COUNT(*)", whereClause), args...)
 	if err != nil {
 		return nil, err
 	}
@@ -267,24 +461,13 @@ func (s *Specialist) Page(db *mysql.DB) (interface{}, error) {
 			return nil, err
 		}
 	}
-	rows, err = db.Query(fmt.Sprintf(s.Stmt["SELECT"], "*, CONCAT(lastname,', ',firstname) AS fullname", fmt.Sprintf("%s ORDER BY fullname ASC LIMIT %d,%d", whereClause, limit, RecordsPerPage)))
+	rows, err = db.QueryContext(ctx, fmt.Sprintf(specialistStmt.Select, "*, CONCAT(lastname,', ',firstname) AS fullname", fmt.Sprintf("%s ORDER BY %s LIMIT %d,%d", whereClause, orderBy, offset, perPage)), args...)
 	if err != nil {
 		return nil, err
 	}
-	// Only the amount of rows equal to RecordsPerPage unless the last page has been requested
-	// (determined by `totalCount - limit`).
-	capacity := totalCount - limit
-	if capacity >= RecordsPerPage {
-		capacity = RecordsPerPage
-	}
 	paging := &app.SpecialistMediaPaging{
-		Pager: &app.Pager{
-			CurrentPage:    limit / RecordsPerPage,
-			RecordsPerPage: RecordsPerPage,
-			TotalCount:     totalCount,
-			TotalPages:     int(math.Ceil(float64(totalCount) / float64(RecordsPerPage))),
-		},
-		Users: make([]*app.SpecialistItem, capacity),
+		Pager: newPager(&query.PageQuery, perPage, totalCount, sort),
+		Users: make([]*app.SpecialistItem, pageCapacity(totalCount, offset, perPage)),
 	}
 	err = s.CollectRows(rows, paging.Users)
 	if err != nil {
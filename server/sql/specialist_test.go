@@ -0,0 +1,119 @@
+package sql
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"github.com/btoll/cpss/server/app"
+)
+
+func TestSpecialistPatch(t *testing.T) {
+	user := &Principal{ID: 7, AuthLevel: AuthLevelUser}
+	admin := &Principal{ID: 1, AuthLevel: AuthLevelAdmin}
+	name := "Smith"
+	authLevel := AuthLevelAdmin
+	payrate := 99.0
+	active := false
+	tests := []struct {
+		name    string
+		p       *Principal
+		payload *app.SpecialistPatchPayload
+		ok      bool
+	}{
+		{name: "own name", p: user, payload: &app.SpecialistPatchPayload{Lastname: &name}, ok: true},
+		{name: "someone else's name", p: user, payload: &app.SpecialistPatchPayload{ID: intPtr(8), Lastname: &name}},
+		{name: "own auth level", p: user, payload: &app.SpecialistPatchPayload{AuthLevel: &authLevel}},
+		{name: "own payrate", p: user, payload: &app.SpecialistPatchPayload{Payrate: &payrate}},
+		{name: "own active", p: user, payload: &app.SpecialistPatchPayload{Active: &active}},
+		{name: "an admin's auth level change", p: admin, payload: &app.SpecialistPatchPayload{ID: intPtr(8), AuthLevel: &authLevel}, ok: true},
+		{name: "nobody", payload: &app.SpecialistPatchPayload{Lastname: &name}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.payload.ID == nil {
+				tt.payload.ID = intPtr(7)
+			}
+			script := &fakeScript{}
+			db := openFake(t, script)
+			ctx := context.Background()
+			if tt.p != nil {
+				ctx = WithPrincipal(ctx, tt.p)
+			}
+			_, err := NewSpecialist(db).Patch(ctx, tt.payload)
+			if tt.ok != (err == nil) {
+				t.Fatalf("Patch() error = %v, want ok %v", err, tt.ok)
+			}
+			updated := false
+			for _, stmt := range script.Statements {
+				if strings.HasPrefix(stmt.Query, "UPDATE specialist") {
+					updated = true
+				}
+			}
+			if updated != tt.ok {
+				t.Errorf("Patch() updated the specialist = %v, want %v", updated, tt.ok)
+			}
+		})
+	}
+}
+
+func TestSpecialistUpdate(t *testing.T) {
+	user := &Principal{ID: 7, AuthLevel: AuthLevelUser}
+	admin := &Principal{ID: 1, AuthLevel: AuthLevelAdmin}
+	current := []driver.Value{int64(7), "jsmith", "hash", "John", "Smith", true, "j@example.com", 20.0, int64(AuthLevelUser), int64(1000)}
+	payload := func(change func(p *app.SpecialistPayload)) *app.SpecialistPayload {
+		p := &app.SpecialistPayload{ID: intPtr(7), Username: "jsmith", Firstname: "Johnny", Lastname: "Smith", Active: true, Email: "j@example.com", Payrate: 20, AuthLevel: AuthLevelUser, LoginTime: 5000}
+		if change != nil {
+			change(p)
+		}
+		return p
+	}
+	tests := []struct {
+		name      string
+		p         *Principal
+		payload   *app.SpecialistPayload
+		ok        bool
+		loginTime int64
+	}{
+		{name: "own name", p: user, payload: payload(nil), ok: true, loginTime: 1000},
+		{name: "own auth level", p: user, payload: payload(func(p *app.SpecialistPayload) { p.AuthLevel = AuthLevelAdmin })},
+		{name: "own payrate", p: user, payload: payload(func(p *app.SpecialistPayload) { p.Payrate = 99 })},
+		{name: "own active", p: user, payload: payload(func(p *app.SpecialistPayload) { p.Active = false })},
+		{name: "someone else", p: &Principal{ID: 8, AuthLevel: AuthLevelSupervisor}, payload: payload(nil)},
+		{name: "an admin", p: admin, payload: payload(func(p *app.SpecialistPayload) { p.AuthLevel = AuthLevelAdmin }), ok: true, loginTime: 5000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script := &fakeScript{
+				Query: func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+					if strings.HasPrefix(query, "SELECT * FROM specialist") {
+						return []string{"id", "username", "password", "firstname", "lastname", "active", "email", "payrate", "authLevel", "loginTime"}, [][]driver.Value{current}, nil
+					}
+					return []string{"payrate"}, [][]driver.Value{{20.0}}, nil
+				},
+			}
+			db := openFake(t, script)
+			_, err := NewSpecialist(db).Update(WithPrincipal(context.Background(), tt.p), tt.payload)
+			if tt.ok != (err == nil) {
+				t.Fatalf("Update() error = %v, want ok %v", err, tt.ok)
+			}
+			var update *fakeStatement
+			for i, stmt := range script.Statements {
+				if strings.HasPrefix(stmt.Query, "UPDATE specialist") {
+					update = &script.Statements[i]
+				}
+			}
+			if (update != nil) != tt.ok {
+				t.Fatalf("Update() updated the specialist = %v, want %v", update != nil, tt.ok)
+			}
+			if update != nil && update.Args[7] != tt.loginTime {
+				t.Errorf("Update() login time = %v, want %d", update.Args[7], tt.loginTime)
+			}
+		})
+	}
+}
+
+func intPtr(n int) *int {
+	return &n
+}
@@ -1,132 +1,335 @@
 package sql
 
 import (
+	"context"
 	mysql "database/sql"
 	"fmt"
+	"reflect"
+	"strings"
 	"time"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/btoll/cpss/server/app"
+	"github.com/goadesign/goa"
 )
 
-type CRUD interface {
-	Create(db *mysql.DB) (interface{}, error)
-	Update(db *mysql.DB) (interface{}, error)
-	Delete(db *mysql.DB) error
+// The repositories of the resources.  Each one is made once with the pool that the service opens when it
+// starts, and is handed to the controllers that need it, so a controller can be given a fake one instead.
+// Every method logs its own error.
+
+type BillSheetRepository interface {
+	Bulk(ctx context.Context, query *BulkQuery) ([]*app.TransitionResultItem, error)
+	Create(ctx context.Context, payload *app.BillSheetPayload) (*app.BillSheetMedia, error)
+	Delete(ctx context.Context, id int) error
+	Export(ctx context.Context, query *BillSheetExportQuery, w RowWriter) error
+	List(ctx context.Context, principal *Principal) ([]*app.BillSheetItem, error)
+	Page(ctx context.Context, query *BillSheetPageQuery) (*app.BillSheetMediaPaging, error)
+	Patch(ctx context.Context, payload *app.BillSheetPatchPayload) (*app.BillSheetMedia, error)
+	Read(ctx context.Context, id int) (*app.BillSheetMedia, error)
+	Transition(ctx context.Context, query *TransitionQuery) ([]*app.TransitionResultItem, error)
+	Update(ctx context.Context, payload *app.BillSheetPayload) (*app.BillSheetMedia, error)
 }
 
-type Hasher interface {
-	SaltAndHash(pwd []byte) string
+type CaseloadRepository interface {
+	Create(ctx context.Context, payload *app.CaseloadPayload) (*app.CaseloadMedia, error)
+	Delete(ctx context.Context, id int) error
+	List(ctx context.Context) ([]*app.CaseloadItem, error)
+	Page(ctx context.Context, query *CaseloadPageQuery) (*app.CaseloadMediaPaging, error)
+	Patch(ctx context.Context, payload *app.CaseloadPatchPayload) (*app.CaseloadMedia, error)
+	Update(ctx context.Context, payload *app.CaseloadPayload) (*app.CaseloadMedia, error)
+}
+
+type ConsumerRepository interface {
+	// Returns the id of the new consumer.
+	Create(ctx context.Context, payload *app.ConsumerPayload) (int, error)
+	Delete(ctx context.Context, id int) error
+	Export(ctx context.Context, query *ConsumerExportQuery, w RowWriter) error
+	// Only the consumers currently assigned to the principal when `mine` is set.
+	List(ctx context.Context, mine bool) ([]*app.ConsumerItem, error)
+	Page(ctx context.Context, query *ConsumerPageQuery) (*app.ConsumerMediaPaging, error)
+	Patch(ctx context.Context, payload *app.ConsumerPatchPayload) (*app.ConsumerMedia, error)
+	Read(ctx context.Context, id int) (*app.ConsumerMedia, error)
+	Update(ctx context.Context, payload *app.ConsumerPayload) (*app.ConsumerMedia, error)
+}
+
+type CountyRepository interface {
+	Create(ctx context.Context, payload *app.CountyPayload) (*app.CountyMedia, error)
+	Delete(ctx context.Context, id int) error
+	List(ctx context.Context) (app.CountyMediaCollection, error)
+	Page(ctx context.Context, query *PageQuery) (*app.CountyMediaPaging, error)
+	Read(ctx context.Context, id int) (*app.CountyMedia, error)
+	Update(ctx context.Context, payload *app.CountyPayload) (*app.CountyMedia, error)
+}
+
+type DIARepository interface {
+	Create(ctx context.Context, payload *app.DIAPayload) (*app.DIAMedia, error)
+	Delete(ctx context.Context, id int) error
+	List(ctx context.Context) (app.DIAMediaCollection, error)
+	Page(ctx context.Context, query *PageQuery) (*app.DIAMediaPaging, error)
+	Update(ctx context.Context, payload *app.DIAPayload) (*app.DIAMedia, error)
+}
+
+type FundingSourceRepository interface {
+	Create(ctx context.Context, payload *app.FundingSourcePayload) (*app.FundingSourceMedia, error)
+	Delete(ctx context.Context, id int) error
+	List(ctx context.Context) (app.FundingSourceMediaCollection, error)
+	Page(ctx context.Context, query *PageQuery) (*app.FundingSourceMediaPaging, error)
+	Update(ctx context.Context, payload *app.FundingSourcePayload) (*app.FundingSourceMedia, error)
+}
+
+type HealthRepository interface {
+	// Returns the version of the schema, which is an error when it's behind SchemaVersion.
+	CheckReady(ctx context.Context) (int, error)
+}
+
+type ImportRepository interface {
+	Import(ctx context.Context, query *ImportQuery) (*app.ImportMedia, error)
+}
+
+type JobRepository interface {
+	// Returns how many billsheets were billed.
+	CloseBillingPeriod(ctx context.Context, before string) (int, error)
+	FinishRun(ctx context.Context, run *app.JobRunMedia, output string, runErr error) error
+	GetLowUnitBlocks(ctx context.Context, threshold float64) ([]string, error)
+	// Lists the most recent runs of a job.
+	List(ctx context.Context, query *JobRunQuery) (app.JobRunMediaCollection, error)
+	Read(ctx context.Context, id int) (*app.JobRunMedia, error)
+	StartRun(ctx context.Context, name, trigger, instance string, ttl time.Duration) (*app.JobRunMedia, error)
+}
+
+type NoteTemplateRepository interface {
+	Delete(ctx context.Context, serviceCode int) error
+	Read(ctx context.Context, serviceCode int) (app.NoteFieldMediaCollection, error)
+	Update(ctx context.Context, payload *app.NoteTemplatePayload) (app.NoteFieldMediaCollection, error)
+}
+
+type NotificationRepository interface {
+	GetAdmins(ctx context.Context) ([]int, error)
+	GetQueuedEmails(ctx context.Context, limit int) ([]*QueuedEmail, error)
+	MarkEmailFailed(ctx context.Context, email *QueuedEmail, sendErr error) error
+	MarkEmailSent(ctx context.Context, email *QueuedEmail) error
+	Notify(ctx context.Context, kind string, specialist int, data map[string]interface{}) error
+	Read(ctx context.Context, specialist int) (*app.NotificationMedia, error)
+	// Returns how many specialists were reminded.
+	SendTimesheetReminders(ctx context.Context) (int, error)
+	Update(ctx context.Context, payload *app.NotificationPayload) (*app.NotificationMedia, error)
+}
+
+type PayHistoryRepository interface {
+	Export(ctx context.Context, query *PayHistoryExportQuery, w RowWriter) error
+	List(ctx context.Context, specialist int) (app.PayHistoryMediaCollection, error)
+}
+
+type ReportRepository interface {
+	Billing(ctx context.Context, query *ReportQuery) ([]*app.BillingReportItem, error)
+	Productivity(ctx context.Context, query *ReportQuery) ([]*app.ProductivityReportItem, error)
+	Utilization(ctx context.Context, query *ReportQuery) ([]*app.UtilizationReportItem, error)
+}
+
+type SessionRepository interface {
+	Authenticate(ctx context.Context, token string) (*Principal, error)
+	// Returns how many sessions were ended.
+	Expire(ctx context.Context) (int, error)
+	Read(ctx context.Context, id int) (*app.SessionMedia, error)
+	RequestPasswordReset(ctx context.Context, username, linkFormat string) error
+	ResetPassword(ctx context.Context, token, password string) error
+	// Returns the token of the new session.
+	Start(ctx context.Context, specialist int) (string, error)
+	VerifyPassword(ctx context.Context, username, password string) (*app.SessionMedia, error)
+}
+
+type SearchRepository interface {
+	Search(ctx context.Context, query *SearchQuery) ([]*app.SearchResultItem, error)
+}
+
+type ServiceCodeRepository interface {
+	Create(ctx context.Context, payload *app.ServiceCodePayload) (*app.ServiceCodeMedia, error)
+	Delete(ctx context.Context, id int) error
+	List(ctx context.Context) (app.ServiceCodeMediaCollection, error)
+	Patch(ctx context.Context, payload *app.ServiceCodePatchPayload) (*app.ServiceCodeMedia, error)
+	Update(ctx context.Context, payload *app.ServiceCodePayload) (*app.ServiceCodeMedia, error)
+}
+
+type SignatureRepository interface {
+	Create(ctx context.Context, payload *app.SignaturePayload) (*app.SignatureMedia, error)
+	Read(ctx context.Context, billsheet int) (app.SignatureMediaCollection, error)
+	Verify(ctx context.Context, billsheet int) (app.SignatureMediaCollection, error)
+}
+
+type SpecialistRepository interface {
+	ChangePassword(ctx context.Context, id int, currentPassword *string, password string) error
+	Create(ctx context.Context, payload *app.SpecialistPayload) (*app.SpecialistMedia, error)
+	Delete(ctx context.Context, id int) error
+	Export(ctx context.Context, query *SpecialistExportQuery, w RowWriter) error
+	List(ctx context.Context) ([]*app.SpecialistItem, error)
+	Page(ctx context.Context, query *SpecialistPageQuery) (*app.SpecialistMediaPaging, error)
+	Patch(ctx context.Context, payload *app.SpecialistPatchPayload) (*app.SpecialistMedia, error)
+	Read(ctx context.Context, id int) (*app.SpecialistMedia, error)
+	Unlock(ctx context.Context, specialist int) error
+	Update(ctx context.Context, payload *app.SpecialistPayload) (*app.SpecialistMedia, error)
 }
 
-type Lister interface {
-	List(db *mysql.DB) (interface{}, error)
+type StatusRepository interface {
+	Create(ctx context.Context, payload *app.StatusPayload) (*app.StatusMedia, error)
+	Delete(ctx context.Context, id int) error
+	List(ctx context.Context) (app.StatusMediaCollection, error)
+	Update(ctx context.Context, payload *app.StatusPayload) (*app.StatusMedia, error)
 }
 
-type Pager interface {
-	Page(db *mysql.DB) (interface{}, error)
+type TwoFactorRepository interface {
+	AuthenticateChallenge(ctx context.Context, challenge string) (*Principal, error)
+	Confirm(ctx context.Context, id int, code string) (*app.TwoFactorMediaRecovery, error)
+	Disable(ctx context.Context, id int, code string) error
+	Enroll(ctx context.Context, id int, password string, code *string) (*app.TwoFactorMediaEnroll, error)
+	Read(ctx context.Context, specialist int) (*app.TwoFactorMedia, error)
+	RegenerateRecoveryCodes(ctx context.Context, id int, code string) (*app.TwoFactorMediaRecovery, error)
+	// Nil when the password is enough.
+	Start(ctx context.Context, id, authLevel int) (*app.SessionChallengeMedia, error)
+	// Returns the id of the specialist.
+	Verify(ctx context.Context, challenge, code string) (int, error)
 }
 
-type Reader interface {
-	Read(db *mysql.DB) (interface{}, error)
+type Hasher interface {
+	SaltAndHash(pwd []byte) string
 }
 
 type Verifier interface {
 	Verify(clearText string) (bool, error)
 }
 
-type PageQuery struct {
-	Page        int
-	WhereClause string
+// Satisfied by both *mysql.DB and *mysql.Tx, so that a statement can be run inside or outside of a transaction.
+type Queryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (mysql.Result, error)
+	PrepareContext(ctx context.Context, query string) (*mysql.Stmt, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*mysql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *mysql.Row
 }
 
-var RecordsPerPage = 50
-
-func cleanup(db *mysql.DB) error {
-	return db.Close()
+// Returned when a record was changed by someone else since the client read it.  The current record is
+// sent back so that the client can merge its changes, it's in the field of its resource.
+type StaleError struct {
+	BillSheet *app.BillSheetMedia
+	Consumer  *app.ConsumerMedia
 }
 
-func connect() (*mysql.DB, error) {
-	return mysql.Open("", "")
+func (e *StaleError) Error() string {
+	return "This record has been changed by someone else, please reload it!"
 }
 
-func getToday() string {
-	today := time.Now()
-	year, month, day := today.Date()
-	// Pad two spaces with leading 0, if needed.
-	return fmt.Sprintf("%d-%02d-%02d", year, month, day)
+// Collects the columns of a sparse UPDATE statement.  Only the values that were given are set, a nil
+// value (or a nil pointer, which is how goa represents an attribute that wasn't sent) is skipped.
+type columnPatch struct {
+	Columns []string
+	Args    []interface{}
 }
 
-func Create(s CRUD) (interface{}, error) {
-	db, err := connect()
-	if err != nil {
-		return -1, err
+func (p *columnPatch) Set(column string, value interface{}) {
+	if value == nil {
+		return
 	}
-	rec, err := s.Create(db)
-	if err != nil {
-		return -1, err
+	if v := reflect.ValueOf(value); v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return
+		}
+		value = v.Elem().Interface()
 	}
-	cleanup(db)
-	return rec, nil
+	p.Columns = append(p.Columns, fmt.Sprintf("%s=?", column))
+	p.Args = append(p.Args, value)
 }
 
-func Read(r Reader) (interface{}, error) {
-	db, err := connect()
-	if err != nil {
-		return nil, err
-	}
-	coll, err := r.Read(db)
-	if err != nil {
-		return nil, err
-	}
-	cleanup(db)
-	return coll, nil
+// Bumps a counter column, such as a record's version, along with the other columns.
+func (p *columnPatch) Increment(column string) {
+	p.Columns = append(p.Columns, fmt.Sprintf("%s=%s+1", column, column))
 }
 
-func Update(s CRUD) (interface{}, error) {
-	db, err := connect()
+func (p *columnPatch) IsEmpty() bool {
+	return len(p.Columns) == 0
+}
+
+// Like Exec, but only if the record is still at the given version.  Returns whether it was.
+func (p *columnPatch) ExecVersion(ctx context.Context, db Queryer, table string, id, version int) (bool, error) {
+	if p.IsEmpty() {
+		return true, nil
+	}
+	res, err := db.ExecContext(ctx, fmt.Sprintf("UPDATE %s SET %s WHERE id=? AND version=?", table, strings.Join(p.Columns, ",")), append(p.Args, id, version)...)
 	if err != nil {
-		return nil, err
+		return false, err
 	}
-	rec, err := s.Update(db)
+	affected, err := res.RowsAffected()
 	if err != nil {
-		return nil, err
+		return false, err
 	}
-	cleanup(db)
-	return rec, nil
+	return affected > 0, nil
 }
 
-func Delete(s CRUD) error {
-	db, err := connect()
-	if err != nil {
-		return err
+func (p *columnPatch) Exec(ctx context.Context, db Queryer, table string, id int) error {
+	if p.IsEmpty() {
+		return nil
 	}
-	err = s.Delete(db)
-	cleanup(db)
-	return nil
+	_, err := db.ExecContext(ctx, fmt.Sprintf("UPDATE %s SET %s WHERE id=?", table, strings.Join(p.Columns, ",")), append(p.Args, id)...)
+	return err
 }
 
-func List(l Lister) (interface{}, error) {
-	db, err := connect()
+// Opens the pool that the repositories share for as long as the service runs.  Its stats are the ones
+// that are reported.
+func Open() (*mysql.DB, error) {
+	db, err := mysql.Open(driverName, "")
 	if err != nil {
 		return nil, err
 	}
-	coll, err := l.List(db)
-	if err != nil {
+	if err := reportPoolStats(db); err != nil {
+		db.Close()
 		return nil, err
 	}
-	cleanup(db)
-	return coll, nil
+	return db, nil
 }
 
-func Page(p Pager) (interface{}, error) {
-	db, err := connect()
+func Close(db *mysql.DB) error {
+	stopPoolStats(db)
+	return db.Close()
+}
+
+func getToday() string {
+	today := time.Now()
+	year, month, day := today.Date()
+	// Pad two spaces with leading 0, if needed.
+	return fmt.Sprintf("%d-%02d-%02d", year, month, day)
+}
+
+// Converts a client date (MM/DD/YY) into the format that MySQL expects (YYYY-MM-DD).  The month and day
+// don't have to be zero-padded, but the result always is so that the dates can be compared as strings.
+// A date that can't be parsed is a bad request.
+func formatDate(date string) (string, error) {
+	t, err := time.Parse("1/2/06", date)
 	if err != nil {
-		return nil, err
+		return "", goa.ErrBadRequest("Bad date: expected MM/DD/YY")
 	}
-	coll, err := p.Page(db)
-	if err != nil {
-		return nil, err
+	return t.Format("2006-01-02"), nil
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// Returns a LIKE pattern that matches anything containing s.  The wildcards in s are escaped, so that they
+// only ever match themselves.
+func likeContains(s string) string {
+	return "%" + likeEscaper.Replace(s) + "%"
+}
+
+// Returns the WHERE clause of the filters that consumers and specialists share, and its arguments.  A
+// filter that isn't given doesn't narrow anything down.
+func nameFilter(active *bool, lastname, firstname *string) (string, []interface{}) {
+	clauses := []string{}
+	args := []interface{}{}
+	if active != nil {
+		clauses = append(clauses, "active = ?")
+		args = append(args, *active)
+	}
+	if lastname != nil && *lastname != "" {
+		clauses = append(clauses, "lastname LIKE ?")
+		args = append(args, likeContains(*lastname))
+	}
+	if firstname != nil && *firstname != "" {
+		clauses = append(clauses, "firstname LIKE ?")
+		args = append(args, likeContains(*firstname))
 	}
-	cleanup(db)
-	return coll, nil
+	return strings.Join(clauses, " AND "), args
 }
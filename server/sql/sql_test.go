@@ -0,0 +1,72 @@
+package sql
+
+import (
+	"testing"
+
+	"github.com/goadesign/goa"
+)
+
+func TestFormatDate(t *testing.T) {
+	tests := []struct {
+		date string
+		want string
+		bad  bool
+	}{
+		{date: "02/01/18", want: "2018-02-01"},
+		{date: "2/1/18", want: "2018-02-01"},
+		{date: "10/1/18", want: "2018-10-01"},
+		{date: "12/31/99", want: "1999-12-31"},
+		{date: "", bad: true},
+		{date: "2018-02-01", bad: true},
+		{date: "13/01/18", bad: true},
+		{date: "02/30/18", bad: true},
+		{date: "1/1/18' OR '1'='1", bad: true},
+		{date: "1/1/18/1", bad: true},
+	}
+	for _, tt := range tests {
+		got, err := formatDate(tt.date)
+		if tt.bad {
+			if err == nil {
+				t.Errorf("formatDate(%q) = %q, want an error", tt.date, got)
+				continue
+			}
+			if e, ok := err.(goa.ServiceError); !ok || e.ResponseStatus() != 400 {
+				t.Errorf("formatDate(%q) error = %v, want a bad request", tt.date, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("formatDate(%q) error = %v", tt.date, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("formatDate(%q) = %q, want %q", tt.date, got, tt.want)
+		}
+	}
+}
+
+// The formatted dates are compared as strings, so they have to sort the same way as the dates.
+func TestFormatDateOrder(t *testing.T) {
+	tests := []struct {
+		earlier string
+		later   string
+	}{
+		{"2/1/18", "10/1/18"},
+		{"9/30/18", "10/1/18"},
+		{"12/31/17", "1/1/18"},
+		{"1/9/18", "1/10/18"},
+	}
+	for _, tt := range tests {
+		earlier, err := formatDate(tt.earlier)
+		if err != nil {
+			t.Fatal(err)
+		}
+		later, err := formatDate(tt.later)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !(earlier < later) {
+			t.Errorf("formatDate(%q) = %q should sort before formatDate(%q) = %q", tt.earlier, earlier, tt.later, later)
+		}
+	}
+}
@@ -1,106 +1,58 @@
 package sql
 
 import (
+	"context"
 	mysql "database/sql"
-	"fmt"
 
 	"github.com/btoll/cpss/server/app"
 )
 
-type Status struct {
-	Data interface{}
-	Stmt map[string]string
+var StatusTable = &LookupTable{
+	Table:       "status",
+	Label:       "Status",
+	DefaultSort: "name",
 }
 
-func NewStatus(payload interface{}) *Status {
-	return &Status{
-		Data: payload,
-		Stmt: map[string]string{
-			"DELETE": "DELETE FROM status WHERE id=?",
-			"INSERT": "INSERT status SET name=?",
-			"SELECT": "SELECT %s FROM status ORDER BY name",
-			"UPDATE": "UPDATE status SET name=? WHERE id=?",
-		},
-	}
+type Status struct {
+	lookup *Lookup
 }
 
-func (s *Status) Create(db *mysql.DB) (interface{}, error) {
-	payload := s.Data.(*app.StatusPayload)
-	stmt, err := db.Prepare(s.Stmt["INSERT"])
-	if err != nil {
-		return -1, err
-	}
-	res, err := stmt.Exec(payload.Name)
-	if err != nil {
-		return -1, err
-	}
-	id, err := res.LastInsertId()
-	if err != nil {
-		return -1, err
-	}
-	return &app.StatusMedia{
-		ID:   int(id),
-		Name: payload.Name,
-	}, nil
+func NewStatus(db *mysql.DB) *Status {
+	return &Status{lookup: NewLookup(StatusTable, db)}
 }
 
-func (s *Status) Update(db *mysql.DB) (interface{}, error) {
-	payload := s.Data.(*app.StatusPayload)
-	stmt, err := db.Prepare(s.Stmt["UPDATE"])
-	if err != nil {
-		return nil, err
-	}
+func statusMedia(row *LookupRow) *app.StatusMedia {
+	return &app.StatusMedia{ID: row.ID, Name: row.Name}
+}
 
-	_, err = stmt.Exec(payload.Name, payload.ID)
+func (s *Status) Create(ctx context.Context, payload *app.StatusPayload) (*app.StatusMedia, error) {
+	row, err := s.lookup.Create(ctx, &LookupRow{Name: payload.Name})
 	if err != nil {
 		return nil, err
 	}
-	return &app.StatusMedia{
-		ID:   *payload.ID,
-		Name: payload.Name,
-	}, nil
+	return statusMedia(row), nil
 }
 
-func (s *Status) Delete(db *mysql.DB) error {
-	stmt, err := db.Prepare(s.Stmt["DELETE"])
-	if err != nil {
-		return err
-	}
-	id := s.Data.(int)
-	_, err = stmt.Exec(&id)
-	return err
+func (s *Status) Delete(ctx context.Context, id int) error {
+	return s.lookup.Delete(ctx, id)
 }
 
-func (s *Status) List(db *mysql.DB) (interface{}, error) {
-	rows, err := db.Query(fmt.Sprintf(s.Stmt["SELECT"], "COUNT(*)"))
+func (s *Status) List(ctx context.Context) (app.StatusMediaCollection, error) {
+	rows, err := s.lookup.List(ctx)
 	if err != nil {
 		return nil, err
 	}
-	var count int
-	for rows.Next() {
-		err = rows.Scan(&count)
-		if err != nil {
-			return nil, err
-		}
+	coll := make(app.StatusMediaCollection, len(rows))
+	for i, row := range rows {
+		coll[i] = statusMedia(row)
 	}
-	rows, err = db.Query(fmt.Sprintf(s.Stmt["SELECT"], "*"))
+	return coll, nil
+}
+
+func (s *Status) Update(ctx context.Context, payload *app.StatusPayload) (*app.StatusMedia, error) {
+	row, err := s.lookup.Update(ctx, &LookupRow{ID: intOrZero(payload.ID), Name: payload.Name})
 	if err != nil {
 		return nil, err
 	}
-	coll := make(app.StatusMediaCollection, count)
-	i := 0
-	for rows.Next() {
-		var id int
-		var name string
-		err = rows.Scan(&id, &name)
-		if err != nil {
-			return nil, err
-		}
-		coll[i] = &app.StatusMedia{
-			ID:   id,
-			Name: name,
-		}
-		i++
-	}
-	return coll, nil
+	return statusMedia(row), nil
 }
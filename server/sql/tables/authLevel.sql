@@ -13,7 +13,8 @@ LOCK TABLES `auth_level` WRITE;
 /*!40000 ALTER TABLE `auth_level` DISABLE KEYS */;
 INSERT INTO `auth_level` VALUES
 	(1,'Admin'),
-	(2,'User');
+	(2,'User'),
+	(3,'Supervisor');
 /*!40000 ALTER TABLE `auth_level` ENABLE KEYS */;
 UNLOCK TABLES;
 
@@ -12,9 +12,12 @@ CREATE TABLE IF NOT EXISTS `billsheet` (
   `status` smallint DEFAULT -1,
   `billedAmount` float DEFAULT 0.0,
   `confirmation` varchar(100) DEFAULT NULL,
-  `description` tinyblob DEFAULT NULL,
+  `description` text DEFAULT NULL,
+  `state` enum('draft','submitted','approved','rejected','billed','paid','denied','void') NOT NULL DEFAULT 'draft',
+  `version` int NOT NULL DEFAULT 1,
   PRIMARY KEY (`id`),
   KEY `ID` (`id`),
+  FULLTEXT KEY `search` (`description`,`confirmation`),
   CONSTRAINT `fkspecialist` FOREIGN KEY (`specialist`) REFERENCES `specialist` (`id`),
   CONSTRAINT `fkconsumer` FOREIGN KEY (`consumer`) REFERENCES `consumer` (`id`)
   /*CONSTRAINT `fkservicecode` FOREIGN KEY (`serviceCode`) REFERENCES `service_code` (`id`),*/
@@ -0,0 +1,15 @@
+USE cpss;
+
+DROP TABLE IF EXISTS `billsheet_note` ;
+
+CREATE TABLE IF NOT EXISTS `billsheet_note` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `billsheet` int(11) NOT NULL,
+  `field` varchar(50) NOT NULL,
+  `value` text DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `ID` (`id`),
+  KEY `billsheet` (`billsheet`),
+  CONSTRAINT `fkbillsheetnote` FOREIGN KEY (`billsheet`) REFERENCES `billsheet` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=latin1 ;
+
@@ -0,0 +1,18 @@
+USE cpss;
+
+DROP TABLE IF EXISTS `billsheet_transition` ;
+
+CREATE TABLE IF NOT EXISTS `billsheet_transition` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `billsheet` int(11) NOT NULL,
+  `fromState` varchar(20) NOT NULL,
+  `toState` varchar(20) NOT NULL,
+  `specialist` int(11) NOT NULL,
+  `comment` text DEFAULT NULL,
+  `transitionTime` int(25) NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `ID` (`id`),
+  KEY `billsheet` (`billsheet`),
+  CONSTRAINT `fkbillsheettransition` FOREIGN KEY (`billsheet`) REFERENCES `billsheet` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=latin1 ;
+
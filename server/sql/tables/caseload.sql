@@ -0,0 +1,18 @@
+USE cpss;
+
+DROP TABLE IF EXISTS `caseload` ;
+
+CREATE TABLE IF NOT EXISTS `caseload` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `specialist` int(11) NOT NULL,
+  `consumer` int(11) NOT NULL,
+  `startDate` date NOT NULL,
+  `endDate` date DEFAULT NULL,
+  `isPrimary` tinyint DEFAULT 0,
+  PRIMARY KEY (`id`),
+  KEY `ID` (`id`),
+  KEY `specialistConsumer` (`specialist`, `consumer`),
+  CONSTRAINT `fkcaseloadspecialist` FOREIGN KEY (`specialist`) REFERENCES `specialist` (`id`),
+  CONSTRAINT `fkcaseloadconsumer` FOREIGN KEY (`consumer`) REFERENCES `consumer` (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=latin1 ;
+
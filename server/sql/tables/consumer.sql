@@ -13,8 +13,10 @@ CREATE TABLE IF NOT EXISTS `consumer` (
   `recipientID` varchar(30) DEFAULT NULL,
   `dia` int(1) DEFAULT NULL,
   `other` tinyblob DEFAULT NULL,
+  `version` int NOT NULL DEFAULT 1,
   PRIMARY KEY (`id`),
-  KEY `ID` (`id`)
+  KEY `ID` (`id`),
+  FULLTEXT KEY `search` (`firstname`,`lastname`,`recipientID`,`bsu`)
   /*CONSTRAINT `fkactive` FOREIGN KEY (`active`) REFERENCES `active` (`active_id`),*/
 ) ENGINE=InnoDB DEFAULT CHARSET=latin1 ;
 
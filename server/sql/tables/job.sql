@@ -0,0 +1,13 @@
+USE cpss;
+
+DROP TABLE IF EXISTS `job` ;
+
+-- A job is locked by the server instance that's running it, so that only one instance runs it at a time.
+-- The lock expires on its own in case the instance dies while holding it.
+CREATE TABLE IF NOT EXISTS `job` (
+  `name` varchar(50) NOT NULL,
+  `lockedBy` varchar(255) DEFAULT NULL,
+  `lockedUntil` int(25) DEFAULT 0,
+  PRIMARY KEY (`name`)
+) ENGINE=InnoDB DEFAULT CHARSET=latin1 ;
+
@@ -0,0 +1,18 @@
+USE cpss;
+
+DROP TABLE IF EXISTS `job_run` ;
+
+CREATE TABLE IF NOT EXISTS `job_run` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `job` varchar(50) NOT NULL,
+  `trigger` enum('schedule','manual') NOT NULL,
+  `status` enum('running','succeeded','failed') NOT NULL DEFAULT 'running',
+  `instance` varchar(255) NOT NULL,
+  `startTime` int(25) NOT NULL,
+  `endTime` int(25) DEFAULT 0,
+  `output` text DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `ID` (`id`),
+  KEY `job` (`job`)
+) ENGINE=InnoDB DEFAULT CHARSET=latin1 ;
+
@@ -0,0 +1,14 @@
+USE cpss;
+
+DROP TABLE IF EXISTS `login_attempt` ;
+
+-- The failed logins since the last good one.  A specialist with too many is locked out until `lockedUntil`.
+CREATE TABLE IF NOT EXISTS `login_attempt` (
+  `specialist` int(11) NOT NULL,
+  `failures` int DEFAULT 0,
+  `lastFailure` int(25) DEFAULT 0,
+  `lockedUntil` int(25) DEFAULT 0,
+  PRIMARY KEY (`specialist`),
+  CONSTRAINT `fkloginattemptspecialist` FOREIGN KEY (`specialist`) REFERENCES `specialist` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=latin1 ;
+
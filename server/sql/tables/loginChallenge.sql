@@ -0,0 +1,17 @@
+USE cpss;
+
+DROP TABLE IF EXISTS `login_challenge` ;
+
+-- Proves that the password was right while waiting for the second factor.
+CREATE TABLE IF NOT EXISTS `login_challenge` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `specialist` int(11) NOT NULL,
+  `tokenHash` char(64) NOT NULL,
+  `expires` int(25) NOT NULL,
+  `usedTime` int(25) DEFAULT 0,
+  PRIMARY KEY (`id`),
+  KEY `ID` (`id`),
+  UNIQUE KEY `tokenHash` (`tokenHash`),
+  CONSTRAINT `fkloginchallengespecialist` FOREIGN KEY (`specialist`) REFERENCES `specialist` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=latin1 ;
+
@@ -0,0 +1,17 @@
+USE cpss;
+
+DROP TABLE IF EXISTS `login_session` ;
+
+-- A session lasts as long as it's used at least once every SessionLength seconds.
+CREATE TABLE IF NOT EXISTS `login_session` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `specialist` int(11) NOT NULL,
+  `tokenHash` char(64) NOT NULL,
+  `createdTime` int(25) NOT NULL,
+  `lastSeen` int(25) NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `ID` (`id`),
+  UNIQUE KEY `tokenHash` (`tokenHash`),
+  CONSTRAINT `fkloginsessionspecialist` FOREIGN KEY (`specialist`) REFERENCES `specialist` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=latin1 ;
+
@@ -0,0 +1,17 @@
+USE cpss;
+
+-- Each service code defines its own progress note template, which is the set of fields below.
+-- The old `appTimeEntry` columns (`Intake`, `PlanI`, `IdSkill`, etc.) are good candidates for field names.
+DROP TABLE IF EXISTS `note_field` ;
+
+CREATE TABLE IF NOT EXISTS `note_field` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `serviceCode` int(11) NOT NULL,
+  `name` varchar(50) NOT NULL,
+  `label` varchar(100) NOT NULL,
+  `required` tinyint DEFAULT 0,
+  PRIMARY KEY (`id`),
+  KEY `ID` (`id`),
+  UNIQUE KEY `serviceCodeName` (`serviceCode`, `name`)
+) ENGINE=InnoDB DEFAULT CHARSET=latin1 ;
+
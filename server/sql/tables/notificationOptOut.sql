@@ -0,0 +1,12 @@
+USE cpss;
+
+DROP TABLE IF EXISTS `notification_opt_out` ;
+
+-- A specialist gets every kind of notification unless they've opted out of it.
+CREATE TABLE IF NOT EXISTS `notification_opt_out` (
+  `specialist` int(11) NOT NULL,
+  `kind` varchar(50) NOT NULL,
+  PRIMARY KEY (`specialist`, `kind`),
+  CONSTRAINT `fkoptoutspecialist` FOREIGN KEY (`specialist`) REFERENCES `specialist` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=latin1 ;
+
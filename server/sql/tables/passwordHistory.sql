@@ -0,0 +1,16 @@
+USE cpss;
+
+DROP TABLE IF EXISTS `password_history` ;
+
+-- The hashes of the last few passwords of each specialist, so that they can't be used again.
+CREATE TABLE IF NOT EXISTS `password_history` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `specialist` int(11) NOT NULL,
+  `password` varchar(255) NOT NULL,
+  `changedTime` int(25) NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `ID` (`id`),
+  KEY `specialist` (`specialist`),
+  CONSTRAINT `fkpasswordhistoryspecialist` FOREIGN KEY (`specialist`) REFERENCES `specialist` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=latin1 ;
+
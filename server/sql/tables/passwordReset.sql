@@ -0,0 +1,18 @@
+USE cpss;
+
+DROP TABLE IF EXISTS `password_reset` ;
+
+-- Only a hash of the token is kept, the token itself is only ever in the email.
+CREATE TABLE IF NOT EXISTS `password_reset` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `specialist` int(11) NOT NULL,
+  `tokenHash` char(64) NOT NULL,
+  `createdTime` int(25) NOT NULL,
+  `expires` int(25) NOT NULL,
+  `usedTime` int(25) DEFAULT 0,
+  PRIMARY KEY (`id`),
+  KEY `ID` (`id`),
+  UNIQUE KEY `tokenHash` (`tokenHash`),
+  CONSTRAINT `fkpasswordresetspecialist` FOREIGN KEY (`specialist`) REFERENCES `specialist` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=latin1 ;
+
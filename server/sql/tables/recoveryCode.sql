@@ -0,0 +1,15 @@
+USE cpss;
+
+DROP TABLE IF EXISTS `recovery_code` ;
+
+CREATE TABLE IF NOT EXISTS `recovery_code` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `specialist` int(11) NOT NULL,
+  `codeHash` char(64) NOT NULL,
+  `usedTime` int(25) DEFAULT 0,
+  PRIMARY KEY (`id`),
+  KEY `ID` (`id`),
+  KEY `specialist` (`specialist`),
+  CONSTRAINT `fkrecoverycodespecialist` FOREIGN KEY (`specialist`) REFERENCES `specialist` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=latin1 ;
+
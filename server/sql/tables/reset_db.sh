@@ -14,5 +14,23 @@ cat active.sql \
     billsheet.sql \
     payHistory.sql \
     unitBlock.sql \
+    caseload.sql \
+    noteField.sql \
+    billsheetNote.sql \
+    billsheetSignature.sql \
+    billsheetTransition.sql \
+    job.sql \
+    jobRun.sql \
+    emailQueue.sql \
+    notificationOptOut.sql \
+    loginAttempt.sql \
+    passwordReset.sql \
+    twoFactor.sql \
+    recoveryCode.sql \
+    loginChallenge.sql \
+    passwordHistory.sql \
+    loginSession.sql \
+    teamMember.sql \
+    schemaVersion.sql \
     | mysql -u btoll -p
 
@@ -0,0 +1,23 @@
+USE cpss;
+
+DROP TABLE IF EXISTS `schema_version` ;
+
+-- Every migration that's been applied.  A fresh database is made at the latest version, so it starts out
+-- with the latest migration already applied.  Bump `sql.SchemaVersion` along with every new migration.
+CREATE TABLE IF NOT EXISTS `schema_version` (
+  `version` int NOT NULL,
+  `description` varchar(255) NOT NULL,
+  `appliedAt` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`version`)
+) ENGINE=InnoDB DEFAULT CHARSET=latin1 ;
+
+INSERT INTO `schema_version` (version, description) VALUES
+	(1, 'search indexes'),
+	(2, 'caseloads'),
+	(3, 'billsheet notes'),
+	(4, 'billsheet signatures'),
+	(5, 'billsheet workflow'),
+	(6, 'record versions'),
+	(7, 'jobs'),
+	(8, 'email notifications'),
+	(9, 'logins and sessions');
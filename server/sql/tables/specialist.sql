@@ -14,7 +14,8 @@ CREATE TABLE IF NOT EXISTS `specialist` (
   `authLevel` int DEFAULT 2,
   `loginTime` int(25) DEFAULT 0,
   PRIMARY KEY (`id`),
-  KEY `ID` (`id`)
+  KEY `ID` (`id`),
+  FULLTEXT KEY `search` (`firstname`,`lastname`,`email`)
 ) ENGINE=InnoDB DEFAULT CHARSET=latin1 ;
 
 --LOCK TABLES `specialist` WRITE;
@@ -0,0 +1,13 @@
+USE cpss;
+
+DROP TABLE IF EXISTS `team_member` ;
+
+-- The specialists that a supervisor looks after.
+CREATE TABLE IF NOT EXISTS `team_member` (
+  `supervisor` int(11) NOT NULL,
+  `specialist` int(11) NOT NULL,
+  PRIMARY KEY (`supervisor`, `specialist`),
+  CONSTRAINT `fkteamsupervisor` FOREIGN KEY (`supervisor`) REFERENCES `specialist` (`id`) ON DELETE CASCADE,
+  CONSTRAINT `fkteamspecialist` FOREIGN KEY (`specialist`) REFERENCES `specialist` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=latin1 ;
+
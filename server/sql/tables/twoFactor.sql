@@ -0,0 +1,16 @@
+USE cpss;
+
+DROP TABLE IF EXISTS `two_factor` ;
+
+-- A TOTP secret isn't used until the specialist has confirmed it with a code.  `lastStep` is the time step
+-- of the last code that was used, so that a code can't be used twice.
+CREATE TABLE IF NOT EXISTS `two_factor` (
+  `specialist` int(11) NOT NULL,
+  `secret` varchar(64) NOT NULL,
+  `enabled` tinyint DEFAULT 0,
+  `enrolledTime` int(25) DEFAULT 0,
+  `lastStep` int(25) DEFAULT 0,
+  PRIMARY KEY (`specialist`),
+  CONSTRAINT `fktwofactorspecialist` FOREIGN KEY (`specialist`) REFERENCES `specialist` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=latin1 ;
+
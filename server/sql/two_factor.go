@@ -0,0 +1,519 @@
+package sql
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	mysql "database/sql"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/btoll/cpss/server/app"
+)
+
+// TOTP as described by RFC 6238, with the defaults that every authenticator app understands: SHA1, six
+// digits and a thirty second step.
+const (
+	totpDigits = 6
+	totpStep   = 30
+	// How many steps either side of now a code is still good for, to allow for clock drift.
+	totpSkew = 1
+)
+
+// The name that authenticator apps show for the account.
+var TOTPIssuer = "CPSS"
+
+// How long the second step of a login can wait after the password.
+var ChallengeLength = 5 * time.Minute
+
+// How many recovery codes are given out at once.
+var RecoveryCodeCount = 10
+
+var b32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func newTOTPSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return b32.EncodeToString(b), nil
+}
+
+func totpCode(secret string, step int64) (string, error) {
+	key, err := b32.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0xf
+	n := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", n%1000000), nil
+}
+
+// Returns the time step that the code belongs to, or -1 if it isn't good for any step close to now.
+func matchTOTP(secret, code string, now time.Time) (int64, error) {
+	current := now.Unix() / totpStep
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		expected, err := totpCode(secret, step)
+		if err != nil {
+			return -1, err
+		}
+		if hmac.Equal([]byte(expected), []byte(code)) {
+			return step, nil
+		}
+	}
+	return -1, nil
+}
+
+func isTOTPCode(code string) bool {
+	if len(code) != totpDigits {
+		return false
+	}
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Recovery codes are given to the specialist as two groups of five, but are compared without the dash
+// and regardless of case.
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.Replace(strings.TrimSpace(code), "-", "", -1))
+}
+
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 5)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	code := fmt.Sprintf("%x", b)
+	return code[:5] + "-" + code[5:], nil
+}
+
+// Returned by the second step of a login when there's no second factor yet.  The challenge can be used
+// to enroll and confirm, and then the login is finished with a code.
+var ErrNotEnrolled = errors.New("Please set up two-factor authentication first!")
+
+// An admin can't log in without a second factor.  Everyone else only needs one if they've enrolled.
+func isTwoFactorRequired(authLevel int) bool {
+	return authLevel == AuthLevelAdmin
+}
+
+type TwoFactor struct {
+	db *mysql.DB
+}
+
+func NewTwoFactor(db *mysql.DB) *TwoFactor {
+	return &TwoFactor{db: db}
+}
+
+var twoFactorStmt = struct {
+	Delete             string
+	DeleteRecovery     string
+	Enable             string
+	InsertChallenge    string
+	InsertRecovery     string
+	Replace            string
+	Select             string
+	SelectChallenge    string
+	SelectEnrolling    string
+	SelectRecoveryLeft string
+	UpdateChallenge    string
+	UpdateRecovery     string
+	UpdateStep         string
+}{
+	Delete:             "DELETE FROM two_factor WHERE specialist=?",
+	DeleteRecovery:     "DELETE FROM recovery_code WHERE specialist=?",
+	Enable:             "UPDATE two_factor SET enabled=1,enrolledTime=? WHERE specialist=?",
+	InsertChallenge:    "INSERT login_challenge SET specialist=?,tokenHash=?,expires=?",
+	InsertRecovery:     "INSERT recovery_code SET specialist=?,codeHash=?",
+	Replace:            "REPLACE two_factor SET specialist=?,secret=?,enabled=0,enrolledTime=0,lastStep=0",
+	Select:             "SELECT secret,enabled,lastStep FROM two_factor WHERE specialist=?",
+	SelectChallenge:    "SELECT specialist FROM login_challenge WHERE tokenHash=? AND usedTime=0 AND expires > ?",
+	SelectEnrolling:    "SELECT specialist.id,specialist.authLevel FROM login_challenge INNER JOIN specialist ON specialist.id = login_challenge.specialist LEFT JOIN two_factor ON two_factor.specialist = login_challenge.specialist WHERE tokenHash=? AND usedTime=0 AND expires > ? AND specialist.active=1 AND IFNULL(two_factor.enabled,0)=0",
+	SelectRecoveryLeft: "SELECT COUNT(*) FROM recovery_code WHERE specialist=? AND usedTime=0",
+	UpdateChallenge:    "UPDATE login_challenge SET usedTime=? WHERE tokenHash=? AND usedTime=0",
+	UpdateRecovery:     "UPDATE recovery_code SET usedTime=? WHERE specialist=? AND codeHash=? AND usedTime=0",
+	UpdateStep:         "UPDATE two_factor SET lastStep=? WHERE specialist=? AND lastStep < ?",
+}
+
+func init() {
+	registerStmts("TwoFactor", twoFactorStmt)
+}
+
+func (t *TwoFactor) Read(ctx context.Context, specialist int) (_ *app.TwoFactorMedia, err error) {
+	defer logError(ctx, "Read TwoFactor", &err)
+	return t.read(ctx, t.db, specialist)
+}
+
+// Returns the secret of the specialist and whether it's been confirmed.  The secret is empty if the
+// specialist has never enrolled.
+func (t *TwoFactor) GetSecret(ctx context.Context, db *mysql.DB, id int) (string, bool, int64, error) {
+	var secret string
+	var enabled bool
+	var lastStep int64
+	err := db.QueryRowContext(ctx, twoFactorStmt.Select, id).Scan(&secret, &enabled, &lastStep)
+	if err == mysql.ErrNoRows {
+		return "", false, 0, nil
+	}
+	return secret, enabled, lastStep, err
+}
+
+// Checks a code from the authenticator app or a recovery code.  Either one can only be used once.  A bad
+// code counts as a failed login.
+func (t *TwoFactor) CheckCode(ctx context.Context, db *mysql.DB, id int, code string, allowRecovery bool) error {
+	secret, _, lastStep, err := t.GetSecret(ctx, db, id)
+	if err != nil {
+		return err
+	}
+	if secret == "" {
+		return ErrBadLogin
+	}
+	ok := false
+	if isTOTPCode(code) {
+		step, err := matchTOTP(secret, code, time.Now())
+		if err != nil {
+			return err
+		}
+		if ok, err = t.UseStep(ctx, db, id, step, lastStep); err != nil {
+			return err
+		}
+	} else if allowRecovery {
+		res, err := db.ExecContext(ctx, twoFactorStmt.UpdateRecovery, int(time.Now().Unix()), id, hashToken(normalizeRecoveryCode(code)))
+		if err != nil {
+			return err
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		ok = affected == 1
+	}
+	if !ok {
+		if err = recordFailedLogin(ctx, db, id); err != nil {
+			return err
+		}
+		return ErrBadLogin
+	}
+	return nil
+}
+
+// Records that the time step of a code has been used, so that neither it nor any step before it can be
+// used again.  Returns false if the code didn't match (-1) or its step has already been used.
+func (t *TwoFactor) UseStep(ctx context.Context, db Queryer, id int, step, lastStep int64) (bool, error) {
+	if step == -1 || step <= lastStep {
+		return false, nil
+	}
+	res, err := db.ExecContext(ctx, twoFactorStmt.UpdateStep, step, id, step)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+// Throws away any old recovery codes and returns a new set.
+func (t *TwoFactor) NewRecoveryCodes(ctx context.Context, db *mysql.DB, id int) ([]string, error) {
+	if _, err := db.ExecContext(ctx, twoFactorStmt.DeleteRecovery, id); err != nil {
+		return nil, err
+	}
+	stmt, err := db.PrepareContext(ctx, twoFactorStmt.InsertRecovery)
+	if err != nil {
+		return nil, err
+	}
+	codes := make([]string, RecoveryCodeCount)
+	for i := range codes {
+		codes[i], err = newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		if _, err = stmt.ExecContext(ctx, id, hashToken(normalizeRecoveryCode(codes[i]))); err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+func (t *TwoFactor) read(ctx context.Context, db *mysql.DB, id int) (*app.TwoFactorMedia, error) {
+	if err := RequireSelfOrAdmin(ctx, id); err != nil {
+		return nil, err
+	}
+	authLevel, err := NewBillSheet(db).GetAuthLevel(ctx, db, id)
+	if err != nil {
+		return nil, err
+	}
+	_, enabled, _, err := t.GetSecret(ctx, db, id)
+	if err != nil {
+		return nil, err
+	}
+	var left int
+	if err = db.QueryRowContext(ctx, twoFactorStmt.SelectRecoveryLeft, id).Scan(&left); err != nil {
+		return nil, err
+	}
+	return &app.TwoFactorMedia{
+		Specialist:        id,
+		Enabled:           enabled,
+		Required:          isTwoFactorRequired(authLevel),
+		RecoveryCodesLeft: left,
+	}, nil
+}
+
+// Decides whether a login needs a second step.  When it does, a challenge is returned that has to be
+// given back along with the code.  Nil means the password is enough.
+func (t *TwoFactor) Start(ctx context.Context, id, authLevel int) (_ *app.SessionChallengeMedia, err error) {
+	defer logError(ctx, "Start TwoFactor", &err)
+	return t.start(ctx, t.db, id, authLevel)
+}
+
+func (t *TwoFactor) start(ctx context.Context, db *mysql.DB, id, authLevel int) (*app.SessionChallengeMedia, error) {
+	_, enabled, _, err := t.GetSecret(ctx, db, id)
+	if err != nil {
+		return nil, err
+	}
+	// The password is enough, so the login is done and the failures are forgotten.  Otherwise they're
+	// kept until the second step is done too, so that the codes can't be guessed without a lockout.
+	if !enabled && !isTwoFactorRequired(authLevel) {
+		return nil, clearFailedLogins(ctx, db, id)
+	}
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	_, err = db.ExecContext(ctx, twoFactorStmt.InsertChallenge, id, hashToken(token), int(time.Now().Add(ChallengeLength).Unix()))
+	if err != nil {
+		return nil, err
+	}
+	return &app.SessionChallengeMedia{
+		Specialist: id,
+		Challenge:  token,
+		Enroll:     !enabled,
+	}, nil
+}
+
+// The second step of a login.  Returns the id of the specialist.  The challenge can only be used once.
+func (t *TwoFactor) Verify(ctx context.Context, challenge, code string) (_ int, err error) {
+	defer logError(ctx, "Verify TwoFactor", &err)
+	return t.verify(ctx, t.db, challenge, code)
+}
+
+func (t *TwoFactor) verify(ctx context.Context, db *mysql.DB, challenge, code string) (int, error) {
+	var id int
+	err := db.QueryRowContext(ctx, twoFactorStmt.SelectChallenge, hashToken(challenge), int(time.Now().Unix())).Scan(&id)
+	if err == mysql.ErrNoRows {
+		return -1, ErrBadLogin
+	}
+	if err != nil {
+		return -1, err
+	}
+	locked, err := isLockedOut(ctx, db, id)
+	if err != nil {
+		return -1, err
+	}
+	if locked {
+		return -1, ErrBadLogin
+	}
+	_, enabled, _, err := t.GetSecret(ctx, db, id)
+	if err != nil {
+		return -1, err
+	}
+	// There's no code to check yet, so it isn't a failed login.  The challenge is how they enroll.
+	if !enabled {
+		return -1, ErrNotEnrolled
+	}
+	if err = t.CheckCode(ctx, db, id, code, true); err != nil {
+		return -1, err
+	}
+	res, err := db.ExecContext(ctx, twoFactorStmt.UpdateChallenge, int(time.Now().Unix()), hashToken(challenge))
+	if err != nil {
+		return -1, err
+	}
+	if affected, err := res.RowsAffected(); err != nil || affected != 1 {
+		return -1, ErrBadLogin
+	}
+	if err = clearFailedLogins(ctx, db, id); err != nil {
+		return -1, err
+	}
+	return id, nil
+}
+
+// Returns who a login challenge belongs to when they still have to enroll before they can finish logging
+// in.  The challenge doesn't start a session, it's only good for enrolling and confirming.
+func (t *TwoFactor) AuthenticateChallenge(ctx context.Context, challenge string) (_ *Principal, err error) {
+	defer logError(ctx, "AuthenticateChallenge TwoFactor", &err)
+	p := &Principal{Challenge: true}
+	err = t.db.QueryRowContext(ctx, twoFactorStmt.SelectEnrolling, hashToken(challenge), int(time.Now().Unix())).Scan(&p.ID, &p.AuthLevel)
+	if err == mysql.ErrNoRows {
+		return nil, ErrNoPrincipal
+	}
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Starts over with a new secret, which isn't used until it's confirmed.  The password is asked for again
+// so that an unattended session can't be used to take over the second factor, and so is a code when
+// there's already a second factor (a recovery code will do when the device has been lost).
+func (t *TwoFactor) Enroll(ctx context.Context, id int, password string, code *string) (_ *app.TwoFactorMediaEnroll, err error) {
+	defer logError(ctx, "Enroll TwoFactor", &err)
+	return t.enroll(ctx, t.db, id, password, code)
+}
+
+func (t *TwoFactor) enroll(ctx context.Context, db *mysql.DB, id int, password string, code *string) (*app.TwoFactorMediaEnroll, error) {
+	if err := RequireSelfOrAdmin(ctx, id); err != nil {
+		return nil, err
+	}
+	if err := checkPassword(ctx, db, id, password); err != nil {
+		return nil, err
+	}
+	_, enabled, _, err := t.GetSecret(ctx, db, id)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		if code == nil {
+			return nil, ErrBadLogin
+		}
+		if err = t.CheckCode(ctx, db, id, *code, true); err != nil {
+			return nil, err
+		}
+	}
+	var username string
+	if err = db.QueryRowContext(ctx, "SELECT username FROM specialist WHERE id=?", id).Scan(&username); err != nil {
+		return nil, err
+	}
+	secret, err := newTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	if _, err = db.ExecContext(ctx, twoFactorStmt.Replace, id, secret); err != nil {
+		return nil, err
+	}
+	if _, err = db.ExecContext(ctx, twoFactorStmt.DeleteRecovery, id); err != nil {
+		return nil, err
+	}
+	uri := url.URL{
+		Scheme: "otpauth",
+		Host:   "totp",
+		Path:   fmt.Sprintf("/%s:%s", TOTPIssuer, username),
+		RawQuery: url.Values{
+			"secret": {secret},
+			"issuer": {TOTPIssuer},
+			"digits": {fmt.Sprintf("%d", totpDigits)},
+			"period": {fmt.Sprintf("%d", totpStep)},
+		}.Encode(),
+	}
+	return &app.TwoFactorMediaEnroll{
+		Specialist: id,
+		Secret:     secret,
+		URI:        uri.String(),
+	}, nil
+}
+
+// Turns the second factor on once the specialist has shown that their app has the secret.  The recovery
+// codes are only ever shown here.
+func (t *TwoFactor) Confirm(ctx context.Context, id int, code string) (_ *app.TwoFactorMediaRecovery, err error) {
+	defer logError(ctx, "Confirm TwoFactor", &err)
+	return t.confirm(ctx, t.db, id, code)
+}
+
+func (t *TwoFactor) confirm(ctx context.Context, db *mysql.DB, id int, code string) (*app.TwoFactorMediaRecovery, error) {
+	if err := RequireSelfOrAdmin(ctx, id); err != nil {
+		return nil, err
+	}
+	secret, enabled, lastStep, err := t.GetSecret(ctx, db, id)
+	if err != nil {
+		return nil, err
+	}
+	if secret == "" || enabled {
+		return nil, errors.New("There is nothing to confirm, please enroll first!")
+	}
+	// The code is used up like any other, so finishing a login has to wait for the next one.
+	step, err := matchTOTP(secret, code, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	ok, err := t.UseStep(ctx, db, id, step, lastStep)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.New("That code is wrong or has already been used, please check the time on your device and try again!")
+	}
+	if _, err = db.ExecContext(ctx, twoFactorStmt.Enable, int(time.Now().Unix()), id); err != nil {
+		return nil, err
+	}
+	codes, err := t.NewRecoveryCodes(ctx, db, id)
+	if err != nil {
+		return nil, err
+	}
+	return &app.TwoFactorMediaRecovery{
+		Specialist:    id,
+		RecoveryCodes: codes,
+	}, nil
+}
+
+// Replaces the recovery codes, which needs a code from the app.
+func (t *TwoFactor) RegenerateRecoveryCodes(ctx context.Context, id int, code string) (_ *app.TwoFactorMediaRecovery, err error) {
+	defer logError(ctx, "RegenerateRecoveryCodes TwoFactor", &err)
+	return t.regenerateRecoveryCodes(ctx, t.db, id, code)
+}
+
+func (t *TwoFactor) regenerateRecoveryCodes(ctx context.Context, db *mysql.DB, id int, code string) (*app.TwoFactorMediaRecovery, error) {
+	if err := RequireSelfOrAdmin(ctx, id); err != nil {
+		return nil, err
+	}
+	if err := t.CheckCode(ctx, db, id, code, false); err != nil {
+		return nil, err
+	}
+	codes, err := t.NewRecoveryCodes(ctx, db, id)
+	if err != nil {
+		return nil, err
+	}
+	return &app.TwoFactorMediaRecovery{
+		Specialist:    id,
+		RecoveryCodes: codes,
+	}, nil
+}
+
+// Only a specialist who doesn't need a second factor can turn it off.
+func (t *TwoFactor) Disable(ctx context.Context, id int, code string) (err error) {
+	defer logError(ctx, "Disable TwoFactor", &err)
+	return t.disable(ctx, t.db, id, code)
+}
+
+func (t *TwoFactor) disable(ctx context.Context, db *mysql.DB, id int, code string) error {
+	if err := RequireSelfOrAdmin(ctx, id); err != nil {
+		return err
+	}
+	authLevel, err := NewBillSheet(db).GetAuthLevel(ctx, db, id)
+	if err != nil {
+		return err
+	}
+	if isTwoFactorRequired(authLevel) {
+		return errors.New("An admin cannot turn off two-factor authentication!")
+	}
+	if err = t.CheckCode(ctx, db, id, code, true); err != nil {
+		return err
+	}
+	if _, err = db.ExecContext(ctx, twoFactorStmt.DeleteRecovery, id); err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, twoFactorStmt.Delete, id)
+	return err
+}
@@ -0,0 +1,127 @@
+package sql
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The secret and codes of the SHA1 test vectors in RFC 6238, cut down to six digits.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tt := range tests {
+		got, err := totpCode(rfcSecret, tt.unix/totpStep)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("totpCode(%d) = %q, want %q", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestMatchTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := now.Unix() / totpStep
+	code := func(step int64) string {
+		c, err := totpCode(rfcSecret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	tests := []struct {
+		name string
+		code string
+		want int64
+	}{
+		{"current", code(current), current},
+		{"a step behind", code(current - totpSkew), current - totpSkew},
+		{"a step ahead", code(current + totpSkew), current + totpSkew},
+		{"too old", code(current - totpSkew - 1), -1},
+		{"too new", code(current + totpSkew + 1), -1},
+		{"wrong", "000000", -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := matchTOTP(rfcSecret, tt.code, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("matchTOTP(%q) = %d, want %d", tt.code, got, tt.want)
+			}
+		})
+	}
+}
+
+// A code is only good once, and a bad or used code counts toward the lockout.
+func TestCheckCode(t *testing.T) {
+	current := time.Now().Unix() / totpStep
+	code, err := totpCode(rfcSecret, current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		code     string
+		lastStep int64
+		affected int64
+		ok       bool
+	}{
+		{name: "fresh", code: code, lastStep: current - 1, affected: 1, ok: true},
+		{name: "already used", code: code, lastStep: current},
+		{name: "used by a later code", code: code, lastStep: current + 1},
+		{name: "used at the same time", code: code, lastStep: current - 1, affected: 0},
+		{name: "wrong", code: "000000", lastStep: current - 1},
+		{name: "recovery code not allowed", code: "abcde-12345", lastStep: current - 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script := &fakeScript{
+				Exec: func(query string, args []driver.Value) (int64, error) {
+					if strings.HasPrefix(query, "UPDATE two_factor") {
+						return tt.affected, nil
+					}
+					return 1, nil
+				},
+				Query: func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+					return []string{"secret", "enabled", "lastStep"}, [][]driver.Value{{rfcSecret, true, tt.lastStep}}, nil
+				},
+			}
+			db := openFake(t, script)
+			err := (&TwoFactor{}).CheckCode(context.Background(), db, 2, tt.code, false)
+			if tt.ok != (err == nil) {
+				t.Fatalf("CheckCode() error = %v, want ok %v", err, tt.ok)
+			}
+			if !tt.ok && err != ErrBadLogin {
+				t.Errorf("CheckCode() error = %v, want %v", err, ErrBadLogin)
+			}
+			failed := false
+			for _, stmt := range script.Statements {
+				if strings.HasPrefix(stmt.Query, "INSERT login_attempt") {
+					failed = true
+				}
+				if strings.HasPrefix(stmt.Query, "DELETE FROM login_attempt") {
+					t.Errorf("CheckCode() forgot the failed logins")
+				}
+			}
+			if failed == tt.ok {
+				t.Errorf("recorded a failed login = %v, want %v", failed, !tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package sql
+
+import (
+	"context"
+	mysql "database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/btoll/cpss/server/app"
+)
+
+// The `auth_level` table.
+const (
+	AuthLevelAdmin      = 1
+	AuthLevelUser       = 2
+	AuthLevelSupervisor = 3
+)
+
+// The states of a billsheet.  A billsheet starts out as a draft and can be edited until it's approved.
+const (
+	StateDraft     = "draft"
+	StateSubmitted = "submitted"
+	StateApproved  = "approved"
+	StateRejected  = "rejected"
+	StateBilled    = "billed"
+	StatePaid      = "paid"
+	StateDenied    = "denied"
+	StateVoid      = "void"
+)
+
+// Who can make a transition.  The owner is the specialist on the billsheet, and the supervisor is the
+// one whose team the owner is on, which is never the owner themselves.  Note that an admin can always
+// make any legal transition.
+const (
+	roleOwner      = "owner"
+	roleSupervisor = "supervisor"
+	roleAdmin      = "admin"
+)
+
+// from -> to -> roles
+var transitions = map[string]map[string][]string{
+	StateDraft: {
+		StateSubmitted: {roleOwner},
+		StateVoid:      {roleOwner},
+	},
+	StateSubmitted: {
+		StateDraft:    {roleOwner},
+		StateApproved: {roleSupervisor},
+		StateRejected: {roleSupervisor},
+	},
+	StateRejected: {
+		StateDraft:     {roleOwner},
+		StateSubmitted: {roleOwner},
+	},
+	StateApproved: {
+		StateBilled: {roleAdmin},
+		StateVoid:   {roleAdmin},
+	},
+	StateBilled: {
+		StatePaid:   {roleAdmin},
+		StateDenied: {roleAdmin},
+		StateVoid:   {roleAdmin},
+	},
+	StateDenied: {
+		StateBilled: {roleAdmin},
+		StateVoid:   {roleAdmin},
+	},
+}
+
+// Once a billsheet has been approved it can no longer be edited.
+func isLocked(state string) bool {
+	switch state {
+	case StateDraft, StateSubmitted, StateRejected:
+		return false
+	}
+	return true
+}
+
+type TransitionQuery struct {
+	IDs     []int
+	State   string
+	Comment string
+}
+
+type Workflow struct {
+	Query *TransitionQuery
+}
+
+func NewWorkflow(query *TransitionQuery) *Workflow {
+	return &Workflow{Query: query}
+}
+
+var workflowStmt = struct {
+	InsertHistory string
+	IsSupervisor  string
+	Select        string
+	Update        string
+}{
+	InsertHistory: "INSERT billsheet_transition SET billsheet=?,fromState=?,toState=?,specialist=?,comment=?,transitionTime=?",
+	IsSupervisor:  "SELECT COUNT(*) FROM team_member WHERE supervisor=? AND specialist=?",
+	Select:        "SELECT state,specialist FROM billsheet WHERE id=? FOR UPDATE",
+	Update:        "UPDATE billsheet SET state=?,version=version+1 WHERE id=? AND state=?",
+}
+
+func init() {
+	registerStmts("Workflow", workflowStmt)
+}
+
+func (w *Workflow) CanTransition(from, to string, authLevel int, isOwner, isSupervisor bool) error {
+	roles, ok := transitions[from][to]
+	if !ok {
+		return fmt.Errorf("Bad transition: a BillSheet cannot go from %s to %s!", from, to)
+	}
+	if authLevel == AuthLevelAdmin {
+		return nil
+	}
+	for _, role := range roles {
+		if role == roleOwner && isOwner {
+			return nil
+		}
+		if role == roleSupervisor && authLevel == AuthLevelSupervisor && isSupervisor && !isOwner {
+			return nil
+		}
+	}
+	return fmt.Errorf("Not allowed: you cannot move a BillSheet from %s to %s!", from, to)
+}
+
+// Returns whether the principal supervises the specialist.
+func (w *Workflow) IsSupervisor(ctx context.Context, db Queryer, principal *Principal, specialist int) (bool, error) {
+	if principal.AuthLevel != AuthLevelSupervisor {
+		return false, nil
+	}
+	var count int
+	err := db.QueryRowContext(ctx, workflowStmt.IsSupervisor, principal.ID, specialist).Scan(&count)
+	return count > 0, err
+}
+
+// Moves a single billsheet to a new state and records the change in its history, as the principal.  The
+// db should be a transaction, so that the billsheet is locked while it's checked and so that the state
+// and its history are written together, see transitionTx.
+func (w *Workflow) TransitionOne(ctx context.Context, db Queryer, id int, principal *Principal) (string, error) {
+	query := w.Query
+	if err := (&BillSheet{}).CheckScope(ctx, db, principal, id); err != nil {
+		return "", err
+	}
+	var from string
+	var specialist int
+	err := db.QueryRowContext(ctx, workflowStmt.Select, id).Scan(&from, &specialist)
+	if err == mysql.ErrNoRows {
+		return "", errors.New("There is no BillSheet with that id!")
+	}
+	if err != nil {
+		return "", err
+	}
+	isSupervisor, err := w.IsSupervisor(ctx, db, principal, specialist)
+	if err != nil {
+		return from, err
+	}
+	if err = w.CanTransition(from, query.State, principal.AuthLevel, specialist == principal.ID, isSupervisor); err != nil {
+		return from, err
+	}
+	stmt, err := db.PrepareContext(ctx, workflowStmt.Update)
+	if err != nil {
+		return from, err
+	}
+	res, err := stmt.ExecContext(ctx, query.State, id, from)
+	if err != nil {
+		return from, err
+	}
+	// Someone else moved it first.
+	if affected, err := res.RowsAffected(); err != nil {
+		return from, err
+	} else if affected == 0 {
+		return from, fmt.Errorf("Not changed: the BillSheet is no longer %s!", from)
+	}
+	stmt, err = db.PrepareContext(ctx, workflowStmt.InsertHistory)
+	if err != nil {
+		return query.State, err
+	}
+	_, err = stmt.ExecContext(ctx, id, from, query.State, principal.ID, query.Comment, int(time.Now().Unix()))
+	if err != nil {
+		return query.State, err
+	}
+	if query.State == StateRejected {
+		err = (&Notification{}).Enqueue(ctx, db, NotifyRejectedBillSheet, specialist, map[string]interface{}{
+			"BillSheet": id,
+			"Comment":   query.Comment,
+		})
+		if err != nil {
+			return query.State, err
+		}
+	}
+	return query.State, nil
+}
+
+// Every billsheet is transitioned independently, and the result of each is reported back.
+func (w *Workflow) Transition(ctx context.Context, db *mysql.DB) ([]*app.TransitionResultItem, error) {
+	query := w.Query
+	if query.State == StateRejected && strings.TrimSpace(query.Comment) == "" {
+		return nil, errors.New("A comment is required when rejecting a BillSheet!")
+	}
+	principal := PrincipalFromContext(ctx)
+	if principal == nil {
+		return nil, ErrNoPrincipal
+	}
+	coll := make([]*app.TransitionResultItem, len(query.IDs))
+	for i, id := range query.IDs {
+		state, err := w.transitionTx(ctx, db, id, principal)
+		result := &app.TransitionResultItem{
+			ID:    id,
+			State: &state,
+		}
+		if err != nil {
+			message := err.Error()
+			result.Error = &message
+		}
+		coll[i] = result
+	}
+	return coll, nil
+}
+
+// Transitions a single billsheet in its own transaction.
+func (w *Workflow) transitionTx(ctx context.Context, db *mysql.DB, id int, principal *Principal) (string, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	state, err := w.TransitionOne(ctx, tx, id, principal)
+	if err != nil {
+		tx.Rollback()
+		return state, err
+	}
+	return state, tx.Commit()
+}
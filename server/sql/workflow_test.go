@@ -0,0 +1,108 @@
+package sql
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+)
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		name         string
+		from         string
+		to           string
+		authLevel    int
+		isOwner      bool
+		isSupervisor bool
+		ok           bool
+	}{
+		{"owner submits", StateDraft, StateSubmitted, AuthLevelUser, true, false, true},
+		{"someone else submits", StateDraft, StateSubmitted, AuthLevelUser, false, false, false},
+		{"owner approves", StateSubmitted, StateApproved, AuthLevelUser, true, false, false},
+		{"supervisor approves their team's", StateSubmitted, StateApproved, AuthLevelSupervisor, false, true, true},
+		{"supervisor rejects their team's", StateSubmitted, StateRejected, AuthLevelSupervisor, false, true, true},
+		{"supervisor approves another team's", StateSubmitted, StateApproved, AuthLevelSupervisor, false, false, false},
+		{"supervisor approves their own", StateSubmitted, StateApproved, AuthLevelSupervisor, true, false, false},
+		{"supervisor submits their own", StateDraft, StateSubmitted, AuthLevelSupervisor, true, false, true},
+		{"supervisor bills", StateApproved, StateBilled, AuthLevelSupervisor, false, true, false},
+		{"admin bills", StateApproved, StateBilled, AuthLevelAdmin, false, false, true},
+		{"admin approves", StateSubmitted, StateApproved, AuthLevelAdmin, false, false, true},
+		{"admin skips a state", StateDraft, StateApproved, AuthLevelAdmin, false, false, false},
+		{"nobody leaves paid", StatePaid, StateVoid, AuthLevelAdmin, false, false, false},
+		{"owner edits an approved one", StateApproved, StateDraft, AuthLevelUser, true, false, false},
+	}
+	w := NewWorkflow(&TransitionQuery{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := w.CanTransition(tt.from, tt.to, tt.authLevel, tt.isOwner, tt.isSupervisor)
+			if tt.ok && err != nil {
+				t.Errorf("CanTransition(%s, %s) error = %v, want it allowed", tt.from, tt.to, err)
+			}
+			if !tt.ok && err == nil {
+				t.Errorf("CanTransition(%s, %s) is allowed, want an error", tt.from, tt.to)
+			}
+		})
+	}
+}
+
+// The state is only changed if it's still the one that was checked, and the history is only written
+// if it was.
+func TestTransitionOne(t *testing.T) {
+	tests := []struct {
+		name     string
+		affected int64
+		ok       bool
+	}{
+		{name: "moved", affected: 1, ok: true},
+		{name: "moved by someone else first", affected: 0, ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script := &fakeScript{
+				Exec: func(query string, args []driver.Value) (int64, error) {
+					if strings.HasPrefix(query, "UPDATE billsheet") {
+						return tt.affected, nil
+					}
+					return 1, nil
+				},
+				Query: func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+					return []string{"state", "specialist"}, [][]driver.Value{{StateApproved, int64(2)}}, nil
+				},
+			}
+			db := openFake(t, script)
+			tx, err := db.Begin()
+			if err != nil {
+				t.Fatal(err)
+			}
+			admin := &Principal{ID: 1, AuthLevel: AuthLevelAdmin}
+			state, err := NewWorkflow(&TransitionQuery{State: StateBilled}).TransitionOne(context.Background(), tx, 7, admin)
+			if tt.ok != (err == nil) {
+				t.Fatalf("TransitionOne() error = %v, want ok %v", err, tt.ok)
+			}
+			want := StateApproved
+			if tt.ok {
+				want = StateBilled
+			}
+			if state != want {
+				t.Errorf("TransitionOne() = %q, want %q", state, want)
+			}
+			var update *fakeStatement
+			wroteHistory := false
+			for i, stmt := range script.Statements {
+				if strings.HasPrefix(stmt.Query, "UPDATE billsheet") {
+					update = &script.Statements[i]
+				}
+				if strings.HasPrefix(stmt.Query, "INSERT billsheet_transition") {
+					wroteHistory = true
+				}
+			}
+			if update == nil || !strings.HasSuffix(update.Query, "AND state=?") || update.Args[2] != StateApproved {
+				t.Errorf("the state update isn't guarded by the state that was checked: %v", update)
+			}
+			if wroteHistory != tt.ok {
+				t.Errorf("wrote the history = %v, want %v", wroteHistory, tt.ok)
+			}
+		})
+	}
+}
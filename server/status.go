@@ -9,22 +9,26 @@ import (
 // StatusController implements the Status resource.
 type StatusController struct {
 	*goa.Controller
+	statuses sql.StatusRepository
 }
 
 // NewStatusController creates a Status controller.
-func NewStatusController(service *goa.Service) *StatusController {
-	return &StatusController{Controller: service.NewController("StatusController")}
+func NewStatusController(service *goa.Service, statuses sql.StatusRepository) *StatusController {
+	return &StatusController{
+		Controller: service.NewController("StatusController"),
+		statuses:   statuses,
+	}
 }
 
 // Create runs the create action.
 func (c *StatusController) Create(ctx *app.CreateStatusContext) error {
 	// StatusController_Create: start_implement
 
-	res, err := sql.Create(sql.NewStatus(ctx.Payload))
+	res, err := c.statuses.Create(ctx, ctx.Payload)
 	if err != nil {
 		return err
 	}
-	return ctx.OK(res.(*app.StatusMedia))
+	return ctx.OK(res)
 
 	// StatusController_Create: end_implement
 }
@@ -33,7 +37,7 @@ func (c *StatusController) Create(ctx *app.CreateStatusContext) error {
 func (c *StatusController) Delete(ctx *app.DeleteStatusContext) error {
 	// StatusController_Delete: start_implement
 
-	err := sql.Delete(sql.NewStatus(ctx.ID))
+	err := c.statuses.Delete(ctx, ctx.ID)
 	if err != nil {
 		return err
 	}
@@ -46,11 +50,11 @@ func (c *StatusController) Delete(ctx *app.DeleteStatusContext) error {
 func (c *StatusController) List(ctx *app.ListStatusContext) error {
 	// StatusController_List: start_implement
 
-	collection, err := sql.List(sql.NewStatus(nil))
+	collection, err := c.statuses.List(ctx)
 	if err != nil {
 		return err
 	}
-	return ctx.OK(collection.(app.StatusMediaCollection))
+	return ctx.OK(collection)
 
 	// StatusController_List: end_implement
 }
@@ -59,11 +63,11 @@ func (c *StatusController) List(ctx *app.ListStatusContext) error {
 func (c *StatusController) Update(ctx *app.UpdateStatusContext) error {
 	// StatusController_Update: start_implement
 
-	rec, err := sql.Update(sql.NewStatus(ctx.Payload))
+	rec, err := c.statuses.Update(ctx, ctx.Payload)
 	if err != nil {
 		return err
 	}
-	return ctx.OK(rec.(*app.StatusMedia))
+	return ctx.OK(rec)
 
 	// StatusController_Update: end_implement
 }
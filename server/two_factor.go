@@ -0,0 +1,95 @@
+package main
+
+import (
+	"github.com/btoll/cpss/server/app"
+	"github.com/btoll/cpss/server/sql"
+	"github.com/goadesign/goa"
+)
+
+// TwoFactorController implements the TwoFactor resource.
+type TwoFactorController struct {
+	*goa.Controller
+	twoFactor sql.TwoFactorRepository
+}
+
+// NewTwoFactorController creates a TwoFactor controller.
+func NewTwoFactorController(service *goa.Service, twoFactor sql.TwoFactorRepository) *TwoFactorController {
+	return &TwoFactorController{
+		Controller: service.NewController("TwoFactorController"),
+		twoFactor:  twoFactor,
+	}
+}
+
+// Confirm runs the confirm action.
+func (c *TwoFactorController) Confirm(ctx *app.ConfirmTwoFactorContext) error {
+	// TwoFactorController_Confirm: start_implement
+
+	rec, err := c.twoFactor.Confirm(ctx, ctx.ID, ctx.Payload.Code)
+	if err != nil {
+		return err
+	}
+	return ctx.OKRecovery(rec)
+
+	// TwoFactorController_Confirm: end_implement
+}
+
+// Disable runs the disable action.
+func (c *TwoFactorController) Disable(ctx *app.DisableTwoFactorContext) error {
+	// TwoFactorController_Disable: start_implement
+
+	err := c.twoFactor.Disable(ctx, ctx.ID, ctx.Payload.Code)
+	if err == sql.ErrBadLogin {
+		return ctx.Unauthorized()
+	}
+	if err != nil {
+		return err
+	}
+	return ctx.NoContent()
+
+	// TwoFactorController_Disable: end_implement
+}
+
+// Enroll runs the enroll action.
+func (c *TwoFactorController) Enroll(ctx *app.EnrollTwoFactorContext) error {
+	// TwoFactorController_Enroll: start_implement
+
+	rec, err := c.twoFactor.Enroll(ctx, ctx.ID, ctx.Payload.Password, ctx.Payload.Code)
+	if err == sql.ErrBadLogin {
+		return ctx.Unauthorized()
+	}
+	if err != nil {
+		return err
+	}
+	return ctx.OKEnroll(rec)
+
+	// TwoFactorController_Enroll: end_implement
+}
+
+// Recovery runs the recovery action.
+func (c *TwoFactorController) Recovery(ctx *app.RecoveryTwoFactorContext) error {
+	// TwoFactorController_Recovery: start_implement
+
+	rec, err := c.twoFactor.RegenerateRecoveryCodes(ctx, ctx.ID, ctx.Payload.Code)
+	if err == sql.ErrBadLogin {
+		return ctx.Unauthorized()
+	}
+	if err != nil {
+		return err
+	}
+	return ctx.OKRecovery(rec)
+
+	// TwoFactorController_Recovery: end_implement
+}
+
+// Show runs the show action.
+func (c *TwoFactorController) Show(ctx *app.ShowTwoFactorContext) error {
+	// TwoFactorController_Show: start_implement
+
+	rec, err := c.twoFactor.Read(ctx, ctx.ID)
+	if err != nil {
+		return err
+	}
+	return ctx.OK(rec)
+
+	// TwoFactorController_Show: end_implement
+}